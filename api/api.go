@@ -0,0 +1,10 @@
+// Package api содержит машиночитаемый контракт HTTP API сервера метрик.
+package api
+
+import _ "embed"
+
+// OpenAPI — спецификация OpenAPI 3 для маршрутов /api/v1 и устаревших маршрутов.
+// Сервер отдаёт её по адресу /api/v1/openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -8,83 +8,161 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/zheki1/yaprmtrc/internal/buildinfo"
+	"github.com/zheki1/yaprmtrc/internal/logging"
 	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/netutil"
 	"github.com/zheki1/yaprmtrc/internal/retry"
 	"github.com/zheki1/yaprmtrc/internal/security"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 	"go.uber.org/zap"
 )
 
+// tenantHeader — заголовок, которым агент сообщает серверу арендатора.
+const tenantHeader = "X-Tenant-ID"
+
+// realIPHeader — заголовок с адресом исходящего интерфейса агента; по нему
+// сервер проверяет доверенную подсеть (trusted_subnet).
+const realIPHeader = "X-Real-IP"
+
+// Заголовки, которыми агент представляется серверу; сервер пишет их в аудит.
+const (
+	agentHostHeader    = "X-Agent-Host"
+	agentVersionHeader = "X-Agent-Version"
+)
+
+// agentVersion возвращает версию сборки агента или "dev".
+func agentVersion() string {
+	if buildinfo.Version == "" {
+		return "dev"
+	}
+	return buildinfo.Version
+}
+
 // Agent — агент сбора метрик. Периодически собирает runtime- и gopsutil-метрики
 // и отправляет их на сервер пакетно (через /updates).
+//
+// Конфигурация хранится атомарно и заменяется целиком при перезагрузке
+// (SIGHUP); циклы сбора и отправки подписываются на её смену.
 type Agent struct {
-	cfg    *Config
+	cfg    atomic.Pointer[Config]
 	client *resty.Client
 	logger *zap.SugaredLogger
 
+	mu      sync.Mutex
+	changed []chan struct{}
+
 	Gauge   map[string]float64
 	Counter map[string]int64
 }
 
 // NewAgent создаёт новый агент с указанной конфигурацией.
 func NewAgent(cfg *Config) (*Agent, error) {
-	logger, err := NewLogger()
+	logger, err := logging.New(cfg.logOptions())
 	if err != nil {
 		return nil, fmt.Errorf("cannot init logger: %w", err)
 	}
-	return &Agent{
-		cfg:    cfg,
-		client: resty.New().SetBaseURL("http://" + cfg.Addr).SetTimeout(5 * time.Second),
+	client := resty.New().SetBaseURL("http://" + cfg.Addr).SetTimeout(5 * time.Second)
+	client.SetHeader("User-Agent", "yaprmtrc-agent/"+agentVersion())
+	client.SetHeader(agentVersionHeader, agentVersion())
+	if host, err := os.Hostname(); err == nil {
+		client.SetHeader(agentHostHeader, host)
+	}
+	if cfg.Tenant != "" {
+		client.SetHeader(tenantHeader, cfg.Tenant)
+	}
+	if cfg.Token != "" {
+		client.SetAuthToken(cfg.Token)
+	}
+	if ip, err := netutil.OutboundIP(cfg.Addr); err == nil {
+		client.SetHeader(realIPHeader, ip.String())
+	} else {
+		logger.Warnw("cannot determine outbound address, X-Real-IP is not sent", "error", err)
+	}
+	a := &Agent{
+		client: client,
 		logger: logger,
 
 		Gauge:   make(map[string]float64),
 		Counter: make(map[string]int64),
-	}, nil
+	}
+	a.cfg.Store(cfg)
+	return a, nil
 }
 
-// Start запускает циклы сбора и отправки метрик. Блокирует вызывающую горутину.
-func (a *Agent) Start() {
-	a.logger.Infoln(fmt.Sprintf("Agent started. Server=%s, poll=%ds, report=%ds\n",
-		a.cfg.Addr, a.cfg.PollInterval, a.cfg.ReportInterval))
+// config возвращает действующую конфигурацию.
+func (a *Agent) config() *Config {
+	return a.cfg.Load()
+}
 
-	jobs := make(chan Job, a.cfg.RateLimit)
-	StartWorkers(a.cfg.RateLimit, jobs)
+// Start запускает циклы сбора и отправки метрик и блокирует вызывающую
+// горутину до отмены ctx.
+func (a *Agent) Start(ctx context.Context) {
+	cfg := a.config()
+	a.logger.Infoln(fmt.Sprintf("Agent started. Server=%s, poll=%ds, report=%ds\n",
+		cfg.Addr, cfg.PollInterval, cfg.ReportInterval))
 
 	go func() {
-		ticker := time.NewTicker(time.Duration(a.cfg.PollInterval) * time.Second)
-		defer ticker.Stop()
-
 		a.collectRuntimeMetrics()
-		for range ticker.C {
-			a.collectRuntimeMetrics()
-		}
+		a.every(pollInterval, a.collectRuntimeMetrics)
 	}()
 
 	go func() {
-		ticker := time.NewTicker(time.Duration(a.cfg.PollInterval) * time.Second)
-		defer ticker.Stop()
-
 		a.collectGopsutilMetrics()
-		for range ticker.C {
-			a.collectGopsutilMetrics()
-		}
+		a.every(pollInterval, a.collectGopsutilMetrics)
 	}()
 
-	go func() {
-		ticker := time.NewTicker(time.Duration(a.cfg.ReportInterval) * time.Second)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			a.sendAllMetrics(jobs)
+	workers := cfg.RateLimit
+	jobs := make(chan Job, workers)
+	StartWorkers(workers, jobs)
+
+	go a.every(reportInterval, func() {
+		// Пул меняет размер перед очередной отправкой: прежние воркеры
+		// доделывают взятые задачи и завершаются после закрытия канала.
+		if n := a.config().RateLimit; n != workers {
+			close(jobs)
+			workers = n
+			jobs = make(chan Job, workers)
+			StartWorkers(workers, jobs)
 		}
-	}()
+		a.sendAllMetrics(jobs)
+	})
 
-	select {}
+	<-ctx.Done()
+	a.logger.Infow("shutdown signal received")
+}
 
-	// TODO - use sync.WaitGroup to wait for workers to finish (on graceful shutdown implementing)
+func pollInterval(c *Config) time.Duration { return time.Duration(c.PollInterval) * time.Second }
+
+func reportInterval(c *Config) time.Duration { return time.Duration(c.ReportInterval) * time.Second }
+
+// every вызывает f с периодом interval(cfg) и перезапускает таймер, если
+// период изменился при перезагрузке конфигурации.
+func (a *Agent) every(interval func(*Config) time.Duration, f func()) {
+	changed := a.subscribe()
+	d := interval(a.config())
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f()
+		case <-changed:
+			if next := interval(a.config()); next != d {
+				d = next
+				ticker.Reset(d)
+			}
+		}
+	}
 }
 
 func (a *Agent) sendAllMetrics(jobs chan<- Job) {
@@ -111,16 +189,30 @@ func (a *Agent) sendAllMetrics(jobs chan<- Job) {
 	}
 }
 
-func (a *Agent) sendMetric(metric models.Metrics) error {
-	if err := retry.DoRetry(context.Background(), isRetryableNetErr, func() error {
+// startSend начинает участок трассы name с новым идентификатором запроса.
+// Идентификаторы передаются серверу в заголовках X-Request-ID и traceparent
+// и попадают в записи журнала агента, чтобы по ним можно было найти запрос
+// в журнале и аудите сервера. Повторные попытки отправки идут с теми же
+// идентификаторами.
+func startSend(name string) (context.Context, *tracing.Span) {
+	ctx := tracing.WithRequestID(context.Background(), tracing.NewRequestID())
+	return tracing.Start(ctx, name, tracing.WithKind(tracing.KindClient))
+}
+
+func (a *Agent) sendMetric(metric models.Metrics) (err error) {
+	cfg := a.config()
+	ctx, span := startSend("POST /update")
+	defer func() { span.End(err) }()
+
+	if err := retry.DoRetry(ctx, isRetryableNetErr, func() error {
 		payload, err := json.Marshal(metric)
 		if err != nil {
 			return err
 		}
 
 		body := payload
-		if a.cfg.CryptoKey != "" {
-			pubKey, err := security.LoadPublicKey(a.cfg.CryptoKey)
+		if cfg.CryptoKey != "" {
+			pubKey, err := security.LoadPublicKey(cfg.CryptoKey)
 			if err != nil {
 				return fmt.Errorf("failed to load public key: %w", err)
 			}
@@ -136,16 +228,18 @@ func (a *Agent) sendMetric(metric models.Metrics) error {
 		}
 
 		req := a.client.R().
+			SetContext(ctx).
 			SetHeader("Content-Type", "application/json").
 			SetHeader("Content-Encoding", "gzip").
 			SetBody(body)
+		tracing.Inject(ctx, req.Header)
 
-		if a.cfg.CryptoKey != "" {
+		if cfg.CryptoKey != "" {
 			req.SetHeader("Encrypted", "true")
 		}
 
-		if a.cfg.Key != "" {
-			req.SetHeader("HashSHA256", security.CalcHash(payload, a.cfg.Key))
+		if cfg.Key != "" {
+			req.SetHeader("HashSHA256", security.CalcHash(payload, cfg.Key))
 		}
 
 		resp, err := req.Post("/update")
@@ -154,27 +248,40 @@ func (a *Agent) sendMetric(metric models.Metrics) error {
 		}
 
 		if !resp.IsSuccess() {
-			return fmt.Errorf("bad status: %s", resp.Status())
+			return statusError(resp)
 		}
 		return nil
 	}); err != nil {
-		a.logger.Info("failed sending metric")
+		a.logger.Infow("failed sending metric", append(tracing.Fields(ctx), "error", err)...)
 		return err
 	}
 
 	return nil
 }
 
-func (a *Agent) sendBatch(metrics []models.Metrics) error {
-	if err := retry.DoRetry(context.Background(), isRetryableNetErr, func() error {
-		payload, err := json.Marshal(metrics)
+// errPartialBatch означает, что сервер применил пакет не полностью
+// и часть метрик нужно отправить повторно.
+var errPartialBatch = errors.New("batch partially applied")
+
+// sendBatch отправляет пакет в режиме частичного применения (/updates?partial=true).
+// При повторной попытке отправляются только метрики, которые сервер не смог
+// записать (статус failed), — не раньше, чем просит Retry-After ответа;
+// отклонённые валидацией метрики логируются и больше не отправляются.
+func (a *Agent) sendBatch(metrics []models.Metrics) (err error) {
+	cfg := a.config()
+	pending := metrics
+	ctx, span := startSend("POST /updates")
+	defer func() { span.End(err) }()
+
+	if err := retry.DoRetry(ctx, isRetryableBatchErr, func() error {
+		payload, err := json.Marshal(pending)
 		if err != nil {
 			return err
 		}
 
 		body := payload
-		if a.cfg.CryptoKey != "" {
-			pubKey, err := security.LoadPublicKey(a.cfg.CryptoKey)
+		if cfg.CryptoKey != "" {
+			pubKey, err := security.LoadPublicKey(cfg.CryptoKey)
 			if err != nil {
 				return fmt.Errorf("failed to load public key: %w", err)
 			}
@@ -190,16 +297,19 @@ func (a *Agent) sendBatch(metrics []models.Metrics) error {
 		}
 
 		req := a.client.R().
+			SetContext(ctx).
 			SetHeader("Content-Type", "application/json").
 			SetHeader("Content-Encoding", "gzip").
+			SetQueryParam("partial", "true").
 			SetBody(body)
+		tracing.Inject(ctx, req.Header)
 
-		if a.cfg.CryptoKey != "" {
+		if cfg.CryptoKey != "" {
 			req.SetHeader("Encrypted", "true")
 		}
 
-		if a.cfg.Key != "" {
-			req.SetHeader("HashSHA256", security.CalcHash(payload, a.cfg.Key))
+		if cfg.Key != "" {
+			req.SetHeader("HashSHA256", security.CalcHash(payload, cfg.Key))
 		}
 
 		resp, err := req.Post("/updates")
@@ -208,17 +318,69 @@ func (a *Agent) sendBatch(metrics []models.Metrics) error {
 		}
 
 		if !resp.IsSuccess() {
-			return fmt.Errorf("bad status: %s", resp.Status())
+			return statusError(resp)
+		}
+
+		pending = a.pendingAfterBatch(ctx, pending, resp.Body())
+		if len(pending) > 0 {
+			err := fmt.Errorf("%w: %d metrics to resend", errPartialBatch, len(pending))
+			// Частичный ответ тоже может просить подождать (лимит новых серий).
+			if d, ok := retry.ParseAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+				return &retry.AfterError{Delay: d, Err: err}
+			}
+			return err
 		}
 		return nil
 	}); err != nil {
-		a.logger.Info("failed sending metric")
+		a.logger.Infow("failed sending metric", append(tracing.Fields(ctx), "error", err)...)
 		return err
 	}
 
 	return nil
 }
 
+// pendingAfterBatch разбирает ответ сервера и возвращает метрики, которые
+// нужно отправить повторно. Ответ без результатов (сервер без поддержки
+// частичного применения) считается полным успехом.
+func (a *Agent) pendingAfterBatch(ctx context.Context, sent []models.Metrics, body []byte) []models.Metrics {
+	var res models.BatchResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil
+	}
+
+	var pending []models.Metrics
+	for _, r := range res.Results {
+		if r.Index < 0 || r.Index >= len(sent) {
+			continue
+		}
+		switch r.Status {
+		case models.StatusFailed:
+			pending = append(pending, sent[r.Index])
+		case models.StatusRejected:
+			a.logger.Infow("metric rejected by server", append(tracing.Fields(ctx), "id", r.ID, "error", r.Error)...)
+		}
+	}
+	return pending
+}
+
+// statusError описывает неуспешный ответ сервера. Для 429 и 503 с заголовком
+// Retry-After возвращается *retry.AfterError, чтобы повтор выполнился не
+// раньше, чем просит сервер.
+func statusError(resp *resty.Response) error {
+	err := fmt.Errorf("bad status: %s", resp.Status())
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if d, ok := retry.ParseAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+			return &retry.AfterError{Delay: d, Err: err}
+		}
+	}
+	return err
+}
+
+func isRetryableBatchErr(err error) bool {
+	return errors.Is(err, errPartialBatch) || isRetryableNetErr(err)
+}
+
 func gzipPayload(payload []byte) ([]byte, error) {
 	var buf bytes.Buffer
 	zw := gzip.NewWriter(&buf)
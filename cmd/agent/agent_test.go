@@ -1,11 +1,22 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 )
 
 func TestGzipPayload(t *testing.T) {
@@ -74,9 +85,9 @@ func TestCollectGopsutilMetrics(t *testing.T) {
 		Counter: make(map[string]int64),
 	}
 
-	logger, err := NewLogger()
+	logger, err := logging.New(logging.Options{})
 	if err != nil {
-		t.Fatalf("NewLogger: %v", err)
+		t.Fatalf("logging.New: %v", err)
 	}
 	a.logger = logger
 
@@ -105,7 +116,7 @@ func TestNewAgent(t *testing.T) {
 	if a == nil {
 		t.Fatal("expected non-nil agent")
 	}
-	if a.cfg != cfg {
+	if a.config() != cfg {
 		t.Fatal("expected config to match")
 	}
 	if a.Gauge == nil {
@@ -115,3 +126,205 @@ func TestNewAgent(t *testing.T) {
 		t.Fatal("expected non-nil Counter map")
 	}
 }
+
+func TestSendBatch_RetriesOnlyFailed(t *testing.T) {
+	var requests [][]models.Metrics
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("partial") != "true" {
+			t.Errorf("expected partial=true, got %q", r.URL.RawQuery)
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var batch []models.Metrics
+		if err := json.NewDecoder(gz).Decode(&batch); err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, batch)
+
+		res := models.BatchResult{}
+		for i, m := range batch {
+			status := models.StatusOK
+			if len(requests) == 1 && m.ID == "B" {
+				status = models.StatusFailed
+			}
+			if m.ID == "bad" {
+				status = models.StatusRejected
+			}
+			res.Results = append(res.Results, models.MetricResult{Index: i, ID: m.ID, Status: status})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	a, err := NewAgent(&Config{Addr: strings.TrimPrefix(srv.URL, "http://"), RateLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := 1.0
+	d := int64(1)
+	err = a.sendBatch([]models.Metrics{
+		{ID: "A", MType: models.Gauge, Value: &v},
+		{ID: "B", MType: models.Counter, Delta: &d},
+		{ID: "bad", MType: models.Gauge, Value: &v},
+	})
+	if err != nil {
+		t.Fatalf("sendBatch: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if len(requests[1]) != 1 || requests[1][0].ID != "B" {
+		t.Fatalf("expected only B to be resent, got %+v", requests[1])
+	}
+}
+
+func TestAgent_SendsIdentityHeaders(t *testing.T) {
+	var got, authorization, realIP, host, userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Tenant-ID")
+		authorization = r.Header.Get("Authorization")
+		realIP = r.Header.Get("X-Real-IP")
+		host = r.Header.Get("X-Agent-Host")
+		userAgent = r.UserAgent()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	a, err := NewAgent(&Config{Addr: strings.TrimPrefix(srv.URL, "http://"), RateLimit: 1, Tenant: "team-a", Token: "ymt_secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := 1.0
+	if err := a.sendMetric(models.Metrics{ID: "A", MType: models.Gauge, Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if got != "team-a" {
+		t.Fatalf("expected X-Tenant-ID team-a, got %q", got)
+	}
+	if authorization != "Bearer ymt_secret" {
+		t.Fatalf("expected bearer token, got %q", authorization)
+	}
+	if realIP != "127.0.0.1" {
+		t.Fatalf("expected X-Real-IP of the loopback interface, got %q", realIP)
+	}
+	if want, _ := os.Hostname(); host != want {
+		t.Fatalf("expected X-Agent-Host %q, got %q", want, host)
+	}
+	if userAgent != "yaprmtrc-agent/dev" {
+		t.Fatalf("unexpected User-Agent %q", userAgent)
+	}
+}
+
+func TestSendBatch_HonoursRetryAfter(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	a, err := NewAgent(&Config{Addr: strings.TrimPrefix(srv.URL, "http://"), RateLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	v := 1.0
+	if err := a.sendBatch([]models.Metrics{{ID: "A", MType: models.Gauge, Value: &v}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected retry after 429, got %d calls", calls)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("agent must wait for Retry-After instead of its own schedule, waited %s", elapsed)
+	}
+}
+
+func TestSendBatch_HonoursRetryAfterOnPartialResponse(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		status := models.StatusOK
+		if calls == 1 {
+			status = models.StatusFailed
+			w.Header().Set("Retry-After", "0")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		_ = json.NewEncoder(w).Encode(models.BatchResult{Results: []models.MetricResult{{Index: 0, ID: "A", Status: status}}})
+	}))
+	defer srv.Close()
+
+	a, err := NewAgent(&Config{Addr: strings.TrimPrefix(srv.URL, "http://"), RateLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	v := 1.0
+	if err := a.sendBatch([]models.Metrics{{ID: "A", MType: models.Gauge, Value: &v}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected a resend after the partial response, got %d calls", calls)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("agent must wait for Retry-After of a 207 response, waited %s", elapsed)
+	}
+}
+
+func TestSendBatch_PropagatesRequestIDAcrossRetries(t *testing.T) {
+	var ids, parents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(tracing.RequestIDHeader))
+		parents = append(parents, r.Header.Get(tracing.TraceparentHeader))
+		if len(ids) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	a, err := NewAgent(&Config{Addr: strings.TrimPrefix(srv.URL, "http://"), RateLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := 1.0
+	if err := a.sendBatch([]models.Metrics{{ID: "A", MType: models.Gauge, Value: &v}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(ids))
+	}
+	if !tracing.ValidRequestID(ids[0]) || ids[0] != ids[1] {
+		t.Errorf("request IDs = %q, want one valid ID for all attempts", ids)
+	}
+	if _, err := tracing.ParseTraceparent(parents[0]); err != nil || parents[0] != parents[1] {
+		t.Errorf("traceparent = %q: %v", parents, err)
+	}
+
+	if err := a.sendBatch([]models.Metrics{{ID: "A", MType: models.Gauge, Value: &v}}); err != nil {
+		t.Fatal(err)
+	}
+	if ids[2] == ids[0] {
+		t.Error("next batch reused the request ID")
+	}
+}
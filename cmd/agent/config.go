@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/zheki1/yaprmtrc/internal/config"
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+// Config хранит конфигурацию агента; источники и их приоритет описаны в LoadConfig.
+type Config struct {
+	Addr           string // адрес сервера метрик
+	ReportInterval int    // период отправки в секундах
+	PollInterval   int    // период опроса в секундах
+	Key            string // ключ подписи HMAC-SHA256
+	RateLimit      int    // лимит одновременных запросов к серверу
+	CryptoKey      string // путь к публичному ключу для шифрования тел запросов
+	Tenant         string // арендатор, от имени которого отправляются метрики
+	Token          string // API-токен сервера с ролью writer
+
+	LogLevel      string // уровень журнала
+	LogFormat     string // json или console
+	LogFile       string // файл журнала; пусто — stderr
+	LogMaxSize    int    // размер файла журнала в МБ до ротации; 0 — без ротации
+	LogMaxBackups int    // сколько ротированных файлов хранить
+	TraceFile     string // файл для спанов в OTLP/JSON
+	TraceEndpoint string // адрес OTLP/HTTP для выгрузки спанов
+
+	ConfigFile  string // путь к файлу конфигурации (-c, CONFIG)
+	PrintConfig bool   // вывести действующую конфигурацию и выйти
+}
+
+// configOptions связывает флаги агента с ключами файла конфигурации и
+// переменными окружения.
+var configOptions = []config.Option{
+	{Key: "address", Flag: "a", Env: "ADDRESS"},
+	{Key: "report_interval", Flag: "r", Env: "REPORT_INTERVAL"},
+	{Key: "poll_interval", Flag: "p", Env: "POLL_INTERVAL"},
+	{Key: "key", Flag: "k", Env: "KEY", Secret: true},
+	{Key: "rate_limit", Flag: "l", Env: "RATE_LIMIT"},
+	{Key: "crypto_key", Flag: "crypto-key", Env: "CRYPTO_KEY"},
+	{Key: "tenant", Flag: "tenant", Env: "TENANT"},
+	{Key: "token", Flag: "token", Env: "TOKEN", Secret: true},
+	{Key: "log_level", Flag: "log-level", Env: "LOG_LEVEL"},
+	{Key: "log_format", Flag: "log-format", Env: "LOG_FORMAT"},
+	{Key: "log_file", Flag: "log-file", Env: "LOG_FILE"},
+	{Key: "log_max_size", Flag: "log-max-size", Env: "LOG_MAX_SIZE"},
+	{Key: "log_max_backups", Flag: "log-max-backups", Env: "LOG_MAX_BACKUPS"},
+	{Key: "trace_file", Flag: "trace-file", Env: "TRACE_FILE"},
+	{Key: "trace_endpoint", Flag: "trace-endpoint", Env: "TRACE_ENDPOINT"},
+}
+
+// defaultConfig возвращает конфигурацию по умолчанию.
+func defaultConfig() *Config {
+	return &Config{
+		Addr:           "localhost:8080",
+		ReportInterval: 10,
+		PollInterval:   2,
+		Key:            "",
+		RateLimit:      1,
+		CryptoKey:      "",
+		Tenant:         "",
+		Token:          "",
+		LogLevel:       "info",
+		LogFormat:      logging.EncodingJSON,
+		LogFile:        "",
+		LogMaxSize:     100,
+		LogMaxBackups:  3,
+		TraceFile:      "",
+		TraceEndpoint:  "",
+	}
+}
+
+// flagSet описывает флаги агента, привязанные к полям c; значения по
+// умолчанию — текущие значения полей.
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.StringVar(&c.ConfigFile, config.FileFlag, c.ConfigFile, "Path to JSON config file")
+	fs.BoolVar(&c.PrintConfig, "print-config", c.PrintConfig, "Print the effective configuration with secrets redacted and exit")
+	fs.StringVar(&c.Addr, "a", c.Addr, "Address of metrics server")
+	fs.IntVar(&c.ReportInterval, "r", c.ReportInterval, "Report interval in seconds")
+	fs.IntVar(&c.PollInterval, "p", c.PollInterval, "Poll interval in seconds")
+	fs.StringVar(&c.Key, "k", c.Key, "Hash key")
+	fs.IntVar(&c.RateLimit, "l", c.RateLimit, "Rate limit")
+	fs.StringVar(&c.CryptoKey, "crypto-key", c.CryptoKey, "Path to public key file")
+	fs.StringVar(&c.Tenant, "tenant", c.Tenant, "Tenant ID sent in the X-Tenant-ID header")
+	fs.StringVar(&c.Token, "token", c.Token, "API token sent as Authorization: Bearer (writer role)")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log encoding: json or console")
+	fs.StringVar(&c.LogFile, "log-file", c.LogFile, "Log file path (empty logs to stderr)")
+	fs.IntVar(&c.LogMaxSize, "log-max-size", c.LogMaxSize, "Rotate the log file after this many megabytes (0 disables)")
+	fs.IntVar(&c.LogMaxBackups, "log-max-backups", c.LogMaxBackups, "Number of rotated log files to keep")
+	fs.StringVar(&c.TraceFile, "trace-file", c.TraceFile, "Append trace spans to this file as OTLP/JSON")
+	fs.StringVar(&c.TraceEndpoint, "trace-endpoint", c.TraceEndpoint, "OTLP/HTTP endpoint to export trace spans to, e.g. http://localhost:4318")
+	return fs
+}
+
+// LoadConfig собирает конфигурацию из файла JSON (-c или CONFIG), флагов
+// командной строки args и переменных окружения lookupEnv; каждый следующий
+// источник важнее предыдущего. Возвращает все найденные ошибки разбора и
+// проверки сразу.
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := defaultConfig()
+	fs := cfg.flagSet()
+	err := config.Load(fs, configOptions, args, lookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, err
+	}
+	errs := []error{err}
+
+	if len(fs.Args()) != 0 {
+		errs = append(errs, fmt.Errorf("unknown flags: %v", fs.Args()))
+	}
+
+	errs = append(errs, cfg.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate проверяет значения параметров.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("-a: server address is required"))
+	}
+	if c.ReportInterval <= 0 {
+		errs = append(errs, errors.New("-r: report interval must be positive"))
+	}
+	if c.PollInterval <= 0 {
+		errs = append(errs, errors.New("-p: poll interval must be positive"))
+	}
+	if c.RateLimit <= 0 {
+		errs = append(errs, errors.New("-l: rate limit must be positive"))
+	}
+	if err := c.logOptions().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.traceOptions().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// logOptions возвращает параметры журнала.
+func (c *Config) logOptions() logging.Options {
+	return logging.Options{
+		Level:      c.LogLevel,
+		Encoding:   c.LogFormat,
+		File:       c.LogFile,
+		MaxSizeMB:  c.LogMaxSize,
+		MaxBackups: c.LogMaxBackups,
+	}
+}
+
+// traceOptions возвращает параметры выгрузки трасс.
+func (c *Config) traceOptions() tracing.Options {
+	return tracing.Options{Service: "yaprmtrc-agent", File: c.TraceFile, Endpoint: c.TraceEndpoint}
+}
+
+// diff возвращает ключи конфигурации, значения которых в other отличаются.
+func (c *Config) diff(other *Config) []string {
+	a, b := *c, *other
+	return config.Diff(a.flagSet(), b.flagSet(), configOptions)
+}
+
+// Print выводит действующую конфигурацию в формате файла конфигурации,
+// скрывая ключ подписи и токен.
+func (c *Config) Print(w io.Writer) error {
+	cp := *c
+	return config.PrintJSON(w, cp.flagSet(), configOptions)
+}
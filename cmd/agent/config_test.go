@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lookup(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	data := `{"address": "file:8080", "report_interval": 30, "poll_interval": 5, "tenant": "acme"}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig([]string{"-r", "20", "-tenant", "flag"},
+		lookup(map[string]string{"CONFIG": path, "TENANT": "env"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != "file:8080" || cfg.PollInterval != 5 {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.ReportInterval != 20 {
+		t.Errorf("ReportInterval = %d, want flag value 20", cfg.ReportInterval)
+	}
+	if cfg.Tenant != "env" {
+		t.Errorf("Tenant = %q, want env value", cfg.Tenant)
+	}
+}
+
+func TestLoadConfig_AggregatesErrors(t *testing.T) {
+	_, err := LoadConfig([]string{"-p", "0", "extra"}, lookup(map[string]string{"REPORT_INTERVAL": "x", "RATE_LIMIT": "-1"}))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"invalid REPORT_INTERVAL: x", "-p: poll interval", "-l: rate limit", "unknown flags: [extra]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestConfig_PrintRedactsSecrets(t *testing.T) {
+	cfg, err := LoadConfig([]string{"-k", "hash-secret", "-token", "api-secret"}, lookup(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "secret") || !strings.Contains(out, `"report_interval": 10`) {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRun_PrintConfigRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-print-config", "-a", "metrics:8080", "-r", "30"}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "agent.json")
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig([]string{"-c", path}, lookup(nil))
+	if err != nil {
+		t.Fatalf("-print-config output is not a config file: %v\n%s", err, out.String())
+	}
+	if cfg.Addr != "metrics:8080" || cfg.ReportInterval != 30 {
+		t.Errorf("values lost in round trip: %+v", cfg)
+	}
+}
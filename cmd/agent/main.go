@@ -1,103 +1,69 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 
 	"github.com/zheki1/yaprmtrc/internal/buildinfo"
+	"github.com/zheki1/yaprmtrc/internal/cli"
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 )
 
 var buildVersion string
 var buildDate string
 var buildCommit string
 
-// Config хранит конфигурацию агента: адрес сервера, интервалы опроса и отправки,
-// ключ HMAC и лимит одновременных запросов.
-type Config struct {
-	Addr           string
-	ReportInterval int
-	PollInterval   int
-	Key            string
-	RateLimit      int
-	CryptoKey      string
-}
-
 func main() {
 	buildinfo.Version = buildVersion
 	buildinfo.Date = buildDate
 	buildinfo.Commit = buildCommit
-	buildinfo.Print()
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "agent: %v\n", err)
-	}
+	cli.Exit("agent", run(os.Args[1:], os.Stdout))
 }
 
-func run() error {
-	// default values
-	cfg := &Config{
-		Addr:           "localhost:8080",
-		ReportInterval: 10,
-		PollInterval:   2,
-		Key:            "",
-		RateLimit:      1,
-		CryptoKey:      "",
-	}
-
-	// flags
-	flag.StringVar(&cfg.Addr, "a", cfg.Addr, "Address of metrics server")
-	flag.IntVar(&cfg.ReportInterval, "r", cfg.ReportInterval, "Report interval in seconds")
-	flag.IntVar(&cfg.PollInterval, "p", cfg.PollInterval, "Poll interval in seconds")
-	flag.StringVar(&cfg.Key, "k", cfg.Key, "Hash key")
-	flag.IntVar(&cfg.RateLimit, "l", cfg.RateLimit, "Rate limit")
-	flag.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "Path to public key file")
-	flag.Parse()
-
-	if len(flag.Args()) != 0 {
-		return fmt.Errorf("unknown flags: %v", flag.Args())
+// run запускает агент с аргументами args. Баннер сборки печатается в stdout
+// только при обычном запуске: вывод -print-config должен оставаться
+// файлом конфигурации.
+func run(args []string, stdout io.Writer) error {
+	cfg, err := LoadConfig(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
 	}
-
-	if v, ok := os.LookupEnv("ADDRESS"); ok {
-		cfg.Addr = v
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
 	}
-
-	if v, ok := os.LookupEnv("REPORT_INTERVAL"); ok {
-		i, err := strconv.Atoi(v)
-		if err != nil || i <= 0 {
-			return fmt.Errorf("invalid REPORT_INTERVAL: %s", v)
-		}
-		cfg.ReportInterval = i
+	if cfg.PrintConfig {
+		return cfg.Print(stdout)
 	}
+	buildinfo.Fprint(stdout)
 
-	if v, ok := os.LookupEnv("POLL_INTERVAL"); ok {
-		i, err := strconv.Atoi(v)
-		if err != nil || i <= 0 {
-			return fmt.Errorf("invalid POLL_INTERVAL: %s", v)
-		}
-		cfg.PollInterval = i
+	agent, err := NewAgent(cfg)
+	if err != nil {
+		return err
 	}
+	defer logging.RedirectStdLog(agent.logger)()
 
-	if v, ok := os.LookupEnv("KEY"); ok {
-		cfg.Key = v
+	stopTracing, err := tracing.Setup(cfg.traceOptions())
+	if err != nil {
+		return fmt.Errorf("cannot init tracing: %w", err)
 	}
-
-	if v, ok := os.LookupEnv("RATE_LIMIT"); ok {
-		i, err := strconv.Atoi(v)
-		if err != nil || i <= 0 {
-			return fmt.Errorf("invalid RATE_LIMIT: %s", v)
+	defer func() {
+		if err := stopTracing(); err != nil {
+			agent.logger.Errorw("trace export failed", "error", err)
 		}
-		cfg.RateLimit = i
-	}
+	}()
+	go watchReload(agent, args, os.LookupEnv)
 
-	if v, ok := os.LookupEnv("CRYPTO_KEY"); ok {
-		cfg.CryptoKey = v
-	}
-
-	agent, err := NewAgent(cfg)
-	if err != nil {
-		return err
-	}
-	agent.Start()
+	// Start возвращается по сигналу, чтобы отложенные вызовы выгрузили
+	// последние участки трассировки.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	agent.Start(ctx)
 	return nil
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/security"
+)
+
+// reloadableKeys — ключи конфигурации, которые применяются при перезагрузке.
+// Адрес сервера, арендатор и токен зашиты в HTTP-клиент и требуют перезапуска.
+var reloadableKeys = map[string]bool{
+	"key":             true,
+	"crypto_key":      true,
+	"log_level":       true,
+	"poll_interval":   true,
+	"report_interval": true,
+	"rate_limit":      true,
+}
+
+// watchReload перечитывает конфигурацию из args, окружения и файла
+// конфигурации на каждый SIGHUP.
+func watchReload(a *Agent, args []string, lookupEnv func(string) (string, bool)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		a.logger.Infow("SIGHUP received, reloading configuration")
+		_ = a.reloadConfig(args, lookupEnv)
+	}
+}
+
+// reloadConfig загружает конфигурацию и применяет её. Неверная конфигурация
+// отклоняется целиком, действующая остаётся без изменений.
+func (a *Agent) reloadConfig(args []string, lookupEnv func(string) (string, bool)) error {
+	next, err := LoadConfig(args, lookupEnv)
+	if err == nil {
+		err = a.Reload(next)
+	}
+	if err != nil {
+		a.logger.Errorw("config reload rejected, running configuration kept", "error", err)
+	}
+	return err
+}
+
+// Reload применяет из next параметры reloadableKeys одной атомарной заменой
+// конфигурации; циклы сбора и отправки подхватывают новые интервалы сразу.
+// Изменения остальных параметров не применяются и попадают в журнал.
+func (a *Agent) Reload(next *Config) error {
+	if err := next.logOptions().Validate(); err != nil {
+		return err
+	}
+	if next.CryptoKey != "" {
+		if _, err := security.LoadPublicKey(next.CryptoKey); err != nil {
+			return fmt.Errorf("-crypto-key: %w", err)
+		}
+	}
+
+	cur := a.config()
+	var applied, restart []string
+	for _, k := range cur.diff(next) {
+		if reloadableKeys[k] {
+			applied = append(applied, k)
+		} else {
+			restart = append(restart, k)
+		}
+	}
+
+	running := *cur
+	running.Key = next.Key
+	running.CryptoKey = next.CryptoKey
+	running.LogLevel = next.LogLevel
+	running.PollInterval = next.PollInterval
+	running.ReportInterval = next.ReportInterval
+	running.RateLimit = next.RateLimit
+
+	a.cfg.Store(&running)
+	if next.LogLevel != cur.LogLevel {
+		_ = logging.SetLevel(next.LogLevel)
+	}
+	a.notify()
+
+	a.logger.Infow("configuration reloaded", "applied", applied)
+	if len(restart) > 0 {
+		a.logger.Infow("changed settings require a restart and were not applied", "settings", restart)
+	}
+	return nil
+}
+
+// subscribe возвращает канал, в который приходит уведомление после
+// каждой перезагрузки конфигурации.
+func (a *Agent) subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	a.mu.Lock()
+	a.changed = append(a.changed, ch)
+	a.mu.Unlock()
+	return ch
+}
+
+// notify уведомляет подписчиков о смене конфигурации. Уведомления не
+// копятся: подписчику достаточно узнать, что конфигурация изменилась.
+func (a *Agent) notify() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ch := range a.changed {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
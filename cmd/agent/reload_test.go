@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/logging"
+)
+
+func TestAgent_ReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = logging.SetLevel("info") })
+
+	write(`{"poll_interval": 2, "report_interval": 10}`)
+	args := []string{"-c", path}
+	cfg, err := LoadConfig(args, lookup(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAgent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := a.subscribe()
+
+	write(`{"poll_interval": 1, "report_interval": 3, "rate_limit": 4, "key": "k",
+		"log_level": "warn", "address": "other:8080"}`)
+	if err := a.reloadConfig(args, lookup(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := a.config()
+	if got.PollInterval != 1 || got.ReportInterval != 3 || got.RateLimit != 4 || got.Key != "k" {
+		t.Errorf("reloadable settings not applied: %+v", got)
+	}
+	if got.Addr != "localhost:8080" {
+		t.Errorf("address must require a restart, got %q", got.Addr)
+	}
+	if logging.GetLevel() != "warn" {
+		t.Errorf("log level = %v, want warn", logging.GetLevel())
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("subscribers must be notified")
+	}
+
+	write(`{"poll_interval": 0}`)
+	if err := a.reloadConfig(args, lookup(nil)); err == nil {
+		t.Fatal("invalid config must be rejected")
+	}
+	write(`{"crypto_key": "/nonexistent/public.pem"}`)
+	if err := a.reloadConfig(args, lookup(nil)); err == nil {
+		t.Fatal("unreadable crypto key must be rejected")
+	}
+	if a.config() != got {
+		t.Fatal("rejected config must leave the running one in place")
+	}
+}
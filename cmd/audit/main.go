@@ -0,0 +1,97 @@
+// Команда audit проверяет сцепленный журнал аудита сервера (-audit-chain).
+//
+//	audit verify -file audit.log -chain hmac -key secret -public-key audit.pub
+//
+// Проверка сообщает первую изменённую, удалённую или переставленную запись
+// или неверную подпись контрольной точки и тогда завершается с кодом 1.
+// Значения по умолчанию берутся из AUDIT_FILE, AUDIT_CHAIN и AUDIT_CHAIN_KEY,
+// как у сервера.
+package main
+
+import (
+	"crypto/rsa"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zheki1/yaprmtrc/internal/auditchain"
+	"github.com/zheki1/yaprmtrc/internal/cli"
+	"github.com/zheki1/yaprmtrc/internal/security"
+)
+
+const usage = `usage: audit verify [flags]
+
+  verify  check the hash chain and checkpoint signatures of an audit file
+`
+
+func main() {
+	cli.Exit("audit", run(os.Args[1:], os.Stdout))
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	cmd, args := args[0], args[1:]
+	if cmd != "verify" {
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(out)
+	file := fs.String("file", os.Getenv("AUDIT_FILE"), "path to the audit file")
+	mode := fs.String("chain", envOr("AUDIT_CHAIN", auditchain.ModeSHA256), "chain mode: sha256 or hmac")
+	key := fs.String("key", os.Getenv("AUDIT_CHAIN_KEY"), "HMAC key for -chain=hmac")
+	pubKey := fs.String("public-key", "", "path to RSA public key that verifies checkpoint signatures")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("audit file is not set: use -file")
+	}
+
+	chain := auditchain.Chain{Mode: *mode, Key: []byte(*key)}
+	if err := chain.Validate(); err != nil {
+		return err
+	}
+	var pub *rsa.PublicKey
+	if *pubKey != "" {
+		k, err := security.LoadPublicKey(*pubKey)
+		if err != nil {
+			return fmt.Errorf("-public-key: %w", err)
+		}
+		pub = k
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rep, err := auditchain.Verify(f, chain, pub)
+	if err != nil {
+		return fmt.Errorf("%s is broken at %w", *file, err)
+	}
+
+	fmt.Fprintf(out, "ok: %d records, %d checkpoints", rep.Records, rep.Checkpoints)
+	if pub != nil {
+		fmt.Fprintf(out, " (%d signatures verified)", rep.Signed)
+	} else if rep.Checkpoints > 0 {
+		fmt.Fprint(out, " (signatures not checked: use -public-key)")
+	}
+	fmt.Fprintln(out)
+	if rep.Unprotected > 0 {
+		fmt.Fprintf(out, "warning: %d records after the last checkpoint are not protected against deletion\n", rep.Unprotected)
+	}
+	return nil
+}
+
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		return v
+	}
+	return def
+}
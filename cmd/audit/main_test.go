@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/auditchain"
+)
+
+func writeChainedLog(t *testing.T, path string, key *rsa.PrivateKey) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := auditchain.NewWriter(f, auditchain.Chain{Mode: auditchain.ModeHMAC, Key: []byte("secret")}, key, 2, auditchain.State{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := w.Append([]byte(fmt.Sprintf(`{"ts":%d,"metrics":["m"]}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writePublicKey(t *testing.T, path string, key *rsa.PrivateKey) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_Verify(t *testing.T) {
+	t.Setenv("AUDIT_FILE", "")
+	t.Setenv("AUDIT_CHAIN", "")
+	t.Setenv("AUDIT_CHAIN_KEY", "")
+	dir := t.TempDir()
+	log, pub := filepath.Join(dir, "audit.log"), filepath.Join(dir, "audit.pub")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChainedLog(t, log, key)
+	writePublicKey(t, pub, key)
+	args := []string{"verify", "-file", log, "-chain", "hmac", "-key", "secret", "-public-key", pub}
+
+	var out bytes.Buffer
+	if err := run(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ok: 5 records, 2 checkpoints (2 signatures verified)", "warning: 1 records"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q lacks %q", out.String(), want)
+		}
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `{"ts":3,`, `{"ts":30,`, 1)
+	if err := os.WriteFile(log, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = run(args, &out)
+	if err == nil || !strings.Contains(err.Error(), "broken at line 4 (record 3)") {
+		t.Fatalf("expected broken record 3, got %v", err)
+	}
+
+	if err := run([]string{"verify", "-file", log, "-chain", "hmac"}, &out); err == nil {
+		t.Error("hmac chain without a key must fail")
+	}
+	if err := run([]string{"check"}, &out); err == nil {
+		t.Error("unknown command must fail")
+	}
+}
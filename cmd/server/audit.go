@@ -2,22 +2,87 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	retryablehttp "github.com/hashicorp/go-retryablehttp"
+
+	"github.com/zheki1/yaprmtrc/internal/auditchain"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 )
 
-// AuditEvent represents an audit log entry emitted after successful metric processing.
+// AuditEventVersion is the version of the AuditEvent schema. Events written
+// before the field was added have no version and carry only Ts, Tenant,
+// Metrics and IPAddress.
+const AuditEventVersion = 2
+
+// Audit event results.
+const (
+	AuditResultSuccess = "success" // all metrics were written
+	AuditResultPartial = "partial" // a partial batch was written in part (207)
+	AuditResultDenied  = "denied"  // the request was not authorised (401, 403)
+	AuditResultFailure = "failure" // the request was rejected or failed
+)
+
+// AuditEvent represents an audit log entry for a metric write attempt.
+// Tenant identifies the tenant whose metrics were changed; it is empty when
+// the request was rejected before its tenant was resolved.
+// Metrics lists the metrics actually changed, Values what the request tried
+// to write. RequestID, TraceID and SpanID tie the event to the request's log
+// lines and trace.
 type AuditEvent struct {
-	Ts        int64    `json:"ts"`
-	Metrics   []string `json:"metrics"`
-	IPAddress string   `json:"ip_address"`
+	Version      int          `json:"version,omitempty"`
+	Ts           int64        `json:"ts"`
+	Tenant       string       `json:"tenant"`
+	Metrics      []string     `json:"metrics"`
+	IPAddress    string       `json:"ip_address"`
+	Route        string       `json:"route,omitempty"`
+	Values       []AuditValue `json:"values,omitempty"`
+	AgentHost    string       `json:"agent_host,omitempty"`
+	AgentVersion string       `json:"agent_version,omitempty"`
+	UserAgent    string       `json:"user_agent,omitempty"`
+	Signed       bool         `json:"signed,omitempty"`
+	Encrypted    bool         `json:"encrypted,omitempty"`
+	Result       string       `json:"result,omitempty"`
+	Status       int          `json:"status,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	RequestID    string       `json:"request_id,omitempty"`
+	TraceID      string       `json:"trace_id,omitempty"`
+	SpanID       string       `json:"span_id,omitempty"`
+}
+
+// AuditValue is a metric value a request tried to write. Value and Delta
+// are empty if the request did not carry a valid number; Raw then holds the
+// value as sent in the URL of /update/{type}/{name}/{value}.
+type AuditValue struct {
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Delta  *int64            `json:"delta,omitempty"`
+	Value  *float64          `json:"value,omitempty"`
+	Raw    string            `json:"raw,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// logFields returns the event's request and trace IDs as log fields.
+func (e AuditEvent) logFields() []any {
+	var fields []any
+	if e.RequestID != "" {
+		fields = append(fields, "request_id", e.RequestID)
+	}
+	if e.TraceID != "" {
+		fields = append(fields, "trace_id", e.TraceID)
+	}
+	return fields
 }
 
 //go:generate mockgen -destination=mocks_test.go -package=main github.com/zheki1/yaprmtrc/cmd/server AuditObserver,Logger
@@ -28,9 +93,12 @@ type AuditObserver interface {
 }
 
 // AuditPublisher manages a list of observers and publishes events to all of them.
+// Delivery is synchronous until StartQueue moves it to a background queue.
 type AuditPublisher struct {
 	mu        sync.RWMutex
 	observers []AuditObserver
+	inflight  *sync.WaitGroup // deliveries to the current observers
+	queue     *auditQueue
 	logger    Logger
 	sem       chan struct{}
 }
@@ -38,8 +106,9 @@ type AuditPublisher struct {
 // NewAuditPublisher creates a new AuditPublisher.
 func NewAuditPublisher(logger Logger) *AuditPublisher {
 	return &AuditPublisher{
-		logger: logger,
-		sem:    make(chan struct{}, 10),
+		inflight: new(sync.WaitGroup),
+		logger:   logger,
+		sem:      make(chan struct{}, 10),
 	}
 }
 
@@ -51,21 +120,92 @@ func (p *AuditPublisher) Register(o AuditObserver) {
 	p.observers = append(p.observers, o)
 }
 
-// Publish sends an audit event to all registered observers.
+// Replace swaps the registered observers for observers in one step and
+// returns the previous ones, so the caller can close them. It returns only
+// after deliveries that started with the previous observers have finished.
+func (p *AuditPublisher) Replace(observers []AuditObserver) []AuditObserver {
+	p.mu.Lock()
+	old, inflight := p.observers, p.inflight
+	p.observers, p.inflight = observers, new(sync.WaitGroup)
+	p.mu.Unlock()
+
+	inflight.Wait()
+	return old
+}
+
+// Observers returns a copy of the registered observers.
+func (p *AuditPublisher) Observers() []AuditObserver {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append([]AuditObserver(nil), p.observers...)
+}
+
+// StartQueue makes Publish enqueue events for background workers instead
+// of delivering them in the caller. Call Close to flush the queue.
+func (p *AuditPublisher) StartQueue(cfg AuditQueueConfig) error {
+	q, err := newAuditQueue(cfg, p.deliver, p.logger)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queue = q
+	return nil
+}
+
+// Close flushes the queue started by StartQueue, waiting for delivery until
+// ctx expires. Events published after Close are dropped.
+func (p *AuditPublisher) Close(ctx context.Context) error {
+	p.mu.RLock()
+	q := p.queue
+	p.mu.RUnlock()
+	if q == nil {
+		return nil
+	}
+	return q.close(ctx)
+}
+
+// Publish sends an audit event to all registered observers, or only
+// enqueues it if StartQueue was called.
+func (p *AuditPublisher) Publish(event AuditEvent) {
+	auditEvents.Inc()
+
+	p.mu.RLock()
+	q := p.queue
+	p.mu.RUnlock()
+	if q != nil {
+		q.push(event)
+		return
+	}
+	p.deliver(event)
+}
+
+// deliver notifies all registered observers of event.
 // Observers are notified concurrently; a semaphore limits the number of
 // in-flight goroutines so they do not grow without bound.
-func (p *AuditPublisher) Publish(event AuditEvent) {
+// Delivery latency and in-flight notifications are exported as audit_*
+// self-metrics.
+func (p *AuditPublisher) deliver(event AuditEvent) {
+	start := time.Now()
+	defer auditPublishSeconds.ObserveSince(start)
+
 	p.mu.RLock()
 	observers := make([]AuditObserver, len(p.observers))
 	copy(observers, p.observers)
+	inflight := p.inflight
+	inflight.Add(1)
 	p.mu.RUnlock()
+	defer inflight.Done()
 
 	var wg sync.WaitGroup
 	for _, o := range observers {
 		p.sem <- struct{}{} // acquire semaphore slot
+		auditInFlight.Add(1)
 		wg.Add(1)
 		go func(obs AuditObserver) {
 			defer func() {
+				auditInFlight.Add(-1)
 				<-p.sem // release slot
 				wg.Done()
 			}()
@@ -76,9 +216,13 @@ func (p *AuditPublisher) Publish(event AuditEvent) {
 }
 
 // FileAuditObserver writes audit events as JSON lines to a file.
+// With a chain, each event is wrapped in a hash-chained record (see
+// package auditchain).
 type FileAuditObserver struct {
 	mu     sync.Mutex
+	path   string
 	file   *os.File
+	chain  *auditchain.Writer
 	logger Logger
 }
 
@@ -88,32 +232,76 @@ func NewFileAuditObserver(filePath string, logger Logger) (*FileAuditObserver, e
 	if err != nil {
 		return nil, fmt.Errorf("audit file: open error: %w", err)
 	}
-	return &FileAuditObserver{file: f, logger: logger}, nil
+	return &FileAuditObserver{path: filePath, file: f, logger: logger}, nil
+}
+
+// AuditChainConfig configures the hash chain of the audit file.
+type AuditChainConfig struct {
+	Chain           auditchain.Chain
+	Signer          *rsa.PrivateKey // signs checkpoints; nil — no checkpoints
+	CheckpointEvery int             // records between checkpoints
+}
+
+// NewChainedFileAuditObserver creates a FileAuditObserver that continues the
+// hash chain already in the file, or starts one in an empty file.
+func NewChainedFileAuditObserver(filePath string, cfg AuditChainConfig, logger Logger) (*FileAuditObserver, error) {
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit file: open error: %w", err)
+	}
+	st, err := auditchain.Resume(f)
+	if err == nil {
+		var w *auditchain.Writer
+		if w, err = auditchain.NewWriter(f, cfg.Chain, cfg.Signer, cfg.CheckpointEvery, st); err == nil {
+			return &FileAuditObserver{path: filePath, file: f, chain: w, logger: logger}, nil
+		}
+	}
+	_ = f.Close()
+	return nil, fmt.Errorf("audit file %s: %w", filePath, err)
 }
 
 // Notify appends the audit event as a JSON line to the configured file.
 func (o *FileAuditObserver) Notify(event AuditEvent) {
 	data, err := json.Marshal(event)
 	if err != nil {
-		o.logger.Errorf("audit file: marshal error: %v", err)
+		auditErrors.With("file").Inc()
+		o.logger.Errorw("audit file: marshal error", append(event.logFields(), "error", err)...)
 		return
 	}
 
-	data = append(data, '\n')
-
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if _, err := o.file.Write(data); err != nil {
-		o.logger.Errorf("audit file: write error: %v", err)
+	if o.chain != nil {
+		err = o.chain.Append(data)
+	} else {
+		_, err = o.file.Write(append(data, '\n'))
 	}
+	if err != nil {
+		auditErrors.With("file").Inc()
+		o.logger.Errorw("audit file: write error", append(event.logFields(), "error", err)...)
+	}
+}
+
+// Check reports whether the audit file is still open and writable.
+func (o *FileAuditObserver) Check(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, err := o.file.Stat()
+	return err
 }
 
-// Close closes the underlying file.
+// Close writes a final checkpoint for a chained file and closes it.
 func (o *FileAuditObserver) Close() error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
-	return o.file.Close()
+
+	var err error
+	if o.chain != nil {
+		err = o.chain.Checkpoint()
+	}
+	return errors.Join(err, o.file.Close())
 }
 
 // HTTPAuditObserver sends audit events as JSON via HTTP POST to a remote URL.
@@ -141,41 +329,118 @@ func NewHTTPAuditObserver(url string, logger Logger) *HTTPAuditObserver {
 }
 
 // Notify sends the audit event as a JSON POST request to the configured URL.
+// The event's request ID and trace context are passed on in the
+// X-Request-ID and traceparent headers.
 func (o *HTTPAuditObserver) Notify(event AuditEvent) {
 	data, err := json.Marshal(event)
 	if err != nil {
-		o.logger.Errorf("audit http: marshal error: %v", err)
+		auditErrors.With("http").Inc()
+		o.logger.Errorw("audit http: marshal error", append(event.logFields(), "error", err)...)
 		return
 	}
 
 	req, err := retryablehttp.NewRequest("POST", o.url, bytes.NewReader(data))
 	if err != nil {
-		o.logger.Errorf("audit http: request error: %v", err)
+		auditErrors.With("http").Inc()
+		o.logger.Errorw("audit http: request error", append(event.logFields(), "error", err)...)
 		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if event.RequestID != "" {
+		req.Header.Set(tracing.RequestIDHeader, event.RequestID)
+	}
+	if sc, err := tracing.ParseTraceparent("00-" + event.TraceID + "-" + event.SpanID + "-01"); err == nil {
+		req.Header.Set(tracing.TraceparentHeader, sc.Traceparent())
+	}
 
 	resp, err := o.client.Do(req)
 	if err != nil {
-		o.logger.Errorf("audit http: post error: %v", err)
+		auditErrors.With("http").Inc()
+		o.logger.Errorw("audit http: post error", append(event.logFields(), "error", err)...)
 		return
 	}
 	defer resp.Body.Close()
 }
 
-// notifyAudit builds an AuditEvent from the request and metric names, then publishes it.
-func (s *Server) notifyAudit(r *http.Request, metricNames []string) {
-	ip := r.RemoteAddr
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		ip = host
+// Check reports whether the audit endpoint accepts TCP connections.
+// It does not send an event, so the remote log stays free of probes.
+func (o *HTTPAuditObserver) Check(ctx context.Context) error {
+	u, err := url.Parse(o.url)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
 	}
+	return conn.Close()
+}
 
-	event := AuditEvent{
-		Ts:        time.Now().Unix(),
-		Metrics:   metricNames,
-		IPAddress: ip,
+// newAuditObservers creates the observers configured by -audit-file and -audit-url.
+// A file observer for the same file is taken from current instead of
+// opening the file again, so two writers never extend one hash chain.
+func newAuditObservers(cfg *Config, current []AuditObserver, logger Logger) ([]AuditObserver, error) {
+	var observers []AuditObserver
+	if cfg.AuditFile != "" {
+		fileObs := reuseFileObserver(current, cfg.AuditFile)
+		if fileObs == nil {
+			var err error
+			if fileObs, err = newFileAuditObserver(cfg, logger); err != nil {
+				return nil, fmt.Errorf("audit file observer: %w", err)
+			}
+		}
+		observers = append(observers, fileObs)
+	}
+	if cfg.AuditURL != "" {
+		observers = append(observers, NewHTTPAuditObserver(cfg.AuditURL, logger))
 	}
+	return observers, nil
+}
 
-	s.audit.Publish(event)
+// reuseFileObserver returns the observer in current that writes path, if any.
+func reuseFileObserver(current []AuditObserver, path string) *FileAuditObserver {
+	for _, o := range current {
+		if f, ok := o.(*FileAuditObserver); ok && f.path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// newFileAuditObserver opens cfg.AuditFile, chained if -audit-chain is set.
+func newFileAuditObserver(cfg *Config, logger Logger) (*FileAuditObserver, error) {
+	if cfg.AuditChain == "" {
+		return NewFileAuditObserver(cfg.AuditFile, logger)
+	}
+	chain, err := cfg.auditChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewChainedFileAuditObserver(cfg.AuditFile, chain, logger)
+}
+
+// closeAuditObservers releases observers that hold resources, such as open
+// files, except those still in use (kept).
+func closeAuditObservers(observers []AuditObserver, logger Logger, kept ...AuditObserver) {
+	for _, o := range observers {
+		if slices.Contains(kept, o) {
+			continue
+		}
+		if c, ok := o.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				logger.Errorf("audit observer close failed: %v", err)
+			}
+		}
+	}
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit queue overflow policies.
+const (
+	// AuditOverflowBlock makes Publish wait until the queue has room.
+	// Events of requests refused access (see refusedAccess) never wait:
+	// if they do not fit, they are dropped.
+	AuditOverflowBlock = "block"
+	// AuditOverflowDropOldest discards the oldest queued event to make room.
+	AuditOverflowDropOldest = "drop-oldest"
+	// AuditOverflowSpill appends events that do not fit to a spill file;
+	// they are queued again once the queue drains.
+	AuditOverflowSpill = "spill"
+)
+
+// auditRefillInterval is how often spilled events are moved back to the queue.
+const auditRefillInterval = 500 * time.Millisecond
+
+// AuditQueueConfig configures asynchronous audit delivery.
+type AuditQueueConfig struct {
+	Size      int    // queue capacity; 0 keeps delivery synchronous
+	Workers   int    // goroutines delivering queued events
+	Overflow  string // AuditOverflowBlock, AuditOverflowDropOldest or AuditOverflowSpill
+	SpillFile string // spill file for AuditOverflowSpill
+}
+
+// auditQueue is a bounded queue of audit events drained by background
+// workers. Event order is kept while the queue has room; under overflow
+// with the spill policy, spilled events are delivered after newer ones.
+type auditQueue struct {
+	events   chan AuditEvent
+	overflow string
+	spill    *auditSpill // nil unless overflow is AuditOverflowSpill
+	deliver  func(AuditEvent)
+	logger   Logger
+
+	// mu guards closed; Publish holds it for reading while it enqueues,
+	// so close waits for in-progress pushes before closing events.
+	mu     sync.RWMutex
+	closed bool
+
+	workers    sync.WaitGroup
+	stop       chan struct{}
+	refillDone chan struct{}
+}
+
+func newAuditQueue(cfg AuditQueueConfig, deliver func(AuditEvent), logger Logger) (*auditQueue, error) {
+	q := &auditQueue{
+		events:     make(chan AuditEvent, cfg.Size),
+		overflow:   cfg.Overflow,
+		deliver:    deliver,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		refillDone: make(chan struct{}),
+	}
+	if q.overflow == AuditOverflowSpill {
+		spill, err := openAuditSpill(cfg.SpillFile)
+		if err != nil {
+			return nil, err
+		}
+		q.spill = spill
+	}
+
+	workers := max(cfg.Workers, 1)
+	q.workers.Add(workers)
+	for range workers {
+		go q.work()
+	}
+	go q.refill()
+	return q, nil
+}
+
+func (q *auditQueue) work() {
+	defer q.workers.Done()
+	for ev := range q.events {
+		auditQueueDepth.Set(int64(len(q.events)))
+		q.deliver(ev)
+	}
+}
+
+// push enqueues event according to the overflow policy.
+func (q *auditQueue) push(event AuditEvent) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.drop("closed", event, errors.New("audit queue is closed"))
+		return
+	}
+	defer func() { auditQueueDepth.Set(int64(len(q.events))) }()
+
+	select {
+	case q.events <- event:
+		return
+	default:
+	}
+
+	switch {
+	case q.overflow == AuditOverflowDropOldest:
+		for {
+			select {
+			case q.events <- event:
+				return
+			default:
+			}
+			select {
+			case old := <-q.events:
+				q.drop("overflow", old, errors.New("audit queue is full"))
+			default:
+			}
+		}
+	case q.overflow == AuditOverflowSpill:
+		if err := q.spill.write(event); err != nil {
+			q.drop("spill_error", event, err)
+		}
+	case refusedAccess(event):
+		q.drop("overflow", event, errors.New("audit queue is full"))
+	default:
+		q.events <- event
+	}
+}
+
+// refusedAccess reports whether event belongs to a request refused by rate
+// limiting, authentication or authorisation. Anyone can produce such
+// requests in bulk, so under AuditOverflowBlock they must not hold the
+// handler, and they must not push events of admitted writes out of the queue.
+func refusedAccess(event AuditEvent) bool {
+	return event.Result == AuditResultDenied || event.Status == http.StatusTooManyRequests
+}
+
+func (q *auditQueue) drop(reason string, event AuditEvent, err error) {
+	auditDropped.With(reason).Inc()
+	q.logger.Errorw("audit event dropped", append(event.logFields(), "reason", reason, "error", err)...)
+}
+
+// refill moves spilled events back to the queue whenever it is at most half
+// full. On close it moves the rest, waiting for room until ctx passed to
+// close expires.
+func (q *auditQueue) refill() {
+	defer close(q.refillDone)
+	if q.spill == nil {
+		return
+	}
+
+	ticker := time.NewTicker(auditRefillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if len(q.events) > cap(q.events)/2 || q.spill.len() == 0 {
+				continue
+			}
+			q.requeue(q.stop)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// requeue moves spilled events to the queue. Events that do not fit before
+// done is closed are written back to the spill file.
+func (q *auditQueue) requeue(done <-chan struct{}) {
+	events, err := q.spill.take()
+	if err != nil {
+		q.logger.Errorw("audit spill file read failed", "error", err)
+	}
+	for i, ev := range events {
+		select {
+		case q.events <- ev:
+			auditQueueDepth.Set(int64(len(q.events)))
+		case <-done:
+			for _, rest := range events[i:] {
+				if err := q.spill.write(rest); err != nil {
+					q.drop("spill_error", rest, err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// close stops accepting events and waits until queued and spilled events
+// are delivered or ctx expires. With the spill policy, undelivered events
+// stay in the spill file and are delivered after the next start; otherwise
+// they are counted as dropped.
+func (q *auditQueue) close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	<-q.refillDone
+	if q.spill != nil && q.spill.len() > 0 {
+		q.requeue(ctx.Done())
+	}
+	close(q.events)
+
+	delivered := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(delivered)
+	}()
+
+	var err error
+	select {
+	case <-delivered:
+	case <-ctx.Done():
+		var lost int
+		for ev := range q.events {
+			if q.spill != nil && q.spill.write(ev) == nil {
+				continue
+			}
+			auditDropped.With("shutdown").Inc()
+			lost++
+		}
+		if lost > 0 {
+			err = fmt.Errorf("audit queue: %d events not delivered before shutdown", lost)
+		}
+		if q.spill != nil && q.spill.len() > 0 {
+			q.logger.Infow("audit events left in spill file", "file", q.spill.path, "events", q.spill.len())
+		}
+	}
+	auditQueueDepth.Set(0)
+
+	if q.spill != nil {
+		err = errors.Join(err, q.spill.close())
+	}
+	return err
+}
+
+// auditSpill is an append-only JSON lines file of events that did not fit
+// into the queue.
+type auditSpill struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	n    int
+}
+
+// openAuditSpill opens the spill file, keeping events left by a previous run.
+func openAuditSpill(path string) (*auditSpill, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit spill file: %w", err)
+	}
+	s := &auditSpill{path: path, file: f}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("audit spill file: %w", err)
+	}
+	s.n = bytes.Count(data, []byte{'\n'})
+	auditSpilled.Set(int64(s.n))
+	return s, nil
+}
+
+func (s *auditSpill) write(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("audit spill file: %w", err)
+	}
+	s.n++
+	auditSpilled.Set(int64(s.n))
+	return nil
+}
+
+func (s *auditSpill) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.n
+}
+
+// take reads all spilled events and empties the file. Lines that cannot be
+// decoded are skipped and reported in the returned error.
+func (s *auditSpill) take() ([]AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var (
+		events []AuditEvent
+		errs   []error
+	)
+	sc := bufio.NewScanner(s.file)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var ev AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			auditDropped.With("spill_corrupt").Inc()
+			errs = append(errs, err)
+			continue
+		}
+		events = append(events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		// The rest of the file cannot be read; it is discarded so the
+		// same error does not repeat on every refill.
+		auditDropped.With("spill_corrupt").Inc()
+		errs = append(errs, err)
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return nil, err
+	}
+	s.n = 0
+	auditSpilled.Set(0)
+	return events, errors.Join(errs...)
+}
+
+func (s *auditSpill) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// blockingObserver records events and holds each delivery until release is closed.
+type blockingObserver struct {
+	mu      sync.Mutex
+	events  []string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingObserver() *blockingObserver {
+	return &blockingObserver{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (o *blockingObserver) Notify(event AuditEvent) {
+	o.started <- struct{}{}
+	<-o.release
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event.Metrics[0])
+}
+
+func (o *blockingObserver) received() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+func newQueuedPublisher(t *testing.T, cfg AuditQueueConfig, obs AuditObserver) *AuditPublisher {
+	t.Helper()
+	p := NewAuditPublisher(zap.NewNop().Sugar())
+	p.Register(obs)
+	if err := p.StartQueue(cfg); err != nil {
+		t.Fatalf("StartQueue: %v", err)
+	}
+	return p
+}
+
+func event(name string) AuditEvent {
+	return AuditEvent{Ts: time.Now().Unix(), Metrics: []string{name}}
+}
+
+func closePublisher(t *testing.T, p *AuditPublisher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestAuditQueue_PublishDoesNotWaitForObservers(t *testing.T) {
+	obs := newBlockingObserver()
+	p := newQueuedPublisher(t, AuditQueueConfig{Size: 10, Workers: 1, Overflow: AuditOverflowBlock}, obs)
+
+	done := make(chan struct{})
+	go func() {
+		p.Publish(event("a"))
+		p.Publish(event("b"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish waited for a slow observer")
+	}
+
+	close(obs.release)
+	closePublisher(t, p)
+	if got := obs.received(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("delivered %v, want [a b]", got)
+	}
+}
+
+func TestAuditQueue_DropOldest(t *testing.T) {
+	obs := newBlockingObserver()
+	p := newQueuedPublisher(t, AuditQueueConfig{Size: 1, Workers: 1, Overflow: AuditOverflowDropOldest}, obs)
+	before := auditDropped.With("overflow").Value()
+
+	p.Publish(event("a"))
+	<-obs.started // a is being delivered, the queue is empty
+	p.Publish(event("b"))
+	p.Publish(event("c"))
+
+	if n := auditDropped.With("overflow").Value() - before; n != 1 {
+		t.Errorf("dropped %d events, want 1", n)
+	}
+	close(obs.release)
+	closePublisher(t, p)
+	if got := obs.received(); len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Fatalf("delivered %v, want [a c]", got)
+	}
+}
+
+func TestAuditQueue_BlockDropsRefusedRequests(t *testing.T) {
+	obs := newBlockingObserver()
+	p := newQueuedPublisher(t, AuditQueueConfig{Size: 1, Workers: 1, Overflow: AuditOverflowBlock}, obs)
+	before := auditDropped.With("overflow").Value()
+
+	p.Publish(event("a"))
+	<-obs.started // a is being delivered, the queue is empty
+	p.Publish(event("b"))
+
+	done := make(chan struct{})
+	go func() {
+		unauthorized := event("401")
+		unauthorized.Status, unauthorized.Result = http.StatusUnauthorized, AuditResultDenied
+		limited := event("429")
+		limited.Status, limited.Result = http.StatusTooManyRequests, AuditResultFailure
+		p.Publish(unauthorized)
+		p.Publish(limited)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish of a refused request waited for a full queue")
+	}
+
+	if n := auditDropped.With("overflow").Value() - before; n != 2 {
+		t.Errorf("dropped %d events, want 2", n)
+	}
+	close(obs.release)
+	closePublisher(t, p)
+	if got := obs.received(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("delivered %v, want [a b]", got)
+	}
+}
+
+func TestAuditQueue_SpillsAndRefills(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.jsonl")
+	obs := newBlockingObserver()
+	p := newQueuedPublisher(t, AuditQueueConfig{Size: 1, Workers: 1, Overflow: AuditOverflowSpill, SpillFile: path}, obs)
+
+	p.Publish(event("a"))
+	<-obs.started
+	for _, name := range []string{"b", "c", "d"} {
+		p.Publish(event(name))
+	}
+	if n := auditSpilled.Value(); n != 2 {
+		t.Errorf("spilled events = %d, want 2", n)
+	}
+
+	close(obs.release)
+	closePublisher(t, p)
+	if got := obs.received(); len(got) != 4 {
+		t.Fatalf("delivered %v, want all 4 events", got)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("spill file not emptied: %s", data)
+	}
+}
+
+func TestAuditQueue_SpillSurvivesShutdownTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.jsonl")
+	stuck := newBlockingObserver()
+	defer close(stuck.release)
+	p := newQueuedPublisher(t, AuditQueueConfig{Size: 1, Workers: 1, Overflow: AuditOverflowSpill, SpillFile: path}, stuck)
+
+	p.Publish(event("a"))
+	<-stuck.started
+	p.Publish(event("b"))
+	p.Publish(event("c"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The next start delivers what the previous run left on disk.
+	obs := newBlockingObserver()
+	close(obs.release)
+	next := newQueuedPublisher(t, AuditQueueConfig{Size: 10, Workers: 1, Overflow: AuditOverflowSpill, SpillFile: path}, obs)
+	closePublisher(t, next)
+	if got := obs.received(); len(got) != 2 {
+		t.Fatalf("delivered %v after restart, want [b c]", got)
+	}
+}
+
+func TestAuditQueue_DropsAfterClose(t *testing.T) {
+	obs := newBlockingObserver()
+	close(obs.release)
+	p := newQueuedPublisher(t, AuditQueueConfig{Size: 1, Workers: 1, Overflow: AuditOverflowBlock}, obs)
+	closePublisher(t, p)
+
+	before := auditDropped.With("closed").Value()
+	p.Publish(event("late"))
+	if n := auditDropped.With("closed").Value() - before; n != 1 {
+		t.Errorf("closed drops = %d, want 1", n)
+	}
+	if got := obs.received(); len(got) != 0 {
+		t.Errorf("delivered %v after Close", got)
+	}
+}
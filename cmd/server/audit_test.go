@@ -1,14 +1,20 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"go.uber.org/mock/gomock"
+
+	"github.com/zheki1/yaprmtrc/internal/auditchain"
 )
 
 func TestAuditPublisher_Publish(t *testing.T) {
@@ -43,6 +49,41 @@ func TestAuditPublisher_NoObservers(t *testing.T) {
 	pub.Publish(AuditEvent{Ts: 1, Metrics: []string{"m1"}, IPAddress: "1.2.3.4"})
 }
 
+func TestAuditPublisher_ReplaceWaitsForInFlightDelivery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	pub := NewAuditPublisher(NewMockLogger(ctrl))
+	entered, release := make(chan struct{}), make(chan struct{})
+	obs := NewMockAuditObserver(ctrl)
+	obs.EXPECT().Notify(gomock.Any()).Do(func(AuditEvent) {
+		close(entered)
+		<-release
+	})
+	pub.Register(obs)
+
+	go pub.Publish(AuditEvent{Ts: 1, Metrics: []string{"m1"}})
+	<-entered
+
+	replaced := make(chan []AuditObserver)
+	go func() { replaced <- pub.Replace(nil) }()
+
+	select {
+	case <-replaced:
+		t.Fatal("Replace returned while the old observer was still notified")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case old := <-replaced:
+		if len(old) != 1 || old[0] != obs {
+			t.Fatalf("expected the old observer back, got %v", old)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Replace did not return after the delivery finished")
+	}
+}
+
 func TestFileAuditObserver_Notify(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockLog := NewMockLogger(ctrl)
@@ -124,6 +165,78 @@ func TestFileAuditObserver_AppendsLines(t *testing.T) {
 	}
 }
 
+func TestChainedFileAuditObserver_ResumesChain(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg := AuditChainConfig{
+		Chain:           auditchain.Chain{Mode: auditchain.ModeHMAC, Key: []byte("secret")},
+		Signer:          key,
+		CheckpointEvery: 2,
+	}
+
+	// Two server runs: the second continues the first one's chain, and
+	// Close covers the tail with a checkpoint.
+	for run := 0; run < 2; run++ {
+		obs, err := NewChainedFileAuditObserver(path, cfg, &testLogger{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			obs.Notify(AuditEvent{Ts: int64(run*3 + i), Metrics: []string{"m"}, IPAddress: "1.1.1.1"})
+		}
+		if err := obs.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rep, err := auditchain.Verify(f, cfg.Chain, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Records != 6 || rep.Unprotected != 0 || rep.Signed != rep.Checkpoints {
+		t.Errorf("report = %+v", rep)
+	}
+}
+
+func TestNewAuditObservers_ReusesFileObserver(t *testing.T) {
+	cfg := &Config{AuditFile: filepath.Join(t.TempDir(), "audit.log"), AuditChain: auditchain.ModeSHA256}
+	logger := &testLogger{}
+
+	first, err := newAuditObservers(cfg, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reload keeps the open file: a second writer would fork the chain
+	// from the same tail.
+	next, err := newAuditObservers(cfg, first, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0] != first[0] {
+		t.Fatalf("file observer was reopened: %v -> %v", first, next)
+	}
+	closeAuditObservers(first, logger, next...)
+	next[0].Notify(AuditEvent{Ts: 1, Metrics: []string{"m"}})
+	closeAuditObservers(next, logger)
+
+	data, err := os.ReadFile(cfg.AuditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec auditchain.Record
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Seq != 1 {
+		t.Errorf("expected a chained record, got %s (%v)", data, err)
+	}
+}
+
 func TestHTTPAuditObserver_Notify(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockLog := NewMockLogger(ctrl)
@@ -1,30 +1,145 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"os"
+	"fmt"
+	"io"
+	"net/url"
 	"strconv"
 	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/auditchain"
+	"github.com/zheki1/yaprmtrc/internal/config"
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/netutil"
+	"github.com/zheki1/yaprmtrc/internal/security"
+	"github.com/zheki1/yaprmtrc/internal/staleness"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 )
 
-// Config хранит конфигурацию сервера: адрес, интервалы сохранения,
-// путь к хранилищу, DSN базы данных и параметры аудита.
+// Config хранит конфигурацию сервера; источники и их приоритет описаны в LoadConfig.
 type Config struct {
-	Address         string
-	StoreInterval   time.Duration
-	FileStoragePath string
-	Restore         bool
-	DatabaseDSN     string
-	Key             string
-	AuditFile       string
-	AuditURL        string
-	CryptoKey       string
+	Address         string        // адрес HTTP-сервера
+	StoreInterval   time.Duration // период сохранения в файл; 0 — синхронно
+	FileStoragePath string        // файл для сохранения метрик
+	Restore         bool          // восстановить метрики из файла при старте
+	DatabaseDSN     string        // DSN PostgreSQL; пусто — хранилище в памяти
+	Key             string        // ключ подписи HMAC-SHA256
+	CryptoKey       string        // путь к приватному ключу для расшифровки тел запросов
+
+	AuditFile       string        // файл журнала аудита
+	AuditURL        string        // адрес получателя аудита
+	AuditQueueSize  int           // ёмкость очереди аудита; 0 — доставка в обработчике
+	AuditWorkers    int           // число воркеров доставки аудита
+	AuditOverflow   string        // политика переполнения очереди: block, drop-oldest, spill
+	AuditSpillFile  string        // файл переполнения для spill
+	AuditFlush      time.Duration // сколько ждать доставки очереди при завершении
+	AuditChain      string        // цепочка записей аудита: sha256, hmac или пусто
+	AuditChainKey   string        // ключ HMAC для цепочки
+	AuditSigningKey string        // путь к приватному ключу RSA для контрольных точек
+	AuditCheckpoint int           // записей между контрольными точками
+
+	HistorySize    int    // значений на метрику для веб-интерфейса; 0 — без истории
+	AlertRules     string // файл правил оповещений
+	RecordingRules string // файл правил записи
+
+	TenantHeader   string  // заголовок с арендатором; пусто — не читается
+	AuthTokens     string  // файл API-токенов
+	TenantTokens   string  // устаревший синоним AuthTokens
+	AuthDB         bool    // хранить API-токены в БД
+	TrustedSubnet  string  // подсети агентов, которым разрешена запись
+	TrustedProxies string  // прокси, чьим X-Forwarded-For можно верить
+	RateLimitRPS   float64 // запросов в секунду на клиента; 0 — без ограничения
+	RateLimitBurst int     // допустимый всплеск запросов; 0 — RPS с округлением вверх
+
+	MaxBodySize     int64 // размер тела запроса в байтах; 0 — без ограничения
+	MaxDecompressed int64 // размер тела после распаковки; 0 — без ограничения
+	MaxBatchSize    int   // метрик в пакете; 0 — без ограничения
+	MaxSeries       int   // серий по всем арендаторам; 0 — без ограничения
+	MaxNewSeries    int   // новых серий на клиента в минуту; 0 — без ограничения
+
+	StaleTTL      time.Duration // через сколько без обновлений серия устаревает; 0 — никогда
+	StaleRules    string        // TTL для отдельных метрик и префиксов
+	StaleDelete   bool          // удалять устаревшие серии, а не помечать
+	StaleInterval time.Duration // период поиска устаревших серий
+	ShutdownDelay time.Duration // сколько /readyz отвечает 503 перед остановкой
+
+	TLSCert     string // сертификат TLS; включает HTTPS
+	TLSKey      string // приватный ключ TLS
+	TLSClientCA string // CA клиентских сертификатов; CN сертификата — арендатор
+
+	LogLevel      string // уровень журнала
+	LogFormat     string // json или console
+	LogFile       string // файл журнала; пусто — stderr
+	LogMaxSize    int    // размер файла журнала в МБ до ротации; 0 — без ротации
+	LogMaxBackups int    // сколько ротированных файлов хранить
+	TraceFile     string // файл для спанов в OTLP/JSON
+	TraceEndpoint string // адрес OTLP/HTTP для выгрузки спанов
+
+	ConfigFile  string // путь к файлу конфигурации (-c, CONFIG)
+	PrintConfig bool   // вывести действующую конфигурацию и выйти
 }
 
-// LoadConfig читает конфигурацию из флагов командной строки и переменных окружения.
-// Переменные окружения имеют приоритет над флагами.
-func LoadConfig(logger Logger) *Config {
-	cfg := &Config{
+// configOptions связывает флаги сервера с ключами файла конфигурации и
+// переменными окружения. STORE_INTERVAL задаётся в секундах и разбирается
+// отдельно, поэтому у store_interval нет переменной окружения в таблице.
+var configOptions = []config.Option{
+	{Key: "address", Flag: "a", Env: "ADDRESS"},
+	{Key: "store_interval", Flag: "i"},
+	{Key: "file_storage_path", Flag: "f", Env: "FILE_STORAGE_PATH"},
+	{Key: "restore", Flag: "r", Env: "RESTORE"},
+	{Key: "database_dsn", Flag: "d", Env: "DATABASE_DSN", Secret: true},
+	{Key: "key", Flag: "k", Env: "KEY", Secret: true},
+	{Key: "audit_file", Flag: "audit-file", Env: "AUDIT_FILE"},
+	{Key: "audit_url", Flag: "audit-url", Env: "AUDIT_URL"},
+	{Key: "audit_queue_size", Flag: "audit-queue-size", Env: "AUDIT_QUEUE_SIZE"},
+	{Key: "audit_workers", Flag: "audit-workers", Env: "AUDIT_WORKERS"},
+	{Key: "audit_overflow", Flag: "audit-overflow", Env: "AUDIT_OVERFLOW"},
+	{Key: "audit_spill_file", Flag: "audit-spill-file", Env: "AUDIT_SPILL_FILE"},
+	{Key: "audit_flush_timeout", Flag: "audit-flush-timeout", Env: "AUDIT_FLUSH_TIMEOUT"},
+	{Key: "audit_chain", Flag: "audit-chain", Env: "AUDIT_CHAIN"},
+	{Key: "audit_chain_key", Flag: "audit-chain-key", Env: "AUDIT_CHAIN_KEY", Secret: true},
+	{Key: "audit_signing_key", Flag: "audit-signing-key", Env: "AUDIT_SIGNING_KEY"},
+	{Key: "audit_checkpoint_every", Flag: "audit-checkpoint-every", Env: "AUDIT_CHECKPOINT_EVERY"},
+	{Key: "crypto_key", Flag: "crypto-key", Env: "CRYPTO_KEY"},
+	{Key: "history_size", Flag: "history-size", Env: "HISTORY_SIZE"},
+	{Key: "alert_rules", Flag: "alert-rules", Env: "ALERT_RULES"},
+	{Key: "recording_rules", Flag: "recording-rules", Env: "RECORDING_RULES"},
+	{Key: "tenant_header", Flag: "tenant-header", Env: "TENANT_HEADER"},
+	{Key: "auth_tokens", Flag: "auth-tokens", Env: "AUTH_TOKENS"},
+	{Key: "tenant_tokens", Flag: "tenant-tokens", Env: "TENANT_TOKENS"},
+	{Key: "auth_db", Flag: "auth-db", Env: "AUTH_DB"},
+	{Key: "trusted_subnet", Flag: "t", Env: "TRUSTED_SUBNET"},
+	{Key: "trusted_proxies", Flag: "trusted-proxies", Env: "TRUSTED_PROXIES"},
+	{Key: "rate_limit_rps", Flag: "rate-limit-rps", Env: "RATE_LIMIT_RPS"},
+	{Key: "rate_limit_burst", Flag: "rate-limit-burst", Env: "RATE_LIMIT_BURST"},
+	{Key: "max_body_size", Flag: "max-body-size", Env: "MAX_BODY_SIZE"},
+	{Key: "max_decompressed_size", Flag: "max-decompressed-size", Env: "MAX_DECOMPRESSED_SIZE"},
+	{Key: "max_batch_size", Flag: "max-batch-size", Env: "MAX_BATCH_SIZE"},
+	{Key: "max_series", Flag: "max-series", Env: "MAX_SERIES"},
+	{Key: "max_new_series_per_minute", Flag: "max-new-series-per-minute", Env: "MAX_NEW_SERIES_PER_MINUTE"},
+	{Key: "stale_ttl", Flag: "stale-ttl", Env: "STALE_TTL"},
+	{Key: "stale_rules", Flag: "stale-rules", Env: "STALE_RULES"},
+	{Key: "stale_delete", Flag: "stale-delete", Env: "STALE_DELETE"},
+	{Key: "stale_sweep_interval", Flag: "stale-sweep-interval", Env: "STALE_SWEEP_INTERVAL"},
+	{Key: "shutdown_drain_delay", Flag: "shutdown-drain-delay", Env: "SHUTDOWN_DRAIN_DELAY"},
+	{Key: "tls_cert", Flag: "tls-cert", Env: "TLS_CERT"},
+	{Key: "tls_key", Flag: "tls-key", Env: "TLS_KEY"},
+	{Key: "tls_client_ca", Flag: "tls-client-ca", Env: "TLS_CLIENT_CA"},
+	{Key: "log_level", Flag: "log-level", Env: "LOG_LEVEL"},
+	{Key: "log_format", Flag: "log-format", Env: "LOG_FORMAT"},
+	{Key: "log_file", Flag: "log-file", Env: "LOG_FILE"},
+	{Key: "log_max_size", Flag: "log-max-size", Env: "LOG_MAX_SIZE"},
+	{Key: "log_max_backups", Flag: "log-max-backups", Env: "LOG_MAX_BACKUPS"},
+	{Key: "trace_file", Flag: "trace-file", Env: "TRACE_FILE"},
+	{Key: "trace_endpoint", Flag: "trace-endpoint", Env: "TRACE_ENDPOINT"},
+}
+
+// defaultConfig возвращает конфигурацию по умолчанию.
+func defaultConfig() *Config {
+	return &Config{
 		Address:         "localhost:8080",
 		StoreInterval:   300 * time.Second,
 		FileStoragePath: "./metrics-recovery.json",
@@ -33,57 +148,266 @@ func LoadConfig(logger Logger) *Config {
 		Key:             "",
 		AuditFile:       "",
 		AuditURL:        "",
+		AuditQueueSize:  1000,
+		AuditWorkers:    4,
+		AuditOverflow:   AuditOverflowBlock,
+		AuditSpillFile:  "",
+		AuditFlush:      10 * time.Second,
+		AuditChain:      "",
+		AuditChainKey:   "",
+		AuditSigningKey: "",
+		AuditCheckpoint: 100,
 		CryptoKey:       "",
+		HistorySize:     history.DefaultSize,
+		AlertRules:      "",
+		RecordingRules:  "",
+		TenantHeader:    DefaultTenantHeader,
+		AuthTokens:      "",
+		TenantTokens:    "",
+		AuthDB:          false,
+		TrustedSubnet:   "",
+		TrustedProxies:  "",
+		RateLimitRPS:    0,
+		RateLimitBurst:  0,
+		MaxBodySize:     8 << 20,
+		MaxDecompressed: 32 << 20,
+		MaxBatchSize:    10000,
+		MaxSeries:       0,
+		MaxNewSeries:    0,
+		StaleTTL:        0,
+		StaleRules:      "",
+		StaleDelete:     false,
+		StaleInterval:   staleness.DefaultInterval,
+		ShutdownDelay:   0,
+		TLSCert:         "",
+		TLSKey:          "",
+		TLSClientCA:     "",
+		LogLevel:        "info",
+		LogFormat:       logging.EncodingJSON,
+		LogFile:         "",
+		LogMaxSize:      100,
+		LogMaxBackups:   3,
+		TraceFile:       "",
+		TraceEndpoint:   "",
 	}
+}
 
-	// flags
-	flag.StringVar(&cfg.Address, "a", cfg.Address, "server address")
-	flag.DurationVar(&cfg.StoreInterval, "i", cfg.StoreInterval, "store interval")
-	flag.StringVar(&cfg.FileStoragePath, "f", cfg.FileStoragePath, "file storage path")
-	flag.BoolVar(&cfg.Restore, "r", cfg.Restore, "restore from file")
-	flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "database dsn")
-	flag.StringVar(&cfg.Key, "k", cfg.Key, "Hash key")
-	flag.StringVar(&cfg.AuditFile, "audit-file", cfg.AuditFile, "audit log file path")
-	flag.StringVar(&cfg.AuditURL, "audit-url", cfg.AuditURL, "audit log remote URL")
-	flag.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "Path to private key file")
-	flag.Parse()
+// flagSet описывает флаги сервера, привязанные к полям c; значения по
+// умолчанию — текущие значения полей.
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&c.ConfigFile, config.FileFlag, c.ConfigFile, "path to JSON config file")
+	fs.BoolVar(&c.PrintConfig, "print-config", c.PrintConfig, "print the effective configuration with secrets redacted and exit")
+	fs.StringVar(&c.Address, "a", c.Address, "server address")
+	fs.DurationVar(&c.StoreInterval, "i", c.StoreInterval, "store interval")
+	fs.StringVar(&c.FileStoragePath, "f", c.FileStoragePath, "file storage path")
+	fs.BoolVar(&c.Restore, "r", c.Restore, "restore from file")
+	fs.StringVar(&c.DatabaseDSN, "d", c.DatabaseDSN, "database dsn")
+	fs.StringVar(&c.Key, "k", c.Key, "Hash key")
+	fs.StringVar(&c.AuditFile, "audit-file", c.AuditFile, "audit log file path")
+	fs.StringVar(&c.AuditURL, "audit-url", c.AuditURL, "audit log remote URL")
+	fs.IntVar(&c.AuditQueueSize, "audit-queue-size", c.AuditQueueSize, "audit queue capacity (0 delivers audit events synchronously)")
+	fs.IntVar(&c.AuditWorkers, "audit-workers", c.AuditWorkers, "number of audit delivery workers")
+	fs.StringVar(&c.AuditOverflow, "audit-overflow", c.AuditOverflow, "what to do when the audit queue is full: block, drop-oldest or spill")
+	fs.StringVar(&c.AuditSpillFile, "audit-spill-file", c.AuditSpillFile, "file for audit events that do not fit into the queue (-audit-overflow=spill)")
+	fs.DurationVar(&c.AuditFlush, "audit-flush-timeout", c.AuditFlush, "how long to deliver queued audit events on shutdown")
+	fs.StringVar(&c.AuditChain, "audit-chain", c.AuditChain, "hash-chain audit file records: sha256 or hmac (empty disables)")
+	fs.StringVar(&c.AuditChainKey, "audit-chain-key", c.AuditChainKey, "HMAC key for -audit-chain=hmac")
+	fs.StringVar(&c.AuditSigningKey, "audit-signing-key", c.AuditSigningKey, "path to RSA private key that signs audit checkpoints")
+	fs.IntVar(&c.AuditCheckpoint, "audit-checkpoint-every", c.AuditCheckpoint, "write a signed audit checkpoint after this many records")
+	fs.StringVar(&c.CryptoKey, "crypto-key", c.CryptoKey, "Path to private key file")
+	fs.IntVar(&c.HistorySize, "history-size", c.HistorySize, "number of recent values kept per metric for the dashboard (0 disables)")
+	fs.StringVar(&c.AlertRules, "alert-rules", c.AlertRules, "path to alerting rules file (JSON)")
+	fs.StringVar(&c.RecordingRules, "recording-rules", c.RecordingRules, "path to recording rules file (JSON)")
+	fs.StringVar(&c.TenantHeader, "tenant-header", c.TenantHeader, "request header with the tenant ID (empty disables)")
+	fs.StringVar(&c.AuthTokens, "auth-tokens", c.AuthTokens, "path to API tokens file (JSON); enables bearer token auth")
+	fs.StringVar(&c.TenantTokens, "tenant-tokens", c.TenantTokens, "deprecated: use -auth-tokens")
+	fs.BoolVar(&c.AuthDB, "auth-db", c.AuthDB, "keep API tokens in the database (requires -d); enables bearer token auth")
+	fs.StringVar(&c.TrustedSubnet, "t", c.TrustedSubnet, "trusted agent subnets in CIDR notation, comma-separated (empty disables the check)")
+	fs.StringVar(&c.TrustedProxies, "trusted-proxies", c.TrustedProxies, "proxy subnets whose X-Forwarded-For header is trusted, comma-separated")
+	fs.Float64Var(&c.RateLimitRPS, "rate-limit-rps", c.RateLimitRPS, "requests per second allowed for each client (0 disables)")
+	fs.IntVar(&c.RateLimitBurst, "rate-limit-burst", c.RateLimitBurst, "burst of requests allowed for each client (0 — rate rounded up)")
+	fs.Int64Var(&c.MaxBodySize, "max-body-size", c.MaxBodySize, "max request body size in bytes as received (0 disables)")
+	fs.Int64Var(&c.MaxDecompressed, "max-decompressed-size", c.MaxDecompressed, "max request body size in bytes after gzip decompression (0 disables)")
+	fs.IntVar(&c.MaxBatchSize, "max-batch-size", c.MaxBatchSize, "max number of metrics in a batch (0 disables)")
+	fs.IntVar(&c.MaxSeries, "max-series", c.MaxSeries, "max number of series across all tenants (0 disables)")
+	fs.IntVar(&c.MaxNewSeries, "max-new-series-per-minute", c.MaxNewSeries, "max new series each client may create per minute (0 disables)")
+	fs.DurationVar(&c.StaleTTL, "stale-ttl", c.StaleTTL, "series not updated for this long become stale (0 disables)")
+	fs.StringVar(&c.StaleRules, "stale-rules", c.StaleRules, "per-metric or per-prefix TTL overrides, e.g. FreeMemory=10m,cpu*=5m")
+	fs.BoolVar(&c.StaleDelete, "stale-delete", c.StaleDelete, "delete stale series instead of marking them")
+	fs.DurationVar(&c.StaleInterval, "stale-sweep-interval", c.StaleInterval, "how often to look for stale series")
+	fs.DurationVar(&c.ShutdownDelay, "shutdown-drain-delay", c.ShutdownDelay, "how long /readyz reports 503 before the server stops accepting requests on shutdown")
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "path to TLS certificate (enables HTTPS)")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "path to TLS private key")
+	fs.StringVar(&c.TLSClientCA, "tls-client-ca", c.TLSClientCA, "path to CA bundle for client certificates; certificate CN is the tenant")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log encoding: json or console")
+	fs.StringVar(&c.LogFile, "log-file", c.LogFile, "log file path (empty logs to stderr)")
+	fs.IntVar(&c.LogMaxSize, "log-max-size", c.LogMaxSize, "rotate the log file after this many megabytes (0 disables)")
+	fs.IntVar(&c.LogMaxBackups, "log-max-backups", c.LogMaxBackups, "number of rotated log files to keep")
+	fs.StringVar(&c.TraceFile, "trace-file", c.TraceFile, "append trace spans to this file as OTLP/JSON")
+	fs.StringVar(&c.TraceEndpoint, "trace-endpoint", c.TraceEndpoint, "OTLP/HTTP endpoint to export trace spans to, e.g. http://localhost:4318")
+	return fs
+}
+
+// LoadConfig собирает конфигурацию из файла JSON (-c или CONFIG), флагов
+// командной строки args и переменных окружения lookupEnv; каждый следующий
+// источник важнее предыдущего. Возвращает все найденные ошибки разбора и
+// проверки сразу.
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := defaultConfig()
+	fs := cfg.flagSet()
+	err := config.Load(fs, configOptions, args, lookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, err
+	}
+	errs := []error{err}
 
-	// env priority
-	if v, ok := os.LookupEnv("ADDRESS"); ok {
-		cfg.Address = v
+	if fs.NArg() > 0 {
+		errs = append(errs, fmt.Errorf("unknown flags: %v", fs.Args()))
 	}
-	if v, ok := os.LookupEnv("STORE_INTERVAL"); ok {
+
+	if v, ok := lookupEnv("STORE_INTERVAL"); ok {
 		if sec, err := strconv.Atoi(v); err == nil {
 			cfg.StoreInterval = time.Duration(sec) * time.Second
 		} else {
-			logger.Fatalf("invalid REPORT_INTERVAL: %s", v)
+			errs = append(errs, fmt.Errorf("invalid STORE_INTERVAL: %s", v))
 		}
 	}
-	if v, ok := os.LookupEnv("FILE_STORAGE_PATH"); ok {
-		cfg.FileStoragePath = v
+
+	errs = append(errs, cfg.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
 	}
-	if v, ok := os.LookupEnv("RESTORE"); ok {
-		if b, err := strconv.ParseBool(v); err == nil {
-			cfg.Restore = b
-		} else {
-			logger.Fatalf("invalid RESTORE: %s", v)
+	return cfg, nil
+}
+
+// Validate проверяет значения параметров и их сочетания.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
 		}
 	}
-	if v, ok := os.LookupEnv("DATABASE_DSN"); ok {
-		cfg.DatabaseDSN = v
+
+	check(c.Address != "", "-a: server address is required")
+	check(c.StoreInterval >= 0, "-i: store interval must not be negative")
+	check(c.HistorySize >= 0, "-history-size must not be negative")
+	check(c.RateLimitRPS >= 0, "-rate-limit-rps must not be negative")
+	check(c.RateLimitBurst >= 0, "-rate-limit-burst must not be negative")
+	check(c.MaxBodySize >= 0, "-max-body-size must not be negative")
+	check(c.MaxDecompressed >= 0, "-max-decompressed-size must not be negative")
+	check(c.MaxBatchSize >= 0, "-max-batch-size must not be negative")
+	check(c.MaxSeries >= 0, "-max-series must not be negative")
+	check(c.MaxNewSeries >= 0, "-max-new-series-per-minute must not be negative")
+	check(c.StaleTTL >= 0, "-stale-ttl must not be negative")
+	check(c.StaleInterval > 0, "-stale-sweep-interval must be positive")
+	check(c.ShutdownDelay >= 0, "-shutdown-drain-delay must not be negative")
+
+	if _, err := staleness.ParseRules(c.StaleRules); err != nil {
+		errs = append(errs, fmt.Errorf("-stale-rules: %w", err))
 	}
-	if v, ok := os.LookupEnv("KEY"); ok {
-		cfg.Key = v
+	if _, err := netutil.ParseSubnets(c.TrustedSubnet); err != nil {
+		errs = append(errs, fmt.Errorf("-t: %w", err))
 	}
-	if v, ok := os.LookupEnv("AUDIT_FILE"); ok {
-		cfg.AuditFile = v
+	if _, err := netutil.ParseSubnets(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("-trusted-proxies: %w", err))
 	}
-	if v, ok := os.LookupEnv("AUDIT_URL"); ok {
-		cfg.AuditURL = v
+	check(c.AuditQueueSize >= 0, "-audit-queue-size must not be negative")
+	check(c.AuditWorkers > 0, "-audit-workers must be positive")
+	check(c.AuditFlush >= 0, "-audit-flush-timeout must not be negative")
+	switch c.AuditOverflow {
+	case AuditOverflowBlock, AuditOverflowDropOldest:
+	case AuditOverflowSpill:
+		check(c.AuditSpillFile != "", "-audit-overflow=spill requires -audit-spill-file")
+	default:
+		check(false, "-audit-overflow must be %s, %s or %s", AuditOverflowBlock, AuditOverflowDropOldest, AuditOverflowSpill)
 	}
-	if v, ok := os.LookupEnv("CRYPTO_KEY"); ok {
-		cfg.CryptoKey = v
+	if c.AuditChain != "" {
+		check(c.AuditFile != "", "-audit-chain requires -audit-file")
+		chain := auditchain.Chain{Mode: c.AuditChain, Key: []byte(c.AuditChainKey)}
+		if err := chain.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("-audit-chain: %w", err))
+		}
 	}
+	check(c.AuditSigningKey == "" || c.AuditChain != "", "-audit-signing-key requires -audit-chain")
+	check(c.AuditCheckpoint > 0, "-audit-checkpoint-every must be positive")
+	if c.AuditURL != "" {
+		u, err := url.Parse(c.AuditURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"-audit-url must be an http or https URL")
+	}
+
+	check(!(c.AuthDB && c.AuthTokens != ""), "-auth-db and -auth-tokens are mutually exclusive")
+	check(c.TenantTokens == "" || (c.AuthTokens == "" && !c.AuthDB),
+		"-tenant-tokens is a deprecated alias of -auth-tokens and cannot be combined with -auth-tokens or -auth-db")
+	check(!c.AuthDB || c.DatabaseDSN != "", "-auth-db requires a database (-d)")
+	check((c.TLSCert == "") == (c.TLSKey == ""), "-tls-cert and -tls-key must be set together")
+	if err := c.logOptions().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.traceOptions().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	check(c.TLSClientCA == "" || c.TLSCert != "", "-tls-client-ca requires -tls-cert and -tls-key")
+
+	return errors.Join(errs...)
+}
+
+// logOptions возвращает параметры журнала.
+func (c *Config) logOptions() logging.Options {
+	return logging.Options{
+		Level:      c.LogLevel,
+		Encoding:   c.LogFormat,
+		File:       c.LogFile,
+		MaxSizeMB:  c.LogMaxSize,
+		MaxBackups: c.LogMaxBackups,
+	}
+}
+
+// auditQueueConfig возвращает параметры очереди аудита.
+func (c *Config) auditQueueConfig() AuditQueueConfig {
+	return AuditQueueConfig{
+		Size:      c.AuditQueueSize,
+		Workers:   c.AuditWorkers,
+		Overflow:  c.AuditOverflow,
+		SpillFile: c.AuditSpillFile,
+	}
+}
+
+// auditChainConfig возвращает параметры цепочки файла аудита и загружает
+// ключ подписи контрольных точек.
+func (c *Config) auditChainConfig() (AuditChainConfig, error) {
+	cfg := AuditChainConfig{
+		Chain:           auditchain.Chain{Mode: c.AuditChain, Key: []byte(c.AuditChainKey)},
+		CheckpointEvery: c.AuditCheckpoint,
+	}
+	if c.AuditSigningKey != "" {
+		key, err := security.LoadPrivateKey(c.AuditSigningKey)
+		if err != nil {
+			return cfg, fmt.Errorf("-audit-signing-key: %w", err)
+		}
+		cfg.Signer = key
+	}
+	return cfg, nil
+}
+
+// traceOptions возвращает параметры выгрузки трасс.
+func (c *Config) traceOptions() tracing.Options {
+	return tracing.Options{Service: "yaprmtrc-server", File: c.TraceFile, Endpoint: c.TraceEndpoint}
+}
+
+// diff возвращает ключи конфигурации, значения которых в other отличаются.
+func (c *Config) diff(other *Config) []string {
+	a, b := *c, *other
+	return config.Diff(a.flagSet(), b.flagSet(), configOptions)
+}
 
-	return cfg
+// Print выводит действующую конфигурацию в формате файла конфигурации,
+// скрывая ключ подписи и пароль базы данных.
+func (c *Config) Print(w io.Writer) error {
+	cp := *c
+	return config.PrintJSON(w, cp.flagSet(), configOptions)
 }
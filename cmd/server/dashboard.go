@@ -0,0 +1,238 @@
+package main
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+	"github.com/zheki1/yaprmtrc/web"
+)
+
+// Размеры области графика на странице метрики (в единицах viewBox).
+// Совпадают с SPARK_WIDTH и SPARK_HEIGHT в web/static/app.js.
+const (
+	sparkWidth  = 600
+	sparkHeight = 120
+)
+
+var dashboardTpl = template.Must(template.ParseFS(web.Templates, "*.html"))
+
+// MetricRow представляет строку таблицы на HTML-странице списка метрик.
+// Устаревшие серии (Stale) выделяются в таблице.
+type MetricRow struct {
+	Name      string
+	Type      string
+	Value     string
+	UpdatedAt string
+	Stale     bool
+}
+
+func metricRow(m models.Metrics) MetricRow {
+	row := MetricRow{Name: m.ID, Type: m.MType, Value: formatValue(m), Stale: m.Stale}
+	if m.UpdatedAt != nil {
+		row.UpdatedAt = m.UpdatedAt.Format(time.RFC3339)
+	}
+	return row
+}
+
+// pageHeader — общие данные шапки страниц: арендатор, чьи метрики
+// показаны, и заголовок, которым app.js передаёт его в API.
+type pageHeader struct {
+	Title        string
+	Page         string
+	Tenant       string
+	TenantHeader string
+}
+
+func (s *Server) pageHeader(r *http.Request, title, page string) pageHeader {
+	h := pageHeader{Title: title, Page: page, Tenant: tenant.FromContext(r.Context())}
+	if s.tenants != nil {
+		h.TenantHeader = s.tenants.Header
+	}
+	return h
+}
+
+// dashboardPage — данные шаблона index.html.
+type dashboardPage struct {
+	pageHeader
+	Rows []MetricRow
+}
+
+// labelRow — метка метрики для шаблона metric.html.
+type labelRow struct {
+	Key   string
+	Value string
+}
+
+// metricPage — данные шаблона metric.html.
+type metricPage struct {
+	pageHeader
+	Metric  MetricRow
+	Labels  []labelRow
+	Enabled bool
+	Width   int
+	Height  int
+	Points  string
+	Min     string
+	Max     string
+	Samples int
+}
+
+func formatValue(m models.Metrics) string {
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	case m.MType == models.Counter && m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	}
+	return ""
+}
+
+func (s *Server) renderPage(w http.ResponseWriter, r *http.Request, name string, data any) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	if err := dashboardTpl.ExecuteTemplate(w, name, data); err != nil {
+		s.logError(r, "failed to render template", err)
+	}
+}
+
+// pageHandler отдаёт страницу со списком метрик. Таблица отрисовывается на
+// сервере, а поиск, сортировку, группировку и автообновление добавляет app.js.
+func (s *Server) pageHandler(w http.ResponseWriter, r *http.Request) {
+	metrics, err := s.storage.GetAll(r.Context())
+
+	if err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+
+	rows := make([]MetricRow, 0, len(metrics))
+	for _, ms := range metrics {
+		rows = append(rows, metricRow(ms))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rowLess(rows[i], rows[j])
+	})
+
+	s.renderPage(w, r, "index.html", dashboardPage{pageHeader: s.pageHeader(r, "Metrics", "list"), Rows: rows})
+}
+
+func rowLess(a, b MetricRow) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Type < b.Type
+}
+
+// metricPageHandler отдаёт страницу одной метрики с графиком последних значений,
+// если на сервере включён сбор истории.
+func (s *Server) metricPageHandler(w http.ResponseWriter, r *http.Request) {
+	mType, name, ok := metricPath(w, r)
+	if !ok {
+		return
+	}
+
+	m, found, err := s.lookupMetric(r.Context(), mType, name)
+	if err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+	if !found {
+		metricNotFound(w, r)
+		return
+	}
+
+	page := metricPage{
+		pageHeader: s.pageHeader(r, name+" — Metrics", "metric"),
+		Metric:     metricRow(m),
+		Enabled:    s.history != nil,
+		Width:      sparkWidth,
+		Height:     sparkHeight,
+	}
+
+	if len(m.Labels) > 0 {
+		for k, v := range m.Labels {
+			page.Labels = append(page.Labels, labelRow{k, v})
+		}
+		sort.Slice(page.Labels, func(i, j int) bool { return page.Labels[i].Key < page.Labels[j].Key })
+	}
+
+	if s.history != nil {
+		samples := s.history.Get(r.Context(), mType, name)
+		page.Samples = len(samples)
+		page.Points = sparklinePoints(samples, sparkWidth, sparkHeight)
+		if len(samples) > 0 {
+			lo, hi := sampleRange(samples)
+			page.Min = strconv.FormatFloat(lo, 'f', -1, 64)
+			page.Max = strconv.FormatFloat(hi, 'f', -1, 64)
+		}
+	}
+
+	s.renderPage(w, r, "metric.html", page)
+}
+
+func sampleRange(samples []history.Sample) (lo, hi float64) {
+	lo, hi = samples[0].V, samples[0].V
+	for _, s := range samples[1:] {
+		lo = min(lo, s.V)
+		hi = max(hi, s.V)
+	}
+	return lo, hi
+}
+
+// sparklinePoints переводит точки истории в координаты атрибута points
+// элемента <polyline> в области width×height. Ось Y направлена вниз,
+// постоянный ряд рисуется горизонтальной линией посередине.
+func sparklinePoints(samples []history.Sample, width, height float64) string {
+	if len(samples) == 0 {
+		return ""
+	}
+
+	lo, hi := sampleRange(samples)
+	span := hi - lo
+
+	var step float64
+	if len(samples) > 1 {
+		step = width / float64(len(samples)-1)
+	}
+
+	var b strings.Builder
+	for i, s := range samples {
+		y := height / 2
+		if span != 0 {
+			y = height - (s.V-lo)/span*height
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.FormatFloat(float64(i)*step, 'f', 1, 64))
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatFloat(y, 'f', 1, 64))
+	}
+	return b.String()
+}
+
+// staticHandler отдаёт встроенные стили и скрипты веб-интерфейса.
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "file")
+	if name != path.Base(name) {
+		notFoundHandler(w, r)
+		return
+	}
+	if _, err := fs.Stat(web.Static, name); err != nil {
+		notFoundHandler(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeFileFS(w, r, web.Static, name)
+}
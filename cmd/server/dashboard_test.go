@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/web"
+)
+
+func newDashboardServer() (*Server, http.Handler) {
+	s, _ := newTestServerWithRouter()
+	s.history = history.NewStore(10)
+	s.storage = history.Wrap(s.storage, s.history)
+	return s, router(s)
+}
+
+func get(h http.Handler, url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	return w
+}
+
+func TestDashboard_IndexSortedWithControls(t *testing.T) {
+	s, h := newDashboardServer()
+	ctx := context.Background()
+	_ = s.storage.UpdateGauge(ctx, "b.gauge", 2)
+	_ = s.storage.UpdateCounter(ctx, "a.count", 5)
+
+	w := get(h, "/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{`id="search"`, `id="group"`, `id="refresh"`, `data-sort="value"`, `/static/app.js`} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("page has no %s", want)
+		}
+	}
+	a := strings.Index(body, `href="/metric/counter/a.count"`)
+	b := strings.Index(body, `href="/metric/gauge/b.gauge"`)
+	if a < 0 || b < 0 || a > b {
+		t.Fatalf("rows must be rendered sorted by name: %s", body)
+	}
+}
+
+func TestDashboard_MetricPageSparkline(t *testing.T) {
+	s, h := newDashboardServer()
+	ctx := context.Background()
+	for _, v := range []float64{1, 3, 2} {
+		_ = s.storage.UpdateGauge(ctx, "Alloc", v)
+	}
+
+	w := get(h, "/metric/gauge/Alloc")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `points="0.0,120.0 300.0,0.0 600.0,60.0"`) {
+		t.Fatalf("sparkline is not rendered: %s", w.Body.String())
+	}
+
+	w = get(h, "/api/v1/metrics/gauge/Alloc/history")
+	var res struct {
+		Samples []history.Sample `json:"samples"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Samples) != 3 || res.Samples[2].V != 2 {
+		t.Fatalf("unexpected history: %s", w.Body.String())
+	}
+
+	if w := get(h, "/metric/gauge/Missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown metric, got %d", w.Code)
+	}
+}
+
+func TestDashboard_MetricPageWithoutHistory(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	_ = s.storage.UpdateGauge(context.Background(), "Alloc", 1)
+
+	w := get(h, "/metric/gauge/Alloc")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "History is not collected") {
+		t.Fatalf("unexpected page: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDashboard_StaticAssetsAreOffline(t *testing.T) {
+	_, h := newTestServerWithRouter()
+
+	w := get(h, "/static/app.js")
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Fatalf("app.js: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := get(h, "/static/missing.js"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown asset, got %d", w.Code)
+	}
+
+	external := regexp.MustCompile(`(src|href)="(https?:)?//`)
+	for _, fsys := range []fs.FS{web.Templates, web.Static} {
+		err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			if external.Match(data) || strings.Contains(string(data), "url(http") {
+				t.Errorf("%s references an external resource", p)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSparklinePoints(t *testing.T) {
+	at := time.Unix(0, 0)
+	tests := []struct {
+		name    string
+		samples []float64
+		want    string
+	}{
+		{"empty", nil, ""},
+		{"single", []float64{5}, "0.0,5.0"},
+		{"flat", []float64{7, 7, 7}, "0.0,5.0 5.0,5.0 10.0,5.0"},
+		{"rising", []float64{0, 10}, "0.0,10.0 10.0,0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := make([]history.Sample, len(tt.samples))
+			for i, v := range tt.samples {
+				samples[i] = history.Sample{T: at, V: v}
+			}
+			if got := sparklinePoints(samples, 10, 10); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	v := 1.5
+	d := int64(3)
+	if got := formatValue(models.Metrics{MType: models.Gauge, Value: &v}); got != "1.5" {
+		t.Fatalf("gauge: %q", got)
+	}
+	if got := formatValue(models.Metrics{MType: models.Counter, Delta: &d}); got != "3" {
+		t.Fatalf("counter: %q", got)
+	}
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"time"
 
-	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
 )
 
 // FileStorage обеспечивает сохранение и восстановление метрик в JSON-файл для переживания перезапусков.
+// Метрики всех арендаторов хранятся в одном файле; у метрик арендатора
+// по умолчанию поле tenant опускается, так что старые файлы остаются совместимыми.
 type FileStorage struct {
 	path string
 }
@@ -18,7 +22,19 @@ func NewFileStorage(path string) *FileStorage {
 }
 
 // Save сериализует срез метрик в JSON и записывает в файл.
-func (fs *FileStorage) Save(metrics []models.Metrics) (err error) {
+// Результат и длительность записи учитываются в показателях file_storage_*.
+func (fs *FileStorage) Save(metrics []repository.TenantMetrics) (err error) {
+	start := time.Now()
+	defer func() {
+		fileSaveSeconds.ObserveSince(start)
+		if err != nil {
+			fileSaves.With("error").Inc()
+			return
+		}
+		fileSaves.With("ok").Inc()
+		fileSaveMetrics.Set(int64(len(metrics)))
+	}()
+
 	file, err := os.Create(fs.path)
 	if err != nil {
 		return err
@@ -40,8 +56,31 @@ func (fs *FileStorage) Save(metrics []models.Metrics) (err error) {
 	return nil
 }
 
+// CheckWritable проверяет, что файл можно записать, не изменяя его:
+// существующий файл открывается на запись, иначе в его каталоге
+// создаётся и сразу удаляется временный файл.
+func (fs *FileStorage) CheckWritable() error {
+	f, err := os.OpenFile(fs.path, os.O_WRONLY, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
 // Load читает метрики из JSON-файла.
-func (fs *FileStorage) Load() (metrics []models.Metrics, err error) {
+func (fs *FileStorage) Load() (metrics []repository.TenantMetrics, err error) {
 	file, err := os.Open(fs.path)
 	if err != nil {
 		return nil, err
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
 )
 
 func TestFileStorage_SaveAndLoad(t *testing.T) {
@@ -15,9 +18,9 @@ func TestFileStorage_SaveAndLoad(t *testing.T) {
 
 	v := 1.5
 	d := int64(10)
-	metrics := []models.Metrics{
-		{ID: "Alloc", MType: models.Gauge, Value: &v},
-		{ID: "PollCount", MType: models.Counter, Delta: &d},
+	metrics := []repository.TenantMetrics{
+		{Metrics: models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &v}},
+		{Tenant: "team-a", Metrics: models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &d}},
 	}
 
 	if err := fs.Save(metrics); err != nil {
@@ -35,13 +38,31 @@ func TestFileStorage_SaveAndLoad(t *testing.T) {
 
 	found := false
 	for _, m := range loaded {
-		if m.ID == "Alloc" && m.MType == models.Gauge && *m.Value == 1.5 {
+		if m.ID == "Alloc" && m.MType == models.Gauge && *m.Value == 1.5 && m.TenantOf() == tenant.Default {
 			found = true
 		}
 	}
 	if !found {
 		t.Fatal("expected Alloc gauge metric")
 	}
+	if loaded[1].Tenant != "team-a" {
+		t.Fatalf("expected PollCount of team-a, got %+v", loaded[1])
+	}
+}
+
+func TestFileStorage_Load_LegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	if err := os.WriteFile(path, []byte(`[{"id":"Alloc","type":"gauge","value":1}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewFileStorage(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].ID != "Alloc" || loaded[0].TenantOf() != tenant.Default {
+		t.Fatalf("unexpected metrics: %+v", loaded)
+	}
 }
 
 func TestFileStorage_Load_MissingFile(t *testing.T) {
@@ -56,7 +77,7 @@ func TestFileStorage_Load_MissingFile(t *testing.T) {
 func TestFileStorage_Save_InvalidPath(t *testing.T) {
 	fs := NewFileStorage("/nonexistent/dir/metrics.json")
 
-	err := fs.Save([]models.Metrics{})
+	err := fs.Save([]repository.TenantMetrics{})
 	if err == nil {
 		t.Fatal("expected error when saving to invalid path")
 	}
@@ -4,8 +4,8 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
 	"net/http"
 	"strconv"
@@ -14,62 +14,166 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/zheki1/yaprmtrc/internal/cardinality"
 	"github.com/zheki1/yaprmtrc/internal/models"
 	"github.com/zheki1/yaprmtrc/internal/security"
+	"github.com/zheki1/yaprmtrc/internal/validation"
 )
 
-func (s *Server) valueHandlerJSON(w http.ResponseWriter, r *http.Request) {
+// readPayload проверяет Content-Type, распаковывает gzip и при заголовке
+// Encrypted: true расшифровывает тело запроса. Распакованное тело не может
+// быть больше maxDecompressedSize — защита от gzip-бомб. При ошибке
+// отправляет клиенту problem+json и возвращает false.
+func (s *Server) readPayload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
 	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
-		http.Error(w, "content type must be application/json", http.StatusBadRequest)
-		return
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidContentType,
+			"content type must be application/json"), nil)
+		return nil, false
 	}
 
+	defer func() {
+		if err := r.Body.Close(); err != nil {
+			s.logError(r, "failed to close request body", err)
+		}
+	}()
+
 	var reader io.Reader = r.Body
 	if r.Header.Get("Content-Encoding") == "gzip" {
 		gzr, err := gzip.NewReader(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidEncoding,
+				"request body is not valid gzip"), err)
+			return nil, false
 		}
 		defer func() {
 			if err := gzr.Close(); err != nil {
-				s.logger.Error("failed to close gzip reader", err.Error())
+				s.logError(r, "failed to close gzip reader", err)
 			}
 		}()
 		reader = gzr
 	}
 
+	buf, err := readLimited(reader, s.maxDecompressedSize)
+	if err != nil {
+		writeProblem(w, r, bodyReadProblem(err, codeInvalidEncoding), err)
+		return nil, false
+	}
+
+	if r.Header.Get("Encrypted") == "true" {
+		cryptoKey := s.settings().cryptoKey
+		if cryptoKey == "" {
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, codeEncryptionRequired,
+				"encrypted payload received but server has no private key"), nil)
+			return nil, false
+		}
+		privKey, err := security.LoadPrivateKey(cryptoKey)
+		if err != nil {
+			writeProblem(w, r, NewProblem(http.StatusInternalServerError, codeKeyUnavailable,
+				"failed to load private key"), err)
+			return nil, false
+		}
+		buf, err = security.DecryptHybrid(buf, privKey)
+		if err != nil {
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, codeDecryptFailed,
+				"failed to decrypt payload"), err)
+			return nil, false
+		}
+	}
+
+	return buf, true
+}
+
+// readLimited читает r целиком, но не более limit байт (limit <= 0 — без
+// ограничения); при превышении возвращает *http.MaxBytesError.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	return buf, nil
+}
+
+// decodeJSON разбирает тело запроса в v, отвечая invalid_json при ошибке.
+func decodeJSON(w http.ResponseWriter, r *http.Request, buf []byte, v any) bool {
+	if err := json.Unmarshal(buf, v); err != nil {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidJSON,
+			"request body is not valid JSON for this endpoint"), err)
+		return false
+	}
+	return true
+}
+
+// storageProblem отвечает на ошибку записи или чтения хранилища. Превышение
+// лимитов числа серий — ошибка клиента: 422 для общего лимита и 429 с
+// Retry-After для лимита новых серий в минуту.
+func storageProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var le *cardinality.LimitError
+	if errors.As(err, &le) {
+		if errors.Is(err, cardinality.ErrSeriesLimit) {
+			writeProblem(w, r, NewProblem(http.StatusUnprocessableEntity, codeSeriesLimit, le.Error()), nil)
+			return
+		}
+		setRetryAfter(w, le.RetryAfter)
+		writeProblem(w, r, NewProblem(http.StatusTooManyRequests, codeNewSeriesLimit, le.Error()), nil)
+		return
+	}
+	writeProblem(w, r, NewProblem(http.StatusInternalServerError, codeStorageError,
+		"storage operation failed"), err)
+}
+
+func metricNotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, NewProblem(http.StatusNotFound, codeMetricNotFound, "metric not found"), nil)
+}
+
+func (s *Server) valueHandlerJSON(w http.ResponseWriter, r *http.Request) {
+	buf, ok := s.readPayload(w, r)
+	if !ok {
+		return
+	}
+
 	var m models.Metrics
-	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&m); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, buf, &m) {
 		return
 	}
 
-	if m.ID == "" || m.MType == "" {
-		http.Error(w, "id and type are required", http.StatusBadRequest)
+	if err := validation.Name(m.ID); err != nil {
+		writeProblem(w, r, validationProblem(err), nil)
 		return
 	}
 
 	switch m.MType {
 	case models.Gauge:
-		value, ok, err := s.storage.GetGauge(context.Background(), m.ID)
-		if !ok || err != nil {
-			http.Error(w, "metric not found", http.StatusNotFound)
+		value, ok, err := s.storage.GetGauge(r.Context(), m.ID)
+		if err != nil {
+			storageProblem(w, r, err)
+			return
+		}
+		if !ok {
+			metricNotFound(w, r)
 			return
 		}
 		m.Value = &value
 
 	case models.Counter:
-		delta, ok, err := s.storage.GetCounter(context.Background(), m.ID)
-		if !ok || err != nil {
-			http.Error(w, "metric not found", http.StatusNotFound)
+		delta, ok, err := s.storage.GetCounter(r.Context(), m.ID)
+		if err != nil {
+			storageProblem(w, r, err)
+			return
+		}
+		if !ok {
+			metricNotFound(w, r)
 			return
 		}
 		m.Delta = &delta
 
 	default:
-		http.Error(w, "unknown metric type", http.StatusBadRequest)
+		writeProblem(w, r, validationProblem(validation.ErrUnknownType), nil)
 		return
 	}
 
@@ -77,111 +181,75 @@ func (s *Server) valueHandlerJSON(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(m); err != nil {
-		s.logger.Error("failed to encode response", err.Error())
+		s.logError(r, "failed to encode response", err)
 	}
 }
 
 func (s *Server) updateHandlerJSON(w http.ResponseWriter, r *http.Request) {
-	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
-		http.Error(w, "content type must be application/json", http.StatusBadRequest)
-		return
-	}
-
-	var reader io.Reader = r.Body
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		gzr, err := gzip.NewReader(r.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer func() {
-			if err := gzr.Close(); err != nil {
-				s.logger.Error("failed to close gzip reader", err.Error())
-			}
-		}()
-		reader = gzr
-	}
-	defer func() {
-		if err := r.Body.Close(); err != nil {
-			s.logger.Error("failed to close request body", err.Error())
-		}
-	}()
-
-	buf, err := io.ReadAll(reader)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	buf, ok := s.readPayload(w, r)
+	if !ok {
 		return
 	}
 
-	if r.Header.Get("Encrypted") == "true" {
-		if s.cryptoKey == "" {
-			http.Error(w, "encryption required but no private key", http.StatusBadRequest)
-			return
-		}
-		privKey, err := security.LoadPrivateKey(s.cryptoKey)
-		if err != nil {
-			http.Error(w, "failed to load private key", http.StatusInternalServerError)
-			return
-		}
-		buf, err = security.DecryptHybrid(buf, privKey)
-		if err != nil {
-			http.Error(w, "failed to decrypt payload", http.StatusBadRequest)
-			return
-		}
-	}
-
 	var m models.Metrics
-	if err := json.Unmarshal(buf, &m); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	defer func() { auditAttempt(r, m) }()
+	if !decodeJSON(w, r, buf, &m) {
 		return
 	}
 
-	if m.ID == "" || m.MType == "" {
-		http.Error(w, "id and type are required", http.StatusBadRequest)
+	if err := validation.Metric(m); err != nil {
+		writeProblem(w, r, validationProblem(err), nil)
 		return
 	}
 
-	switch m.MType {
-	case models.Gauge:
-		if m.Value == nil {
-			http.Error(w, "value is required", http.StatusBadRequest)
-			return
-		}
-		if err := s.storage.UpdateGauge(context.Background(), m.ID, *m.Value); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-	case models.Counter:
-		if m.Delta == nil {
-			http.Error(w, "delta is required", http.StatusBadRequest)
-			return
-		}
-		if err := s.storage.UpdateCounter(context.Background(), m.ID, *m.Delta); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-	default:
-		http.Error(w, "unknown metric type", http.StatusBadRequest)
+	if err := s.storeMetric(r.Context(), m); err != nil {
+		storageProblem(w, r, err)
 		return
 	}
 
 	s.saveIfNeeded()
-	s.notifyAudit(r, []string{m.ID})
+	auditChanged(r, m.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(m); err != nil {
-		s.logger.Error("failed to encode response", err.Error())
+		s.logError(r, "failed to encode response", err)
+	}
+}
+
+// storeMetric записывает одну проверенную метрику. Метрики с метками
+// записываются через UpdateBatch, так как только он сохраняет метки.
+func (s *Server) storeMetric(ctx context.Context, m models.Metrics) error {
+	if len(m.Labels) > 0 {
+		_, err := s.storage.UpdateBatch(ctx, []models.Metrics{m})
+		return err
+	}
+
+	switch m.MType {
+	case models.Gauge:
+		return s.storage.UpdateGauge(ctx, m.ID, *m.Value)
+	case models.Counter:
+		return s.storage.UpdateCounter(ctx, m.ID, *m.Delta)
 	}
+	return validation.ErrUnknownType
 }
 
 func (s *Server) updateHandler(w http.ResponseWriter, r *http.Request) {
 	mType := chi.URLParam(r, "type")
 	name := chi.URLParam(r, "name")
 	valueStr := chi.URLParam(r, "value")
+
+	// Значение попадает в аудит числом, если его удалось разобрать, иначе
+	// строкой из URL.
+	attempt := AuditValue{ID: name, MType: mType, Raw: valueStr}
+	defer func() { auditValue(r, attempt) }()
+
 	if name == "" {
-		http.Error(w, "Metric name not found", http.StatusNotFound)
+		writeProblem(w, r, NewProblem(http.StatusNotFound, codeMetricNotFound, "metric name is required"), nil)
+		return
+	}
+	if err := validation.Name(name); err != nil {
+		writeProblem(w, r, validationProblem(err), nil)
 		return
 	}
 
@@ -189,31 +257,37 @@ func (s *Server) updateHandler(w http.ResponseWriter, r *http.Request) {
 	case models.Gauge:
 		v, err := strconv.ParseFloat(valueStr, 64)
 		if err != nil {
-			http.Error(w, "invalid value", http.StatusBadRequest)
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidValue, "invalid value"), err)
+			return
+		}
+		attempt.Value, attempt.Raw = &v, ""
+		if err := validation.Gauge(v); err != nil {
+			writeProblem(w, r, validationProblem(err), nil)
 			return
 		}
-		err = s.storage.UpdateGauge(context.Background(), name, v)
+		err = s.storage.UpdateGauge(r.Context(), name, v)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			storageProblem(w, r, err)
 			return
 		}
 	case models.Counter:
 		delta, err := strconv.ParseInt(valueStr, 10, 64)
 		if err != nil {
-			http.Error(w, "invalid value", http.StatusBadRequest)
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidValue, "invalid value"), err)
 			return
 		}
-		err = s.storage.UpdateCounter(context.Background(), name, delta)
+		attempt.Delta, attempt.Raw = &delta, ""
+		err = s.storage.UpdateCounter(r.Context(), name, delta)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			storageProblem(w, r, err)
 			return
 		}
 	default:
-		http.Error(w, "unknown metric type", http.StatusBadRequest)
+		writeProblem(w, r, validationProblem(validation.ErrUnknownType), nil)
 		return
 	}
 
-	s.notifyAudit(r, []string{name})
+	auditChanged(r, name)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -224,93 +298,38 @@ func (s *Server) valueHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch mType {
 	case models.Gauge:
-		v, ok, err := s.storage.GetGauge(context.Background(), name)
+		v, ok, err := s.storage.GetGauge(r.Context(), name)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			storageProblem(w, r, err)
 			return
 		}
 		if ok {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprintf(w, "%g", v)
 			return
 		}
 	case models.Counter:
-		v, ok, err := s.storage.GetCounter(context.Background(), name)
+		v, ok, err := s.storage.GetCounter(r.Context(), name)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			storageProblem(w, r, err)
 			return
 		}
 		if ok {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprintf(w, "%d", v)
 			return
 		}
 	}
 
-	http.Error(w, "metric not found", http.StatusNotFound)
-}
-
-// MetricRow представляет строку таблицы на HTML-странице списка метрик.
-type MetricRow struct {
-	Name  string
-	Type  string
-	Value string
-}
-
-var pageTpl = template.Must(template.New("index").Parse(`
-<!DOCTYPE html>
-<html>
-<head><title>Metrics</title></head>
-<body>
-	<h1>Metrics</h1>
-	<table>
-		<tr>
-			<th>Name</th>
-			<th>Type</th>
-			<th>Value</th>
-		</tr>
-
-		{{range .}}
-		<tr>
-			<td>{{.Name}}</td>
-			<td>{{.Type}}</td>
-			<td>{{.Value}}</td>
-		</tr>
-		{{end}}
-		
-	</table>
-</body>
-</html>
-`))
-
-func (s *Server) pageHandler(w http.ResponseWriter, r *http.Request) {
-	metrics, err := s.storage.GetAll(context.Background())
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	rows := make([]MetricRow, 0, len(metrics))
-	for _, ms := range metrics {
-		switch ms.MType {
-		case models.Gauge:
-			rows = append(rows, MetricRow{ms.ID, ms.MType, strconv.FormatFloat(*ms.Value, 'f', -1, 64)})
-		case models.Counter:
-			rows = append(rows, MetricRow{ms.ID, ms.MType, strconv.FormatInt(*ms.Delta, 10)})
-		}
-	}
-
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	if err := pageTpl.Execute(w, rows); err != nil {
-		s.logger.Error("failed to render template", err.Error())
-	}
+	metricNotFound(w, r)
 }
 
 func (s *Server) pingHandler(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		http.Error(w, "database not configured", http.StatusInternalServerError)
+		writeProblem(w, r, NewProblem(http.StatusInternalServerError, codeDBNotConfigured,
+			"database not configured"), nil)
 		return
 	}
 
@@ -318,11 +337,8 @@ func (s *Server) pingHandler(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if err := s.db.Ping(ctx); err != nil {
-		s.logger.Error(
-			"database ping failed",
-			"error", err,
-		)
-		http.Error(w, "database unavailable", http.StatusInternalServerError)
+		writeProblem(w, r, NewProblem(http.StatusInternalServerError, codeDBUnavailable,
+			"database unavailable"), err)
 		return
 	}
 
@@ -330,79 +346,123 @@ func (s *Server) pingHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) batchUpdateHandler(w http.ResponseWriter, r *http.Request) {
-	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
-		http.Error(w, "content type must be application/json", http.StatusBadRequest)
+	buf, ok := s.readPayload(w, r)
+	if !ok {
 		return
 	}
 
-	var reader io.Reader = r.Body
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		gzr, err := gzip.NewReader(r.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer func() {
-			if err := gzr.Close(); err != nil {
-				s.logger.Error("failed to close gzip reader", err.Error())
-			}
-		}()
-		reader = gzr
+	var m []models.Metrics
+	defer func() { auditAttempt(r, m...) }()
+	if !decodeJSON(w, r, buf, &m) || !s.checkBatchSize(w, r, len(m)) {
+		return
 	}
-	defer func() {
-		if err := r.Body.Close(); err != nil {
-			s.logger.Error("failed to close request body", err.Error())
-		}
-	}()
 
-	buf, err := io.ReadAll(reader)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if r.URL.Query().Get("partial") == "true" {
+		s.applyBatchPartial(w, r, m)
 		return
 	}
 
-	if r.Header.Get("Encrypted") == "true" {
-		if s.cryptoKey == "" {
-			http.Error(w, "encryption required but no private key", http.StatusBadRequest)
-			return
-		}
-		privKey, err := security.LoadPrivateKey(s.cryptoKey)
-		if err != nil {
-			http.Error(w, "failed to load private key", http.StatusInternalServerError)
-			return
-		}
-		buf, err = security.DecryptHybrid(buf, privKey)
-		if err != nil {
-			http.Error(w, "failed to decrypt payload", http.StatusBadRequest)
-			return
-		}
+	if err := validation.Batch(m); err != nil {
+		writeProblem(w, r, validationProblem(err), err)
+		return
 	}
 
-	var m []models.Metrics
-	if err := json.Unmarshal(buf, &m); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if _, err := s.storage.UpdateBatch(r.Context(), m); err != nil {
+		storageProblem(w, r, err)
 		return
 	}
 
+	for i := range m {
+		auditChanged(r, m[i].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		s.logError(r, "failed to encode response", err)
+	}
+}
+
+// applyBatchPartial применяет корректные элементы пакета и отвечает списком
+// результатов по каждому элементу. Некорректные элементы отклоняются, не мешая
+// остальным. Статус ответа — 200, если применены все элементы, иначе 207.
+func (s *Server) applyBatchPartial(w http.ResponseWriter, r *http.Request, m []models.Metrics) {
 	if len(m) == 0 {
-		http.Error(w, "empty request body", http.StatusBadRequest)
+		writeProblem(w, r, validationProblem(validation.ErrEmptyBatch), nil)
 		return
 	}
 
-	if err := s.storage.UpdateBatch(context.Background(), m); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	results := make([]models.MetricResult, len(m))
+	valid := make([]models.Metrics, 0, len(m))
+	validIdx := make([]int, 0, len(m))
+
+	for i, mt := range m {
+		results[i] = models.MetricResult{Index: i, ID: mt.ID, MType: mt.MType}
+		if err := validation.Metric(mt); err != nil {
+			results[i].Status = models.StatusRejected
+			results[i].Error = err.Error()
+			continue
+		}
+		valid = append(valid, mt)
+		validIdx = append(validIdx, i)
 	}
 
-	names := make([]string, len(m))
-	for i := range m {
-		names[i] = m[i].ID
+	if len(valid) > 0 {
+		totals, err := s.storage.UpdateBatch(r.Context(), valid)
+		if err != nil {
+			status, detail := models.StatusFailed, "storage error"
+			var le *cardinality.LimitError
+			switch {
+			case errors.As(err, &le) && errors.Is(err, cardinality.ErrSeriesLimit):
+				status, detail = models.StatusRejected, le.Error()
+			case errors.As(err, &le):
+				detail = le.Error()
+				setRetryAfter(w, le.RetryAfter)
+			default:
+				s.logError(r, "partial batch update failed", err)
+			}
+			for _, i := range validIdx {
+				results[i].Status = status
+				results[i].Error = detail
+			}
+			valid = nil
+		} else {
+			fillBatchResults(results, m, validIdx, totals)
+		}
+	}
+
+	if len(valid) > 0 {
+		s.saveIfNeeded()
+		for i := range valid {
+			auditChanged(r, valid[i].ID)
+		}
+	}
+
+	status := http.StatusOK
+	if len(valid) != len(m) {
+		status = http.StatusMultiStatus
 	}
-	s.notifyAudit(r, names)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(m); err != nil {
-		s.logger.Error("failed to encode response", err.Error())
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.BatchResult{Results: results}); err != nil {
+		s.logError(r, "failed to encode response", err)
+	}
+}
+
+// fillBatchResults отмечает применённые элементы и проставляет значения
+// серий после обновления из totals — результата UpdateBatch: для gauge —
+// последнее значение из пакета, для counter — итог, записанный этим пакетом.
+func fillBatchResults(results []models.MetricResult, m []models.Metrics, applied []int, totals []models.Metrics) {
+	type key struct{ mType, id string }
+	byKey := make(map[key]models.Metrics, len(totals))
+	for _, t := range totals {
+		byKey[key{t.MType, t.ID}] = t
+	}
+
+	for _, i := range applied {
+		results[i].Status = models.StatusOK
+		t := byKey[key{m[i].MType, m[i].ID}]
+		results[i].Value, results[i].Delta = t.Value, t.Delta
 	}
 }
@@ -227,6 +227,99 @@ func TestBatchUpdateHandler(t *testing.T) {
 	}
 }
 
+func TestBatchUpdateHandler_InvalidItems(t *testing.T) {
+
+	s := newTestServer()
+
+	b := []byte(`[{"id":"A","type":"gauge","value":1},{"id":"x","type":"gauge"},{"id":"bad name","type":"counter","delta":1}]`)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/updates",
+		bytes.NewBuffer(b),
+	)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	s.batchUpdateHandler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Errors []struct {
+			Index int    `json:"index"`
+			ID    string `json:"id"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Errors) != 2 || body.Errors[0].Index != 1 || body.Errors[1].Index != 2 {
+		t.Fatalf("unexpected errors: %+v", body.Errors)
+	}
+
+	if _, ok, _ := s.storage.GetGauge(context.Background(), "A"); ok {
+		t.Fatal("batch with invalid items must not be applied")
+	}
+}
+
+func TestBatchUpdateHandler_Partial(t *testing.T) {
+
+	s := newTestServer()
+
+	_ = s.storage.UpdateCounter(context.Background(), "C", 10)
+
+	b := []byte(`[{"id":"A","type":"gauge","value":1.5},{"id":"x","type":"gauge"},{"id":"C","type":"counter","delta":5}]`)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/updates?partial=true",
+		bytes.NewBuffer(b),
+	)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	s.batchUpdateHandler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d", resp.StatusCode)
+	}
+
+	var res models.BatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(res.Results))
+	}
+
+	if r := res.Results[0]; r.Status != models.StatusOK || r.Value == nil || *r.Value != 1.5 {
+		t.Fatalf("unexpected gauge result: %+v", r)
+	}
+	if r := res.Results[1]; r.Status != models.StatusRejected || r.Error == "" {
+		t.Fatalf("unexpected rejected result: %+v", r)
+	}
+	if r := res.Results[2]; r.Status != models.StatusOK || r.Delta == nil || *r.Delta != 15 {
+		t.Fatalf("unexpected counter result: %+v", r)
+	}
+
+	if v, ok, _ := s.storage.GetGauge(context.Background(), "A"); !ok || v != 1.5 {
+		t.Fatal("valid gauge must be applied")
+	}
+}
+
 func TestPageHandler(t *testing.T) {
 
 	s := newTestServer()
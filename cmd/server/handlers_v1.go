@@ -0,0 +1,511 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zheki1/yaprmtrc/api"
+	"github.com/zheki1/yaprmtrc/internal/alerting"
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/query"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+	"github.com/zheki1/yaprmtrc/internal/validation"
+)
+
+// routesV1 регистрирует ресурсный API /api/v1. Контракт описан в api/openapi.json.
+// Роли маршрутов действуют, только если включена аутентификация по токенам.
+func routesV1(s *Server) func(r chi.Router) {
+	return func(r chi.Router) {
+		reader := s.requireRole(auth.RoleReader)
+		writer := s.writeAccess()
+		admin := s.requireRole(auth.RoleAdmin)
+
+		r.Get("/openapi.json", openAPIHandler)
+
+		r.With(reader).Get("/metrics", s.listMetricsV1)
+		r.With(writer).Post("/metrics:batch", s.batchMetricsV1)
+		r.With(reader).Get("/metrics/{type}/{name}", s.getMetricV1)
+		r.With(writer).Put("/metrics/{type}/{name}", s.putMetricV1)
+		r.With(admin).Delete("/metrics/{type}/{name}", s.deleteMetricV1)
+		r.With(reader).Get("/metrics/{type}/{name}/history", s.historyMetricV1)
+
+		r.With(reader).Get("/alerts", s.alertsV1)
+		r.With(reader).Get("/query", s.queryV1)
+
+		r.With(admin).Get("/admin/cardinality", s.cardinalityV1)
+		r.With(admin).Get("/admin/log-level", s.getLogLevelV1)
+		r.With(admin).Put("/admin/log-level", s.putLogLevelV1)
+	}
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(api.OpenAPI)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logError(r, "failed to encode response", err)
+	}
+}
+
+// lookupMetric читает текущее значение метрики из хранилища вместе
+// с временем обновления и признаком устаревания.
+func (s *Server) lookupMetric(ctx context.Context, mType, name string) (models.Metrics, bool, error) {
+	if err := validation.Type(mType); err != nil {
+		return models.Metrics{}, false, err
+	}
+	return s.storage.Get(ctx, mType, name)
+}
+
+// metricPath извлекает и проверяет тип и имя метрики из пути запроса.
+func metricPath(w http.ResponseWriter, r *http.Request) (mType, name string, ok bool) {
+	mType = chi.URLParam(r, "type")
+	name = chi.URLParam(r, "name")
+
+	if err := validation.Type(mType); err != nil {
+		writeProblem(w, r, validationProblem(err), nil)
+		return "", "", false
+	}
+	if err := validation.Name(name); err != nil {
+		writeProblem(w, r, validationProblem(err), nil)
+		return "", "", false
+	}
+	return mType, name, true
+}
+
+// listFields — поля метрики, допустимые в параметре fields.
+var listFields = map[string]bool{
+	"id": true, "type": true, "delta": true, "value": true, "labels": true,
+	"updated_at": true, "stale": true,
+}
+
+// metricsPage — тело ответа GET /api/v1/metrics.
+type metricsPage struct {
+	Metrics    any    `json:"metrics"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// parseListQuery разбирает параметры type, prefix, regex, label=key=value
+// (повторяемый), limit и cursor.
+func parseListQuery(r *http.Request) (repository.ListQuery, error) {
+	v := r.URL.Query()
+	q := repository.ListQuery{
+		Type:   v.Get("type"),
+		Prefix: v.Get("prefix"),
+		Cursor: v.Get("cursor"),
+	}
+
+	if q.Type != "" {
+		if err := validation.Type(q.Type); err != nil {
+			return q, err
+		}
+	}
+	if expr := v.Get("regex"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return q, fmt.Errorf("invalid regex: %w", err)
+		}
+		q.Regex = re
+	}
+	for _, l := range v["label"] {
+		k, val, ok := strings.Cut(l, "=")
+		if !ok || k == "" {
+			return q, fmt.Errorf("label filter must look like key=value, got %q", l)
+		}
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[k] = val
+	}
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > repository.MaxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", repository.MaxListLimit)
+		}
+		q.Limit = n
+	}
+
+	return q, nil
+}
+
+// parseFields разбирает параметр fields (список через запятую).
+// Пустой результат означает «все поля».
+func parseFields(r *http.Request) ([]string, error) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(raw, ",")
+	for i, f := range fields {
+		f = strings.TrimSpace(f)
+		if !listFields[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields[i] = f
+	}
+	return fields, nil
+}
+
+// project оставляет в метриках только запрошенные поля.
+func project(metrics []models.Metrics, fields []string) []map[string]any {
+	res := make([]map[string]any, len(metrics))
+	for i, m := range metrics {
+		obj := make(map[string]any, len(fields))
+		for _, f := range fields {
+			switch f {
+			case "id":
+				obj["id"] = m.ID
+			case "type":
+				obj["type"] = m.MType
+			case "delta":
+				if m.Delta != nil {
+					obj["delta"] = *m.Delta
+				}
+			case "value":
+				if m.Value != nil {
+					obj["value"] = *m.Value
+				}
+			case "labels":
+				if len(m.Labels) > 0 {
+					obj["labels"] = m.Labels
+				}
+			case "updated_at":
+				if m.UpdatedAt != nil {
+					obj["updated_at"] = m.UpdatedAt
+				}
+			case "stale":
+				obj["stale"] = m.Stale
+			}
+		}
+		res[i] = obj
+	}
+	return res
+}
+
+// listMetricsV1 отдаёт страницу метрик. Фильтрация и пагинация выполняются
+// хранилищем (Repository.List); обработчик только проецирует поля.
+func (s *Server) listMetricsV1(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidQuery, err.Error()), nil)
+		return
+	}
+	fields, err := parseFields(r)
+	if err != nil {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidQuery, err.Error()), nil)
+		return
+	}
+
+	page, err := s.storage.List(r.Context(), q)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidQuery, err.Error()), nil)
+		return
+	}
+	if err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+
+	resp := metricsPage{Metrics: page.Metrics, NextCursor: page.Next}
+	if fields != nil {
+		resp.Metrics = project(page.Metrics, fields)
+	}
+
+	s.writeJSON(w, r, http.StatusOK, resp)
+}
+
+func (s *Server) getMetricV1(w http.ResponseWriter, r *http.Request) {
+	mType, name, ok := metricPath(w, r)
+	if !ok {
+		return
+	}
+
+	m, found, err := s.lookupMetric(r.Context(), mType, name)
+	if err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+	if !found {
+		metricNotFound(w, r)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, m)
+}
+
+// putMetricV1 записывает значение метрики. Тело — объект с полем value (gauge)
+// или delta (counter); поля id и type, если заданы, должны совпадать с путём.
+// В ответе возвращается значение после обновления.
+func (s *Server) putMetricV1(w http.ResponseWriter, r *http.Request) {
+	// Тело дополняет имя и тип из пути; разобранное попадает в аудит при
+	// любом исходе.
+	m := models.Metrics{ID: chi.URLParam(r, "name"), MType: chi.URLParam(r, "type")}
+	defer func() { auditAttempt(r, m) }()
+
+	mType, name, ok := metricPath(w, r)
+	if !ok {
+		return
+	}
+
+	buf, ok := s.readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	if !decodeJSON(w, r, buf, &m) {
+		return
+	}
+	if (m.ID != "" && m.ID != name) || (m.MType != "" && m.MType != mType) {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeBadRequest,
+			"id and type in body must match the path"), nil)
+		return
+	}
+	m.ID, m.MType = name, mType
+
+	if err := validation.Metric(m); err != nil {
+		writeProblem(w, r, validationProblem(err), nil)
+		return
+	}
+
+	if err := s.storeMetric(r.Context(), m); err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+
+	s.saveIfNeeded()
+	auditChanged(r, name)
+
+	current, found, err := s.lookupMetric(r.Context(), mType, name)
+	if err != nil || !found {
+		current = m
+	}
+
+	s.writeJSON(w, r, http.StatusOK, current)
+}
+
+func (s *Server) batchMetricsV1(w http.ResponseWriter, r *http.Request) {
+	buf, ok := s.readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	var m []models.Metrics
+	defer func() { auditAttempt(r, m...) }()
+	if !decodeJSON(w, r, buf, &m) || !s.checkBatchSize(w, r, len(m)) {
+		return
+	}
+
+	s.applyBatchPartial(w, r, m)
+}
+
+func (s *Server) deleteMetricV1(w http.ResponseWriter, r *http.Request) {
+	auditAttempt(r, models.Metrics{ID: chi.URLParam(r, "name"), MType: chi.URLParam(r, "type")})
+
+	mType, name, ok := metricPath(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.storage.Delete(r.Context(), mType, name)
+	if err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+	if !deleted {
+		metricNotFound(w, r)
+		return
+	}
+
+	s.saveIfNeeded()
+	auditChanged(r, name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// metricHistory — тело ответа GET /api/v1/metrics/{type}/{name}/history.
+type metricHistory struct {
+	ID      string           `json:"id"`
+	MType   string           `json:"type"`
+	Samples []history.Sample `json:"samples"`
+}
+
+// historyMetricV1 отдаёт последние значения метрики. Если сбор истории
+// отключён, список точек пуст.
+func (s *Server) historyMetricV1(w http.ResponseWriter, r *http.Request) {
+	mType, name, ok := metricPath(w, r)
+	if !ok {
+		return
+	}
+
+	_, found, err := s.lookupMetric(r.Context(), mType, name)
+	if err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+	if !found {
+		metricNotFound(w, r)
+		return
+	}
+
+	resp := metricHistory{ID: name, MType: mType, Samples: []history.Sample{}}
+	if s.history != nil {
+		resp.Samples = s.history.Get(r.Context(), mType, name)
+	}
+
+	s.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// alertsV1 отдаёт активные оповещения (pending и firing) арендатора запроса.
+// Если файл правил не задан, список пуст.
+func (s *Server) alertsV1(w http.ResponseWriter, r *http.Request) {
+	alerts := []alerting.Alert{}
+	if s.alerts != nil {
+		alerts = s.alerts.Active(r.Context())
+	}
+
+	s.writeJSON(w, r, http.StatusOK, struct {
+		Alerts []alerting.Alert `json:"alerts"`
+	}{alerts})
+}
+
+// queryResult — тело ответа GET /api/v1/query: число (type=scalar)
+// или набор серий (type=vector).
+type queryResult struct {
+	Type   query.ValueType `json:"type"`
+	Value  *float64        `json:"value,omitempty"`
+	Series *query.Vector   `json:"series,omitempty"`
+}
+
+// querySource запоминает ошибку хранилища, чтобы отличить её от ошибки
+// в самом выражении.
+type querySource struct {
+	repo repository.Repository
+	err  error
+}
+
+func (q *querySource) List(ctx context.Context, lq repository.ListQuery) (repository.ListPage, error) {
+	page, err := q.repo.List(ctx, lq)
+	if err != nil {
+		q.err = err
+	}
+	return page, err
+}
+
+// queryV1 вычисляет выражение из параметра query. Синтаксические и
+// смысловые ошибки (в том числе функция окна без истории) дают 400.
+func (s *Server) queryV1(w http.ResponseWriter, r *http.Request) {
+	expr := r.URL.Query().Get("query")
+	if strings.TrimSpace(expr) == "" {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidQuery, "query is required"), nil)
+		return
+	}
+	n, err := query.Parse(expr)
+	if err != nil {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidQuery, err.Error()), nil)
+		return
+	}
+
+	src := &querySource{repo: s.storage}
+	e := &query.Evaluator{Source: src}
+	if s.history != nil {
+		e.History = s.history
+	}
+
+	v, err := e.Eval(r.Context(), n)
+	if err != nil && src.err != nil {
+		storageProblem(w, r, err)
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeInvalidQuery, err.Error()), nil)
+		return
+	}
+
+	resp := queryResult{Type: v.Type()}
+	switch v := v.(type) {
+	case query.Scalar:
+		f := float64(v)
+		resp.Value = &f
+	case query.Vector:
+		if v == nil {
+			v = query.Vector{}
+		}
+		resp.Series = &v
+	}
+	s.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// cardinalityV1 отдаёт число серий, отказы по лимитам и клиентов, создавших
+// больше всего серий (параметр top, по умолчанию 10).
+func (s *Server) cardinalityV1(w http.ResponseWriter, r *http.Request) {
+	if s.cardinality == nil {
+		writeProblem(w, r, NewProblem(http.StatusNotFound, codeNotFound,
+			"cardinality tracking is disabled"), nil)
+		return
+	}
+
+	top := 10
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, codeBadRequest,
+				"top must be a positive integer"), err)
+			return
+		}
+		top = n
+	}
+
+	s.writeJSON(w, r, http.StatusOK, s.cardinality.Stats(top))
+}
+
+// logLevel — тело запроса и ответа /api/v1/admin/log-level.
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) getLogLevelV1(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, r, http.StatusOK, logLevel{Level: logging.GetLevel()})
+}
+
+// putLogLevelV1 меняет уровень журнала до перезапуска или до перезагрузки
+// конфигурации с другим log_level.
+func (s *Server) putLogLevelV1(w http.ResponseWriter, r *http.Request) {
+	buf, ok := s.readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	var body logLevel
+	if !decodeJSON(w, r, buf, &body) {
+		return
+	}
+
+	from := logging.GetLevel()
+	if err := logging.SetLevel(body.Level); err != nil {
+		writeProblem(w, r, NewProblem(http.StatusBadRequest, codeBadRequest,
+			"level must be one of debug, info, warn, error"), err)
+		return
+	}
+	// Пишется только состоявшаяся смена; при уровне выше info запись
+	// отбрасывается самим журналом.
+	s.logger.Infow("log level changed", append(tracing.Fields(r.Context()), "from", from, "to", logging.GetLevel())...)
+
+	s.writeJSON(w, r, http.StatusOK, logLevel{Level: logging.GetLevel()})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+// healthTimeout — общий предел времени проверок /readyz.
+const healthTimeout = time.Second
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// Статусы проверок.
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// HealthChecker — зависимость, доступность которой проверяет /readyz.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// healthCheck — результат проверки одной зависимости. Причина отказа
+// клиенту не отправляется (эндпоинты открыты без токена), а пишется в журнал.
+type healthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// healthReport — тело ответа /healthz и /readyz.
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// namedCheck — проверка зависимости с сообщением для клиента при отказе.
+type namedCheck struct {
+	name    string
+	failure string
+	check   func(ctx context.Context) error
+}
+
+// healthzHandler сообщает, что процесс жив и обрабатывает запросы.
+// Зависимости не проверяются: их недоступность — повод вывести сервер
+// из балансировки (/readyz), а не перезапускать его.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, r, http.StatusOK, healthReport{
+		Status: healthOK,
+		Checks: map[string]healthCheck{"process": {Status: healthOK}},
+	})
+}
+
+// readyzHandler проверяет хранилище, возможность записи файла восстановления,
+// доступность получателей аудита и то, что сервер не завершает работу.
+// Проверки выполняются параллельно; при любом отказе ответ — 503.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	checks := s.readinessChecks()
+	report := healthReport{Status: healthOK, Checks: make(map[string]healthCheck, len(checks))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.check(ctx)
+			res := healthCheck{Status: healthOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status, res.Error = healthFail, c.failure
+				s.logger.Infow("readiness check failed", append(tracing.Fields(ctx), "check", c.name, "error", err)...)
+			}
+
+			mu.Lock()
+			report.Checks[c.name] = res
+			if err != nil {
+				report.Status = healthFail
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if report.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, r, status, report)
+}
+
+// readinessChecks собирает проверки для настроенных зависимостей.
+func (s *Server) readinessChecks() []namedCheck {
+	checks := []namedCheck{
+		{"shutdown", "shutdown in progress", func(context.Context) error {
+			if s.shuttingDown.Load() {
+				return errShuttingDown
+			}
+			return nil
+		}},
+		{"repository", "repository unavailable", s.storage.Ping},
+	}
+
+	if s.fileStorage != nil && s.fileStorage.path != "" {
+		checks = append(checks, namedCheck{"recovery_file", "recovery file is not writable",
+			func(context.Context) error { return s.fileStorage.CheckWritable() }})
+	}
+
+	if s.audit != nil {
+		for i, o := range s.audit.Observers() {
+			hc, ok := o.(HealthChecker)
+			if !ok {
+				continue
+			}
+			name := fmt.Sprintf("audit_%d", i)
+			switch o.(type) {
+			case *FileAuditObserver:
+				name = "audit_file"
+			case *HTTPAuditObserver:
+				name = "audit_http"
+			}
+			checks = append(checks, namedCheck{name, "audit sink unreachable", hc.Check})
+		}
+	}
+
+	return checks
+}
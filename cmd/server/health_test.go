@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func decodeHealth(t *testing.T, w *httptest.ResponseRecorder) healthReport {
+	t.Helper()
+	var rep healthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("decode: %v; body %s", err, w.Body.String())
+	}
+	return rep
+}
+
+func TestHealthz_AlwaysOK(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	s.shuttingDown.Store(true)
+
+	w := get(h, "/healthz")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if rep := decodeHealth(t, w); rep.Status != healthOK {
+		t.Fatalf("status = %q", rep.Status)
+	}
+}
+
+func TestReadyz_AllChecksPass(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	s.fileStorage = NewFileStorage(filepath.Join(t.TempDir(), "metrics.json"))
+
+	sink := httptest.NewServer(http.NotFoundHandler())
+	defer sink.Close()
+	s.audit.Register(NewHTTPAuditObserver(sink.URL, s.logger))
+
+	w := get(h, "/readyz")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	rep := decodeHealth(t, w)
+	for _, name := range []string{"shutdown", "repository", "recovery_file", "audit_http"} {
+		c, ok := rep.Checks[name]
+		if !ok {
+			t.Fatalf("check %s missing: %+v", name, rep.Checks)
+		}
+		if c.Status != healthOK || c.LatencyMS < 0 {
+			t.Errorf("check %s = %+v", name, c)
+		}
+	}
+}
+
+func TestReadyz_Failures(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	s.shuttingDown.Store(true)
+	s.fileStorage = NewFileStorage(filepath.Join(t.TempDir(), "missing", "metrics.json"))
+
+	sink := httptest.NewServer(http.NotFoundHandler())
+	sink.Close()
+	s.audit.Register(NewHTTPAuditObserver(sink.URL, s.logger))
+
+	w := get(h, "/readyz")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	rep := decodeHealth(t, w)
+	if rep.Status != healthFail {
+		t.Fatalf("status = %q", rep.Status)
+	}
+	for _, name := range []string{"shutdown", "recovery_file", "audit_http"} {
+		if c := rep.Checks[name]; c.Status != healthFail || c.Error == "" {
+			t.Errorf("check %s = %+v, want failure", name, c)
+		}
+	}
+	if c := rep.Checks["repository"]; c.Status != healthOK {
+		t.Errorf("repository = %+v", c)
+	}
+}
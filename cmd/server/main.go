@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,9 +17,21 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zheki1/yaprmtrc/internal/alerting"
+	"github.com/zheki1/yaprmtrc/internal/auth"
 	"github.com/zheki1/yaprmtrc/internal/buildinfo"
-	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/cardinality"
+	"github.com/zheki1/yaprmtrc/internal/cli"
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/netutil"
+	"github.com/zheki1/yaprmtrc/internal/recording"
 	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/selfmetrics"
+	"github.com/zheki1/yaprmtrc/internal/staleness"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+	"github.com/zheki1/yaprmtrc/internal/validation"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -24,28 +41,56 @@ var buildVersion string
 var buildDate string
 var buildCommit string
 
+// tokenReloadInterval — период проверки файла токенов -auth-tokens.
+const tokenReloadInterval = 5 * time.Second
+
 func main() {
 	buildinfo.Version = buildVersion
 	buildinfo.Date = buildDate
 	buildinfo.Commit = buildCommit
-	buildinfo.Print()
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "server: %v\n", err)
-	}
+	cli.Exit("server", run(os.Args[1:], os.Stdout))
 }
 
-func run() error {
-	logger, err := NewLogger()
+// run запускает сервер с аргументами args. Баннер сборки печатается в stdout
+// только при обычном запуске: вывод -print-config должен оставаться
+// файлом конфигурации.
+func run(args []string, stdout io.Writer) error {
+	cfg, err := LoadConfig(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	if cfg.PrintConfig {
+		return cfg.Print(stdout)
+	}
+	buildinfo.Fprint(stdout)
+
+	logger, err := logging.New(cfg.logOptions())
 	if err != nil {
 		return fmt.Errorf("cannot init logger: %w", err)
 	}
 	defer func() {
 		if err := logger.Sync(); err != nil {
-			log.Printf("logger sync failed: %v", err)
+			fmt.Fprintf(os.Stderr, "server: logger sync failed: %v\n", err)
 		}
 	}()
+	defer logging.RedirectStdLog(logger)()
 
-	cfg := LoadConfig(logger)
+	stopTracing, err := tracing.Setup(cfg.traceOptions())
+	if err != nil {
+		return fmt.Errorf("cannot init tracing: %w", err)
+	}
+	defer func() {
+		if err := stopTracing(); err != nil {
+			logger.Errorw("trace export failed", "error", err)
+		}
+	}()
+
+	if cfg.ConfigFile != "" {
+		logger.Infow("configuration loaded", "file", cfg.ConfigFile)
+	}
 
 	var dbConn *pgxpool.Pool
 	if cfg.DatabaseDSN != "" {
@@ -58,8 +103,10 @@ func run() error {
 			if err := runMigrations(cfg.DatabaseDSN); err != nil {
 				return fmt.Errorf("migration failed: %w", err)
 			}
+			registerPoolMetrics(dbConn)
 		}
 	}
+	selfmetrics.Default.Publish()
 
 	//storage := NewMemStorage()
 	var storage repository.Repository
@@ -74,43 +121,82 @@ func run() error {
 		logger.Info("using memory storage")
 		storage = repository.NewMemRepository()
 	}
+	// Учёт вызовов оборачивает само хранилище, поэтому отказы по лимитам
+	// серий в показатели storage_* не попадают.
+	storage = repository.Instrument(storage)
+
+	var recordingRules *recording.Config
+	if cfg.RecordingRules != "" {
+		if recordingRules, err = recording.LoadConfig(cfg.RecordingRules); err != nil {
+			return err
+		}
+	}
+
+	// Правилам записи нужны метки времени обновлений, которые хранит история,
+	// поэтому при заданных правилах история включается всегда.
+	historySize := cfg.HistorySize
+	if recordingRules != nil && historySize == 0 {
+		historySize = history.DefaultSize
+	}
+
+	var hist *history.Store
+	if historySize > 0 {
+		hist = history.NewStore(historySize)
+		storage = history.Wrap(storage, hist)
+	}
 
 	fileStorage := NewFileStorage(cfg.FileStoragePath)
 
 	if cfg.Restore {
 		if metrics, err := fileStorage.Load(); err == nil {
+			valid := make([]repository.TenantMetrics, 0, len(metrics))
 			for _, ms := range metrics {
-				switch ms.MType {
-				case models.Gauge:
-					if ms.Value != nil {
-						storage.UpdateGauge(context.Background(), ms.ID, *ms.Value)
-					}
-				case models.Counter:
-					if ms.Delta != nil {
-						storage.UpdateCounter(context.Background(), ms.ID, *ms.Delta)
-					}
+				if err := validation.Metric(ms.Metrics); err != nil {
+					logger.Infow("skip invalid metric on restore", "id", ms.ID, "error", err)
+					continue
+				}
+				if err := tenant.Validate(ms.TenantOf()); err != nil {
+					logger.Infow("skip metric of invalid tenant on restore", "id", ms.ID, "tenant", ms.Tenant)
+					continue
 				}
+				valid = append(valid, ms)
+			}
+			if err := repository.Restore(context.Background(), storage, valid); err != nil {
+				logger.Errorw("cannot restore metrics", "error", err)
+			} else {
+				//storage.Import(metrics)
+				logger.Infow("metrics restored", "count", len(valid), "skipped", len(metrics)-len(valid))
 			}
-			//storage.Import(metrics)
-			log.Printf("metrics restored %v", len(metrics))
 		} else {
-			log.Printf("cannot restore metrics %s", err.Error())
+			logger.Infow("cannot restore metrics", "error", err)
 		}
 	}
 
+	// Учёт серий оборачивает хранилище после восстановления, чтобы
+	// восстановленные метрики сразу считались существующими сериями.
+	card, err := cardinality.Wrap(context.Background(), storage, cardinality.Limits{
+		MaxSeries:       cfg.MaxSeries,
+		MaxNewPerMinute: cfg.MaxNewSeries,
+	})
+	if err != nil {
+		return err
+	}
+	storage = card
+	expvar.Publish("cardinality", expvar.Func(func() any { return card.Stats(10) }))
+
 	if cfg.StoreInterval > 0 {
 		go func() {
 			ticker := time.NewTicker(cfg.StoreInterval)
 			defer ticker.Stop()
 
 			for range ticker.C {
-				metrics, err := storage.GetAll(context.Background())
+				metrics, err := repository.Snapshot(context.Background(), storage)
 				if err != nil {
-					log.Printf("cannot get metrics for save: %s", err.Error())
+					logger.Errorw("cannot get metrics for save", "error", err)
 					continue
 				}
 				if err := fileStorage.Save(metrics); err != nil {
-					log.Printf("cannot save metrics into file %s", err.Error())
+					logger.Errorw("cannot save metrics into file", "error", err)
 				}
 			}
 		}()
@@ -122,32 +208,118 @@ func run() error {
 		fileStorage: fileStorage,
 		syncSave:    cfg.StoreInterval == 0,
 		db:          dbConn,
-		key:         cfg.Key,
 		audit:       NewAuditPublisher(logger),
-		cryptoKey:   cfg.CryptoKey,
+		history:     hist,
+		cardinality: card,
+
+		maxBodySize:         cfg.MaxBodySize,
+		maxDecompressedSize: cfg.MaxDecompressed,
+		maxBatchSize:        cfg.MaxBatchSize,
+	}
+	server.live.Store(newLiveSettings(cfg, nil))
+	if cfg.RateLimitRPS > 0 {
+		logger.Infow("per-client rate limit enabled", "rps", cfg.RateLimitRPS, "burst", cfg.RateLimitBurst)
 	}
 
-	if cfg.AuditFile != "" {
-		fileObs, err := NewFileAuditObserver(cfg.AuditFile, logger)
-		if err != nil {
-			return fmt.Errorf("audit file observer: %w", err)
+	server.tenants = &TenantResolver{Header: cfg.TenantHeader}
+	switch {
+	case cfg.AuthDB:
+		if dbConn == nil {
+			return errors.New("-auth-db requires a database (-d)")
 		}
-		defer fileObs.Close()
-		server.audit.Register(fileObs)
+		server.auth = &auth.Authenticator{Store: auth.NewPostgresStore(dbConn)}
+		logger.Info("bearer token auth enabled, tokens in database")
+	case cfg.TenantTokens != "":
+		logger.Warnw("-tenant-tokens (TENANT_TOKENS) is deprecated, use -auth-tokens", "role", auth.LegacyRole)
+		cfg.AuthTokens = cfg.TenantTokens
+		fallthrough
+	case cfg.AuthTokens != "":
+		store := auth.NewFileStore(cfg.AuthTokens)
+		if err := store.Check(); err != nil {
+			return err
+		}
+		server.auth = &auth.Authenticator{Store: store}
+		server.tokenFile = store
+		logger.Infow("bearer token auth enabled", "tokens", cfg.AuthTokens)
+	}
+
+	if server.trustedSubnet, err = netutil.ParseSubnets(cfg.TrustedSubnet); err != nil {
+		return fmt.Errorf("trusted subnet: %w", err)
+	}
+	if server.trustedProxies, err = netutil.ParseSubnets(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
 	}
-	if cfg.AuditURL != "" {
-		server.audit.Register(NewHTTPAuditObserver(cfg.AuditURL, logger))
+	if len(server.trustedSubnet) > 0 {
+		logger.Infow("metric writes limited to trusted subnet", "subnet", server.trustedSubnet.String())
+	}
+
+	auditObservers, err := newAuditObservers(cfg, nil, logger)
+	if err != nil {
+		return err
+	}
+	server.audit.Replace(auditObservers)
+	// Получатели могли смениться при перезагрузке: закрываются действующие.
+	defer func() { closeAuditObservers(server.audit.Observers(), logger) }()
+	if cfg.AuditQueueSize > 0 {
+		if err := server.audit.StartQueue(cfg.auditQueueConfig()); err != nil {
+			return err
+		}
+		// Очередь сбрасывается до закрытия получателей (defer выполняются в обратном порядке).
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.AuditFlush)
+			defer cancel()
+			if err := server.audit.Close(ctx); err != nil {
+				logger.Errorw("audit queue flush failed", "error", err)
+			}
+		}()
+	}
+
+	staleRules, err := staleness.ParseRules(cfg.StaleRules)
+	if err != nil {
+		return err
+	}
+	stalePolicy := staleness.Policy{Default: cfg.StaleTTL, Rules: staleRules, Delete: cfg.StaleDelete}
+
+	var alertInterval time.Duration
+	if cfg.AlertRules != "" {
+		rules, err := alerting.LoadConfig(cfg.AlertRules)
+		if err != nil {
+			return err
+		}
+		engine, closeChannels, err := alerting.NewEngineFromConfig(rules, storage, logger)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := closeChannels(); err != nil {
+				logger.Errorw("alert channels close failed", "error", err)
+			}
+		}()
+		server.alerts = engine
+		alertInterval = time.Duration(rules.Interval)
+		logger.Infow("alerting enabled", "rules", len(rules.Rules), "interval", alertInterval)
 	}
 
 	httpServer := &http.Server{
 		Addr:    cfg.Address,
 		Handler: router(server),
 	}
+	if cfg.TLSClientCA != "" {
+		if httpServer.TLSConfig, err = clientCATLSConfig(cfg.TLSClientCA); err != nil {
+			return err
+		}
+	}
 
 	go func() {
-		log.Printf("Starting server on %s\n", cfg.Address)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Listen failed %s", err.Error())
+		logger.Infow("starting server", "address", cfg.Address, "tls", cfg.TLSCert != "")
+		var err error
+		if cfg.TLSCert != "" {
+			err = httpServer.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorw("listen failed", "error", err)
 		}
 	}()
 
@@ -159,8 +331,36 @@ func run() error {
 	)
 	defer stop()
 
+	go NewReloader(server, cfg, args, os.LookupEnv, logger).Watch(ctx)
+	if server.tokenFile != nil {
+		go server.tokenFile.Watch(ctx, tokenReloadInterval, func(err error) {
+			logger.Errorw("cannot reload auth tokens, previous tokens kept", "error", err)
+		})
+	}
+
+	if server.alerts != nil {
+		go server.alerts.Run(ctx, alertInterval)
+	}
+	if stalePolicy.Enabled() {
+		logger.Infow("stale series sweeper enabled",
+			"ttl", stalePolicy.Default, "rules", len(stalePolicy.Rules),
+			"delete", stalePolicy.Delete, "interval", cfg.StaleInterval)
+		go staleness.NewSweeper(storage, stalePolicy, logger).Run(ctx, cfg.StaleInterval)
+	}
+	if recordingRules != nil {
+		logger.Infow("recording rules enabled", "rules", len(recordingRules.Rules), "interval", recordingRules.Interval)
+		go recording.NewEngine(storage, hist, recordingRules.Rules, logger).Run(ctx, recordingRules.Interval)
+	}
+
 	<-ctx.Done()
-	log.Print("Shutdown signal received")
+	logger.Infow("shutdown signal received")
+	server.shuttingDown.Store(true)
+	if cfg.ShutdownDelay > 0 {
+		// Пока идёт задержка, /readyz отвечает 503 и балансировщик успевает
+		// вывести сервер из ротации; запросы при этом ещё обслуживаются.
+		logger.Infow("draining before shutdown", "delay", cfg.ShutdownDelay)
+		time.Sleep(cfg.ShutdownDelay)
+	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -169,14 +369,14 @@ func run() error {
 		return fmt.Errorf("http server shutdown failed: %w", err)
 	}
 
-	metrics, err := storage.GetAll(context.Background())
+	metrics, err := repository.Snapshot(context.Background(), storage)
 	if err != nil {
 		return fmt.Errorf("cannot get metrics on shutdown: %w", err)
 	}
 	if err := fileStorage.Save(metrics); err != nil {
 		return fmt.Errorf("metrics save failed: %w", err)
 	} else {
-		log.Print("Metrics saved successfully")
+		logger.Infow("metrics saved successfully")
 	}
 
 	if storage != nil {
@@ -201,3 +401,22 @@ func runMigrations(dsn string) error {
 	}
 	return nil
 }
+
+// clientCATLSConfig настраивает проверку клиентских сертификатов (mTLS).
+// Сертификат не обязателен: клиенты без него определяют арендатора
+// токеном или заголовком.
+func clientCATLSConfig(path string) (*tls.Config, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA: no certificates in %s", path)
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
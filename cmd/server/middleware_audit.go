@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/netutil"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+// Заголовки, которыми агент сообщает о себе; попадают в события аудита.
+const (
+	AgentHostHeader    = "X-Agent-Host"
+	AgentVersionHeader = "X-Agent-Version"
+)
+
+// auditedRoutes — маршруты, изменяющие метрики. Каждый запрос к ним, в том
+// числе отклонённый, попадает в аудит.
+var auditedRoutes = map[string]bool{
+	"POST /update/{type}/{name}/{value}":   true,
+	"POST /update":                         true,
+	"POST /updates":                        true,
+	"POST /api/v1/metrics:batch":           true,
+	"PUT /api/v1/metrics/{type}/{name}":    true,
+	"DELETE /api/v1/metrics/{type}/{name}": true,
+}
+
+// auditRecord — то, что обработчик и мидлвары сообщают о запросе для
+// события аудита. Запрос обрабатывается в одной горутине, поэтому
+// блокировка не нужна.
+type auditRecord struct {
+	tenant  string
+	values  []AuditValue
+	changed []string
+	code    string
+}
+
+type auditRecordKey struct{}
+
+func auditRecordFrom(ctx context.Context) *auditRecord {
+	rec, _ := ctx.Value(auditRecordKey{}).(*auditRecord)
+	return rec
+}
+
+// auditMiddleware публикует событие аудита для каждого запроса к
+// auditedRoutes — успешного, отклонённого или завершившегося ошибкой.
+// Стоит перед AuthMiddleware, чтобы видеть и запросы с неверным токеном;
+// маршрут таких запросов, отклонённых до маршрутизации, ищется в mux.
+func auditMiddleware(pub *AuditPublisher, mux chi.Routes, proxies netutil.Subnets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &auditRecord{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, rec)))
+
+			route, rctx := auditedRoute(mux, r)
+			if route == "" {
+				return
+			}
+			if len(rec.values) == 0 {
+				// Обработчик не запускался (запрос отклонён раньше): в аудит
+				// попадает метрика из пути, если она там есть.
+				rec.add(AuditValue{ID: rctx.URLParam("name"), MType: rctx.URLParam("type"), Raw: rctx.URLParam("value")})
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			event := AuditEvent{
+				Version:      AuditEventVersion,
+				Ts:           time.Now().Unix(),
+				Tenant:       rec.tenant,
+				Metrics:      rec.changed,
+				IPAddress:    clientIP(r, proxies),
+				Route:        route,
+				Values:       rec.values,
+				AgentHost:    r.Header.Get(AgentHostHeader),
+				AgentVersion: r.Header.Get(AgentVersionHeader),
+				UserAgent:    r.UserAgent(),
+				Signed:       r.Header.Get("HashSHA256") != "",
+				Encrypted:    r.Header.Get("Encrypted") == "true",
+				Result:       auditResult(status),
+				Status:       status,
+				Error:        rec.code,
+				RequestID:    tracing.RequestIDFrom(r.Context()),
+			}
+			if event.Metrics == nil {
+				event.Metrics = []string{}
+			}
+			if sc := tracing.SpanContextFrom(r.Context()); sc.IsValid() {
+				event.TraceID, event.SpanID = sc.TraceID.String(), sc.SpanID.String()
+			}
+			pub.Publish(event)
+		})
+	}
+}
+
+// auditedRoute возвращает «МЕТОД шаблон» маршрута запроса и его параметры,
+// если маршрут входит в auditedRoutes, иначе пустую строку.
+func auditedRoute(mux chi.Routes, r *http.Request) (string, *chi.Context) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.RoutePattern() == "" {
+		rctx = chi.NewRouteContext()
+		if !mux.Match(rctx, r.Method, r.URL.Path) {
+			return "", nil
+		}
+	}
+	route := r.Method + " " + rctx.RoutePattern()
+	if !auditedRoutes[route] {
+		return "", nil
+	}
+	return route, rctx
+}
+
+func auditResult(status int) string {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return AuditResultDenied
+	case status >= http.StatusBadRequest:
+		return AuditResultFailure
+	case status == http.StatusMultiStatus:
+		return AuditResultPartial
+	default:
+		return AuditResultSuccess
+	}
+}
+
+// auditAttempt сообщает аудиту метрики, которые запрос пытается записать.
+// Обработчики вызывают его отложенно, до разбора и проверки запроса, чтобы
+// в аудит попало всё, что удалось разобрать, при любом исходе. Метрики без
+// имени и типа пропускаются.
+func auditAttempt(r *http.Request, metrics ...models.Metrics) {
+	for _, m := range metrics {
+		auditValue(r, AuditValue{ID: m.ID, MType: m.MType, Delta: m.Delta, Value: m.Value, Labels: m.Labels})
+	}
+}
+
+func auditValue(r *http.Request, v AuditValue) {
+	if rec := auditRecordFrom(r.Context()); rec != nil {
+		rec.add(v)
+	}
+}
+
+// add добавляет значение, если у него есть имя или тип.
+func (rec *auditRecord) add(v AuditValue) {
+	if v.ID != "" || v.MType != "" {
+		rec.values = append(rec.values, v)
+	}
+}
+
+// auditChanged сообщает аудиту метрики, изменённые запросом.
+func auditChanged(r *http.Request, names ...string) {
+	if rec := auditRecordFrom(r.Context()); rec != nil {
+		rec.changed = append(rec.changed, names...)
+	}
+}
+
+// auditTenant сообщает аудиту арендатора запроса.
+func auditTenant(r *http.Request, id string) {
+	if rec := auditRecordFrom(r.Context()); rec != nil {
+		rec.tenant = id
+	}
+}
+
+// auditProblem сообщает аудиту код ошибки, с которой отклонён запрос.
+func auditProblem(r *http.Request, p *Problem) {
+	if rec := auditRecordFrom(r.Context()); rec != nil {
+		rec.code = p.Code
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+func TestAudit_SuccessfulWrite(t *testing.T) {
+	s := newTestServer()
+	obs := &captureObserver{}
+	s.audit.Register(obs)
+	h := router(s)
+
+	r := httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(
+		`[{"id":"Alloc","type":"gauge","value":1.5},{"id":"PollCount","type":"counter","delta":3}]`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", "yaprmtrc-agent/1.2.3")
+	r.Header.Set(AgentHostHeader, "node-1")
+	r.Header.Set(AgentVersionHeader, "1.2.3")
+	r.Header.Set("HashSHA256", "ignored-without-key")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(obs.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(obs.events))
+	}
+	ev := obs.events[0]
+	if ev.Version != AuditEventVersion || ev.Result != AuditResultSuccess || ev.Status != http.StatusOK ||
+		ev.Route != "POST /updates" || ev.Tenant != "default" || ev.RequestID == "" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev.AgentHost != "node-1" || ev.AgentVersion != "1.2.3" || ev.UserAgent != "yaprmtrc-agent/1.2.3" ||
+		!ev.Signed || ev.Encrypted {
+		t.Errorf("unexpected client fields %+v", ev)
+	}
+	if len(ev.Metrics) != 2 || len(ev.Values) != 2 {
+		t.Fatalf("unexpected metrics %v and values %+v", ev.Metrics, ev.Values)
+	}
+	if v := ev.Values[0]; v.ID != "Alloc" || v.MType != models.Gauge || v.Value == nil || *v.Value != 1.5 {
+		t.Errorf("unexpected gauge value %+v", v)
+	}
+	if v := ev.Values[1]; v.MType != models.Counter || v.Delta == nil || *v.Delta != 3 {
+		t.Errorf("unexpected counter value %+v", v)
+	}
+}
+
+func TestAudit_RejectedWrites(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	obs := &captureObserver{}
+	s.audit.Register(obs)
+	h := router(s)
+
+	do := func(method, url, token, body string) {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	do(http.MethodPost, "/update/gauge/Alloc/abc", tokens[auth.RoleWriter], "")
+	do(http.MethodPost, "/update/counter/PollCount/1", "ymt_unknown", "")
+	do(http.MethodPost, "/update", tokens[auth.RoleReader], `{"id":"A","type":"gauge","value":1}`)
+	do(http.MethodPost, "/api/v1/metrics:batch", tokens[auth.RoleWriter],
+		`[{"id":"A","type":"gauge","value":1},{"id":"B","type":"bogus"}]`)
+	do(http.MethodGet, "/value/gauge/A", tokens[auth.RoleReader], "")
+
+	want := []struct {
+		route, result, code, tenant string
+		status, values, changed     int
+	}{
+		{"POST /update/{type}/{name}/{value}", AuditResultFailure, codeInvalidValue, "team-a", http.StatusBadRequest, 1, 0},
+		{"POST /update/{type}/{name}/{value}", AuditResultDenied, codeUnauthorized, "", http.StatusUnauthorized, 1, 0},
+		{"POST /update", AuditResultDenied, codeForbidden, "team-a", http.StatusForbidden, 0, 0},
+		{"POST /api/v1/metrics:batch", AuditResultPartial, "", "team-a", http.StatusMultiStatus, 2, 1},
+	}
+	if len(obs.events) != len(want) {
+		t.Fatalf("expected %d audit events, got %d: %+v", len(want), len(obs.events), obs.events)
+	}
+	for i, w := range want {
+		ev := obs.events[i]
+		if ev.Route != w.route || ev.Result != w.result || ev.Error != w.code || ev.Tenant != w.tenant ||
+			ev.Status != w.status || len(ev.Values) != w.values || len(ev.Metrics) != w.changed {
+			t.Errorf("event %d = %+v, want %+v", i, ev, w)
+		}
+	}
+	if v := obs.events[0].Values[0]; v.ID != "Alloc" || v.MType != models.Gauge || v.Value != nil || v.Raw != "abc" {
+		t.Errorf("unparsed value must be audited without a number, got %+v", v)
+	}
+	if v := obs.events[1].Values[0]; v.ID != "PollCount" || v.Raw != "1" {
+		t.Errorf("denied request must carry the metric from the path, got %+v", v)
+	}
+}
+
+func TestAuditedRoutes_AreRegistered(t *testing.T) {
+	registered := make(map[string]bool)
+	err := chi.Walk(router(newTestServer()).(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for route := range auditedRoutes {
+		if !registered[route] {
+			t.Errorf("audited route %s is not registered", route)
+		}
+	}
+}
+
+func TestAudit_RecordsValuesOfRejectedWrites(t *testing.T) {
+	s := newTestServer()
+	obs := &captureObserver{}
+	s.audit.Register(obs)
+	h := router(s)
+
+	do := func(url, body string) {
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	do("/update/gauge/bad%20name/1.5", "")
+	do("/update/counter/PollCount/x", "")
+	do("/update", `{"id":"Alloc","type":"gauge","value":"high"}`)
+
+	if len(obs.events) != 3 {
+		t.Fatalf("expected 3 audit events, got %d", len(obs.events))
+	}
+	want := []AuditValue{
+		{ID: "bad name", MType: models.Gauge, Raw: "1.5"},
+		{ID: "PollCount", MType: models.Counter, Raw: "x"},
+		{ID: "Alloc", MType: models.Gauge},
+	}
+	for i, ev := range obs.events {
+		if ev.Result != AuditResultFailure || ev.Error == "" || len(ev.Values) != 1 {
+			t.Fatalf("event %d = %+v", i, ev)
+		}
+		if got := ev.Values[0]; got.ID != want[i].ID || got.MType != want[i].MType || got.Raw != want[i].Raw {
+			t.Errorf("event %d value = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+)
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// publicPaths — маршруты, открытые без токена. Заголовок Authorization на
+// них не проверяется, чтобы неверный токен не ломал пробы и статику.
+var publicPaths = map[string]bool{
+	"/ping":                true,
+	"/healthz":             true,
+	"/readyz":              true,
+	"/api/v1/openapi.json": true,
+}
+
+func isPublicPath(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	return publicPaths[path] || strings.HasPrefix(path, "/static/")
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, detail string, cause error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="yaprmtrc"`)
+	writeProblem(w, r, NewProblem(http.StatusUnauthorized, codeUnauthorized, detail), cause)
+}
+
+// AuthMiddleware проверяет API-токен из заголовка Authorization: Bearer и
+// кладёт его владельца в контекст запроса. Запрос без токена пропускается
+// дальше: нужна ли роль, решает RequireRole конкретного маршрута. На
+// публичных маршрутах (publicPaths) и при authenticator == nil заголовок
+// не учитывается.
+func AuthMiddleware(authenticator *auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if authenticator == nil || !ok || isPublicPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, err := authenticator.Authenticate(r.Context(), token)
+			switch {
+			case errors.Is(err, auth.ErrUnknownToken), errors.Is(err, auth.ErrExpiredToken):
+				writeUnauthorized(w, r, err.Error(), nil)
+				return
+			case err != nil:
+				writeProblem(w, r, NewProblem(http.StatusInternalServerError, codeStorageError,
+					"failed to check API token"), err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// RequireRole пропускает запрос, только если владелец токена имеет роль
+// не ниже role: без токена — 401, с недостаточной ролью — 403. При
+// enabled == false (аутентификация выключена) доступ не ограничивается.
+func RequireRole(enabled bool, role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.PrincipalFrom(r.Context())
+			if !ok {
+				writeUnauthorized(w, r, "API token is required", nil)
+				return
+			}
+			if !p.Role.Allows(role) {
+				writeProblem(w, r, NewProblem(http.StatusForbidden, codeForbidden,
+					"role "+string(p.Role)+" is not allowed, "+string(role)+" is required"), nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
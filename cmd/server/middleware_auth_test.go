@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/logging"
+)
+
+// newAuthTestServer возвращает сервер с включённой аутентификацией и
+// открытые токены для каждой роли арендатора team-a.
+func newAuthTestServer(t *testing.T) (*Server, map[auth.Role]string) {
+	t.Helper()
+	store := auth.NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	tokens := make(map[auth.Role]string)
+	for _, role := range []auth.Role{auth.RoleReader, auth.RoleWriter, auth.RoleAdmin} {
+		plain, tok, err := auth.Generate("team-a", role, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Create(context.Background(), tok); err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = plain
+	}
+
+	s := newTestServer()
+	s.auth = &auth.Authenticator{Store: store}
+	s.tenants = &TenantResolver{Header: DefaultTenantHeader}
+	return s, tokens
+}
+
+func TestRouter_Roles(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	h := router(s)
+
+	do := func(method, url, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		if method == http.MethodPut {
+			r = httptest.NewRequest(method, url, strings.NewReader(`{"delta":1}`))
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		token  string
+		status int
+	}{
+		{"static is public", http.MethodGet, "/static/style.css", "", http.StatusOK},
+		{"spec is public", http.MethodGet, "/api/v1/openapi.json", "", http.StatusOK},
+		{"read without token", http.MethodGet, "/api/v1/metrics", "", http.StatusUnauthorized},
+		{"read with unknown token", http.MethodGet, "/api/v1/metrics", "nope", http.StatusUnauthorized},
+		{"reader reads", http.MethodGet, "/api/v1/metrics", tokens[auth.RoleReader], http.StatusOK},
+		{"reader cannot write", http.MethodPost, "/update/counter/PollCount/1", tokens[auth.RoleReader], http.StatusForbidden},
+		{"writer writes", http.MethodPost, "/update/counter/PollCount/1", tokens[auth.RoleWriter], http.StatusOK},
+		{"writer puts", http.MethodPut, "/api/v1/metrics/counter/PollCount", tokens[auth.RoleWriter], http.StatusOK},
+		{"writer reads", http.MethodGet, "/value/counter/PollCount", tokens[auth.RoleWriter], http.StatusOK},
+		{"writer cannot delete", http.MethodDelete, "/api/v1/metrics/counter/PollCount", tokens[auth.RoleWriter], http.StatusForbidden},
+		{"admin deletes", http.MethodDelete, "/api/v1/metrics/counter/PollCount", tokens[auth.RoleAdmin], http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.url, tt.token)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("401 must carry WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestRouter_TokenSetsTenant(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	h := router(s)
+
+	r := httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/5", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens[auth.RoleWriter])
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest(http.MethodGet, "/value/counter/PollCount", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens[auth.RoleReader])
+	r.Header.Set(DefaultTenantHeader, "team-a")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if strings.TrimSpace(w.Body.String()) != "5" {
+		t.Fatalf("expected metric in team-a, got %d %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/value/counter/PollCount", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens[auth.RoleReader])
+	r.Header.Set(DefaultTenantHeader, "team-b")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("token of team-a must not read team-b, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_ExpiredToken(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	s.auth.Now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	store := s.auth.Store
+
+	plain, tok, err := auth.Generate("team-a", auth.RoleAdmin, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(context.Background(), tok); err != nil {
+		t.Fatal(err)
+	}
+	h := router(s)
+
+	for token, want := range map[string]int{plain: http.StatusUnauthorized, tokens[auth.RoleReader]: http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouter_AuthDisabledIgnoresToken(t *testing.T) {
+	h := router(newTestServer())
+
+	r := httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/1", nil)
+	r.Header.Set("Authorization", "Bearer whatever")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 without auth, got %d", w.Code)
+	}
+}
+
+func TestRouter_AdminLogLevel(t *testing.T) {
+	t.Cleanup(func() { _ = logging.SetLevel("info") })
+	s, tokens := newAuthTestServer(t)
+	logs := &testLogger{}
+	s.logger = logs
+	h := router(s)
+
+	do := func(method, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/admin/log-level", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(http.MethodPut, tokens[auth.RoleAdmin], `{"level":"debug"}`); w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(), `"level":"debug"`) {
+		t.Fatalf("expected 200 with new level, got %d: %s", w.Code, w.Body.String())
+	}
+	if logging.GetLevel() != "debug" {
+		t.Fatalf("level = %s, want debug", logging.GetLevel())
+	}
+	if w := do(http.MethodGet, tokens[auth.RoleAdmin], ""); !strings.Contains(w.Body.String(), `"level":"debug"`) {
+		t.Fatalf("unexpected GET response %s", w.Body.String())
+	}
+	if w := do(http.MethodPut, tokens[auth.RoleAdmin], `{"level":"loud"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown level, got %d", w.Code)
+	}
+	if w := do(http.MethodPut, tokens[auth.RoleWriter], `{"level":"error"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("log level is for admins, got %d", w.Code)
+	}
+	if logging.GetLevel() != "debug" {
+		t.Fatalf("rejected requests must not change the level, got %s", logging.GetLevel())
+	}
+	changes := 0
+	for _, msg := range logs.calls {
+		if msg == "log level changed" {
+			changes++
+		}
+	}
+	if changes != 1 {
+		t.Errorf("only the applied change must be logged, got %d records: %v", changes, logs.calls)
+	}
+}
+
+func TestAuthMiddleware_PublicRoutesIgnoreToken(t *testing.T) {
+	s, _ := newAuthTestServer(t)
+	h := router(s)
+
+	for _, url := range []string{"/ping", "/healthz", "/readyz", "/api/v1/openapi.json", "/static/missing.css"} {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("Authorization", "Bearer ymt_unknown")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code == http.StatusUnauthorized {
+			t.Errorf("%s: public route must ignore a bad token, got 401", url)
+		}
+	}
+}
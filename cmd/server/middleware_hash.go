@@ -11,8 +11,15 @@ import (
 // HashMiddleware проверяет целостность запроса по заголовку HashSHA256
 // и добавляет хеш к ответу, если задан key.
 func HashMiddleware(key string) func(http.Handler) http.Handler {
+	return hashMiddleware(func() string { return key })
+}
+
+// hashMiddleware — HashMiddleware, который читает ключ при каждом запросе,
+// чтобы новый ключ действовал сразу после перезагрузки конфигурации.
+func hashMiddleware(keyFunc func() string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			key := keyFunc()
 			if key == "" {
 				next.ServeHTTP(writer, request)
 				return
@@ -22,7 +29,7 @@ func HashMiddleware(key string) func(http.Handler) http.Handler {
 			if got != "" {
 				body, err := io.ReadAll(request.Body)
 				if err != nil {
-					http.Error(writer, "bad request", http.StatusBadRequest)
+					writeProblem(writer, request, bodyReadProblem(err, codeBadRequest), err)
 					return
 				}
 				_ = request.Body.Close()
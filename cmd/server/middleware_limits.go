@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/cardinality"
+	"github.com/zheki1/yaprmtrc/internal/netutil"
+	"github.com/zheki1/yaprmtrc/internal/ratelimit"
+)
+
+// RateLimitMiddleware ограничивает частоту запросов с каждого адреса
+// соединения (с учётом доверенных прокси; заявленный агентом X-Real-IP не
+// учитывается, иначе его легко подменить). Мидлвар стоит перед
+// AuthMiddleware, чтобы перебор токенов и запросы без токена тоже
+// ограничивались. Сверх лимита — 429 с заголовком Retry-After. При
+// limiter == nil ограничение выключено.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, proxies netutil.Subnets) func(http.Handler) http.Handler {
+	return rateLimitMiddleware(func() *ratelimit.Limiter { return limiter }, proxies)
+}
+
+// rateLimitMiddleware — RateLimitMiddleware, который берёт ограничитель при
+// каждом запросе, чтобы перезагрузка конфигурации меняла лимит на ходу.
+func rateLimitMiddleware(limiterFunc func() *ratelimit.Limiter, proxies netutil.Subnets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := limiterFunc()
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ok, wait := limiter.Allow("ip:" + peerIP(r, proxies)); !ok {
+				setRetryAfter(w, wait)
+				writeProblem(w, r, NewProblem(http.StatusTooManyRequests, codeRateLimited,
+					"too many requests, retry later"), nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey определяет клиента для лимита новых серий: API-токен, если
+// запрос аутентифицирован, иначе адрес соединения (как в RateLimitMiddleware).
+func clientKey(r *http.Request, proxies netutil.Subnets) string {
+	if p, ok := auth.PrincipalFrom(r.Context()); ok {
+		return "token:" + p.TokenID
+	}
+	return "ip:" + peerIP(r, proxies)
+}
+
+// setRetryAfter выставляет заголовок Retry-After в целых секундах, не меньше 1.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	sec := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(sec, 1)))
+}
+
+// ClientMiddleware приписывает записи запроса клиенту (см. clientKey), чтобы
+// хранилище могло ограничить число новых серий на клиента.
+func ClientMiddleware(proxies netutil.Subnets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := cardinality.WithClient(r.Context(), clientKey(r, proxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// BodyLimitMiddleware ограничивает размер тела запроса в том виде, в каком
+// оно пришло по сети (до распаковки gzip). При limit <= 0 размер не ограничен.
+func BodyLimitMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeProblem(w, r, payloadTooLarge(limit), nil)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func payloadTooLarge(limit int64) *Problem {
+	return NewProblem(http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+		"request body exceeds "+strconv.FormatInt(limit, 10)+" bytes")
+}
+
+// bodyReadProblem описывает ошибку чтения тела запроса: превышение
+// BodyLimitMiddleware даёт 413, остальные ошибки — 400 с кодом code.
+func bodyReadProblem(err error, code string) *Problem {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return payloadTooLarge(tooLarge.Limit)
+	}
+	return NewProblem(http.StatusBadRequest, code, "cannot read request body")
+}
+
+// checkBatchSize отклоняет пакет длиннее maxBatchSize с ответом 413.
+func (s *Server) checkBatchSize(w http.ResponseWriter, r *http.Request, n int) bool {
+	if s.maxBatchSize > 0 && n > s.maxBatchSize {
+		writeProblem(w, r, NewProblem(http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+			"batch has "+strconv.Itoa(n)+" items, at most "+strconv.Itoa(s.maxBatchSize)+" allowed"), nil)
+		return false
+	}
+	return true
+}
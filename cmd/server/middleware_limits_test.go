@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/cardinality"
+	"github.com/zheki1/yaprmtrc/internal/ratelimit"
+)
+
+func TestRouter_RateLimit(t *testing.T) {
+	s := newTestServer()
+	s.live.Store(&liveSettings{limiter: ratelimit.New(1, 2)})
+	h := router(s)
+
+	do := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/value/counter/Missing", nil)
+		r.RemoteAddr = remote
+		// Заявленный адрес не должен влиять на ключ ограничения.
+		r.Header.Set(RealIPHeader, "10.0.0."+strconv.Itoa(len(remote)))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do("192.0.2.1:1000"); w.Code != http.StatusNotFound {
+			t.Fatalf("request %d within burst: expected 404, got %d", i, w.Code)
+		}
+	}
+	w := do("192.0.2.1:1001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected Retry-After: 1, got %q", w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), codeRateLimited) {
+		t.Fatalf("expected %s problem, got %s", codeRateLimited, w.Body.String())
+	}
+
+	if w := do("192.0.2.2:1000"); w.Code != http.StatusNotFound {
+		t.Fatalf("other client must not be limited, got %d", w.Code)
+	}
+}
+
+func TestRouter_RateLimitBeforeAuth(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	s.live.Store(&liveSettings{limiter: ratelimit.New(1, 2)})
+	h := router(s)
+
+	do := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Перебор токенов ограничивается по адресу, как и любые запросы с него.
+	for i := 0; i < 2; i++ {
+		if code := do("ymt_guess" + strconv.Itoa(i)); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d", i, code)
+		}
+	}
+	if code := do("ymt_guess2"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for further guesses, got %d", code)
+	}
+	if code := do(tokens[auth.RoleReader]); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a valid token from the same address, got %d", code)
+	}
+}
+
+func TestRouter_BodyLimits(t *testing.T) {
+	s := newTestServer()
+	s.maxBodySize = 1024
+	s.maxDecompressedSize = 4096
+	s.maxBatchSize = 2
+	h := router(s)
+
+	post := func(url string, body []byte, gz bool) *httptest.ResponseRecorder {
+		var r *http.Request
+		if gz {
+			r = httptest.NewRequest(http.MethodPost, url, gzipBody(t, body))
+			r.Header.Set("Content-Encoding", "gzip")
+		} else {
+			r = httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		}
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	batch := func(n int, pad int) []byte {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = `{"id":"M` + strconv.Itoa(i) + `","type":"gauge","value":1` + strings.Repeat(" ", pad) + `}`
+		}
+		return []byte("[" + strings.Join(items, ",") + "]")
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		body   []byte
+		gz     bool
+		status int
+		code   string
+	}{
+		{"within limits", "/updates", batch(2, 0), false, http.StatusOK, ""},
+		{"compressed body too large", "/updates", batch(2, 2000), false, http.StatusRequestEntityTooLarge, codePayloadTooLarge},
+		{"gzip bomb", "/updates", batch(1, 100000), true, http.StatusRequestEntityTooLarge, codePayloadTooLarge},
+		{"compressible body within limits", "/updates", batch(2, 1500), true, http.StatusOK, ""},
+		{"too many items", "/updates", batch(3, 0), false, http.StatusRequestEntityTooLarge, codeBatchTooLarge},
+		{"too many items in v1", "/api/v1/metrics:batch", batch(3, 0), false, http.StatusRequestEntityTooLarge, codeBatchTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(tt.url, tt.body, tt.gz)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.code != "" && !strings.Contains(w.Body.String(), tt.code) {
+				t.Fatalf("expected %s problem, got %s", tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_BodyLimitWithHashKey(t *testing.T) {
+	s := newTestServer()
+	s.live.Store(&liveSettings{key: "secret"})
+	s.maxBodySize = 16
+	h := router(s)
+
+	r := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(`{"id":"A","type":"gauge","value":1}`))
+	r.ContentLength = -1 // размер заранее неизвестен, как при chunked-передаче
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("HashSHA256", "ignored")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRouter_SeriesLimits(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	card, err := cardinality.Wrap(context.Background(), s.storage, cardinality.Limits{MaxSeries: 3, MaxNewPerMinute: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.storage, s.cardinality = card, card
+	h := router(s)
+
+	do := func(method, url, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	writer, admin := tokens[auth.RoleWriter], tokens[auth.RoleAdmin]
+
+	if w := do(http.MethodPost, "/updates", writer, `[{"id":"A","type":"gauge","value":1},{"id":"B","type":"gauge","value":1}]`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do(http.MethodPost, "/update/gauge/C/1", writer, "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), codeNewSeriesLimit) {
+		t.Fatalf("expected %s, got %s", codeNewSeriesLimit, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/update/gauge/A/2", writer, ""); w.Code != http.StatusOK {
+		t.Fatalf("existing series must be writable, got %d", w.Code)
+	}
+
+	if w := do(http.MethodPost, "/update/gauge/C/1", admin, ""); w.Code != http.StatusOK {
+		t.Fatalf("other client has its own window, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, "/updates?partial=true", admin, `[{"id":"D","type":"gauge","value":1}]`)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), `"status":"rejected"`) {
+		t.Fatalf("expected rejected item over the series limit, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, "/api/v1/metrics/gauge/D", admin, `{"value":1}`); w.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(w.Body.String(), codeSeriesLimit) {
+		t.Fatalf("expected 422 %s, got %d: %s", codeSeriesLimit, w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/api/v1/admin/cardinality?top=1", admin, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var st cardinality.Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Series != 3 || st.RejectedNewSeries != 1 || st.RejectedSeries != 2 ||
+		len(st.TopContributors) != 1 || st.TopContributors[0].NewSeries != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	if w := do(http.MethodGet, "/api/v1/admin/cardinality", writer, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("cardinality stats are for admins, got %d", w.Code)
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 )
 
 type loggingResponseWriter struct {
@@ -30,13 +33,30 @@ func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 }
 
 // LoggingMiddleware логирует все HTTP-запросы: метод, URI, длительность, статус и размер ответа.
+// Для ошибок дополнительно логируется тело ответа и внутренняя причина,
+// переданная через writeProblem, которая клиенту не отправляется.
+// Число запросов и их длительность учитываются в показателях http_* по
+// шаблону маршрута. Идентификаторы запроса и трассы из контекста (см.
+// TracingMiddleware) добавляются в каждую запись.
 func LoggingMiddleware(logger Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			httpInFlight.Add(1)
+			defer httpInFlight.Add(-1)
+
+			ctx, cause := withProblemDetail(r.Context())
 
 			lrw := &loggingResponseWriter{ResponseWriter: w}
-			next.ServeHTTP(lrw, r)
+			next.ServeHTTP(lrw, r.WithContext(ctx))
+
+			status := lrw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := routeLabel(r)
+			httpRequests.With(r.Method, route, strconv.Itoa(status)).Inc()
+			httpDuration.With(r.Method, route).ObserveSince(start)
 
 			fields := []any{
 				"method", r.Method,
@@ -45,9 +65,13 @@ func LoggingMiddleware(logger Logger) func(http.Handler) http.Handler {
 				"status", lrw.status,
 				"size", lrw.size,
 			}
+			fields = append(fields, tracing.Fields(ctx)...)
 
 			if lrw.status >= http.StatusBadRequest {
 				fields = append(fields, "error", strings.TrimSpace(lrw.body.String()))
+				if *cause != nil {
+					fields = append(fields, "cause", (*cause).Error())
+				}
 				logger.Infow("http error", fields...)
 				return
 			}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/zheki1/yaprmtrc/internal/netutil"
+)
+
+// RealIPHeader — заголовок, в котором агент сообщает адрес своего
+// исходящего интерфейса.
+const RealIPHeader = "X-Real-IP"
+
+// realIP возвращает адрес из заголовка X-Real-IP.
+func realIP(r *http.Request) (netip.Addr, bool) {
+	h := r.Header.Get(RealIPHeader)
+	if h == "" {
+		return netip.Addr{}, false
+	}
+	return netutil.ParseAddr(h)
+}
+
+// clientIP возвращает адрес клиента для аудита и журналов. Адрес, заявленный
+// агентом в X-Real-IP, имеет приоритет — по нему же проверяется доверенная
+// подсеть; без заголовка используется peerIP.
+func clientIP(r *http.Request, proxies netutil.Subnets) string {
+	if addr, ok := realIP(r); ok {
+		return addr.String()
+	}
+	return peerIP(r, proxies)
+}
+
+// peerIP возвращает адрес соединения. Если непосредственный собеседник
+// входит в proxies, берётся ближайший к нему адрес из X-Forwarded-For,
+// не принадлежащий доверенным прокси; иначе — адрес из r.RemoteAddr.
+func peerIP(r *http.Request, proxies netutil.Subnets) string {
+	peer, ok := netutil.ParseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !proxies.Contains(peer) {
+		return peer.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := netutil.ParseAddr(hops[i])
+		if !ok {
+			break
+		}
+		if !proxies.Contains(addr) {
+			return addr.String()
+		}
+	}
+	return peer.String()
+}
+
+// TrustedSubnetMiddleware пропускает запросы на запись метрик, только если
+// адрес из X-Real-IP входит в одну из подсетей subnets; запрос без
+// заголовка или из чужой сети получает 403. Пустой набор подсетей
+// отключает проверку.
+func TrustedSubnetMiddleware(subnets netutil.Subnets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(subnets) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := realIP(r)
+			if !ok {
+				writeProblem(w, r, NewProblem(http.StatusForbidden, codeUntrustedSubnet,
+					RealIPHeader+" header with the agent address is required"), nil)
+				return
+			}
+			if !subnets.Contains(addr) {
+				writeProblem(w, r, NewProblem(http.StatusForbidden, codeUntrustedSubnet,
+					"address "+addr.String()+" is outside the trusted subnet"), nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/netutil"
+)
+
+func mustSubnets(t *testing.T, s string) netutil.Subnets {
+	t.Helper()
+	subnets, err := netutil.ParseSubnets(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subnets
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := mustSubnets(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name      string
+		remote    string
+		realIP    string
+		forwarded []string
+		want      string
+	}{
+		{"remote addr", "192.0.2.1:5000", "", nil, "192.0.2.1"},
+		{"agent declared", "192.0.2.1:5000", "198.51.100.7", nil, "198.51.100.7"},
+		{"invalid real ip", "192.0.2.1:5000", "nope", nil, "192.0.2.1"},
+		{"untrusted peer forwarded", "192.0.2.1:5000", "", []string{"203.0.113.9"}, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.2:5000", "", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"proxy chain", "10.0.0.2:5000", "", []string{"198.51.100.1, 203.0.113.9", "10.0.0.3"}, "203.0.113.9"},
+		{"trusted proxy without header", "10.0.0.2:5000", "", nil, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/updates", nil)
+			r.RemoteAddr = tt.remote
+			if tt.realIP != "" {
+				r.Header.Set(RealIPHeader, tt.realIP)
+			}
+			for _, f := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if got := clientIP(r, proxies); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRouter_TrustedSubnet(t *testing.T) {
+	s := newTestServer()
+	s.trustedSubnet = mustSubnets(t, "192.168.1.0/24")
+	obs := &captureObserver{}
+	s.audit.Register(obs)
+	h := router(s)
+
+	do := func(method, url, realIP string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		if realIP != "" {
+			r.Header.Set(RealIPHeader, realIP)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		realIP string
+		status int
+	}{
+		{"trusted agent", http.MethodPost, "/update/counter/PollCount/1", "192.168.1.10", http.StatusOK},
+		{"outside subnet", http.MethodPost, "/update/counter/PollCount/1", "10.0.0.1", http.StatusForbidden},
+		{"no header", http.MethodPost, "/update/counter/PollCount/1", "", http.StatusForbidden},
+		{"delete is not ingestion", http.MethodDelete, "/api/v1/metrics/counter/PollCount", "", http.StatusNoContent},
+		{"reads are not filtered", http.MethodGet, "/value/counter/Missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.url, tt.realIP)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), codeUntrustedSubnet) {
+				t.Fatalf("expected %s problem, got %s", codeUntrustedSubnet, w.Body.String())
+			}
+		})
+	}
+
+	if len(obs.events) == 0 || obs.events[0].IPAddress != "192.168.1.10" {
+		t.Fatalf("audit must record the agent address, got %+v", obs.events)
+	}
+}
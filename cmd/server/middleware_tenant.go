@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// DefaultTenantHeader — заголовок, которым клиент указывает арендатора.
+const DefaultTenantHeader = "X-Tenant-ID"
+
+// TenantResolver определяет арендатора запроса. Источники по убыванию
+// доверия: CN проверенного клиентского сертификата (mTLS), арендатор
+// API-токена (см. AuthMiddleware), заголовок Header. Если арендатор
+// установлен сертификатом или токеном, заголовок может только совпадать с ним.
+type TenantResolver struct {
+	Header string // пусто — заголовок не учитывается
+}
+
+// certTenant возвращает CN клиентского сертификата, прошедшего проверку.
+func certTenant(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// Resolve возвращает арендатора запроса или Problem, если его нельзя определить.
+func (tr *TenantResolver) Resolve(r *http.Request) (string, *Problem) {
+	id := certTenant(r)
+
+	if p, ok := auth.PrincipalFrom(r.Context()); ok {
+		if id != "" && p.Tenant != id {
+			return "", NewProblem(http.StatusForbidden, codeTenantMismatch,
+				"API token belongs to another tenant than the client certificate")
+		}
+		id = p.Tenant
+	}
+
+	if tr.Header != "" {
+		if h := r.Header.Get(tr.Header); h != "" {
+			if id != "" && h != id {
+				return "", NewProblem(http.StatusForbidden, codeTenantMismatch,
+					tr.Header+" does not match the authenticated tenant")
+			}
+			id = h
+		}
+	}
+
+	if id == "" {
+		return tenant.Default, nil
+	}
+	if err := tenant.Validate(id); err != nil {
+		return "", NewProblem(http.StatusBadRequest, codeInvalidTenant, err.Error())
+	}
+	return id, nil
+}
+
+// TenantMiddleware привязывает контекст запроса к арендатору, так что все
+// обращения к хранилищу ограничены его метриками. При resolver == nil
+// запрос относится к арендатору API-токена или к арендатору по умолчанию.
+func TenantMiddleware(resolver *TenantResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if resolver == nil {
+				if p, ok := auth.PrincipalFrom(r.Context()); ok {
+					r = r.WithContext(tenant.WithTenant(r.Context(), p.Tenant))
+				}
+				auditTenant(r, tenant.FromContext(r.Context()))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id, p := resolver.Resolve(r)
+			if p != nil {
+				writeProblem(w, r, p, nil)
+				return
+			}
+
+			auditTenant(r, id)
+			next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), id)))
+		})
+	}
+}
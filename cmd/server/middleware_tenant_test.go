@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+func TestTenantResolver_Resolve(t *testing.T) {
+	tr := &TenantResolver{Header: DefaultTenantHeader}
+	withCert := func(r *http.Request, cn string) {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	withToken := func(r *http.Request, tenantID string) *http.Request {
+		return r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Tenant: tenantID, Role: auth.RoleReader}))
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(r *http.Request) *http.Request
+		want    string
+		status  int
+	}{
+		{"default", func(r *http.Request) *http.Request { return r }, tenant.Default, 0},
+		{"header", func(r *http.Request) *http.Request {
+			r.Header.Set(DefaultTenantHeader, "team-b")
+			return r
+		}, "team-b", 0},
+		{"token", func(r *http.Request) *http.Request { return withToken(r, "team-a") }, "team-a", 0},
+		{"token and same header", func(r *http.Request) *http.Request {
+			r.Header.Set(DefaultTenantHeader, "team-a")
+			return withToken(r, "team-a")
+		}, "team-a", 0},
+		{"token and other header", func(r *http.Request) *http.Request {
+			r.Header.Set(DefaultTenantHeader, "team-b")
+			return withToken(r, "team-a")
+		}, "", http.StatusForbidden},
+		{"invalid header", func(r *http.Request) *http.Request {
+			r.Header.Set(DefaultTenantHeader, "team a")
+			return r
+		}, "", http.StatusBadRequest},
+		{"certificate", func(r *http.Request) *http.Request {
+			withCert(r, "team-c")
+			return r
+		}, "team-c", 0},
+		{"certificate and same token", func(r *http.Request) *http.Request {
+			withCert(r, "team-c")
+			return withToken(r, "team-c")
+		}, "team-c", 0},
+		{"certificate and other token", func(r *http.Request) *http.Request {
+			withCert(r, "team-c")
+			return withToken(r, "team-a")
+		}, "", http.StatusForbidden},
+		{"certificate and other header", func(r *http.Request) *http.Request {
+			withCert(r, "team-c")
+			r.Header.Set(DefaultTenantHeader, "team-a")
+			return r
+		}, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.prepare(httptest.NewRequest(http.MethodGet, "/", nil))
+
+			got, p := tr.Resolve(r)
+			if tt.status != 0 {
+				if p == nil || p.Status != tt.status {
+					t.Fatalf("expected status %d, got %v (%q)", tt.status, p, got)
+				}
+				return
+			}
+			if p != nil {
+				t.Fatalf("unexpected problem %+v", p)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTenantResolver_HeaderDisabled(t *testing.T) {
+	tr := &TenantResolver{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(DefaultTenantHeader, "team-b")
+
+	if got, p := tr.Resolve(r); p != nil || got != tenant.Default {
+		t.Fatalf("expected default tenant, got %q %v", got, p)
+	}
+}
+
+type captureObserver struct {
+	events []AuditEvent
+}
+
+func (o *captureObserver) Notify(event AuditEvent) {
+	o.events = append(o.events, event)
+}
+
+func TestRouter_TenantIsolation(t *testing.T) {
+	s := newTestServer()
+	s.tenants = &TenantResolver{Header: DefaultTenantHeader}
+	h := router(s)
+	obs := &captureObserver{}
+	s.audit.Register(obs)
+
+	do := func(method, url, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		if id != "" {
+			r.Header.Set(DefaultTenantHeader, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	do(http.MethodPost, "/update/counter/PollCount/1", "team-a")
+	do(http.MethodPost, "/update/counter/PollCount/10", "team-b")
+	do(http.MethodPost, "/update/gauge/OnlyB/1", "team-b")
+
+	if w := do(http.MethodGet, "/value/counter/PollCount", "team-a"); strings.TrimSpace(w.Body.String()) != "1" {
+		t.Fatalf("team-a: expected 1, got %q", w.Body.String())
+	}
+	if w := do(http.MethodGet, "/value/counter/PollCount", "team-b"); strings.TrimSpace(w.Body.String()) != "10" {
+		t.Fatalf("team-b: expected 10, got %q", w.Body.String())
+	}
+	if w := do(http.MethodGet, "/value/counter/PollCount", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("default tenant: expected 404, got %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/", "team-a")
+	if !strings.Contains(w.Body.String(), "PollCount") || strings.Contains(w.Body.String(), "OnlyB") {
+		t.Fatalf("page must list only team-a metrics:\n%s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `data-tenant="team-a"`) {
+		t.Fatal("page must carry the tenant for API requests")
+	}
+
+	if w := do(http.MethodGet, "/value/counter/PollCount", "bad tenant"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid tenant: expected 400, got %d", w.Code)
+	}
+
+	if len(obs.events) != 3 || obs.events[0].Tenant != "team-a" || obs.events[1].Tenant != "team-b" {
+		t.Fatalf("unexpected audit events: %+v", obs.events)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -223,11 +224,28 @@ func TestResponseRecorder_FlushTo_NoBody(t *testing.T) {
 }
 
 type testLogger struct {
-	calls []string
+	calls  []string
+	fields [][]any
 }
 
 func (m *testLogger) Infow(msg string, fields ...any) {
 	m.calls = append(m.calls, msg)
+	m.fields = append(m.fields, fields)
+}
+
+// hasField сообщает, было ли залогировано поле key со значением, содержащим substr.
+func (m *testLogger) hasField(key, substr string) bool {
+	for _, fields := range m.fields {
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] != key {
+				continue
+			}
+			if v, ok := fields[i+1].(string); ok && strings.Contains(v, substr) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (m *testLogger) Fatalf(template string, args ...interface{}) {
@@ -242,6 +260,11 @@ func (m *testLogger) Errorf(template string, args ...interface{}) {
 	m.calls = append(m.calls, template)
 }
 
+func (m *testLogger) Errorw(msg string, fields ...any) {
+	m.calls = append(m.calls, msg)
+	m.fields = append(m.fields, fields)
+}
+
 func TestLoggingResponseWriter_Write(t *testing.T) {
 	w := httptest.NewRecorder()
 	lrw := &loggingResponseWriter{ResponseWriter: w}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+// TracingMiddleware принимает от клиента идентификатор запроса (X-Request-ID)
+// и контекст трассы (traceparent) или создаёт новые, открывает серверный
+// участок трассы на время обработки и кладёт всё это в контекст запроса:
+// оттуда идентификаторы берут журнал, хранилище и аудит. Идентификатор
+// запроса возвращается клиенту в заголовке X-Request-ID.
+//
+// Мидлвар стоит первым в цепочке, чтобы идентификаторы были и у запросов,
+// отклонённых следующими мидлварами.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, r.Method, tracing.WithKind(tracing.KindServer))
+		w.Header().Set(tracing.RequestIDHeader, tracing.RequestIDFrom(ctx))
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r = r.WithContext(ctx)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := routeLabel(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("http.status_code", strconv.Itoa(status))
+
+		var err error
+		if status >= http.StatusInternalServerError {
+			err = fmt.Errorf("HTTP %d", status)
+		}
+		span.End(err)
+	})
+}
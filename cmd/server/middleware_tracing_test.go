@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(s tracing.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) byName(name string) (tracing.SpanData, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return tracing.SpanData{}, false
+}
+
+func TestTracing_PropagatesAgentIDs(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	rec := &spanRecorder{}
+	tracing.SetExporter(rec)
+	t.Cleanup(func() { tracing.SetExporter(nil) })
+
+	s := newTestServer()
+	s.storage = repository.Instrument(s.storage)
+	logger := &testLogger{}
+	s.logger = logger
+	obs := &captureObserver{}
+	s.audit.Register(obs)
+	h := router(s)
+
+	r := httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/1", nil)
+	r.Header.Set(tracing.RequestIDHeader, "agent-req-1")
+	r.Header.Set(tracing.TraceparentHeader, "00-"+traceID+"-"+parentID+"-01")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(tracing.RequestIDHeader); got != "agent-req-1" {
+		t.Errorf("response X-Request-ID = %q", got)
+	}
+	if !logger.hasField("request_id", "agent-req-1") || !logger.hasField("trace_id", traceID) {
+		t.Errorf("log fields %v lack request and trace IDs", logger.fields)
+	}
+
+	if len(obs.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(obs.events))
+	}
+	if ev := obs.events[0]; ev.RequestID != "agent-req-1" || ev.TraceID != traceID || ev.SpanID == "" {
+		t.Errorf("audit event = %+v", ev)
+	}
+
+	server, ok := rec.byName("POST /update/{type}/{name}/{value}")
+	if !ok {
+		t.Fatalf("server span not recorded: %+v", rec.spans)
+	}
+	if server.Context.TraceID.String() != traceID || server.Parent.String() != parentID {
+		t.Errorf("server span %+v does not continue the agent trace", server)
+	}
+	if server.Attrs["request_id"] != "agent-req-1" || server.Attrs["http.status_code"] != "200" {
+		t.Errorf("server span attrs = %v", server.Attrs)
+	}
+	storage, ok := rec.byName("storage.update_counter")
+	if !ok || storage.Parent != server.Context.SpanID {
+		t.Errorf("storage span %+v is not a child of the server span", storage)
+	}
+}
+
+func TestTracing_GeneratesIDs(t *testing.T) {
+	s := newTestServer()
+	logger := &testLogger{}
+	s.logger = logger
+	h := router(s)
+
+	r := httptest.NewRequest(http.MethodGet, "/value/gauge/Missing", nil)
+	r.Header.Set(tracing.RequestIDHeader, "bad id with spaces")
+	r.Header.Set(tracing.TraceparentHeader, "not-a-traceparent")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	id := w.Header().Get(tracing.RequestIDHeader)
+	if !tracing.ValidRequestID(id) || id == "bad id with spaces" {
+		t.Fatalf("response X-Request-ID = %q", id)
+	}
+	if !logger.hasField("request_id", id) || !logger.hasField("trace_id", "") {
+		t.Errorf("log fields %v lack generated IDs", logger.fields)
+	}
+}
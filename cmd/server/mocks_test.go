@@ -108,6 +108,23 @@ func (mr *MockLoggerMockRecorder) Errorf(template any, args ...any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Errorf", reflect.TypeOf((*MockLogger)(nil).Errorf), varargs...)
 }
 
+// Errorw mocks base method.
+func (m *MockLogger) Errorw(msg string, fields ...any) {
+	m.ctrl.T.Helper()
+	varargs := []any{msg}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Errorw", varargs...)
+}
+
+// Errorw indicates an expected call of Errorw.
+func (mr *MockLoggerMockRecorder) Errorw(msg any, fields ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{msg}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Errorw", reflect.TypeOf((*MockLogger)(nil).Errorw), varargs...)
+}
+
 // Fatalf mocks base method.
 func (m *MockLogger) Fatalf(template string, args ...any) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zheki1/yaprmtrc/api"
+	"github.com/zheki1/yaprmtrc/internal/alerting"
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+// openAPISpec — минимальное подмножество OpenAPI 3, нужное для проверки контракта.
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse `json:"responses"`
+		Schemas   map[string]openAPISchema   `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses    map[string]openAPIResponse `json:"responses"`
+	RequiredRole auth.Role                  `json:"x-required-role"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema openAPISchema `json:"schema"`
+	} `json:"content"`
+}
+
+type openAPISchema struct {
+	Ref      string                   `json:"$ref"`
+	Type     string                   `json:"type"`
+	Required []string                 `json:"required"`
+	Items    *openAPISchema           `json:"items"`
+	OneOf    []openAPISchema          `json:"oneOf"`
+	Props    map[string]openAPISchema `json:"properties"`
+}
+
+var httpMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true, "patch": true, "head": true, "options": true,
+}
+
+func loadSpec(t *testing.T) *openAPISpec {
+	t.Helper()
+
+	var spec openAPISpec
+	if err := json.Unmarshal(api.OpenAPI, &spec); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+	return &spec
+}
+
+func (s *openAPISpec) operation(t *testing.T, path, method string) openAPIOperation {
+	t.Helper()
+
+	raw, ok := s.Paths[path][strings.ToLower(method)]
+	if !ok {
+		t.Fatalf("spec has no operation %s %s", method, path)
+	}
+	var op openAPIOperation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		t.Fatalf("invalid operation %s %s: %v", method, path, err)
+	}
+	return op
+}
+
+func (s *openAPISpec) resolveResponse(r openAPIResponse) openAPIResponse {
+	if r.Ref != "" {
+		return s.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+	}
+	return r
+}
+
+func (s *openAPISpec) resolveSchema(sc openAPISchema) openAPISchema {
+	if sc.Ref != "" {
+		return s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")]
+	}
+	return sc
+}
+
+// matches проверяет значение v на соответствие схеме: тип и обязательные поля.
+func (s *openAPISpec) matches(sc openAPISchema, v any) bool {
+	sc = s.resolveSchema(sc)
+
+	if len(sc.OneOf) > 0 {
+		for _, alt := range sc.OneOf {
+			if s.matches(alt, v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch sc.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		for _, req := range sc.Required {
+			if _, ok := obj[req]; !ok {
+				return false
+			}
+		}
+		for name, prop := range sc.Props {
+			if pv, ok := obj[name]; ok && !s.matches(prop, pv) {
+				return false
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return false
+		}
+		for _, item := range arr {
+			if sc.Items != nil && !s.matches(*sc.Items, item) {
+				return false
+			}
+		}
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "integer", "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return true
+}
+
+// checkResponse проверяет, что статус ответа описан в операции, а Content-Type
+// и тело соответствуют описанию.
+func (s *openAPISpec) checkResponse(t *testing.T, path, method string, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	op := s.operation(t, path, method)
+	resp, ok := op.Responses[strconv.Itoa(w.Code)]
+	if !ok {
+		t.Fatalf("%s %s: status %d is not documented (body %s)", method, path, w.Code, w.Body.String())
+	}
+	resp = s.resolveResponse(resp)
+
+	if len(resp.Content) == 0 {
+		return
+	}
+
+	ct := w.Header().Get("Content-Type")
+	for mediaType, media := range resp.Content {
+		if !strings.HasPrefix(ct, mediaType) {
+			continue
+		}
+		if !strings.Contains(mediaType, "json") {
+			return
+		}
+		var body any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: invalid JSON body: %v", method, path, err)
+		}
+		if !s.matches(media.Schema, body) {
+			t.Fatalf("%s %s: body does not match schema for %d: %s", method, path, w.Code, w.Body.String())
+		}
+		return
+	}
+	t.Fatalf("%s %s: content type %q is not documented for %d", method, path, ct, w.Code)
+}
+
+func TestOpenAPI_RoutesMatchSpec(t *testing.T) {
+	spec := loadSpec(t)
+	_, h := newTestServerWithRouter()
+
+	registered := make(map[string]bool)
+	err := chi.Walk(h.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		key := strings.ToLower(method) + " " + route
+		registered[key] = true
+		if _, ok := spec.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("route %s %s is not described in openapi.json", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if !httpMethods[method] {
+				continue
+			}
+			if !registered[method+" "+path] {
+				t.Errorf("openapi.json describes %s %s, but the router has no such route", method, path)
+			}
+		}
+	}
+}
+
+// TestOpenAPI_RolesMatchSpec проверяет, что маршруты требуют именно ту роль,
+// которая указана в x-required-role, а операции без неё доступны без токена.
+func TestOpenAPI_RolesMatchSpec(t *testing.T) {
+	spec := loadSpec(t)
+	s, tokens := newAuthTestServer(t)
+	h := router(s)
+	below := map[auth.Role]auth.Role{auth.RoleWriter: auth.RoleReader, auth.RoleAdmin: auth.RoleWriter}
+	params := strings.NewReplacer("{type}", "counter", "{name}", "X", "{value}", "1", "{file}", "style.css")
+
+	do := func(method, route, token string) int {
+		r := httptest.NewRequest(method, params.Replace(route), nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	err := chi.Walk(h.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		role := spec.operation(t, route, method).RequiredRole
+		code := do(method, route, "")
+		if role == "" {
+			if code == http.StatusUnauthorized {
+				t.Errorf("%s %s is public in openapi.json, but requires a token", method, route)
+			}
+			return nil
+		}
+		if code != http.StatusUnauthorized {
+			t.Errorf("%s %s requires %s, but got %d without a token", method, route, role, code)
+		}
+		if lower, ok := below[role]; ok {
+			if code := do(method, route, tokens[lower]); code != http.StatusForbidden {
+				t.Errorf("%s %s requires %s, but got %d for %s", method, route, role, code, lower)
+			}
+		}
+		if code := do(method, route, tokens[role]); code == http.StatusUnauthorized || code == http.StatusForbidden {
+			t.Errorf("%s %s: %s must be allowed, got %d", method, route, role, code)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAPI_HandlersFollowSpec(t *testing.T) {
+	spec := loadSpec(t)
+	_, h := newTestServerWithRouter()
+
+	steps := []struct {
+		method, url, path, body string
+	}{
+		{http.MethodGet, "/api/v1/openapi.json", "/api/v1/openapi.json", ""},
+		{http.MethodGet, "/api/v1/metrics", "/api/v1/metrics", ""},
+		{http.MethodPut, "/api/v1/metrics/gauge/Alloc", "/api/v1/metrics/{type}/{name}", `{"value":1.5}`},
+		{http.MethodPut, "/api/v1/metrics/counter/Poll", "/api/v1/metrics/{type}/{name}", `{"delta":2}`},
+		{http.MethodPut, "/api/v1/metrics/counter/Poll", "/api/v1/metrics/{type}/{name}", `{"value":2}`},
+		{http.MethodPut, "/api/v1/metrics/histogram/X", "/api/v1/metrics/{type}/{name}", `{"value":2}`},
+		{http.MethodGet, "/api/v1/metrics/gauge/Alloc", "/api/v1/metrics/{type}/{name}", ""},
+		{http.MethodGet, "/api/v1/metrics/gauge/Missing", "/api/v1/metrics/{type}/{name}", ""},
+		{http.MethodGet, "/api/v1/metrics/gauge/Alloc/history", "/api/v1/metrics/{type}/{name}/history", ""},
+		{http.MethodGet, "/api/v1/metrics/gauge/Missing/history", "/api/v1/metrics/{type}/{name}/history", ""},
+		{http.MethodGet, "/api/v1/alerts", "/api/v1/alerts", ""},
+		{http.MethodGet, "/api/v1/query?query=sum(Alloc*)%20*%202", "/api/v1/query", ""},
+		{http.MethodGet, "/api/v1/query?query=1%2B1", "/api/v1/query", ""},
+		{http.MethodGet, "/api/v1/query?query=sum(", "/api/v1/query", ""},
+		{http.MethodGet, "/api/v1/query", "/api/v1/query", ""},
+		{http.MethodGet, "/api/v1/metrics", "/api/v1/metrics", ""},
+		{http.MethodPost, "/api/v1/metrics:batch", "/api/v1/metrics:batch", `[{"id":"A","type":"gauge","value":1}]`},
+		{http.MethodPost, "/api/v1/metrics:batch", "/api/v1/metrics:batch", `[{"id":"A","type":"gauge"}]`},
+		{http.MethodPost, "/api/v1/metrics:batch", "/api/v1/metrics:batch", `[]`},
+		{http.MethodDelete, "/api/v1/metrics/gauge/Alloc", "/api/v1/metrics/{type}/{name}", ""},
+		{http.MethodDelete, "/api/v1/metrics/gauge/Alloc", "/api/v1/metrics/{type}/{name}", ""},
+		{http.MethodPost, "/update/gauge/G/1", "/update/{type}/{name}/{value}", ""},
+		{http.MethodPost, "/update/gauge/G/abc", "/update/{type}/{name}/{value}", ""},
+		{http.MethodPost, "/update", "/update", `{"id":"C","type":"counter","delta":1}`},
+		{http.MethodPost, "/update", "/update", `{"id":"C","type":"counter"}`},
+		{http.MethodPost, "/updates", "/updates", `[{"id":"C","type":"counter","delta":1}]`},
+		{http.MethodPost, "/updates?partial=true", "/updates", `[{"id":"C","type":"counter","delta":1},{"id":""}]`},
+		{http.MethodPost, "/value", "/value", `{"id":"C","type":"counter"}`},
+		{http.MethodPost, "/value", "/value", `{"id":"Nope","type":"counter"}`},
+		{http.MethodGet, "/value/counter/C", "/value/{type}/{name}", ""},
+		{http.MethodGet, "/value/counter/Nope", "/value/{type}/{name}", ""},
+		{http.MethodGet, "/", "/", ""},
+		{http.MethodGet, "/metric/counter/C", "/metric/{type}/{name}", ""},
+		{http.MethodGet, "/metric/counter/Nope", "/metric/{type}/{name}", ""},
+		{http.MethodGet, "/static/style.css", "/static/{file}", ""},
+		{http.MethodGet, "/static/nope.css", "/static/{file}", ""},
+		{http.MethodGet, "/ping", "/ping", ""},
+		{http.MethodGet, "/api/v1/admin/log-level", "/api/v1/admin/log-level", ""},
+		{http.MethodPut, "/api/v1/admin/log-level", "/api/v1/admin/log-level", `{"level":"info"}`},
+		{http.MethodPut, "/api/v1/admin/log-level", "/api/v1/admin/log-level", `{"level":"loud"}`},
+		{http.MethodGet, "/healthz", "/healthz", ""},
+		{http.MethodGet, "/readyz", "/readyz", ""},
+	}
+
+	for _, st := range steps {
+		var body *bytes.Buffer
+		if st.body != "" {
+			body = bytes.NewBufferString(st.body)
+		} else {
+			body = &bytes.Buffer{}
+		}
+
+		req := httptest.NewRequest(st.method, st.url, body)
+		if st.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		spec.checkResponse(t, st.path, st.method, w)
+	}
+}
+
+func TestV1_PutCounterReturnsNewValue(t *testing.T) {
+	_, h := newTestServerWithRouter()
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/metrics/counter/Poll", bytes.NewBufferString(`{"delta":3}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if i == 1 && !strings.Contains(w.Body.String(), `"delta":6`) {
+			t.Fatalf("expected accumulated delta 6, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestV1_DeleteRemovesMetric(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	_ = s.storage.UpdateGauge(t.Context(), "Alloc", 1)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/metrics/gauge/Alloc", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if _, ok, _ := s.storage.GetGauge(t.Context(), "Alloc"); ok {
+		t.Fatal("metric still present after delete")
+	}
+}
+
+func TestV1_StaleMetric(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	ctx := t.Context()
+	_ = s.storage.UpdateGauge(ctx, "FreeMemory", 1)
+	_ = s.storage.UpdateGauge(ctx, "Alloc", 2)
+	if ok, err := s.storage.Expire(ctx, models.Gauge, "FreeMemory", time.Now().Add(time.Minute), false); err != nil || !ok {
+		t.Fatalf("expire: %v %v", ok, err)
+	}
+
+	w := get(h, "/api/v1/metrics/gauge/FreeMemory")
+	var m models.Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !m.Stale || m.UpdatedAt == nil {
+		t.Fatalf("expected stale metric with updated_at, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = get(h, "/api/v1/metrics?fields=id,stale")
+	body := w.Body.String()
+	if !strings.Contains(body, `{"id":"Alloc","stale":false}`) || !strings.Contains(body, `{"id":"FreeMemory","stale":true}`) {
+		t.Fatalf("unexpected projection: %s", body)
+	}
+
+	if w = get(h, "/"); !strings.Contains(w.Body.String(), `class="stale"`) {
+		t.Fatal("dashboard must mark the stale series")
+	}
+}
+
+func TestV1_ListMetricsFiltersAndProjection(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	ctx := t.Context()
+	_ = s.storage.UpdateGauge(ctx, "cpu.user", 1)
+	_ = s.storage.UpdateGauge(ctx, "cpu.system", 2)
+	_ = s.storage.UpdateCounter(ctx, "PollCount", 3)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics?type=gauge&prefix=cpu.&limit=1&fields=id,value", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var page struct {
+		Metrics    []map[string]any `json:"metrics"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Metrics) != 1 || page.Metrics[0]["id"] != "cpu.system" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %s", w.Body.String())
+	}
+	if _, ok := page.Metrics[0]["type"]; ok {
+		t.Fatal("type must be projected out")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/metrics?type=gauge&prefix=cpu.&limit=1&cursor="+page.NextCursor, nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), `"id":"cpu.user"`) || strings.Contains(w.Body.String(), "next_cursor") {
+		t.Fatalf("unexpected second page: %s", w.Body.String())
+	}
+
+	for _, bad := range []string{"type=histogram", "regex=(", "label=novalue", "limit=0", "fields=secret", "cursor=zzz"} {
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+bad, nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestV1_AlertsListsActive(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	ctx := t.Context()
+	_ = s.storage.UpdateGauge(ctx, "HeapAlloc", 2e9)
+
+	cond, err := alerting.ParseCondition("HeapAlloc > 1e9 for 2m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.alerts = alerting.NewEngine(s.storage, []alerting.Rule{{Name: "HighHeap", Cond: cond}}, nil, s.logger.(alerting.Logger))
+	s.alerts.Eval(ctx)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil))
+
+	var res struct {
+		Alerts []alerting.Alert `json:"alerts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Alerts) != 1 || res.Alerts[0].Rule != "HighHeap" || res.Alerts[0].State != alerting.StatePending {
+		t.Fatalf("unexpected alerts: %s", w.Body.String())
+	}
+}
+
+func TestV1_AlertsAreTenantScoped(t *testing.T) {
+	s, tokens := newAuthTestServer(t)
+	h := router(s)
+	ctx := t.Context()
+	_ = s.storage.UpdateGauge(ctx, "HeapAlloc", 2e9)
+
+	cond, err := alerting.ParseCondition("HeapAlloc > 1e9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.alerts = alerting.NewEngine(s.storage, []alerting.Rule{{Name: "HighHeap", Cond: cond}}, nil, s.logger.(alerting.Logger))
+	s.alerts.Eval(ctx)
+	if len(s.alerts.Active(ctx)) != 1 {
+		t.Fatal("default tenant alert must be active")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens[auth.RoleReader])
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "HighHeap") {
+		t.Fatalf("team-a reader must not see default tenant alerts, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestV1_Query(t *testing.T) {
+	s, h := newTestServerWithRouter()
+	ctx := t.Context()
+	_ = s.storage.UpdateGauge(ctx, "CPUutilization1", 10)
+	_ = s.storage.UpdateGauge(ctx, "CPUutilization2", 30)
+	_ = s.storage.UpdateCounter(ctx, "PollCount", 5)
+
+	tests := []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"sum(CPUutilization*)", http.StatusOK, `{"type":"vector","series":[{"value":40}]}`},
+		{"topk(1, CPUutilization*)", http.StatusOK, `{"type":"vector","series":[{"metric":"CPUutilization2","type":"gauge","value":30}]}`},
+		{"PollCount * 2", http.StatusOK, `{"type":"vector","series":[{"value":10}]}`},
+		{"Missing", http.StatusOK, `{"type":"vector","series":[]}`},
+		{"2 * 3", http.StatusOK, `{"type":"scalar","value":6}`},
+		{"sum(", http.StatusBadRequest, ""},
+		{"CPUutilization* + CPUutilization*", http.StatusBadRequest, ""},
+		{"rate(PollCount[1m])", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/query?query="+url.QueryEscape(tt.query), nil))
+			if w.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if tt.want != "" && strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, w.Body.String())
+			}
+		})
+	}
+}
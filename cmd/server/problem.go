@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/zheki1/yaprmtrc/internal/validation"
+)
+
+// Стабильные коды ошибок API. Клиенты могут полагаться на них,
+// в отличие от текста в поле detail.
+const (
+	codeInvalidContentType = "invalid_content_type"
+	codeInvalidEncoding    = "invalid_encoding"
+	codeInvalidJSON        = "invalid_json"
+	codeInvalidName        = "invalid_name"
+	codeInvalidType        = "invalid_type"
+	codeInvalidValue       = "invalid_value"
+	codeInvalidLabels      = "invalid_labels"
+	codeInvalidQuery       = "invalid_query"
+	codeEmptyBatch         = "empty_batch"
+	codeValidationFailed   = "validation_failed"
+	codeMetricNotFound     = "metric_not_found"
+	codeEncryptionRequired = "encryption_not_configured"
+	codeDecryptFailed      = "decrypt_failed"
+	codeKeyUnavailable     = "key_unavailable"
+	codeStorageError       = "storage_error"
+	codeDBNotConfigured    = "database_not_configured"
+	codeDBUnavailable      = "database_unavailable"
+	codeBadRequest         = "bad_request"
+	codeNotFound           = "not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeInvalidTenant      = "invalid_tenant"
+	codeTenantMismatch     = "tenant_mismatch"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeUntrustedSubnet    = "untrusted_subnet"
+	codeRateLimited        = "rate_limited"
+	codePayloadTooLarge    = "payload_too_large"
+	codeBatchTooLarge      = "batch_too_large"
+	codeSeriesLimit        = "series_limit_exceeded"
+	codeNewSeriesLimit     = "new_series_limit_exceeded"
+)
+
+// problemContentType — MIME-тип ответа об ошибке по RFC 7807.
+const problemContentType = "application/problem+json"
+
+// Problem — тело ответа об ошибке в формате RFC 7807 (application/problem+json).
+// Поле Code дублирует последний сегмент Type и предназначено для программной обработки.
+type Problem struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Code     string                  `json:"code"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Errors   []*validation.ItemError `json:"errors,omitempty"`
+}
+
+// NewProblem создаёт Problem с заданным статусом, кодом и безопасным для клиента описанием.
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "urn:yaprmtrc:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+type problemDetailKey struct{}
+
+// withProblemDetail возвращает контекст с ячейкой, в которую writeProblem
+// складывает внутреннюю причину ошибки для LoggingMiddleware.
+func withProblemDetail(ctx context.Context) (context.Context, *error) {
+	var cause error
+	return context.WithValue(ctx, problemDetailKey{}, &cause), &cause
+}
+
+// writeProblem отправляет клиенту problem+json. Внутренняя причина cause
+// (например, ошибка хранилища или декодера) клиенту не передаётся,
+// а сохраняется в контексте запроса для журнала запросов. Код ошибки
+// попадает в событие аудита.
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem, cause error) {
+	if cause != nil {
+		if slot, ok := r.Context().Value(problemDetailKey{}).(*error); ok {
+			*slot = cause
+		}
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	auditProblem(r, p)
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// validationProblem преобразует ошибку пакета validation в Problem.
+func validationProblem(err error) *Problem {
+	var be *validation.BatchError
+	if errors.As(err, &be) {
+		p := NewProblem(http.StatusBadRequest, codeValidationFailed, "some metrics in the batch are invalid")
+		p.Errors = be.Items
+		return p
+	}
+
+	var code string
+	switch {
+	case errors.Is(err, validation.ErrEmptyName),
+		errors.Is(err, validation.ErrNameTooLong),
+		errors.Is(err, validation.ErrInvalidName):
+		code = codeInvalidName
+	case errors.Is(err, validation.ErrUnknownType):
+		code = codeInvalidType
+	case errors.Is(err, validation.ErrEmptyBatch):
+		code = codeEmptyBatch
+	case errors.Is(err, validation.ErrInvalidLabels):
+		code = codeInvalidLabels
+	default:
+		code = codeInvalidValue
+	}
+	return NewProblem(http.StatusBadRequest, code, err.Error())
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, NewProblem(http.StatusNotFound, codeNotFound, "route not found"), nil)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, NewProblem(http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed"), nil)
+}
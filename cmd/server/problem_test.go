@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	t.Helper()
+
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("expected %s, got %q", problemContentType, ct)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	return p
+}
+
+func TestProblem_MetricNotFound(t *testing.T) {
+	_, r := newTestServerWithRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/value/gauge/Missing", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	p := decodeProblem(t, w)
+	if p.Code != codeMetricNotFound || p.Status != http.StatusNotFound {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+	if p.Instance != "/value/gauge/Missing" {
+		t.Fatalf("unexpected instance %q", p.Instance)
+	}
+}
+
+func TestProblem_InvalidType(t *testing.T) {
+	_, r := newTestServerWithRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/update/unknown/X/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if p := decodeProblem(t, w); p.Code != codeInvalidType {
+		t.Fatalf("expected %s, got %+v", codeInvalidType, p)
+	}
+}
+
+func TestProblem_InvalidJSONDoesNotLeakDecoderError(t *testing.T) {
+	s, _ := newTestServerWithRouter()
+	logger := &testLogger{}
+
+	handler := LoggingMiddleware(logger)(http.HandlerFunc(s.updateHandlerJSON))
+
+	req := httptest.NewRequest(http.MethodPost, "/update", bytes.NewBufferString(`{"id":`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "unexpected end of JSON input") {
+		t.Fatalf("decoder error leaked to client: %s", body)
+	}
+
+	p := decodeProblem(t, w)
+	if p.Code != codeInvalidJSON {
+		t.Fatalf("expected %s, got %s", codeInvalidJSON, p.Code)
+	}
+
+	if !logger.hasField("cause", "unexpected end of JSON input") {
+		t.Fatal("expected cause to be logged")
+	}
+}
+
+func TestProblem_RouteNotFound(t *testing.T) {
+	_, r := newTestServerWithRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/no/such/route", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if p := decodeProblem(t, w); p.Code != codeNotFound {
+		t.Fatalf("expected %s, got %+v", codeNotFound, p)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/zheki1/yaprmtrc/internal/logging"
+	"github.com/zheki1/yaprmtrc/internal/ratelimit"
+	"github.com/zheki1/yaprmtrc/internal/security"
+)
+
+// liveSettings — параметры сервера, которые меняются без перезапуска.
+// Набор заменяется целиком одной атомарной записью, поэтому запрос видит
+// либо старые значения, либо новые, но не их смесь.
+type liveSettings struct {
+	key       string
+	cryptoKey string
+	limiter   *ratelimit.Limiter // nil — ограничение частоты выключено
+	rps       float64
+	burst     int
+}
+
+// newLiveSettings собирает параметры из cfg. Ограничитель prev
+// переиспользуется, если лимит не изменился, чтобы не сбрасывать корзины
+// клиентов.
+func newLiveSettings(cfg *Config, prev *liveSettings) *liveSettings {
+	l := &liveSettings{
+		key:       cfg.Key,
+		cryptoKey: cfg.CryptoKey,
+		rps:       cfg.RateLimitRPS,
+		burst:     cfg.RateLimitBurst,
+	}
+	switch {
+	case l.rps <= 0:
+	case prev != nil && prev.limiter != nil && prev.rps == l.rps && prev.burst == l.burst:
+		l.limiter = prev.limiter
+	default:
+		l.limiter = ratelimit.New(l.rps, l.burst)
+	}
+	return l
+}
+
+// settings возвращает действующие перезагружаемые параметры.
+func (s *Server) settings() *liveSettings {
+	if l := s.live.Load(); l != nil {
+		return l
+	}
+	return &liveSettings{}
+}
+
+func (s *Server) hashKey() string { return s.settings().key }
+
+func (s *Server) limiter() *ratelimit.Limiter { return s.settings().limiter }
+
+// reloadableKeys — ключи конфигурации, которые применяются при перезагрузке.
+// Изменения остальных параметров требуют перезапуска.
+var reloadableKeys = map[string]bool{
+	"key":              true,
+	"crypto_key":       true,
+	"audit_file":       true,
+	"audit_url":        true,
+	"log_level":        true,
+	"rate_limit_rps":   true,
+	"rate_limit_burst": true,
+}
+
+// Reloader перечитывает конфигурацию из тех же источников, что и при старте,
+// и применяет к работающему серверу параметры из reloadableKeys.
+type Reloader struct {
+	server    *Server
+	args      []string
+	lookupEnv func(string) (string, bool)
+	logger    Logger
+
+	mu  sync.Mutex
+	cfg *Config // действующая конфигурация
+}
+
+// NewReloader создаёт Reloader для сервера, запущенного с конфигурацией cfg.
+func NewReloader(s *Server, cfg *Config, args []string, lookupEnv func(string) (string, bool), logger Logger) *Reloader {
+	return &Reloader{server: s, args: args, lookupEnv: lookupEnv, logger: logger, cfg: cfg}
+}
+
+// Watch вызывает Reload на каждый SIGHUP, пока не отменён ctx, и
+// перечитывает файл токенов.
+func (r *Reloader) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Infow("SIGHUP received, reloading configuration")
+			_ = r.Reload()
+			r.server.reloadTokens()
+		}
+	}
+}
+
+// Reload загружает и проверяет новую конфигурацию, готовит новые
+// получатели аудита и только затем применяет изменения. При любой ошибке
+// новая конфигурация отклоняется, а действующая остаётся без изменений.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.prepare()
+	if err != nil {
+		r.logger.Errorf("config reload rejected, running configuration kept: %v", err)
+		return err
+	}
+
+	changed := r.cfg.diff(next.cfg)
+	var applied, restart []string
+	for _, k := range changed {
+		if reloadableKeys[k] {
+			applied = append(applied, k)
+		} else {
+			restart = append(restart, k)
+		}
+	}
+
+	r.server.live.Store(newLiveSettings(next.cfg, r.server.live.Load()))
+	// Уровень меняется, только если он изменился в конфигурации: иначе
+	// перезагрузка сбросила бы уровень, выставленный через API.
+	if next.cfg.LogLevel != r.cfg.LogLevel {
+		_ = logging.SetLevel(next.cfg.LogLevel)
+	}
+	if next.auditChanged {
+		closeAuditObservers(r.server.audit.Replace(next.observers), r.logger, next.observers...)
+	}
+
+	running := *r.cfg
+	running.Key = next.cfg.Key
+	running.CryptoKey = next.cfg.CryptoKey
+	running.AuditFile = next.cfg.AuditFile
+	running.AuditURL = next.cfg.AuditURL
+	running.LogLevel = next.cfg.LogLevel
+	running.RateLimitRPS = next.cfg.RateLimitRPS
+	running.RateLimitBurst = next.cfg.RateLimitBurst
+	r.cfg = &running
+
+	r.logger.Infow("configuration reloaded", "applied", applied)
+	if len(restart) > 0 {
+		r.logger.Infow("changed settings require a restart and were not applied", "settings", restart)
+	}
+	return nil
+}
+
+// reload — проверенная новая конфигурация с подготовленными ресурсами.
+type reload struct {
+	cfg          *Config
+	auditChanged bool
+	observers    []AuditObserver
+}
+
+// prepare загружает конфигурацию и проверяет то, что не проверяет
+// Validate: читаемость ключа шифрования и открытие файла аудита.
+func (r *Reloader) prepare() (*reload, error) {
+	cfg, err := LoadConfig(r.args, r.lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	next := &reload{cfg: cfg}
+
+	if cfg.CryptoKey != "" && cfg.CryptoKey != r.cfg.CryptoKey {
+		if _, err := security.LoadPrivateKey(cfg.CryptoKey); err != nil {
+			return nil, fmt.Errorf("-crypto-key: %w", err)
+		}
+	}
+
+	next.auditChanged = cfg.AuditFile != r.cfg.AuditFile || cfg.AuditURL != r.cfg.AuditURL
+	if next.auditChanged {
+		if next.observers, err = newAuditObservers(cfg, r.server.audit.Observers(), r.logger); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/logging"
+)
+
+func TestReloader_AppliesReloadableSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = logging.SetLevel("info") })
+
+	write(`{"key": "old", "rate_limit_rps": 5}`)
+	args := []string{"-c", path}
+	cfg, err := LoadConfig(args, lookup(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer()
+	s.live.Store(newLiveSettings(cfg, nil))
+	limiter := s.limiter()
+	rl := NewReloader(s, cfg, args, lookup(nil), s.logger)
+
+	// Лимит не изменился — ограничитель сохраняется вместе с корзинами.
+	write(`{"key": "new", "rate_limit_rps": 5, "log_level": "debug", "address": ":9999",
+		"audit_file": "` + filepath.Join(dir, "audit.log") + `"}`)
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.hashKey() != "new" {
+		t.Errorf("hash key = %q, want new", s.hashKey())
+	}
+	if s.limiter() != limiter {
+		t.Error("unchanged rate limit must keep the limiter")
+	}
+	if logging.GetLevel() != "debug" {
+		t.Errorf("log level = %v, want debug", logging.GetLevel())
+	}
+	obs := s.audit.Observers()
+	if len(obs) != 1 {
+		t.Fatalf("expected one audit observer, got %d", len(obs))
+	}
+	if _, ok := obs[0].(*FileAuditObserver); !ok {
+		t.Fatalf("expected file observer, got %T", obs[0])
+	}
+	if rl.cfg.Address != "localhost:8080" {
+		t.Errorf("address must require a restart, running config has %q", rl.cfg.Address)
+	}
+
+	write(`{"key": "new", "rate_limit_rps": 0}`)
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.limiter() != nil {
+		t.Error("rate limit 0 must disable the limiter")
+	}
+	if len(s.audit.Observers()) != 0 {
+		t.Error("audit observers must be removed")
+	}
+}
+
+func TestReloader_RejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.json")
+	if err := os.WriteFile(path, []byte(`{"key": "old"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-c", path}
+	cfg, err := LoadConfig(args, lookup(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer()
+	s.live.Store(newLiveSettings(cfg, nil))
+	rl := NewReloader(s, cfg, args, lookup(nil), s.logger)
+
+	for _, data := range []string{
+		`{"key": "new", "rate_limit_rps": -1}`,
+		`{"key": "new", "log_level": "loud"}`,
+		`{"key": "new", "audit_file": "` + filepath.Join(dir, "missing", "audit.log") + `"}`,
+		`{"key": "new", "crypto_key": "` + filepath.Join(dir, "missing.pem") + `"}`,
+		`{"key": `,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := rl.Reload(); err == nil {
+			t.Errorf("config %s must be rejected", data)
+		}
+		if s.hashKey() != "old" || len(s.audit.Observers()) != 0 {
+			t.Fatalf("rejected config %s changed the running server", data)
+		}
+	}
+}
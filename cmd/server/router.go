@@ -1,27 +1,67 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/zheki1/yaprmtrc/internal/auth"
 )
 
 func router(s *Server) http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(TracingMiddleware)
 	r.Use(LoggingMiddleware(s.logger))
-	r.Use(HashMiddleware(s.key))
+	r.Use(auditMiddleware(s.audit, r, s.trustedProxies))
+	r.Use(BodyLimitMiddleware(s.maxBodySize))
+	r.Use(rateLimitMiddleware(s.limiter, s.trustedProxies))
+	r.Use(AuthMiddleware(s.auth))
+	r.Use(ClientMiddleware(s.trustedProxies))
+	r.Use(TenantMiddleware(s.tenants))
+	r.Use(hashMiddleware(s.hashKey))
 	r.Use(GzipMiddleware)
 	r.Use(middleware.StripSlashes)
 
-	r.Post("/update/{type}/{name}/{value}", s.updateHandler)
-	r.Post("/update", s.updateHandlerJSON)
-	r.Post("/value", s.valueHandlerJSON)
-	r.Get("/value/{type}/{name}", s.valueHandler)
-	r.Get("/", s.pageHandler)
+	r.NotFound(notFoundHandler)
+	r.MethodNotAllowed(methodNotAllowedHandler)
+
+	reader := s.requireRole(auth.RoleReader)
+	writer := s.writeAccess()
+
+	// Устаревшие маршруты сохранены для совместимости с агентом;
+	// их аналоги в /api/v1 описаны в api/openapi.json.
+	r.With(writer).Post("/update/{type}/{name}/{value}", s.updateHandler)
+	r.With(writer).Post("/update", s.updateHandlerJSON)
+	r.With(reader).Post("/value", s.valueHandlerJSON)
+	r.With(reader).Get("/value/{type}/{name}", s.valueHandler)
+	r.With(reader).Get("/", s.pageHandler)
 	r.Get("/ping", s.pingHandler)
-	r.Post("/updates", s.batchUpdateHandler)
+	r.Get("/healthz", s.healthzHandler)
+	r.Get("/readyz", s.readyzHandler)
+	r.With(writer).Post("/updates", s.batchUpdateHandler)
+
+	r.With(reader).Get("/metric/{type}/{name}", s.metricPageHandler)
+	r.Get("/static/{file}", staticHandler)
+	r.With(s.requireRole(auth.RoleAdmin)).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+	r.Route("/api/v1", routesV1(s))
 
 	return r
 }
+
+// requireRole ограничивает маршрут ролью role, если аутентификация включена.
+func (s *Server) requireRole(role auth.Role) func(http.Handler) http.Handler {
+	return RequireRole(s.auth != nil, role)
+}
+
+// writeAccess ограничивает маршруты записи метрик: нужна роль writer, а
+// адрес агента должен входить в доверенную подсеть.
+func (s *Server) writeAccess() func(http.Handler) http.Handler {
+	role := s.requireRole(auth.RoleWriter)
+	subnet := TrustedSubnetMiddleware(s.trustedSubnet)
+	return func(next http.Handler) http.Handler {
+		return role(subnet(next))
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/zheki1/yaprmtrc/internal/selfmetrics"
+)
+
+// Показатели работы сервера. Они публикуются в GET /debug/vars
+// в переменной selfmetrics.Namespace (см. README, «Самонаблюдение»).
+var (
+	httpRequests = selfmetrics.NewCounterVec("http_requests_total", "method", "route", "status")
+	httpDuration = selfmetrics.NewHistogramVec("http_request_duration_seconds", nil, "method", "route")
+	httpInFlight = selfmetrics.NewGauge("http_requests_in_flight")
+
+	auditEvents         = selfmetrics.NewCounter("audit_events_total")
+	auditPublishSeconds = selfmetrics.NewHistogram("audit_publish_duration_seconds", nil)
+	auditInFlight       = selfmetrics.NewGauge("audit_notifications_in_flight")
+	auditErrors         = selfmetrics.NewCounterVec("audit_delivery_errors_total", "observer")
+	auditQueueDepth     = selfmetrics.NewGauge("audit_queue_depth")
+	auditSpilled        = selfmetrics.NewGauge("audit_spilled_events")
+	auditDropped        = selfmetrics.NewCounterVec("audit_dropped_events_total", "reason")
+
+	fileSaves       = selfmetrics.NewCounterVec("file_storage_saves_total", "result")
+	fileSaveSeconds = selfmetrics.NewHistogram("file_storage_save_duration_seconds", nil)
+	fileSaveMetrics = selfmetrics.NewGauge("file_storage_last_save_metrics")
+)
+
+// routeLabel возвращает шаблон маршрута chi, по которому обработан запрос.
+// Шаблон, а не URI, держит число серий http_* ограниченным.
+func routeLabel(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if p := rctx.RoutePattern(); p != "" {
+			return p
+		}
+	}
+	return "unmatched"
+}
+
+// registerPoolMetrics публикует статистику пула соединений с базой.
+func registerPoolMetrics(pool *pgxpool.Pool) {
+	stat := func(f func(*pgxpool.Stat) float64) func() float64 {
+		return func() float64 { return f(pool.Stat()) }
+	}
+
+	selfmetrics.NewGaugeFunc("db_pool_acquired_conns", stat(func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }))
+	selfmetrics.NewGaugeFunc("db_pool_idle_conns", stat(func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }))
+	selfmetrics.NewGaugeFunc("db_pool_total_conns", stat(func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }))
+	selfmetrics.NewGaugeFunc("db_pool_max_conns", stat(func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }))
+	selfmetrics.NewGaugeFunc("db_pool_acquires_total", stat(func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }))
+	selfmetrics.NewGaugeFunc("db_pool_empty_acquires_total", stat(func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }))
+	selfmetrics.NewGaugeFunc("db_pool_canceled_acquires_total", stat(func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) }))
+	selfmetrics.NewGaugeFunc("db_pool_acquire_duration_seconds_total", stat(func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }))
+}
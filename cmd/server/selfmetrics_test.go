@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+)
+
+func TestRouter_SelfMetrics(t *testing.T) {
+	_, h := newTestServerWithRouter()
+
+	const route = "/api/v1/metrics/{type}/{name}"
+	notFound := httpRequests.With(http.MethodGet, route, "404")
+	unmatched := httpRequests.With(http.MethodGet, "unmatched", "404")
+	before, unmatchedBefore := notFound.Value(), unmatched.Value()
+	durBefore := httpDuration.With(http.MethodGet, route).Value().Count
+
+	if w := get(h, "/api/v1/metrics/gauge/Missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if w := get(h, "/no/such/route"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	if n := notFound.Value() - before; n != 1 {
+		t.Errorf("requests by route = %d, want 1", n)
+	}
+	if n := unmatched.Value() - unmatchedBefore; n != 1 {
+		t.Errorf("unmatched requests = %d, want 1", n)
+	}
+	if n := httpDuration.With(http.MethodGet, route).Value().Count - durBefore; n != 1 {
+		t.Errorf("duration observations = %d, want 1", n)
+	}
+	if v := httpInFlight.Value(); v != 0 {
+		t.Errorf("in-flight requests = %d after completion", v)
+	}
+}
+
+func TestAuditPublisher_SelfMetrics(t *testing.T) {
+	before := auditEvents.Value()
+	durBefore := auditPublishSeconds.Value().Count
+
+	newTestServer().audit.Publish(AuditEvent{Metrics: []string{"Alloc"}})
+
+	if n := auditEvents.Value() - before; n != 1 {
+		t.Errorf("audit events = %d, want 1", n)
+	}
+	if n := auditPublishSeconds.Value().Count - durBefore; n != 1 {
+		t.Errorf("publish observations = %d, want 1", n)
+	}
+}
+
+func TestFileStorage_SelfMetrics(t *testing.T) {
+	okBefore := fileSaves.With("ok").Value()
+	errBefore := fileSaves.With("error").Value()
+
+	v := 1.0
+	metrics := []repository.TenantMetrics{{Metrics: models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &v}}}
+	if err := NewFileStorage(filepath.Join(t.TempDir(), "m.json")).Save(metrics); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFileStorage("/nonexistent/dir/m.json").Save(metrics); err == nil {
+		t.Fatal("expected save error")
+	}
+
+	if n := fileSaves.With("ok").Value() - okBefore; n != 1 {
+		t.Errorf("successful saves = %d, want 1", n)
+	}
+	if n := fileSaves.With("error").Value() - errBefore; n != 1 {
+		t.Errorf("failed saves = %d, want 1", n)
+	}
+	if n := fileSaveMetrics.Value(); n != 1 {
+		t.Errorf("last save metrics = %d, want 1", n)
+	}
+}
@@ -2,27 +2,69 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zheki1/yaprmtrc/internal/alerting"
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/cardinality"
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/netutil"
 	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
 )
 
 // Server — центральная структура HTTP-сервера сбора метрик.
-// Содержит хранилище, логгер, файловое хранилище, подключение к БД и настройки аудита.
 type Server struct {
-	storage     repository.Repository
+	storage     repository.Repository // с учётом числа серий поверх остальных обёрток
 	logger      Logger
 	fileStorage *FileStorage
 	syncSave    bool
 	db          *pgxpool.Pool
-	key         string
 	audit       *AuditPublisher
-	cryptoKey   string
+	history     *history.Store      // история значений для веб-интерфейса; nil — сбор отключён
+	alerts      *alerting.Engine    // nil, если файл правил не задан
+	tenants     *TenantResolver     // nil — арендатор берётся из токена или по умолчанию
+	auth        *auth.Authenticator // nil — аутентификация выключена
+	tokenFile   *auth.FileStore     // nil, если токены не в файле
+
+	trustedSubnet  netutil.Subnets // подсети агентов, которым разрешена запись
+	trustedProxies netutil.Subnets // прокси, чьим заголовкам X-Forwarded-For можно верить
+
+	cardinality         *cardinality.Repository // учёт числа серий, он же обёртка storage
+	maxBodySize         int64                   // 0 — без ограничения
+	maxDecompressedSize int64                   // размер тела после распаковки; 0 — без ограничения
+	maxBatchSize        int                     // элементов в пакете; 0 — без ограничения
+
+	// live — ключ подписи, ключ шифрования и ограничитель частоты запросов;
+	// заменяются целиком при перезагрузке конфигурации (SIGHUP).
+	live atomic.Pointer[liveSettings]
+	// shuttingDown выставляется при получении сигнала завершения; после
+	// этого /readyz отвечает 503.
+	shuttingDown atomic.Bool
+}
+
+// reloadTokens перечитывает файл токенов; при ошибке прежние токены
+// продолжают действовать.
+func (s *Server) reloadTokens() {
+	if s.tokenFile == nil {
+		return
+	}
+	if err := s.tokenFile.Reload(); err != nil {
+		s.logger.Errorw("cannot reload auth tokens, previous tokens kept", "error", err)
+	}
+}
+
+// logError пишет в журнал ошибку обработки запроса r вместе с
+// идентификаторами запроса и трассы.
+func (s *Server) logError(r *http.Request, msg string, err error) {
+	s.logger.Errorw(msg, append(tracing.Fields(r.Context()), "error", err)...)
 }
 
 func (s *Server) saveIfNeeded() {
 	if s.syncSave {
-		metrics, err := s.storage.GetAll(context.Background())
+		metrics, err := repository.Snapshot(context.Background(), s.storage)
 		if err != nil {
 			s.logger.Fatalf(err.Error())
 		}
@@ -0,0 +1,141 @@
+// Команда token выпускает, отзывает и перечисляет API-токены сервера.
+//
+//	token create -file tokens.json -tenant team-a -role writer -ttl 720h -description agent-01
+//	token list   -file tokens.json
+//	token revoke -file tokens.json <id>
+//
+// Вместо -file можно указать -d (DSN PostgreSQL), если сервер запущен с
+// -auth-db. Открытый токен печатается один раз при выпуске; в хранилище
+// попадает только его SHA-256.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zheki1/yaprmtrc/internal/auth"
+	"github.com/zheki1/yaprmtrc/internal/cli"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+const usage = `usage: token <create|list|revoke> [flags]
+
+  create  issue a new token and print it once
+  list    list issued tokens
+  revoke  revoke the token with the given ID
+`
+
+func main() {
+	cli.Exit("token", run(context.Background(), os.Args[1:], os.Stdout))
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(out)
+	file := fs.String("file", os.Getenv("AUTH_TOKENS"), "path to API tokens file (JSON)")
+	dsn := fs.String("d", os.Getenv("DATABASE_DSN"), "database dsn (tokens in the api_tokens table)")
+
+	var (
+		tenantID    *string
+		role        *string
+		ttl         *time.Duration
+		description *string
+	)
+	switch cmd {
+	case "create":
+		tenantID = fs.String("tenant", tenant.Default, "tenant of the token")
+		role = fs.String("role", string(auth.RoleWriter), "role: reader, writer or admin")
+		ttl = fs.Duration("ttl", 0, "token lifetime (0 — no expiry)")
+		description = fs.String("description", "", "free-form note, e.g. the agent host")
+	case "list", "revoke":
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, closeStore, err := openStore(ctx, *file, *dsn)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	switch cmd {
+	case "create":
+		plain, t, err := auth.Generate(*tenantID, auth.Role(*role), *ttl, *description)
+		if err != nil {
+			return err
+		}
+		if err := store.Create(ctx, t); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "id:     %s\ntenant: %s\nrole:   %s\n", t.ID, t.Tenant, t.Role)
+		if t.ExpiresAt != nil {
+			fmt.Fprintf(out, "expires: %s\n", t.ExpiresAt.Format(time.RFC3339))
+		}
+		fmt.Fprintf(out, "token:  %s\n\nThe token is shown only once, store it now.\n", plain)
+		return nil
+
+	case "list":
+		tokens, err := store.List(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTENANT\tROLE\tCREATED\tEXPIRES\tDESCRIPTION")
+		now := time.Now()
+		for _, t := range tokens {
+			expires := "never"
+			if t.ExpiresAt != nil {
+				expires = t.ExpiresAt.Format(time.RFC3339)
+				if t.Expired(now) {
+					expires += " (expired)"
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.ID, t.Tenant, t.Role, t.CreatedAt.Format(time.RFC3339), expires, t.Description)
+		}
+		return tw.Flush()
+
+	default: // revoke
+		if fs.NArg() != 1 {
+			return errors.New("revoke requires exactly one token ID")
+		}
+		if err := store.Revoke(ctx, fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "token %s revoked\n", fs.Arg(0))
+		return nil
+	}
+}
+
+// openStore открывает хранилище токенов: файл или базу данных.
+func openStore(ctx context.Context, file, dsn string) (auth.Store, func(), error) {
+	switch {
+	case file != "" && dsn != "":
+		return nil, nil, errors.New("-file and -d are mutually exclusive")
+	case file != "":
+		return auth.NewFileStore(file), func() {}, nil
+	case dsn != "":
+		pool, err := pgxpool.New(ctx, dsn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return auth.NewPostgresStore(pool), pool.Close, nil
+	default:
+		return nil, nil, errors.New("token store is not set: use -file or -d")
+	}
+}
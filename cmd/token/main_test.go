@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/auth"
+)
+
+func TestRun_CreateListRevoke(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AUTH_TOKENS", "")
+	t.Setenv("DATABASE_DSN", "")
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	var out bytes.Buffer
+	err := run(ctx, []string{"create", "-file", path, "-tenant", "team-a", "-role", "reader", "-ttl", "1h", "-description", "ci"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := regexp.MustCompile(`id:\s+(\S+)`).FindStringSubmatch(out.String())
+	plain := regexp.MustCompile(`token:\s+(\S+)`).FindStringSubmatch(out.String())
+	if id == nil || plain == nil {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	store := auth.NewFileStore(path)
+	a := &auth.Authenticator{Store: store}
+	p, err := a.Authenticate(ctx, plain[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Tenant != "team-a" || p.Role != auth.RoleReader {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+
+	out.Reset()
+	if err := run(ctx, []string{"list", "-file", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), id[1]) || strings.Contains(out.String(), plain[1]) {
+		t.Fatalf("list must show the ID but not the token:\n%s", out.String())
+	}
+
+	if err := run(ctx, []string{"revoke", "-file", path, id[1]}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(ctx, plain[1]); err == nil {
+		t.Fatal("revoked token must be rejected")
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	t.Setenv("AUTH_TOKENS", "")
+	t.Setenv("DATABASE_DSN", "")
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"list"},
+		{"create", "-file", path, "-role", "root"},
+		{"create", "-file", path, "-tenant", "bad tenant"},
+		{"revoke", "-file", path},
+		{"revoke", "-file", path, "missing"},
+	} {
+		if err := run(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
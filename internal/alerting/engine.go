@@ -0,0 +1,304 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// Состояния оповещения.
+const (
+	StatePending = "pending" // условие выполнено, но меньше Rule.For
+	StateFiring  = "firing"  // условие держится не меньше Rule.For
+)
+
+// notifyTimeout ограничивает отправку одного уведомления.
+const notifyTimeout = 10 * time.Second
+
+// Source — источник значений метрик; ему удовлетворяет repository.Repository.
+type Source interface {
+	GetGauge(ctx context.Context, name string) (float64, bool, error)
+	GetCounter(ctx context.Context, name string) (int64, bool, error)
+}
+
+// Logger — журнал движка; ему удовлетворяет *zap.SugaredLogger.
+type Logger interface {
+	Infow(msg string, fields ...any)
+	Errorf(template string, args ...interface{})
+}
+
+// Alert — активное оповещение.
+type Alert struct {
+	Rule     string     `json:"rule"`
+	Tenant   string     `json:"tenant"`
+	Expr     string     `json:"expr"`
+	Summary  string     `json:"summary,omitempty"`
+	State    string     `json:"state"`
+	Value    float64    `json:"value"`
+	ActiveAt time.Time  `json:"active_at"`
+	FiredAt  *time.Time `json:"fired_at,omitempty"`
+}
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// ruleState — состояние одного правила между вычислениями.
+type ruleState struct {
+	alert   *Alert   // nil, если условие не выполнено
+	samples []sample // точки counter для rate()
+}
+
+// Engine периодически вычисляет правила и рассылает уведомления
+// о переходах firing и resolved.
+type Engine struct {
+	source    Source
+	rules     []Rule
+	notifiers map[string]Notifier
+	logger    Logger
+	now       func() time.Time
+
+	mu    sync.RWMutex
+	state map[string]*ruleState
+}
+
+// NewEngine создаёт движок. notifiers — каналы по именам из ChannelConfig.
+func NewEngine(source Source, rules []Rule, notifiers map[string]Notifier, logger Logger) *Engine {
+	return &Engine{
+		source:    source,
+		rules:     rules,
+		notifiers: notifiers,
+		logger:    logger,
+		now:       time.Now,
+		state:     make(map[string]*ruleState, len(rules)),
+	}
+}
+
+// Run вычисляет правила каждые interval до отмены ctx.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		e.Eval(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Eval выполняет один цикл вычисления всех правил.
+func (e *Engine) Eval(ctx context.Context) {
+	now := e.now()
+
+	var pending []delivery
+	for _, r := range e.rules {
+		v, ok, err := e.value(ctx, r, now)
+		if err != nil {
+			e.logger.Errorf("alert rule %q: %v", r.Name, err)
+			continue
+		}
+		active := ok && r.Cond.Op.compare(v, r.Cond.Threshold)
+		if n := e.transition(r, active, v, now); n != nil {
+			pending = append(pending, delivery{rule: r, n: *n})
+		}
+	}
+
+	for _, d := range pending {
+		e.notify(ctx, d.rule, d.n)
+	}
+}
+
+type delivery struct {
+	rule Rule
+	n    Notification
+}
+
+// value читает значение операнда правила из метрик его арендатора. Второе
+// значение false, если данных пока нет: метрика не найдена или для rate()
+// ещё мало точек.
+func (e *Engine) value(ctx context.Context, r Rule, now time.Time) (float64, bool, error) {
+	ctx = tenant.WithTenant(ctx, r.tenantID())
+	c := r.Cond
+	if !c.Rate {
+		v, ok, err := e.source.GetGauge(ctx, c.Metric)
+		if err != nil || ok {
+			return v, ok, err
+		}
+		d, ok, err := e.source.GetCounter(ctx, c.Metric)
+		return float64(d), ok, err
+	}
+
+	d, ok, err := e.source.GetCounter(ctx, c.Metric)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := e.ruleState(r.key())
+	st.samples = append(st.samples, sample{t: now, v: float64(d)})
+
+	// Оставляем последнюю точку за пределами окна как опорную.
+	cut := 0
+	for cut < len(st.samples)-1 && now.Sub(st.samples[cut+1].t) >= c.Window {
+		cut++
+	}
+	st.samples = st.samples[cut:]
+
+	return rate(st.samples)
+}
+
+// rate вычисляет среднюю скорость роста counter в секунду. Уменьшение
+// значения считается сбросом счётчика: прирост берётся от нуля.
+func rate(samples []sample) (float64, bool, error) {
+	if len(samples) < 2 {
+		return 0, false, nil
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.t.Sub(first.t).Seconds()
+	if elapsed <= 0 {
+		return 0, false, nil
+	}
+
+	var inc float64
+	for i := 1; i < len(samples); i++ {
+		d := samples[i].v - samples[i-1].v
+		if d < 0 {
+			d = samples[i].v
+		}
+		inc += d
+	}
+	return inc / elapsed, true, nil
+}
+
+func (e *Engine) ruleState(key string) *ruleState {
+	st, ok := e.state[key]
+	if !ok {
+		st = &ruleState{}
+		e.state[key] = st
+	}
+	return st
+}
+
+// transition обновляет состояние правила и возвращает уведомление,
+// если оповещение перешло в firing или было разрешено.
+func (e *Engine) transition(r Rule, active bool, v float64, now time.Time) *Notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := e.ruleState(r.key())
+
+	if !active {
+		a := st.alert
+		st.alert = nil
+		if a != nil && a.State == StateFiring {
+			a.Value = v
+			e.logger.Infow("alert resolved", "rule", r.Name, "tenant", r.tenantID())
+			return &Notification{Status: StatusResolved, Alert: *a}
+		}
+		return nil
+	}
+
+	if st.alert == nil {
+		st.alert = &Alert{
+			Rule:     r.Name,
+			Tenant:   r.tenantID(),
+			Expr:     r.Cond.String(),
+			Summary:  r.Summary,
+			State:    StatePending,
+			ActiveAt: now,
+		}
+	}
+	a := st.alert
+	a.Value = v
+
+	if a.State == StatePending && now.Sub(a.ActiveAt) >= r.Cond.For {
+		a.State = StateFiring
+		fired := now
+		a.FiredAt = &fired
+		e.logger.Infow("alert firing", "rule", r.Name, "tenant", r.tenantID(), "value", v)
+		return &Notification{Status: StatusFiring, Alert: *a}
+	}
+	return nil
+}
+
+func (e *Engine) notify(ctx context.Context, r Rule, n Notification) {
+	channels := r.Channels
+	if len(channels) == 0 {
+		for name := range e.notifiers {
+			channels = append(channels, name)
+		}
+		sort.Strings(channels)
+	}
+
+	for _, name := range channels {
+		ch, ok := e.notifiers[name]
+		if !ok {
+			e.logger.Errorf("alert rule %q: unknown channel %q", r.Name, name)
+			continue
+		}
+		nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		if err := ch.Notify(nctx, n); err != nil {
+			e.logger.Errorf("alert rule %q: channel %q: %v", r.Name, name, err)
+		}
+		cancel()
+	}
+}
+
+// Active возвращает оповещения арендатора из ctx в состояниях pending и
+// firing, упорядоченные по имени правила.
+func (e *Engine) Active(ctx context.Context) []Alert {
+	id := tenant.FromContext(ctx)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	res := make([]Alert, 0)
+	for _, st := range e.state {
+		if st.alert != nil && st.alert.Tenant == id {
+			res = append(res, *st.alert)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Rule < res[j].Rule })
+	return res
+}
+
+// NewEngineFromConfig создаёт каналы уведомлений и движок по конфигурации.
+// Возвращает также функцию закрытия файловых каналов.
+func NewEngineFromConfig(cfg *Config, source Source, logger Logger) (*Engine, func() error, error) {
+	notifiers := make(map[string]Notifier, len(cfg.Channels))
+	var files []*FileNotifier
+
+	closeAll := func() error {
+		var firstErr error
+		for _, f := range files {
+			if err := f.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	for _, c := range cfg.Channels {
+		n, err := NewNotifier(c)
+		if err != nil {
+			_ = closeAll()
+			return nil, nil, fmt.Errorf("alert rules: %w", err)
+		}
+		if f, ok := n.(*FileNotifier); ok {
+			files = append(files, f)
+		}
+		notifiers[c.Name] = n
+	}
+
+	return NewEngine(source, cfg.Rules, notifiers, logger), closeAll, nil
+}
@@ -0,0 +1,202 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, msg Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func (n *recordingNotifier) statuses() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	res := make([]string, len(n.sent))
+	for i, m := range n.sent {
+		res[i] = m.Status
+	}
+	return res
+}
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newClock() *clock                   { return &clock{t: time.Unix(1_700_000_000, 0)} }
+
+func newTestEngine(t *testing.T, repo repository.Repository, exprs map[string]string) (*Engine, *recordingNotifier, *clock) {
+	t.Helper()
+
+	rules := make([]Rule, 0, len(exprs))
+	for name, expr := range exprs {
+		c, err := ParseCondition(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, Rule{Name: name, Expr: expr, Cond: c})
+	}
+
+	n := &recordingNotifier{}
+	e := NewEngine(repo, rules, map[string]Notifier{"rec": n}, zap.NewNop().Sugar())
+	c := newClock()
+	e.now = c.now
+	return e, n, c
+}
+
+func TestEngine_PendingFiringResolved(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	e, n, c := newTestEngine(t, repo, map[string]string{"HighHeap": "HeapAlloc > 100 for 2m"})
+
+	e.Eval(ctx)
+	if len(e.Active(ctx)) != 0 {
+		t.Fatal("missing metric must not raise an alert")
+	}
+
+	_ = repo.UpdateGauge(ctx, "HeapAlloc", 200)
+	e.Eval(ctx)
+	if a := e.Active(ctx); len(a) != 1 || a[0].State != StatePending {
+		t.Fatalf("expected pending alert, got %+v", a)
+	}
+
+	c.advance(time.Minute)
+	e.Eval(ctx)
+	if len(n.statuses()) != 0 {
+		t.Fatal("alert must not fire before for elapses")
+	}
+
+	c.advance(time.Minute)
+	e.Eval(ctx)
+	a := e.Active(ctx)
+	if len(a) != 1 || a[0].State != StateFiring || a[0].FiredAt == nil || a[0].Value != 200 {
+		t.Fatalf("expected firing alert, got %+v", a)
+	}
+
+	e.Eval(ctx)
+	if got := n.statuses(); len(got) != 1 || got[0] != StatusFiring {
+		t.Fatalf("firing must be notified once, got %v", got)
+	}
+
+	_ = repo.UpdateGauge(ctx, "HeapAlloc", 50)
+	e.Eval(ctx)
+	if len(e.Active(ctx)) != 0 {
+		t.Fatal("alert must be resolved")
+	}
+	if got := n.statuses(); len(got) != 2 || got[1] != StatusResolved {
+		t.Fatalf("expected resolved notification, got %v", got)
+	}
+}
+
+func TestEngine_PendingClearedSilently(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	e, n, c := newTestEngine(t, repo, map[string]string{"HighHeap": "HeapAlloc > 100 for 2m"})
+
+	_ = repo.UpdateGauge(ctx, "HeapAlloc", 200)
+	e.Eval(ctx)
+	c.advance(time.Minute)
+	_ = repo.UpdateGauge(ctx, "HeapAlloc", 10)
+	e.Eval(ctx)
+
+	if len(e.Active(ctx)) != 0 || len(n.statuses()) != 0 {
+		t.Fatal("pending alert must be dropped without notifications")
+	}
+}
+
+func TestEngine_CounterRate(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	e, n, c := newTestEngine(t, repo, map[string]string{"FastPoll": "rate(PollCount[1m]) > 1"})
+
+	_ = repo.UpdateCounter(ctx, "PollCount", 10)
+	e.Eval(ctx)
+	if len(e.Active(ctx)) != 0 {
+		t.Fatal("a single sample is not enough for rate")
+	}
+
+	c.advance(30 * time.Second)
+	_ = repo.UpdateCounter(ctx, "PollCount", 60) // 2/s
+	e.Eval(ctx)
+	a := e.Active(ctx)
+	if len(a) != 1 || a[0].State != StateFiring || a[0].Value != 2 {
+		t.Fatalf("expected firing alert with rate 2, got %+v", a)
+	}
+
+	// Через две минуты старые точки выходят из окна, прироста нет.
+	c.advance(2 * time.Minute)
+	e.Eval(ctx)
+	if len(e.Active(ctx)) != 0 {
+		t.Fatalf("expected resolved, got %+v", e.Active(ctx))
+	}
+	if got := n.statuses(); len(got) != 2 {
+		t.Fatalf("expected firing and resolved, got %v", got)
+	}
+}
+
+func TestRate_CounterReset(t *testing.T) {
+	at := time.Unix(0, 0)
+	v, ok, _ := rate([]sample{
+		{at, 100},
+		{at.Add(10 * time.Second), 150},
+		{at.Add(20 * time.Second), 30},
+	})
+	if !ok || v != 4 {
+		t.Fatalf("expected 4/s, got %v (%v)", v, ok)
+	}
+}
+
+func TestEngine_RoutesToRuleChannels(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	_ = repo.UpdateGauge(ctx, "Load", 5)
+
+	a, b := &recordingNotifier{}, &recordingNotifier{}
+	cond, _ := ParseCondition("Load > 1")
+	e := NewEngine(repo, []Rule{{Name: "Load", Cond: cond, Channels: []string{"b"}}},
+		map[string]Notifier{"a": a, "b": b}, zap.NewNop().Sugar())
+
+	e.Eval(ctx)
+	if len(a.statuses()) != 0 || len(b.statuses()) != 1 {
+		t.Fatalf("notification must go only to channel b: a=%v b=%v", a.statuses(), b.statuses())
+	}
+}
+
+func TestEngine_RulesAreTenantScoped(t *testing.T) {
+	ctx := context.Background()
+	teamA := tenant.WithTenant(ctx, "team-a")
+	repo := repository.NewMemRepository()
+	_ = repo.UpdateGauge(teamA, "HeapAlloc", 200)
+
+	cond, err := ParseCondition("HeapAlloc > 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(repo, []Rule{
+		{Name: "HighHeap", Cond: cond},
+		{Name: "HighHeap", Tenant: "team-a", Cond: cond},
+	}, nil, zap.NewNop().Sugar())
+	e.Eval(ctx)
+
+	if a := e.Active(ctx); len(a) != 0 {
+		t.Fatalf("default tenant has no HeapAlloc, got %+v", a)
+	}
+	if a := e.Active(teamA); len(a) != 1 || a[0].Tenant != "team-a" || a[0].State != StateFiring {
+		t.Fatalf("team-a rule must fire on team-a series, got %+v", a)
+	}
+}
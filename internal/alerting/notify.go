@@ -0,0 +1,243 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// Статусы уведомления.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Notification — уведомление о смене состояния оповещения.
+type Notification struct {
+	Status string `json:"status"`
+	Alert  Alert  `json:"alert"`
+}
+
+// Notifier — канал доставки уведомлений.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NewNotifier создаёт канал по его описанию из файла правил.
+func NewNotifier(c ChannelConfig) (Notifier, error) {
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("channel %q: %w", c.Name, err)
+	}
+
+	switch c.Type {
+	case "webhook":
+		return NewWebhookNotifier(c.URL), nil
+	case "file":
+		return NewFileNotifier(c.Path)
+	default:
+		return &SMTPNotifier{Addr: c.Addr, From: c.From, To: c.To, Username: c.Username, Password: c.Password}, nil
+	}
+}
+
+// WebhookNotifier отправляет уведомление JSON-запросом POST.
+type WebhookNotifier struct {
+	url    string
+	client *retryablehttp.Client
+}
+
+// NewWebhookNotifier создаёт webhook-канал с повторными попытками.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	client := retryablehttp.NewClient()
+	client.RetryMax = 3
+	client.RetryWaitMin = 100 * time.Millisecond
+	client.RetryWaitMax = 1 * time.Second
+	client.Logger = nil
+
+	return &WebhookNotifier{url: url, client: client}
+}
+
+// Notify отправляет уведомление. Ответ со статусом не 2xx считается ошибкой.
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Notification) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("webhook: marshal: %w", err)
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("webhook: request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: post: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FileNotifier дописывает уведомления в файл строками JSON.
+type FileNotifier struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileNotifier открывает файл для дозаписи, создавая его при необходимости.
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("alert file: %w", err)
+	}
+	return &FileNotifier{file: f}, nil
+}
+
+// Notify записывает уведомление одной строкой JSON.
+func (n *FileNotifier) Notify(_ context.Context, msg Notification) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("alert file: marshal: %w", err)
+	}
+	data = append(data, '\n')
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, err := n.file.Write(data); err != nil {
+		return fmt.Errorf("alert file: write: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает файл.
+func (n *FileNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.file.Close()
+}
+
+// SMTPNotifier отправляет уведомления письмом. Если задан Username,
+// используется аутентификация PLAIN (net/smtp разрешает её только
+// по TLS или на localhost).
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+// Notify отправляет письмо с описанием оповещения. Соединение ограничено
+// сроком ctx: зависший сервер не блокирует движок дольше notifyTimeout.
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Notification) error {
+	if err := n.send(ctx, msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// send повторяет smtp.SendMail поверх соединения, привязанного к ctx.
+func (n *SMTPNotifier) send(ctx context.Context, msg Notification) error {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// Отмена ctx прерывает операцию, которая уже ждёт сервер.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", n.Username, n.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *SMTPNotifier) message(msg Notification) []byte {
+	a := msg.Alert
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(msg.Status), a.Rule)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSafe(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "Rule: %s\r\n", a.Rule)
+	fmt.Fprintf(&b, "Tenant: %s\r\n", a.Tenant)
+	fmt.Fprintf(&b, "Expression: %s\r\n", a.Expr)
+	fmt.Fprintf(&b, "Status: %s\r\n", msg.Status)
+	fmt.Fprintf(&b, "Value: %g\r\n", a.Value)
+	fmt.Fprintf(&b, "Active since: %s\r\n", a.ActiveAt.Format(time.RFC3339))
+	if a.Summary != "" {
+		fmt.Fprintf(&b, "\r\n%s\r\n", a.Summary)
+	}
+	return b.Bytes()
+}
+
+// headerSafe убирает переводы строк, чтобы значение не могло добавить заголовки.
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,265 @@
+package alerting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Status: StatusFiring,
+		Alert: Alert{
+			Rule:     "HighHeap",
+			Expr:     "HeapAlloc > 1e+09 for 2m0s",
+			Summary:  "heap is too large",
+			State:    StateFiring,
+			Value:    2e9,
+			ActiveAt: time.Unix(1_700_000_000, 0).UTC(),
+		},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	got := make(chan Notification, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		got <- n
+	}))
+	defer ts.Close()
+
+	if err := NewWebhookNotifier(ts.URL).Notify(context.Background(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-got; n.Status != StatusFiring || n.Alert.Rule != "HighHeap" {
+		t.Fatalf("unexpected payload %+v", n)
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	if err := NewWebhookNotifier(ts.URL).Notify(context.Background(), testNotification()); err == nil {
+		t.Fatal("expected error for 400 response")
+	}
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	n, err := NewFileNotifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = n.Notify(context.Background(), testNotification())
+	_ = n.Notify(context.Background(), testNotification())
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"rule":"HighHeap"`) {
+		t.Fatalf("unexpected file content %q", data)
+	}
+}
+
+// fakeSMTP — минимальный SMTP-сервер для тестов: принимает одно письмо
+// и отдаёт его в канал.
+type fakeSMTP struct {
+	ln   net.Listener
+	mail chan smtpMail
+}
+
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, mail: make(chan smtpMail, 1)}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(conn)
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+
+	var m smtpMail
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			m.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			m.to = append(m.to, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 end with .")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			m.data = b.String()
+			reply("250 OK")
+			s.mail <- m
+		case upper == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	srv := startFakeSMTP(t)
+
+	n := &SMTPNotifier{
+		Addr: srv.ln.Addr().String(),
+		From: "alerts@example.com",
+		To:   []string{"ops@example.com", "dev@example.com"},
+	}
+	if err := n.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-srv.mail:
+		if m.from != "alerts@example.com" || len(m.to) != 2 {
+			t.Fatalf("unexpected envelope %+v", m)
+		}
+		for _, want := range []string{"Subject: [FIRING] HighHeap", "Value: 2e+09", "heap is too large"} {
+			if !strings.Contains(m.data, want) {
+				t.Errorf("message has no %q:\n%s", want, m.data)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+}
+
+func TestSMTPNotifier_SilentServerTimesOut(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	// Сервер принимает соединение и ничего не отвечает.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	n := &SMTPNotifier{Addr: ln.Addr().String(), From: "alerts@example.com", To: []string{"ops@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := n.Notify(ctx, testNotification()); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Notify must respect ctx deadline, took %s", elapsed)
+	}
+}
+
+func TestNewEngineFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	cfg, err := ParseConfig([]byte(`{
+		"channels": [{"name": "log", "type": "file", "path": ` + strconvQuote(path) + `}],
+		"rules": [{"name": "Up", "expr": "Up >= 1"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, closeFn, err := NewEngineFromConfig(cfg, staticSource{"Up": 1}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Eval(context.Background())
+	if err := closeFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"status":"firing"`) {
+		t.Fatalf("file channel got nothing: %q", data)
+	}
+}
+
+func strconvQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+type staticSource map[string]float64
+
+func (s staticSource) GetGauge(_ context.Context, name string) (float64, bool, error) {
+	v, ok := s[name]
+	return v, ok, nil
+}
+
+func (s staticSource) GetCounter(context.Context, string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Infow(string, ...any)          {}
+func (nopLogger) Errorf(string, ...interface{}) {}
@@ -0,0 +1,289 @@
+// Package alerting вычисляет правила оповещений по метрикам из хранилища
+// и отправляет уведомления через подключаемые каналы.
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// DefaultInterval — период вычисления правил по умолчанию.
+const DefaultInterval = 15 * time.Second
+
+// DefaultRateWindow — окно rate(), если оно не указано в выражении.
+const DefaultRateWindow = time.Minute
+
+// Operator — оператор сравнения значения с порогом.
+type Operator string
+
+// Поддерживаемые операторы сравнения.
+const (
+	OpGT Operator = ">"
+	OpGE Operator = ">="
+	OpLT Operator = "<"
+	OpLE Operator = "<="
+	OpEQ Operator = "=="
+	OpNE Operator = "!="
+)
+
+func (op Operator) compare(v, threshold float64) bool {
+	switch op {
+	case OpGT:
+		return v > threshold
+	case OpGE:
+		return v >= threshold
+	case OpLT:
+		return v < threshold
+	case OpLE:
+		return v <= threshold
+	case OpEQ:
+		return v == threshold
+	case OpNE:
+		return v != threshold
+	}
+	return false
+}
+
+// Condition — разобранное выражение правила.
+type Condition struct {
+	Metric    string        // имя метрики
+	Rate      bool          // rate(): скорость роста counter в секунду
+	Window    time.Duration // окно rate()
+	Op        Operator
+	Threshold float64
+	For       time.Duration // сколько условие должно держаться до срабатывания
+}
+
+// String возвращает выражение в каноническом виде.
+func (c Condition) String() string {
+	operand := c.Metric
+	if c.Rate {
+		operand = fmt.Sprintf("rate(%s[%s])", c.Metric, c.Window)
+	}
+	s := fmt.Sprintf("%s %s %s", operand, c.Op, strconv.FormatFloat(c.Threshold, 'g', -1, 64))
+	if c.For > 0 {
+		s += " for " + c.For.String()
+	}
+	return s
+}
+
+var exprRe = regexp.MustCompile(`^\s*(?:rate\(\s*([A-Za-z0-9_.:-]+)\s*(?:\[\s*([^\]\s]+)\s*\])?\s*\)|([A-Za-z0-9_.:-]+))` +
+	`\s*(>=|<=|==|!=|>|<)\s*(\S+)(?:\s+for\s+(\S+))?\s*$`)
+
+// ParseCondition разбирает выражение вида
+//
+//	HeapAlloc > 1e9 for 2m
+//	rate(PollCount[1m]) >= 10
+//
+// Слева — имя метрики (gauge или counter) либо rate(counter[окно]);
+// справа — число. Суффикс "for <длительность>" необязателен.
+func ParseCondition(expr string) (Condition, error) {
+	m := exprRe.FindStringSubmatch(expr)
+	if m == nil {
+		return Condition{}, fmt.Errorf("invalid expression %q: expected \"<metric> <op> <number> [for <duration>]\"", expr)
+	}
+
+	c := Condition{Op: Operator(m[4])}
+
+	if m[1] != "" {
+		c.Metric = m[1]
+		c.Rate = true
+		c.Window = DefaultRateWindow
+		if m[2] != "" {
+			w, err := time.ParseDuration(m[2])
+			if err != nil || w <= 0 {
+				return Condition{}, fmt.Errorf("invalid rate window %q in %q", m[2], expr)
+			}
+			c.Window = w
+		}
+	} else {
+		c.Metric = m[3]
+	}
+
+	threshold, err := strconv.ParseFloat(m[5], 64)
+	if err != nil {
+		return Condition{}, fmt.Errorf("invalid threshold %q in %q", m[5], expr)
+	}
+	c.Threshold = threshold
+
+	if m[6] != "" {
+		d, err := time.ParseDuration(m[6])
+		if err != nil || d < 0 {
+			return Condition{}, fmt.Errorf("invalid duration %q in %q", m[6], expr)
+		}
+		c.For = d
+	}
+
+	return c, nil
+}
+
+// Rule — правило оповещения. Правило вычисляется по метрикам одного
+// арендатора.
+type Rule struct {
+	Name     string    `json:"name"`
+	Tenant   string    `json:"tenant,omitempty"` // пусто — tenant.Default
+	Expr     string    `json:"expr"`
+	Summary  string    `json:"summary,omitempty"`
+	Channels []string  `json:"channels,omitempty"` // пусто — все каналы
+	Cond     Condition `json:"-"`
+}
+
+// tenantID возвращает арендатора правила.
+func (r Rule) tenantID() string {
+	if r.Tenant == "" {
+		return tenant.Default
+	}
+	return r.Tenant
+}
+
+// key — ключ состояния правила: имена уникальны в пределах арендатора.
+func (r Rule) key() string {
+	return r.tenantID() + "/" + r.Name
+}
+
+// ChannelConfig описывает канал уведомлений. Набор полей зависит от Type:
+//   - webhook: URL;
+//   - file: Path;
+//   - smtp: Addr, From, To, необязательные Username и Password.
+type ChannelConfig struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	URL      string   `json:"url,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Addr     string   `json:"addr,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// Duration — time.Duration, который в JSON записывается строкой ("30s").
+type Duration time.Duration
+
+// UnmarshalJSON разбирает длительность из строки в формате time.ParseDuration.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON записывает длительность строкой.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config — содержимое файла правил.
+type Config struct {
+	Interval Duration        `json:"interval,omitempty"`
+	Channels []ChannelConfig `json:"channels"`
+	Rules    []Rule          `json:"rules"`
+}
+
+// LoadConfig читает и проверяет файл правил в формате JSON.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("alert rules: %w", err)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig разбирает и проверяет конфигурацию правил. Возвращает все
+// найденные ошибки сразу.
+func ParseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("alert rules: %w", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = Duration(DefaultInterval)
+	}
+
+	var errs []error
+
+	channels := make(map[string]bool, len(cfg.Channels))
+	for i, ch := range cfg.Channels {
+		if ch.Name == "" {
+			errs = append(errs, fmt.Errorf("channel #%d: name is required", i))
+			continue
+		}
+		if channels[ch.Name] {
+			errs = append(errs, fmt.Errorf("channel %q: duplicate name", ch.Name))
+		}
+		channels[ch.Name] = true
+		if err := ch.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("channel %q: %w", ch.Name, err))
+		}
+	}
+
+	names := make(map[string]bool, len(cfg.Rules))
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		if r.Tenant != "" {
+			if err := tenant.Validate(r.Tenant); err != nil {
+				errs = append(errs, fmt.Errorf("rule %q: %w", r.Name, err))
+			}
+		}
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("rule #%d: name is required", i))
+		} else if names[r.key()] {
+			errs = append(errs, fmt.Errorf("rule %q: duplicate name", r.Name))
+		}
+		names[r.key()] = true
+
+		cond, err := ParseCondition(r.Expr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", r.Name, err))
+		}
+		r.Cond = cond
+
+		for _, ch := range r.Channels {
+			if !channels[ch] {
+				errs = append(errs, fmt.Errorf("rule %q: unknown channel %q", r.Name, ch))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("alert rules: %w", err)
+	}
+	return &cfg, nil
+}
+
+func (c ChannelConfig) validate() error {
+	switch c.Type {
+	case "webhook":
+		if c.URL == "" {
+			return errors.New("url is required")
+		}
+	case "file":
+		if c.Path == "" {
+			return errors.New("path is required")
+		}
+	case "smtp":
+		if c.Addr == "" || c.From == "" || len(c.To) == 0 {
+			return errors.New("addr, from and to are required")
+		}
+		if strings.ContainsAny(c.From, "\r\n") {
+			return errors.New("invalid from address")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", c.Type)
+	}
+	return nil
+}
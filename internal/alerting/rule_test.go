@@ -0,0 +1,110 @@
+package alerting
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Condition
+	}{
+		{"HeapAlloc > 1e9 for 2m", Condition{Metric: "HeapAlloc", Op: OpGT, Threshold: 1e9, For: 2 * time.Minute}},
+		{"cpu.user<=0.5", Condition{Metric: "cpu.user", Op: OpLE, Threshold: 0.5}},
+		{"rate(PollCount[30s]) >= 10", Condition{Metric: "PollCount", Rate: true, Window: 30 * time.Second, Op: OpGE, Threshold: 10}},
+		{" rate( PollCount ) != -1 for 10s ", Condition{Metric: "PollCount", Rate: true, Window: DefaultRateWindow, Op: OpNE, Threshold: -1, For: 10 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseCondition(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCondition_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"HeapAlloc",
+		"HeapAlloc > ",
+		"HeapAlloc => 1",
+		"HeapAlloc > abc",
+		"HeapAlloc > 1 for soon",
+		"rate(PollCount[0s]) > 1",
+		"rate(PollCount[x]) > 1",
+		"Heap Alloc > 1",
+	} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestConditionString(t *testing.T) {
+	c, err := ParseCondition("rate(PollCount) > 5 for 1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.String(); got != "rate(PollCount[1m0s]) > 5 for 1m0s" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{
+		"interval": "5s",
+		"channels": [{"name": "log", "type": "file", "path": "alerts.log"}],
+		"rules": [{"name": "HighHeap", "expr": "HeapAlloc > 1e9 for 2m", "channels": ["log"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(cfg.Interval) != 5*time.Second {
+		t.Fatalf("unexpected interval %v", cfg.Interval)
+	}
+	if cfg.Rules[0].Cond.Threshold != 1e9 || cfg.Rules[0].Cond.For != 2*time.Minute {
+		t.Fatalf("condition is not parsed: %+v", cfg.Rules[0].Cond)
+	}
+
+	cfg, err = ParseConfig([]byte(`{"rules": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(cfg.Interval) != DefaultInterval {
+		t.Fatalf("expected default interval, got %v", cfg.Interval)
+	}
+}
+
+func TestParseConfig_ReportsAllErrors(t *testing.T) {
+	_, err := ParseConfig([]byte(`{
+		"channels": [
+			{"name": "hook", "type": "webhook"},
+			{"name": "pager", "type": "pager"}
+		],
+		"rules": [
+			{"name": "A", "expr": "x >"},
+			{"name": "A", "expr": "x > 1", "channels": ["missing"]}
+		]
+	}`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		`channel "hook": url is required`,
+		`channel "pager": unknown type`,
+		`rule "A": invalid expression`,
+		`rule "A": duplicate name`,
+		`unknown channel "missing"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
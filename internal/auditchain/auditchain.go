@@ -0,0 +1,306 @@
+// Package auditchain делает журнал аудита защищённым от незаметных правок:
+// каждая запись содержит номер, хеш предыдущей записи и собственный хеш
+// (SHA-256 или HMAC-SHA256), а периодические контрольные точки подписываются
+// ключом RSA. Verify находит первую изменённую, удалённую или переставленную
+// запись.
+//
+// Формат файла — JSON по строке. Запись:
+//
+//	{"seq":1,"event":{...},"prev":"000…0","hash":"9f…"}
+//
+// Контрольная точка:
+//
+//	{"checkpoint":{"seq":100,"hash":"9f…","ts":1700000000,"sig":"base64…"}}
+package auditchain
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Способы сцепления записей.
+const (
+	ModeSHA256 = "sha256" // хеш проверяет любой, подделка видна только по подписанным контрольным точкам
+	ModeHMAC   = "hmac"   // без ключа нельзя ни пересчитать, ни проверить цепочку
+)
+
+// Genesis — значение prev первой записи.
+var Genesis = strings.Repeat("0", sha256.Size*2)
+
+// maxLine ограничивает длину строки журнала при чтении.
+const maxLine = 1 << 20
+
+// Record — звено цепочки.
+type Record struct {
+	Seq   uint64          `json:"seq"`
+	Event json.RawMessage `json:"event"`
+	Prev  string          `json:"prev"`
+	Hash  string          `json:"hash"`
+}
+
+// Checkpoint фиксирует номер и хеш последней записи и подписывается, чтобы
+// цепочку нельзя было пересчитать заново или укоротить до этой записи.
+type Checkpoint struct {
+	Seq       uint64 `json:"seq"`
+	Hash      string `json:"hash"`
+	Time      int64  `json:"ts"`
+	Signature string `json:"sig"`
+}
+
+// line — строка файла: запись или контрольная точка.
+type line struct {
+	Record
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// signed возвращает подписываемые байты контрольной точки.
+func (c Checkpoint) signed() []byte {
+	return []byte("checkpoint\n" + strconv.FormatUint(c.Seq, 10) + "\n" + c.Hash + "\n" + strconv.FormatInt(c.Time, 10))
+}
+
+// Chain вычисляет хеши записей.
+type Chain struct {
+	Mode string // ModeSHA256 или ModeHMAC
+	Key  []byte // ключ HMAC
+}
+
+// Validate проверяет способ сцепления и наличие ключа.
+func (c Chain) Validate() error {
+	switch c.Mode {
+	case ModeSHA256:
+		return nil
+	case ModeHMAC:
+		if len(c.Key) == 0 {
+			return errors.New("hmac chain requires a key")
+		}
+		return nil
+	default:
+		return fmt.Errorf("chain mode must be %s or %s", ModeSHA256, ModeHMAC)
+	}
+}
+
+// Sum возвращает хеш записи seq с событием event после записи с хешем prev.
+func (c Chain) Sum(seq uint64, prev string, event []byte) string {
+	var h hash.Hash
+	if c.Mode == ModeHMAC {
+		h = hmac.New(sha256.New, c.Key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(strconv.FormatUint(seq, 10) + "\n" + prev + "\n"))
+	h.Write(event)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// State — положение конца цепочки, с которого продолжается запись.
+type State struct {
+	Seq             uint64 // номер последней записи; 0 — записей нет
+	Hash            string // хеш последней записи; Genesis, если записей нет
+	SinceCheckpoint int    // записей после последней контрольной точки
+}
+
+// Resume читает журнал и возвращает конец цепочки. Цепочка при этом не
+// проверяется (для этого есть Verify), но строки без полей цепочки — ошибка:
+// сцепление начинается с пустого файла или продолжает сцепленный.
+func Resume(r io.Reader) (State, error) {
+	st := State{Hash: Genesis}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLine)
+	for n := 1; sc.Scan(); n++ {
+		var l line
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			return State{}, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case l.Checkpoint != nil:
+			st.SinceCheckpoint = 0
+		case l.Hash != "" && l.Seq > 0:
+			st.Seq, st.Hash = l.Seq, l.Hash
+			st.SinceCheckpoint++
+		default:
+			return State{}, fmt.Errorf("line %d is not a chained audit record; start the chain in a new file", n)
+		}
+	}
+	return st, sc.Err()
+}
+
+// Writer дописывает сцепленные записи и контрольные точки.
+type Writer struct {
+	w     io.Writer
+	chain Chain
+	key   *rsa.PrivateKey // nil — контрольные точки не пишутся
+	every int
+	now   func() time.Time
+	st    State
+}
+
+// NewWriter возвращает Writer, продолжающий цепочку с состояния st.
+// Если signer задан, после каждых every записей пишется подписанная
+// контрольная точка.
+func NewWriter(w io.Writer, chain Chain, signer *rsa.PrivateKey, every int, st State) (*Writer, error) {
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+	if st.Hash == "" {
+		st.Hash = Genesis
+	}
+	return &Writer{w: w, chain: chain, key: signer, every: every, now: time.Now, st: st}, nil
+}
+
+// Append дописывает событие event (JSON) и, если пора, контрольную точку.
+// Каждая строка пишется одним вызовом Write.
+func (w *Writer) Append(event []byte) error {
+	seq := w.st.Seq + 1
+	rec := Record{Seq: seq, Event: event, Prev: w.st.Hash}
+	rec.Hash = w.chain.Sum(seq, rec.Prev, event)
+	if err := w.writeLine(rec); err != nil {
+		return err
+	}
+	w.st.Seq, w.st.Hash = seq, rec.Hash
+	w.st.SinceCheckpoint++
+
+	if w.every > 0 && w.st.SinceCheckpoint >= w.every {
+		return w.Checkpoint()
+	}
+	return nil
+}
+
+// Checkpoint пишет подписанную контрольную точку, если после предыдущей
+// появились записи и задан ключ подписи.
+func (w *Writer) Checkpoint() error {
+	if w.key == nil || w.st.SinceCheckpoint == 0 {
+		return nil
+	}
+	cp := Checkpoint{Seq: w.st.Seq, Hash: w.st.Hash, Time: w.now().Unix()}
+	digest := sha256.Sum256(cp.signed())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, w.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return fmt.Errorf("sign checkpoint: %w", err)
+	}
+	cp.Signature = base64.StdEncoding.EncodeToString(sig)
+
+	if err := w.writeLine(struct {
+		Checkpoint Checkpoint `json:"checkpoint"`
+	}{cp}); err != nil {
+		return err
+	}
+	w.st.SinceCheckpoint = 0
+	return nil
+}
+
+// State возвращает текущий конец цепочки.
+func (w *Writer) State() State { return w.st }
+
+func (w *Writer) writeLine(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(append(data, '\n'))
+	return err
+}
+
+// Report — итог успешной проверки.
+type Report struct {
+	Records     int
+	Checkpoints int
+	Signed      int    // контрольных точек с проверенной подписью
+	LastSeq     uint64 // номер последней записи
+	Unprotected int    // записей после последней контрольной точки
+}
+
+// BrokenError описывает первую запись, на которой цепочка нарушена.
+type BrokenError struct {
+	Line   int    // номер строки файла, с 1
+	Seq    uint64 // номер записи из строки; 0 — не прочитан
+	Reason string
+}
+
+func (e *BrokenError) Error() string {
+	if e.Seq > 0 {
+		return fmt.Sprintf("line %d (record %d): %s", e.Line, e.Seq, e.Reason)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// Verify проверяет журнал: непрерывность номеров (удаление и перестановка),
+// связь prev с хешем предыдущей записи, хеш каждой записи (изменение) и
+// соответствие контрольных точек цепочке. Подписи контрольных точек
+// проверяются, если задан pub. Возвращает *BrokenError для первой
+// нарушенной записи.
+//
+// Удаление записей после последней контрольной точки не обнаруживается;
+// их число возвращается в Report.Unprotected.
+func Verify(r io.Reader, chain Chain, pub *rsa.PublicKey) (Report, error) {
+	var rep Report
+	if err := chain.Validate(); err != nil {
+		return rep, err
+	}
+
+	prev := Genesis
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLine)
+	n := 0
+	for sc.Scan() {
+		n++
+		var l line
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			return rep, &BrokenError{Line: n, Reason: "not valid JSON: " + err.Error()}
+		}
+
+		if cp := l.Checkpoint; cp != nil {
+			if cp.Seq != rep.LastSeq || cp.Hash != prev {
+				return rep, &BrokenError{Line: n, Seq: cp.Seq, Reason: fmt.Sprintf(
+					"checkpoint for record %d does not match the chain, which ends at record %d here",
+					cp.Seq, rep.LastSeq)}
+			}
+			if pub != nil {
+				sig, err := base64.StdEncoding.DecodeString(cp.Signature)
+				digest := sha256.Sum256(cp.signed())
+				if err != nil || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+					return rep, &BrokenError{Line: n, Seq: cp.Seq, Reason: "checkpoint signature is invalid"}
+				}
+				rep.Signed++
+			}
+			rep.Checkpoints++
+			rep.Unprotected = 0
+			continue
+		}
+
+		want := rep.LastSeq + 1
+		switch {
+		case l.Seq == 0 || l.Hash == "":
+			return rep, &BrokenError{Line: n, Reason: "not a chained audit record"}
+		case l.Seq != want:
+			return rep, &BrokenError{Line: n, Seq: l.Seq, Reason: fmt.Sprintf(
+				"expected record %d: records were deleted or reordered", want)}
+		case l.Prev != prev:
+			return rep, &BrokenError{Line: n, Seq: l.Seq, Reason: "prev does not match the previous record's hash"}
+		case !hmac.Equal([]byte(chain.Sum(l.Seq, l.Prev, l.Event)), []byte(l.Hash)):
+			return rep, &BrokenError{Line: n, Seq: l.Seq, Reason: "hash mismatch: record was modified"}
+		}
+
+		prev = l.Hash
+		rep.LastSeq = l.Seq
+		rep.Records++
+		rep.Unprotected++
+	}
+	if err := sc.Err(); err != nil {
+		return rep, &BrokenError{Line: n + 1, Reason: err.Error()}
+	}
+	return rep, nil
+}
@@ -0,0 +1,183 @@
+// Package auth реализует аутентификацию по API-токенам (Authorization: Bearer)
+// и ролевую модель доступа. Токены хранятся только в виде SHA-256: в файле
+// (FileStore) или в PostgreSQL (PostgresStore); открытый токен показывается
+// один раз при выпуске.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// Role — роль владельца токена. Роли упорядочены: admin может всё, что
+// может writer, а writer — всё, что может reader.
+type Role string
+
+// Роли доступа.
+const (
+	RoleReader Role = "reader" // чтение метрик
+	RoleWriter Role = "writer" // запись метрик (агенты)
+	RoleAdmin  Role = "admin"  // удаление метрик и административные операции
+)
+
+var roleLevel = map[Role]int{RoleReader: 1, RoleWriter: 2, RoleAdmin: 3}
+
+// Valid сообщает, известна ли роль.
+func (r Role) Valid() bool {
+	_, ok := roleLevel[r]
+	return ok
+}
+
+// Allows сообщает, достаточно ли роли r для операции, требующей required.
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleLevel[r] >= roleLevel[required]
+}
+
+// Ошибки аутентификации.
+var (
+	ErrUnknownToken = errors.New("unknown API token")
+	ErrExpiredToken = errors.New("API token has expired")
+	ErrNotFound     = errors.New("token not found")
+)
+
+// Token — выпущенный API-токен. Hash — SHA-256 открытого токена в hex.
+type Token struct {
+	ID          string     `json:"id"`
+	Hash        string     `json:"sha256"`
+	Tenant      string     `json:"tenant"`
+	Role        Role       `json:"role"`
+	Description string     `json:"description,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired сообщает, истёк ли срок действия токена к моменту now.
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Validate проверяет поля токена перед сохранением.
+func (t Token) Validate() error {
+	var errs []error
+	if t.ID == "" {
+		errs = append(errs, errors.New("id is required"))
+	}
+	if b, err := hex.DecodeString(t.Hash); err != nil || len(b) != sha256.Size {
+		errs = append(errs, fmt.Errorf("sha256 must be %d hex characters", 2*sha256.Size))
+	}
+	if err := tenant.Validate(t.Tenant); err != nil {
+		errs = append(errs, err)
+	}
+	if !t.Role.Valid() {
+		errs = append(errs, fmt.Errorf("unknown role %q", t.Role))
+	}
+	return errors.Join(errs...)
+}
+
+// HashToken возвращает SHA-256 открытого токена в hex — в таком виде
+// токены хранятся и ищутся.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenPrefix помогает распознать токен в логах и сканерах секретов.
+const tokenPrefix = "ymt_"
+
+// Generate создаёт новый случайный токен. Возвращает открытый токен,
+// который нужно передать владельцу, и запись для хранилища.
+func Generate(tenantID string, role Role, ttl time.Duration, description string) (string, Token, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", Token{}, err
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", Token{}, err
+	}
+
+	plain := tokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	t := Token{
+		ID:          hex.EncodeToString(id),
+		Hash:        HashToken(plain),
+		Tenant:      tenantID,
+		Role:        role,
+		Description: description,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	if ttl > 0 {
+		exp := t.CreatedAt.Add(ttl)
+		t.ExpiresAt = &exp
+	}
+	if err := t.Validate(); err != nil {
+		return "", Token{}, err
+	}
+	return plain, t, nil
+}
+
+// Store — хранилище токенов.
+type Store interface {
+	// Lookup ищет токен по хешу; второе значение false, если токена нет.
+	Lookup(ctx context.Context, hash string) (Token, bool, error)
+	// Create сохраняет новый токен.
+	Create(ctx context.Context, t Token) error
+	// Revoke удаляет токен по ID; ErrNotFound, если токена нет.
+	Revoke(ctx context.Context, id string) error
+	// List возвращает все токены, упорядоченные по времени выпуска.
+	List(ctx context.Context) ([]Token, error)
+}
+
+// Principal — аутентифицированный владелец токена.
+type Principal struct {
+	TokenID string
+	Tenant  string
+	Role    Role
+}
+
+// Authenticator проверяет открытые токены по Store.
+type Authenticator struct {
+	Store Store
+	Now   func() time.Time
+}
+
+// Authenticate возвращает владельца токена. Неизвестный токен даёт
+// ErrUnknownToken, просроченный — ErrExpiredToken.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	t, ok, err := a.Store.Lookup(ctx, HashToken(token))
+	if err != nil {
+		return Principal{}, err
+	}
+	if !ok {
+		return Principal{}, ErrUnknownToken
+	}
+
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+	if t.Expired(now) {
+		return Principal{}, ErrExpiredToken
+	}
+	return Principal{TokenID: t.ID, Tenant: t.Tenant, Role: t.Role}, nil
+}
+
+type ctxKey struct{}
+
+// WithPrincipal возвращает контекст с владельцем токена.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// PrincipalFrom возвращает владельца токена из контекста.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
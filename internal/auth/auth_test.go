@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role, required Role
+		want           bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleWriter, false},
+		{RoleWriter, RoleReader, true},
+		{RoleWriter, RoleAdmin, false},
+		{RoleAdmin, RoleWriter, true},
+		{Role("root"), RoleReader, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%s allows %s: expected %v, got %v", tt.role, tt.required, tt.want, got)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	plain, tok, err := Generate("team-a", RoleWriter, time.Hour, "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, tokenPrefix) {
+		t.Fatalf("expected %q prefix, got %q", tokenPrefix, plain)
+	}
+	if tok.Hash != HashToken(plain) || strings.Contains(tok.Hash, plain) {
+		t.Fatal("token must be stored as SHA-256 only")
+	}
+	if tok.ExpiresAt == nil || !tok.ExpiresAt.Equal(tok.CreatedAt.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry %v", tok.ExpiresAt)
+	}
+
+	other, _, err := Generate("team-a", RoleWriter, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == plain {
+		t.Fatal("tokens must be random")
+	}
+
+	if _, _, err := Generate("bad tenant", RoleReader, 0, ""); err == nil {
+		t.Fatal("expected error for invalid tenant")
+	}
+	if _, _, err := Generate("team-a", Role("root"), 0, ""); err == nil {
+		t.Fatal("expected error for unknown role")
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir() + "/tokens.json")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &Authenticator{Store: store, Now: func() time.Time { return now }}
+
+	plain, tok, err := Generate("team-a", RoleReader, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok.CreatedAt = now
+	exp := now.Add(time.Hour)
+	tok.ExpiresAt = &exp
+	if err := store.Create(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := a.Authenticate(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (Principal{TokenID: tok.ID, Tenant: "team-a", Role: RoleReader}) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+
+	if _, err := a.Authenticate(ctx, plain+"x"); !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("expected ErrUnknownToken, got %v", err)
+	}
+
+	now = exp
+	if _, err := a.Authenticate(ctx, plain); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+// testStore проверяет общий контракт Store.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	tokens, err := store.List(ctx)
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("expected empty store, got %v %v", tokens, err)
+	}
+
+	_, first, err := Generate("team-a", RoleWriter, 0, "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := Generate("team-b", RoleAdmin, time.Hour, "ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+	exp := second.CreatedAt.Add(time.Hour)
+	second.ExpiresAt = &exp
+
+	for _, tok := range []Token{first, second} {
+		if err := store.Create(ctx, tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Create(ctx, first); err == nil {
+		t.Fatal("expected error for duplicate token")
+	}
+
+	got, ok, err := store.Lookup(ctx, second.Hash)
+	if err != nil || !ok {
+		t.Fatalf("lookup: %v %v", ok, err)
+	}
+	if got.ID != second.ID || got.Tenant != "team-b" || got.Role != RoleAdmin ||
+		got.ExpiresAt == nil || !got.ExpiresAt.Equal(exp) {
+		t.Fatalf("unexpected token %+v", got)
+	}
+
+	tokens, err = store.List(ctx)
+	if err != nil || len(tokens) != 2 || tokens[0].ID != first.ID || tokens[1].ID != second.ID {
+		t.Fatalf("unexpected list %+v %v", tokens, err)
+	}
+
+	if err := store.Revoke(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Lookup(ctx, first.Hash); err != nil || ok {
+		t.Fatalf("revoked token must not be found, got %v %v", ok, err)
+	}
+	if err := store.Revoke(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileStore хранит токены в JSON-файле вида {"tokens": [...]}.
+// Lookup обслуживается из памяти; файл перечитывается методом Reload
+// (сервер вызывает его периодически, см. Watch, и по SIGHUP), поэтому
+// токены, выпущенные или отозванные утилитой cmd/token, действуют без
+// перезапуска сервера. Если изменённый файл не читается, остаётся
+// прежний набор токенов.
+// Записи прежнего формата -tenant-tokens ({"sha256", "tenant"} без id и
+// роли) читаются как токены с ролью LegacyRole.
+type FileStore struct {
+	path string
+
+	mu      sync.RWMutex
+	loaded  bool
+	modTime time.Time
+	size    int64
+	tokens  []Token
+	byHash  map[string]int
+}
+
+// LegacyRole — роль токенов из файлов прежнего формата -tenant-tokens:
+// такие токены давали чтение и запись метрик своего арендатора.
+const LegacyRole = RoleWriter
+
+type tokenFile struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// NewFileStore создаёт хранилище токенов в файле path. Отсутствующий файл
+// означает пустое хранилище и создаётся при первой записи.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// load перечитывает файл, если он изменился с прошлого чтения. При ошибке
+// состояние хранилища не меняется. Вызывается под s.mu.
+func (s *FileStore) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.tokens, s.byHash, s.modTime, s.size, s.loaded = nil, map[string]int{}, time.Time{}, 0, true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("auth tokens: %w", err)
+	}
+	if s.loaded && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("auth tokens: %w", err)
+	}
+	var f tokenFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("auth tokens: %w", err)
+	}
+
+	byHash := make(map[string]int, len(f.Tokens))
+	var errs []error
+	for i, t := range f.Tokens {
+		t = upgradeLegacy(t)
+		f.Tokens[i] = t
+		if err := t.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("token #%d: %w", i, err))
+			continue
+		}
+		if _, dup := byHash[t.Hash]; dup {
+			errs = append(errs, fmt.Errorf("token #%d: duplicate token", i))
+			continue
+		}
+		byHash[t.Hash] = i
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("auth tokens: %w", err)
+	}
+
+	s.tokens, s.byHash, s.modTime, s.size, s.loaded = f.Tokens, byHash, info.ModTime(), info.Size(), true
+	return nil
+}
+
+// upgradeLegacy дополняет запись прежнего формата (без id и роли)
+// идентификатором из префикса хеша и ролью LegacyRole.
+func upgradeLegacy(t Token) Token {
+	if t.ID != "" || t.Role != "" {
+		return t
+	}
+	t.ID = "legacy-" + t.Hash[:min(len(t.Hash), 12)]
+	t.Role = LegacyRole
+	return t
+}
+
+// save атомарно перезаписывает файл; права 0600, так как файл описывает доступ.
+func (s *FileStore) save(tokens []Token) error {
+	data, err := json.MarshalIndent(tokenFile{Tokens: tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("auth tokens: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("auth tokens: %w", err)
+	}
+	s.loaded = false // перечитать записанный файл при следующем обращении
+	return s.load()
+}
+
+// Check загружает файл и возвращает ошибки его содержимого.
+func (s *FileStore) Check() error {
+	return s.Reload()
+}
+
+// Reload перечитывает файл, если он изменился. При ошибке возвращает её и
+// продолжает отвечать прежним набором токенов.
+func (s *FileStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load()
+}
+
+// Watch вызывает Reload каждые interval, пока не отменён ctx, и передаёт
+// ошибки в onError.
+func (s *FileStore) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Lookup ищет токен по хешу в загруженном наборе; файл читается, только
+// если ещё не был загружен.
+func (s *FileStore) Lookup(ctx context.Context, hash string) (Token, bool, error) {
+	s.mu.RLock()
+	loaded := s.loaded
+	s.mu.RUnlock()
+	if !loaded {
+		if err := s.Reload(); err != nil {
+			return Token{}, false, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.byHash[hash]
+	if !ok {
+		return Token{}, false, nil
+	}
+	return s.tokens[i], true, nil
+}
+
+// Create добавляет токен в файл.
+func (s *FileStore) Create(ctx context.Context, t Token) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	for _, existing := range s.tokens {
+		if existing.ID == t.ID || existing.Hash == t.Hash {
+			return fmt.Errorf("token %s already exists", t.ID)
+		}
+	}
+	return s.save(append(append([]Token(nil), s.tokens...), t))
+}
+
+// Revoke удаляет токен из файла.
+func (s *FileStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	for i, t := range s.tokens {
+		if t.ID == id {
+			rest := append(append([]Token(nil), s.tokens[:i]...), s.tokens[i+1:]...)
+			return s.save(rest)
+		}
+	}
+	return ErrNotFound
+}
+
+// List возвращает все токены.
+func (s *FileStore) List(ctx context.Context) ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	res := append([]Token{}, s.tokens...)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res, nil
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	testStore(t, NewFileStore(filepath.Join(t.TempDir(), "tokens.json")))
+}
+
+func TestFileStore_Permissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	_, tok, err := Generate("team-a", RoleReader, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFileStore(path).Create(context.Background(), tok); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected 0600, got %o", perm)
+	}
+}
+
+func TestFileStore_SeesExternalChanges(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	server := NewFileStore(path)
+	if _, ok, err := server.Lookup(ctx, HashToken("x")); err != nil || ok {
+		t.Fatalf("expected empty store, got %v %v", ok, err)
+	}
+
+	// Токен выпускает отдельный процесс (cmd/token) со своим экземпляром.
+	plain, tok, err := Generate("team-a", RoleWriter, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFileStore(path).Create(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := server.Lookup(ctx, HashToken(plain)); err != nil || !ok {
+		t.Fatalf("new token must be visible after reload, got %v %v", ok, err)
+	}
+}
+
+func TestFileStore_KeepsTokensOnBrokenReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewFileStore(path)
+	plain, tok, err := Generate("team-a", RoleReader, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("{broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	if _, ok, err := store.Lookup(ctx, HashToken(plain)); err != nil || !ok {
+		t.Fatalf("previous tokens must stay valid, got %v %v", ok, err)
+	}
+}
+
+func TestFileStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	data := `{"tokens": [
+		{"id": "a", "sha256": "` + HashToken("a") + `", "tenant": "bad tenant", "role": "reader"},
+		{"id": "b", "sha256": "` + HashToken("b") + `", "tenant": "ok", "role": "root"},
+		{"id": "c", "sha256": "` + HashToken("c") + `", "tenant": "ok", "role": "reader"},
+		{"id": "d", "sha256": "` + HashToken("c") + `", "tenant": "ok", "role": "reader"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := NewFileStore(path).Check()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"token #0", "token #1", "token #3: duplicate"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q must mention %q", err, want)
+		}
+	}
+}
+
+func TestFileStore_LegacyTenantTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	data := `{"tokens": [{"sha256": "` + HashToken("old-secret") + `", "tenant": "team-a"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, ok, err := NewFileStore(path).Lookup(context.Background(), HashToken("old-secret"))
+	if err != nil || !ok {
+		t.Fatalf("legacy token must be found, got %v %v", ok, err)
+	}
+	if tok.Tenant != "team-a" || tok.Role != LegacyRole || !strings.HasPrefix(tok.ID, "legacy-") {
+		t.Errorf("unexpected legacy token %+v", tok)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore хранит токены в таблице api_tokens (миграция 004_api_tokens).
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore создаёт хранилище токенов на пуле pool.
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+const tokenColumns = `id, token_sha256, tenant, role, description, created_at, expires_at`
+
+func scanToken(row pgx.Row) (Token, error) {
+	var t Token
+	err := row.Scan(&t.ID, &t.Hash, &t.Tenant, &t.Role, &t.Description, &t.CreatedAt, &t.ExpiresAt)
+	return t, err
+}
+
+// Lookup ищет токен по хешу.
+func (s *PostgresStore) Lookup(ctx context.Context, hash string) (Token, bool, error) {
+	t, err := scanToken(s.pool.QueryRow(ctx,
+		`SELECT `+tokenColumns+` FROM api_tokens WHERE token_sha256 = $1`, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Token{}, false, nil
+	}
+	if err != nil {
+		return Token{}, false, err
+	}
+	return t, true, nil
+}
+
+// Create сохраняет новый токен.
+func (s *PostgresStore) Create(ctx context.Context, t Token) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO api_tokens (`+tokenColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.ID, t.Hash, t.Tenant, t.Role, t.Description, t.CreatedAt, t.ExpiresAt)
+	return err
+}
+
+// Revoke удаляет токен по ID.
+func (s *PostgresStore) Revoke(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM api_tokens WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List возвращает все токены, упорядоченные по времени выпуска.
+func (s *PostgresStore) List(ctx context.Context) ([]Token, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+tokenColumns+` FROM api_tokens ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]Token, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("cannot connect db: %v", err)
+	}
+	defer pool.Close()
+
+	// Схема соответствует migrations/004_api_tokens.up.sql.
+	_, err = pool.Exec(context.Background(), `
+	DROP TABLE IF EXISTS api_tokens;
+	CREATE TABLE api_tokens (
+		id TEXT PRIMARY KEY,
+		token_sha256 TEXT NOT NULL UNIQUE,
+		tenant TEXT NOT NULL,
+		role TEXT NOT NULL CHECK (role IN ('reader', 'writer', 'admin')),
+		description TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ
+	);
+	`)
+	if err != nil {
+		t.Fatalf("cannot prepare schema: %v", err)
+	}
+
+	testStore(t, NewPostgresStore(pool))
+}
@@ -1,6 +1,10 @@
 package buildinfo
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 var (
 	Version string
@@ -9,6 +13,11 @@ var (
 )
 
 func Print() {
+	Fprint(os.Stdout)
+}
+
+// Fprint пишет версию, дату и коммит сборки в w.
+func Fprint(w io.Writer) {
 	v := Version
 	if v == "" {
 		v = "N/A"
@@ -21,7 +30,7 @@ func Print() {
 	if c == "" {
 		c = "N/A"
 	}
-	fmt.Printf("Build version: %s\n", v)
-	fmt.Printf("Build date: %s\n", d)
-	fmt.Printf("Build commit: %s\n", c)
+	fmt.Fprintf(w, "Build version: %s\n", v)
+	fmt.Fprintf(w, "Build date: %s\n", d)
+	fmt.Fprintf(w, "Build commit: %s\n", c)
 }
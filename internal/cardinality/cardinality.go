@@ -0,0 +1,339 @@
+// Package cardinality защищает хранилище от взрывного роста числа серий
+// (уникальных метрик): ограничивает общее число серий и число новых серий,
+// которые один клиент может создать за минуту, и ведёт список клиентов,
+// создавших больше всего серий.
+//
+// Учёт ведётся в памяти процесса: при нескольких экземплярах сервера над
+// одной базой каждый считает только свои записи.
+package cardinality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// Window — окно, в котором считаются новые серии клиента.
+const Window = time.Minute
+
+// maxContributors ограничивает число клиентов в статистике создания серий.
+const maxContributors = 10000
+
+// Ошибки превышения лимитов. Возвращаются обёрнутыми в *LimitError.
+var (
+	ErrSeriesLimit    = errors.New("series limit exceeded")
+	ErrNewSeriesLimit = errors.New("new series per minute limit exceeded")
+)
+
+// LimitError описывает отклонённую запись.
+type LimitError struct {
+	Err        error         // ErrSeriesLimit или ErrNewSeriesLimit
+	Limit      int           // превышенный лимит
+	New        int           // сколько новых серий пытались создать
+	RetryAfter time.Duration // для ErrNewSeriesLimit — когда откроется новое окно
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: limit %d, request creates %d new series", e.Err, e.Limit, e.New)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// Limits — настройки ограничений; 0 отключает соответствующий лимит.
+type Limits struct {
+	MaxSeries       int // всего серий во всех арендаторах
+	MaxNewPerMinute int // новых серий на клиента за Window
+}
+
+type clientKey struct{}
+
+// WithClient возвращает контекст, в котором записи приписываются клиенту
+// client (API-токену или адресу).
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFrom возвращает клиента из контекста; пустая строка — внутренние
+// записи сервера (правила записи, восстановление), на них лимит новых
+// серий в минуту не действует.
+func ClientFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// Contributor — клиент и число созданных им серий.
+type Contributor struct {
+	Client    string `json:"client"`
+	NewSeries uint64 `json:"new_series"`
+}
+
+// Stats — текущее состояние учёта.
+type Stats struct {
+	Series            int           `json:"series"`
+	MaxSeries         int           `json:"max_series"`
+	MaxNewPerMinute   int           `json:"max_new_series_per_minute"`
+	RejectedSeries    uint64        `json:"rejected_series_limit"`
+	RejectedNewSeries uint64        `json:"rejected_new_series_limit"`
+	TopContributors   []Contributor `json:"top_contributors"`
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Repository — обёртка над repository.Repository, которая пропускает запись
+// новой серии, только если она укладывается в Limits.
+type Repository struct {
+	repository.Repository
+	limits Limits
+	now    func() time.Time
+
+	mu                sync.Mutex
+	series            map[string]struct{}
+	windows           map[string]*window
+	contributors      map[string]uint64
+	rejectedSeries    uint64
+	rejectedNewSeries uint64
+}
+
+// Wrap возвращает хранилище repo с ограничениями limits. Существующие
+// серии читаются из repo и учитываются сразу.
+func Wrap(ctx context.Context, repo repository.Repository, limits Limits) (*Repository, error) {
+	records, err := repository.Snapshot(ctx, repo)
+	if err != nil {
+		return nil, fmt.Errorf("cardinality: %w", err)
+	}
+
+	r := &Repository{
+		Repository:   repo,
+		limits:       limits,
+		now:          time.Now,
+		series:       make(map[string]struct{}, len(records)),
+		windows:      make(map[string]*window),
+		contributors: make(map[string]uint64),
+	}
+	for _, m := range records {
+		r.series[seriesKey(m.TenantOf(), m.MType, m.ID)] = struct{}{}
+	}
+	return r, nil
+}
+
+func seriesKey(tenantID, mType, name string) string {
+	return tenantID + "\x00" + mType + "\x00" + name
+}
+
+// admit резервирует серии keys, которых ещё нет. Возвращает функцию отката
+// резерва на случай ошибки записи.
+func (r *Repository) admit(ctx context.Context, keys []string) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fresh := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		if _, ok := r.series[k]; ok {
+			continue
+		}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		fresh = append(fresh, k)
+	}
+	if len(fresh) == 0 {
+		return func() {}, nil
+	}
+
+	if r.limits.MaxSeries > 0 && len(r.series)+len(fresh) > r.limits.MaxSeries {
+		r.rejectedSeries += uint64(len(fresh))
+		return nil, &LimitError{Err: ErrSeriesLimit, Limit: r.limits.MaxSeries, New: len(fresh)}
+	}
+
+	client := ClientFrom(ctx)
+	now := r.now()
+	var w *window
+	if client != "" && r.limits.MaxNewPerMinute > 0 {
+		r.sweepWindows(now)
+		w = r.windows[client]
+		if w == nil || now.Sub(w.start) >= Window {
+			w = &window{start: now}
+			r.windows[client] = w
+		}
+		if w.count+len(fresh) > r.limits.MaxNewPerMinute {
+			r.rejectedNewSeries += uint64(len(fresh))
+			return nil, &LimitError{
+				Err:        ErrNewSeriesLimit,
+				Limit:      r.limits.MaxNewPerMinute,
+				New:        len(fresh),
+				RetryAfter: w.start.Add(Window).Sub(now),
+			}
+		}
+		w.count += len(fresh)
+	}
+
+	for _, k := range fresh {
+		r.series[k] = struct{}{}
+	}
+	r.contribute(client, len(fresh))
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, k := range fresh {
+			delete(r.series, k)
+		}
+		if w != nil {
+			w.count -= len(fresh)
+		}
+		r.contribute(client, -len(fresh))
+	}, nil
+}
+
+// sweepWindows удаляет закрывшиеся окна клиентов.
+func (r *Repository) sweepWindows(now time.Time) {
+	for client, w := range r.windows {
+		if now.Sub(w.start) >= Window {
+			delete(r.windows, client)
+		}
+	}
+}
+
+// contribute учитывает n серий, созданных клиентом. Если клиентов слишком
+// много, из статистики вытесняется клиент с наименьшим вкладом.
+func (r *Repository) contribute(client string, n int) {
+	if client == "" {
+		return
+	}
+	if n < 0 {
+		if c := r.contributors[client]; c > uint64(-n) {
+			r.contributors[client] = c - uint64(-n)
+		} else {
+			delete(r.contributors, client)
+		}
+		return
+	}
+	if _, ok := r.contributors[client]; !ok && len(r.contributors) >= maxContributors {
+		var minClient string
+		var minCount uint64
+		for c, count := range r.contributors {
+			if minClient == "" || count < minCount {
+				minClient, minCount = c, count
+			}
+		}
+		delete(r.contributors, minClient)
+	}
+	r.contributors[client] += uint64(n)
+}
+
+// UpdateGauge обновляет gauge, проверяя лимиты для новой серии.
+func (r *Repository) UpdateGauge(ctx context.Context, name string, value float64) error {
+	rollback, err := r.admit(ctx, []string{seriesKey(tenant.FromContext(ctx), models.Gauge, name)})
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.UpdateGauge(ctx, name, value); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// UpdateCounter обновляет counter, проверяя лимиты для новой серии.
+func (r *Repository) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	rollback, err := r.admit(ctx, []string{seriesKey(tenant.FromContext(ctx), models.Counter, name)})
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.UpdateCounter(ctx, name, delta); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// UpdateBatch обновляет пакет целиком или отклоняет его, если новые серии
+// пакета не укладываются в лимиты.
+func (r *Repository) UpdateBatch(ctx context.Context, metrics []models.Metrics) ([]models.Metrics, error) {
+	tenantID := tenant.FromContext(ctx)
+	keys := make([]string, len(metrics))
+	for i, m := range metrics {
+		keys[i] = seriesKey(tenantID, m.MType, m.ID)
+	}
+
+	rollback, err := r.admit(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := r.Repository.UpdateBatch(ctx, metrics)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	return totals, nil
+}
+
+// Delete удаляет метрику и освобождает её место в лимите серий.
+func (r *Repository) Delete(ctx context.Context, mType, name string) (bool, error) {
+	ok, err := r.Repository.Delete(ctx, mType, name)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	r.mu.Lock()
+	delete(r.series, seriesKey(tenant.FromContext(ctx), mType, name))
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Expire передаёт вызов хранилищу; удалённая серия освобождает место в лимите.
+func (r *Repository) Expire(ctx context.Context, mType, name string, before time.Time, remove bool) (bool, error) {
+	ok, err := r.Repository.Expire(ctx, mType, name, before, remove)
+	if err != nil || !ok || !remove {
+		return ok, err
+	}
+
+	r.mu.Lock()
+	delete(r.series, seriesKey(tenant.FromContext(ctx), mType, name))
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Stats возвращает текущее число серий, счётчики отказов и top клиентов
+// по числу созданных серий (top <= 0 — все).
+func (r *Repository) Stats(top int) Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	contributors := make([]Contributor, 0, len(r.contributors))
+	for client, n := range r.contributors {
+		contributors = append(contributors, Contributor{Client: client, NewSeries: n})
+	}
+	sort.Slice(contributors, func(i, j int) bool {
+		if contributors[i].NewSeries != contributors[j].NewSeries {
+			return contributors[i].NewSeries > contributors[j].NewSeries
+		}
+		return contributors[i].Client < contributors[j].Client
+	})
+	if top > 0 && len(contributors) > top {
+		contributors = contributors[:top]
+	}
+
+	return Stats{
+		Series:            len(r.series),
+		MaxSeries:         r.limits.MaxSeries,
+		MaxNewPerMinute:   r.limits.MaxNewPerMinute,
+		RejectedSeries:    r.rejectedSeries,
+		RejectedNewSeries: r.rejectedNewSeries,
+		TopContributors:   contributors,
+	}
+}
@@ -0,0 +1,144 @@
+package cardinality
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+func newTestRepository(t *testing.T, base repository.Repository, limits Limits) (*Repository, *time.Time) {
+	t.Helper()
+	r, err := Wrap(context.Background(), base, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func gauge(name string) models.Metrics {
+	v := 1.0
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &v}
+}
+
+func TestRepository_MaxSeries(t *testing.T) {
+	ctx := context.Background()
+	base := repository.NewMemRepository()
+	if err := base.UpdateGauge(ctx, "Existing", 1); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := newTestRepository(t, base, Limits{MaxSeries: 3})
+
+	if err := r.UpdateGauge(ctx, "A", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.UpdateBatch(ctx, []models.Metrics{gauge("B"), gauge("C")}); !errors.Is(err, ErrSeriesLimit) {
+		t.Fatalf("expected ErrSeriesLimit, got %v", err)
+	}
+	if _, ok, _ := base.GetGauge(ctx, "B"); ok {
+		t.Fatal("rejected batch must not be written")
+	}
+
+	// Обновление существующих серий лимитом не ограничивается.
+	if _, err := r.UpdateBatch(ctx, []models.Metrics{gauge("A"), gauge("Existing"), gauge("B")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateCounter(ctx, "D", 1); !errors.Is(err, ErrSeriesLimit) {
+		t.Fatalf("expected ErrSeriesLimit, got %v", err)
+	}
+
+	// Серии других арендаторов учитываются в общем лимите.
+	if err := r.UpdateGauge(tenant.WithTenant(ctx, "team-a"), "A", 1); !errors.Is(err, ErrSeriesLimit) {
+		t.Fatalf("expected ErrSeriesLimit for another tenant, got %v", err)
+	}
+
+	if ok, err := r.Delete(ctx, models.Gauge, "A"); err != nil || !ok {
+		t.Fatalf("delete: %v %v", ok, err)
+	}
+	if err := r.UpdateCounter(ctx, "D", 1); err != nil {
+		t.Fatalf("deleted series must free the limit: %v", err)
+	}
+
+	if ok, err := r.Expire(ctx, models.Counter, "D", time.Now().Add(time.Hour), true); err != nil || !ok {
+		t.Fatalf("expire: %v %v", ok, err)
+	}
+	if err := r.UpdateCounter(ctx, "D", 1); err != nil {
+		t.Fatalf("expired series must free the limit: %v", err)
+	}
+
+	st := r.Stats(0)
+	if st.Series != 3 || st.RejectedSeries != 4 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestRepository_MaxNewPerMinute(t *testing.T) {
+	base := repository.NewMemRepository()
+	r, now := newTestRepository(t, base, Limits{MaxNewPerMinute: 2})
+	a := WithClient(context.Background(), "token:a")
+	b := WithClient(context.Background(), "token:b")
+
+	if _, err := r.UpdateBatch(a, []models.Metrics{gauge("A1"), gauge("A2"), gauge("A1")}); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(20 * time.Second)
+	err := r.UpdateGauge(a, "A3", 1)
+	var le *LimitError
+	if !errors.As(err, &le) || !errors.Is(err, ErrNewSeriesLimit) {
+		t.Fatalf("expected ErrNewSeriesLimit, got %v", err)
+	}
+	if le.RetryAfter != 40*time.Second {
+		t.Fatalf("expected retry after 40s, got %s", le.RetryAfter)
+	}
+
+	if err := r.UpdateGauge(a, "A1", 2); err != nil {
+		t.Fatalf("existing series must be writable: %v", err)
+	}
+	if err := r.UpdateGauge(b, "B1", 1); err != nil {
+		t.Fatalf("other client must have its own window: %v", err)
+	}
+	if err := r.UpdateGauge(context.Background(), "Internal", 1); err != nil {
+		t.Fatalf("internal writes are not limited per client: %v", err)
+	}
+
+	*now = now.Add(40 * time.Second)
+	if err := r.UpdateGauge(a, "A3", 1); err != nil {
+		t.Fatalf("new window must allow new series: %v", err)
+	}
+
+	st := r.Stats(1)
+	if st.RejectedNewSeries != 1 {
+		t.Fatalf("expected 1 rejected series, got %+v", st)
+	}
+	if len(st.TopContributors) != 1 || st.TopContributors[0] != (Contributor{Client: "token:a", NewSeries: 3}) {
+		t.Fatalf("unexpected top contributors %+v", st.TopContributors)
+	}
+}
+
+type failingRepository struct {
+	repository.Repository
+}
+
+func (failingRepository) UpdateGauge(context.Context, string, float64) error {
+	return errors.New("storage down")
+}
+
+func TestRepository_RollbackOnStorageError(t *testing.T) {
+	r, _ := newTestRepository(t, failingRepository{repository.NewMemRepository()}, Limits{MaxSeries: 1, MaxNewPerMinute: 1})
+	ctx := WithClient(context.Background(), "ip:192.0.2.1")
+
+	for i := 0; i < 2; i++ {
+		if err := r.UpdateGauge(ctx, "A", 1); err == nil || errors.Is(err, ErrSeriesLimit) || errors.Is(err, ErrNewSeriesLimit) {
+			t.Fatalf("attempt %d: expected storage error, got %v", i, err)
+		}
+	}
+	if st := r.Stats(0); st.Series != 0 || len(st.TopContributors) != 0 {
+		t.Fatalf("failed writes must not be counted, got %+v", st)
+	}
+}
@@ -0,0 +1,27 @@
+// Package cli завершает команды проекта с кодом ошибки. Анализатор
+// exitcheck запрещает os.Exit в пакетах main, поэтому main возвращает
+// ошибку из run и передаёт её сюда: к этому моменту отложенные вызовы run
+// уже выполнены.
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Переопределяются в тестах.
+var (
+	stderr io.Writer = os.Stderr
+	exit             = os.Exit
+)
+
+// Exit печатает ошибку команды name в stderr и завершает процесс с кодом 1.
+// При err == nil ничего не делает.
+func Exit(name string, err error) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(stderr, "%s: %v\n", name, err)
+	exit(1)
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestExit(t *testing.T) {
+	var out bytes.Buffer
+	code := -1
+	stderr, exit = &out, func(c int) { code = c }
+	t.Cleanup(func() { stderr, exit = nil, nil })
+
+	Exit("server", nil)
+	if code != -1 || out.Len() != 0 {
+		t.Fatalf("nil error must not exit, got code %d and %q", code, out.String())
+	}
+
+	Exit("server", errors.New("invalid configuration"))
+	if code != 1 || out.String() != "server: invalid configuration\n" {
+		t.Fatalf("got code %d and %q", code, out.String())
+	}
+}
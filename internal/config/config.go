@@ -0,0 +1,208 @@
+// Package config собирает конфигурацию сервера и агента из трёх источников
+// в порядке возрастания приоритета: файл JSON, флаги командной строки,
+// переменные окружения. Параметры описываются флагами flag.FlagSet, а
+// таблица Option связывает каждый флаг с ключом файла и переменной окружения.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Флаг и переменная окружения с путём к файлу конфигурации.
+const (
+	FileFlag = "c"
+	FileEnv  = "CONFIG"
+)
+
+// Redacted заменяет значения секретных параметров в PrintJSON.
+const Redacted = "[REDACTED]"
+
+// Option описывает параметр конфигурации.
+type Option struct {
+	Key    string // ключ в файле конфигурации
+	Flag   string // имя флага в FlagSet
+	Env    string // переменная окружения; пустая — параметр не читается из окружения
+	Secret bool   // значение скрывается в PrintJSON
+}
+
+// Load разбирает args в fs, затем применяет файл конфигурации (флаг FileFlag
+// или переменная FileEnv) и переменные окружения из lookupEnv так, чтобы
+// флаги были важнее файла, а окружение — важнее флагов.
+//
+// Ошибки файла и окружения не прерывают загрузку, а собираются и
+// возвращаются вместе (errors.Join), чтобы пользователь увидел их все сразу.
+func Load(fs *flag.FlagSet, opts []Option, args []string, lookupEnv func(string) (string, bool)) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Значения, заданные флагами, запоминаются до применения файла
+	// и восстанавливаются после него.
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = f.Value.String() })
+
+	path := explicit[FileFlag]
+	if v, ok := lookupEnv(FileEnv); ok {
+		path = v
+		if fs.Lookup(FileFlag) != nil {
+			_ = fs.Set(FileFlag, v)
+		}
+	}
+
+	var errs []error
+	if path != "" {
+		errs = append(errs, applyFile(fs, opts, path))
+		for name, v := range explicit {
+			if err := fs.Set(name, v); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", name, err))
+			}
+		}
+	}
+
+	for _, o := range opts {
+		if o.Env == "" {
+			continue
+		}
+		if v, ok := lookupEnv(o.Env); ok {
+			if err := fs.Set(o.Flag, v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %s", o.Env, v))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyFile устанавливает флаги из файла JSON. Ключи файла — Option.Key,
+// значения — строки, числа или логические значения; длительности задаются
+// строками вида "30s".
+func applyFile(fs *flag.FlagSet, opts []Option, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	flags := make(map[string]string, len(opts))
+	for _, o := range opts {
+		flags[o.Key] = o.Flag
+	}
+
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, k := range keys {
+		name, ok := flags[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("config file %s: unknown key %q", path, k))
+			continue
+		}
+
+		var v string
+		switch x := raw[k].(type) {
+		case string:
+			v = x
+		case json.Number:
+			v = x.String()
+		case bool:
+			v = strconv.FormatBool(x)
+		case nil:
+			continue
+		default:
+			errs = append(errs, fmt.Errorf("config file %s: %q must be a string, number or boolean", path, k))
+			continue
+		}
+
+		if err := fs.Set(name, v); err != nil {
+			errs = append(errs, fmt.Errorf("config file %s: invalid %q: %s", path, k, v))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Diff возвращает ключи параметров opts, значения которых в a и b различаются.
+func Diff(a, b *flag.FlagSet, opts []Option) []string {
+	var keys []string
+	for _, o := range opts {
+		fa, fb := a.Lookup(o.Flag), b.Lookup(o.Flag)
+		if fa == nil || fb == nil {
+			continue
+		}
+		if fa.Value.String() != fb.Value.String() {
+			keys = append(keys, o.Key)
+		}
+	}
+	return keys
+}
+
+// PrintJSON выводит действующие значения параметров opts объектом JSON в
+// формате файла конфигурации. Секретные значения заменяются на Redacted,
+// пароли в URL скрываются у всех параметров.
+func PrintJSON(w io.Writer, fs *flag.FlagSet, opts []Option) error {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, o := range opts {
+		f := fs.Lookup(o.Flag)
+		if f == nil {
+			return fmt.Errorf("config: option %q refers to unknown flag -%s", o.Key, o.Flag)
+		}
+
+		var v any = f.Value.String()
+		if g, ok := f.Value.(flag.Getter); ok {
+			v = g.Get()
+		}
+		switch x := v.(type) {
+		case time.Duration:
+			v = x.String()
+		case string:
+			v = redact(x, o.Secret)
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		key, _ := json.Marshal(o.Key)
+		fmt.Fprintf(&buf, "  %s: %s", key, b)
+		if i < len(opts)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// redact скрывает пароль в URL; секретные значения не в виде URL с
+// учётными данными заменяются целиком.
+func redact(v string, secret bool) string {
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	if secret && v != "" {
+		return Redacted
+	}
+	return v
+}
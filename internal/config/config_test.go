@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	file  string
+	addr  string
+	limit int
+	wait  time.Duration
+	debug bool
+	key   string
+	dsn   string
+}
+
+var testOptions = []Option{
+	{Key: "address", Flag: "a", Env: "ADDRESS"},
+	{Key: "limit", Flag: "l", Env: "LIMIT"},
+	{Key: "wait", Flag: "w", Env: "WAIT"},
+	{Key: "debug", Flag: "debug"},
+	{Key: "key", Flag: "k", Env: "KEY", Secret: true},
+	{Key: "dsn", Flag: "d", Secret: true},
+}
+
+func (c *testConfig) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&c.file, FileFlag, c.file, "")
+	fs.StringVar(&c.addr, "a", c.addr, "")
+	fs.IntVar(&c.limit, "l", c.limit, "")
+	fs.DurationVar(&c.wait, "w", c.wait, "")
+	fs.BoolVar(&c.debug, "debug", c.debug, "")
+	fs.StringVar(&c.key, "k", c.key, "")
+	fs.StringVar(&c.dsn, "d", c.dsn, "")
+	return fs
+}
+
+func env(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `{"address": "file:1", "limit": 3, "wait": "5s", "debug": true, "key": "file"}`)
+
+	c := &testConfig{addr: "default", limit: 1}
+	args := []string{"-c", path, "-l", "7", "-k", "flag"}
+	err := Load(c.flagSet(), testOptions, args, env(map[string]string{"KEY": "env"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.addr != "file:1" || !c.debug || c.wait != 5*time.Second {
+		t.Errorf("file values not applied: %+v", c)
+	}
+	if c.limit != 7 {
+		t.Errorf("flag must override file: limit = %d", c.limit)
+	}
+	if c.key != "env" {
+		t.Errorf("env must override flag: key = %q", c.key)
+	}
+}
+
+func TestLoad_FileFromEnv(t *testing.T) {
+	path := writeFile(t, `{"address": "file:1"}`)
+
+	c := &testConfig{}
+	if err := Load(c.flagSet(), testOptions, nil, env(map[string]string{FileEnv: path})); err != nil {
+		t.Fatal(err)
+	}
+	if c.addr != "file:1" || c.file != path {
+		t.Fatalf("got %+v", c)
+	}
+}
+
+func TestLoad_AggregatesErrors(t *testing.T) {
+	path := writeFile(t, `{"limit": "many", "wait": 5, "unknown": 1, "address": ["x"]}`)
+
+	c := &testConfig{}
+	err := Load(c.flagSet(), testOptions, []string{"-c", path}, env(map[string]string{"LIMIT": "x"}))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{`invalid "limit"`, `invalid "wait"`, `unknown key "unknown"`, `"address" must be`, "invalid LIMIT: x"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestPrintJSON_RedactsSecrets(t *testing.T) {
+	c := &testConfig{
+		addr:  "localhost:8080",
+		limit: 2,
+		wait:  time.Minute,
+		key:   "secret",
+		dsn:   "postgres://user:pass@db:5432/metrics",
+	}
+
+	var buf bytes.Buffer
+	if err := PrintJSON(&buf, c.flagSet(), testOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	want := map[string]any{
+		"address": "localhost:8080",
+		"limit":   float64(2),
+		"wait":    "1m0s",
+		"debug":   false,
+		"key":     Redacted,
+		"dsn":     "postgres://user:xxxxx@db:5432/metrics",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	// Вывод можно использовать как файл конфигурации.
+	path := writeFile(t, buf.String())
+	loaded := &testConfig{}
+	if err := Load(loaded.flagSet(), testOptions, []string{"-c", path}, env(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.wait != time.Minute || loaded.limit != 2 {
+		t.Errorf("round trip: %+v", loaded)
+	}
+}
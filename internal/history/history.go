@@ -0,0 +1,111 @@
+// Package history хранит недавние значения метрик в кольцевых буферах.
+// Используется веб-интерфейсом для построения графиков.
+// История, как и метрики, разделена по арендаторам из ctx.
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// DefaultSize — число точек на серию по умолчанию.
+const DefaultSize = 120
+
+// Sample — значение метрики в момент времени. Для counter хранится
+// накопленное значение, а не приращение.
+type Sample struct {
+	T time.Time `json:"t"`
+	V float64   `json:"v"`
+}
+
+type seriesKey struct {
+	tenant string
+	mType  string
+	name   string
+}
+
+// ring — кольцевой буфер фиксированного размера.
+type ring struct {
+	buf  []Sample
+	next int
+	full bool
+}
+
+func (r *ring) add(s Sample) {
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ring) samples() []Sample {
+	if !r.full {
+		return append([]Sample(nil), r.buf[:r.next]...)
+	}
+	res := make([]Sample, 0, len(r.buf))
+	res = append(res, r.buf[r.next:]...)
+	return append(res, r.buf[:r.next]...)
+}
+
+// Store хранит последние size точек для каждой серии.
+// Безопасен для конкурентного использования.
+type Store struct {
+	mu     sync.RWMutex
+	size   int
+	series map[seriesKey]*ring
+	now    func() time.Time
+}
+
+// NewStore создаёт хранилище истории на size точек на серию.
+// При size <= 0 используется DefaultSize.
+func NewStore(size int) *Store {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Store{
+		size:   size,
+		series: make(map[seriesKey]*ring),
+		now:    time.Now,
+	}
+}
+
+// Record добавляет точку в историю серии, вытесняя самую старую при переполнении.
+func (s *Store) Record(ctx context.Context, mType, name string, v float64) {
+	t := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := seriesKey{tenant.FromContext(ctx), mType, name}
+	r, ok := s.series[k]
+	if !ok {
+		r = &ring{buf: make([]Sample, s.size)}
+		s.series[k] = r
+	}
+	r.add(Sample{T: t, V: v})
+}
+
+// Get возвращает точки серии в хронологическом порядке.
+// Для неизвестной серии возвращается пустой срез.
+func (s *Store) Get(ctx context.Context, mType, name string) []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.series[seriesKey{tenant.FromContext(ctx), mType, name}]
+	if !ok {
+		return []Sample{}
+	}
+	return r.samples()
+}
+
+// Delete удаляет историю серии.
+func (s *Store) Delete(ctx context.Context, mType, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.series, seriesKey{tenant.FromContext(ctx), mType, name})
+}
@@ -0,0 +1,93 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+func TestStore_RingOrder(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(3)
+	base := time.Unix(0, 0)
+	tick := 0
+	s.now = func() time.Time {
+		tick++
+		return base.Add(time.Duration(tick) * time.Second)
+	}
+
+	for i := 1; i <= 5; i++ {
+		s.Record(ctx, models.Gauge, "g", float64(i))
+	}
+
+	got := s.Get(ctx, models.Gauge, "g")
+	if len(got) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(got))
+	}
+	for i, want := range []float64{3, 4, 5} {
+		if got[i].V != want {
+			t.Fatalf("sample %d: expected %v, got %v", i, want, got[i].V)
+		}
+	}
+	if !got[0].T.Before(got[2].T) {
+		t.Fatal("samples must be in chronological order")
+	}
+
+	if len(s.Get(ctx, models.Counter, "g")) != 0 {
+		t.Fatal("series of another type must be empty")
+	}
+}
+
+func TestRepository_RecordsWrites(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(10)
+	repo := Wrap(repository.NewMemRepository(), store)
+
+	_ = repo.UpdateGauge(ctx, "g", 1.5)
+	_ = repo.UpdateCounter(ctx, "c", 2)
+
+	d := int64(3)
+	v := 2.5
+	_, _ = repo.UpdateBatch(ctx, []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: &d},
+		{ID: "c", MType: models.Counter, Delta: &d},
+		{ID: "g", MType: models.Gauge, Value: &v},
+	})
+
+	counter := store.Get(ctx, models.Counter, "c")
+	if len(counter) != 2 || counter[0].V != 2 || counter[1].V != 8 {
+		t.Fatalf("unexpected counter history: %+v", counter)
+	}
+	gauge := store.Get(ctx, models.Gauge, "g")
+	if len(gauge) != 2 || gauge[1].V != 2.5 {
+		t.Fatalf("unexpected gauge history: %+v", gauge)
+	}
+
+	if _, err := repo.Delete(ctx, models.Gauge, "g"); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Get(ctx, models.Gauge, "g")) != 0 {
+		t.Fatal("history must be removed with the metric")
+	}
+}
+
+func TestStore_Tenants(t *testing.T) {
+	ctx := context.Background()
+	a := tenant.WithTenant(ctx, "team-a")
+	s := NewStore(3)
+
+	s.Record(a, models.Gauge, "g", 1)
+	s.Record(ctx, models.Gauge, "g", 2)
+
+	if got := s.Get(a, models.Gauge, "g"); len(got) != 1 || got[0].V != 1 {
+		t.Fatalf("unexpected team-a history: %+v", got)
+	}
+	s.Delete(a, models.Gauge, "g")
+	if got := s.Get(ctx, models.Gauge, "g"); len(got) != 1 || got[0].V != 2 {
+		t.Fatalf("default tenant history must survive deletion in team-a: %+v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package history
+
+import (
+	"context"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+)
+
+// Repository — обёртка над repository.Repository, которая после каждой
+// успешной записи добавляет текущее значение метрики в Store.
+// Для counter итоговое значение перечитывается из хранилища или берётся
+// из результата UpdateBatch.
+type Repository struct {
+	repository.Repository
+	store *Store
+}
+
+// Wrap возвращает хранилище repo, записывающее историю в store.
+func Wrap(repo repository.Repository, store *Store) *Repository {
+	return &Repository{Repository: repo, store: store}
+}
+
+// UpdateGauge обновляет gauge и добавляет значение в историю.
+func (r *Repository) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := r.Repository.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	r.store.Record(ctx, models.Gauge, name, value)
+	return nil
+}
+
+// UpdateCounter обновляет counter и добавляет итоговое значение в историю.
+func (r *Repository) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := r.Repository.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	r.recordCounter(ctx, name)
+	return nil
+}
+
+// UpdateBatch обновляет пакет метрик и добавляет в историю по одной точке
+// на каждую затронутую серию — итоговое значение, которое вернуло хранилище.
+func (r *Repository) UpdateBatch(ctx context.Context, metrics []models.Metrics) ([]models.Metrics, error) {
+	totals, err := r.Repository.UpdateBatch(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range totals {
+		switch {
+		case t.MType == models.Gauge && t.Value != nil:
+			r.store.Record(ctx, models.Gauge, t.ID, *t.Value)
+		case t.MType == models.Counter && t.Delta != nil:
+			r.store.Record(ctx, models.Counter, t.ID, float64(*t.Delta))
+		}
+	}
+	return totals, nil
+}
+
+// Delete удаляет метрику вместе с её историей.
+func (r *Repository) Delete(ctx context.Context, mType, name string) (bool, error) {
+	ok, err := r.Repository.Delete(ctx, mType, name)
+	if err == nil && ok {
+		r.store.Delete(ctx, mType, name)
+	}
+	return ok, err
+}
+
+// Expire передаёт вызов хранилищу; вместе с удалённой метрикой удаляется её история.
+func (r *Repository) Expire(ctx context.Context, mType, name string, before time.Time, remove bool) (bool, error) {
+	ok, err := r.Repository.Expire(ctx, mType, name, before, remove)
+	if err == nil && ok && remove {
+		r.store.Delete(ctx, mType, name)
+	}
+	return ok, err
+}
+
+func (r *Repository) recordCounter(ctx context.Context, name string) {
+	v, ok, err := r.Repository.GetCounter(ctx, name)
+	if err != nil || !ok {
+		return
+	}
+	r.store.Record(ctx, models.Counter, name, float64(v))
+}
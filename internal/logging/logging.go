@@ -0,0 +1,120 @@
+// Package logging — общий журнал сервера и агента на базе zap: уровень,
+// который меняется без перезапуска, кодирование JSON или console, вывод в
+// файл с ротацией по размеру и перенаправление стандартного пакета log.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Кодирование записей журнала.
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+)
+
+// Logger — методы журнала, которыми пользуются сервер, агент и мидлвары.
+// Ему удовлетворяет *zap.SugaredLogger.
+type Logger interface {
+	Infow(msg string, fields ...any)
+	Fatalf(template string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(template string, args ...interface{})
+	Errorw(msg string, fields ...any)
+}
+
+// Options — параметры журнала.
+type Options struct {
+	Level      string // debug, info, warn или error; пустой — info
+	Encoding   string // EncodingJSON (по умолчанию) или EncodingConsole
+	File       string // файл журнала; пустой — stderr
+	MaxSizeMB  int    // размер файла в мегабайтах, после которого он ротируется; 0 — без ротации
+	MaxBackups int    // сколько ротированных файлов хранить; меньше 1 — один
+}
+
+// level — уровень всех журналов процесса. Общий, чтобы его можно было
+// менять через SetLevel из обработчика или при перезагрузке конфигурации.
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+// Validate проверяет параметры и возвращает все ошибки сразу.
+func (o Options) Validate() error {
+	var errs []error
+	if _, err := zapcore.ParseLevel(o.Level); err != nil {
+		errs = append(errs, fmt.Errorf("-log-level: %w", err))
+	}
+	switch o.Encoding {
+	case "", EncodingJSON, EncodingConsole:
+	default:
+		errs = append(errs, fmt.Errorf("-log-format must be %s or %s", EncodingJSON, EncodingConsole))
+	}
+	if o.MaxSizeMB < 0 {
+		errs = append(errs, errors.New("-log-max-size must not be negative"))
+	}
+	if o.MaxBackups < 0 {
+		errs = append(errs, errors.New("-log-max-backups must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// New создаёт журнал и устанавливает общий уровень opts.Level.
+func New(opts Options) (*zap.SugaredLogger, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := SetLevel(opts.Level); err != nil {
+		return nil, err
+	}
+
+	var sink zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	if opts.File != "" {
+		f, err := openRotatingFile(opts.File, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("log file: %w", err)
+		}
+		sink = f
+	}
+
+	encCfg := zap.NewProductionEncoderConfig()
+	var enc zapcore.Encoder
+	if opts.Encoding == EncodingConsole {
+		encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		encCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		enc = zapcore.NewConsoleEncoder(encCfg)
+	} else {
+		enc = zapcore.NewJSONEncoder(encCfg)
+	}
+
+	core := zapcore.NewCore(enc, sink, level)
+	logger := zap.New(core,
+		zap.AddCaller(),
+		zap.AddStacktrace(zapcore.ErrorLevel),
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+	)
+	return logger.Sugar(), nil
+}
+
+// SetLevel меняет уровень всех журналов процесса.
+func SetLevel(name string) error {
+	l, err := zapcore.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
+
+// GetLevel возвращает текущий уровень журналов.
+func GetLevel() string {
+	return level.Level().String()
+}
+
+// RedirectStdLog направляет вывод стандартного пакета log в logger на
+// уровне info. Возвращает функцию, которая восстанавливает прежний вывод.
+func RedirectStdLog(logger *zap.SugaredLogger) func() {
+	return zap.RedirectStdLog(logger.Desugar())
+}
@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew_FileAndLevel(t *testing.T) {
+	t.Cleanup(func() { _ = SetLevel("info") })
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	logger, err := New(Options{Level: "warn", File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Infow("hidden")
+	logger.Warnw("shown", "k", "v")
+
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debugw("debug after SetLevel")
+	if GetLevel() != "debug" {
+		t.Fatalf("GetLevel = %q", GetLevel())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", data)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	if rec["msg"] != "shown" || rec["k"] != "v" || rec["level"] != "warn" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
+
+func TestNew_Console(t *testing.T) {
+	t.Cleanup(func() { _ = SetLevel("info") })
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	logger, err := New(Options{Encoding: EncodingConsole, File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Infow("hello", "k", "v")
+
+	data, _ := os.ReadFile(path)
+	if !bytes.Contains(data, []byte("INFO")) || !bytes.Contains(data, []byte(`{"k": "v"}`)) {
+		t.Fatalf("unexpected console record %q", data)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	err := Options{Level: "loud", Encoding: "xml", MaxSizeMB: -1, MaxBackups: -1}.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"-log-level", "-log-format", "-log-max-size", "-log-max-backups"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	t.Cleanup(func() { _ = SetLevel("info") })
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger, err := New(Options{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore := RedirectStdLog(logger)
+	log.Printf("from stdlib %d", 42)
+	restore()
+
+	data, _ := os.ReadFile(path)
+	if !bytes.Contains(data, []byte("from stdlib 42")) {
+		t.Fatalf("stdlib log not redirected: %q", data)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, rec := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := f.Write([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for p, content := range want {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("backups beyond maxBackups must be removed")
+	}
+}
+
+func TestRotatingFile_KeepsWritingWhenRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	// Непустой каталог на месте копии: переименование в него не удаётся.
+	busy := filepath.Join(path+".1", "busy")
+	if err := os.MkdirAll(busy, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	write := func(s string) error {
+		_, err := f.Write([]byte(s))
+		return err
+	}
+
+	if err := write("aaaaaaaa\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := write("bbbbbbbb\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := write("cccccccc\n"); err == nil {
+		t.Error("failed rotation must be reported")
+	}
+	// После неудачи следующая попытка — только через maxSize байт.
+	if err := write("dddddddd\n"); err != nil {
+		t.Errorf("write after failed rotation: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "aaaaaaaa\nbbbbbbbb\ncccccccc\ndddddddd\n"; string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+
+	// Когда препятствие убрано, очередная попытка ротации удаётся.
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := write("eeeeeeee\n"); err != nil {
+		t.Fatalf("rotation after recovery: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "eeeeeeee\n" {
+		t.Errorf("log after rotation = %q", data)
+	}
+}
+
+func TestSetLevel_Invalid(t *testing.T) {
+	if err := SetLevel("loud"); err == nil {
+		t.Fatal("expected error")
+	}
+	if level.Level() != zapcore.InfoLevel {
+		t.Fatal("invalid level must not change the current one")
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile — файл журнала с ротацией по размеру. Когда очередная запись
+// не помещается в maxSize байт, файл переименовывается в path.1, прежние
+// копии сдвигаются (path.1 → path.2 …), а копии старше maxBackups удаляются.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64 // 0 — без ротации
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if maxBackups < 1 {
+		maxBackups = 1
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		// Если ротация не удалась, но файл снова открыт, запись идёт в
+		// него, а ошибка возвращается, чтобы её увидел журнал.
+		if rotateErr = f.rotate(); rotateErr != nil && f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Sync()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// rotate закрывает текущий файл, сдвигает копии и открывает новый файл.
+// Если файл не удалось переименовать, он открывается снова на дозапись:
+// журнал продолжает писаться без ротации, а счётчик размера обнуляется,
+// чтобы следующая попытка была не раньше, чем через maxSize байт, а не на
+// каждой записи. f.file равен nil, только если открыть файл не удалось.
+func (f *rotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	_ = os.Remove(backupName(f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(backupName(f.path, i), backupName(f.path, i+1))
+	}
+	if err := os.Rename(f.path, backupName(f.path, 1)); err != nil {
+		err = errors.Join(fmt.Errorf("rotate %s: %w", f.path, err), f.open())
+		f.size = 0
+		return err
+	}
+	return f.open()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
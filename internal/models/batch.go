@@ -0,0 +1,28 @@
+package models
+
+// Статусы обработки элемента пакета в режиме частичного применения (/updates?partial=true).
+const (
+	// StatusOK — метрика применена.
+	StatusOK = "ok"
+	// StatusRejected — метрика не прошла валидацию; повторная отправка не поможет.
+	StatusRejected = "rejected"
+	// StatusFailed — метрика не записана из-за ошибки хранилища; её можно отправить повторно.
+	StatusFailed = "failed"
+)
+
+// MetricResult описывает результат обработки одного элемента пакета.
+// Для применённых метрик Value/Delta содержат значение после обновления.
+type MetricResult struct {
+	Index  int      `json:"index"`           // позиция элемента в исходном пакете
+	ID     string   `json:"id"`              // имя метрики
+	MType  string   `json:"type"`            // тип метрики
+	Status string   `json:"status"`          // StatusOK, StatusRejected или StatusFailed
+	Error  string   `json:"error,omitempty"` // причина, если метрика не применена
+	Delta  *int64   `json:"delta,omitempty"` // значение counter после обновления
+	Value  *float64 `json:"value,omitempty"` // значение gauge после обновления
+}
+
+// BatchResult — ответ на пакетное обновление в режиме частичного применения.
+type BatchResult struct {
+	Results []MetricResult `json:"results"`
+}
@@ -1,6 +1,8 @@
 // Package models определяет структуры данных для обмена метриками между агентом и сервером.
 package models
 
+import "time"
+
 const (
 	// Counter — тип метрики "счётчик" (кумулятивное целочисленное значение).
 	Counter = "counter"
@@ -11,9 +13,15 @@ const (
 // Metrics описывает одну метрику, передаваемую через JSON API.
 // Поле MType принимает значение [Counter] или [Gauge].
 // Для counter используется поле Delta, для gauge — поле Value.
+// Labels — необязательные метки серии; они не входят в идентификатор метрики
+// и заменяют ранее сохранённые метки, только если переданы.
+// UpdatedAt и Stale заполняет сервер при чтении; при записи они игнорируются.
 type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID        string            `json:"id"`                   // имя метрики
+	MType     string            `json:"type"`                 // параметр, принимающий значение gauge или counter
+	Delta     *int64            `json:"delta,omitempty"`      // значение метрики в случае передачи counter
+	Value     *float64          `json:"value,omitempty"`      // значение метрики в случае передачи gauge
+	Labels    map[string]string `json:"labels,omitempty"`     // метки серии
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"` // время последнего обновления серии
+	Stale     bool              `json:"stale,omitempty"`      // серия не обновлялась дольше своего TTL
 }
@@ -0,0 +1,97 @@
+// Package netutil содержит сетевые помощники сервера и агента: списки
+// подсетей CIDR для фильтрации клиентов и определение исходящего адреса.
+package netutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Subnets — набор подсетей CIDR. Пустой набор не содержит ни одного адреса.
+type Subnets []netip.Prefix
+
+// ParseSubnets разбирает список подсетей через запятую, например
+// "10.0.0.0/8, 192.168.1.0/24". Пустая строка даёт пустой набор.
+// Адрес без маски трактуется как подсеть из одного адреса.
+func ParseSubnets(s string) (Subnets, error) {
+	var (
+		res  Subnets
+		errs []error
+	)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid subnet %q", part))
+				continue
+			}
+			res = append(res, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(part)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid subnet %q", part))
+			continue
+		}
+		res = append(res, p.Masked())
+	}
+	return res, errors.Join(errs...)
+}
+
+// Contains сообщает, входит ли адрес в одну из подсетей.
+func (s Subnets) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range s {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// String возвращает подсети через запятую в формате ParseSubnets.
+func (s Subnets) String() string {
+	parts := make([]string, len(s))
+	for i, p := range s {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseAddr разбирает IP-адрес, допуская форму host:port (как в
+// http.Request.RemoteAddr) и пробелы по краям.
+func ParseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// OutboundIP возвращает адрес интерфейса, через который уходят пакеты на
+// адрес target (host:port). UDP-«подключение» не отправляет данных в сеть:
+// ядро только выбирает маршрут и исходящий адрес.
+func OutboundIP(target string) (netip.Addr, error) {
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+
+	addr, ok := ParseAddr(conn.LocalAddr().String())
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("unexpected local address %q", conn.LocalAddr())
+	}
+	return addr, nil
+}
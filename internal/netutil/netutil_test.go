@@ -0,0 +1,71 @@
+package netutil
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseSubnets(t *testing.T) {
+	s, err := ParseSubnets(" 10.0.0.0/8, 192.168.1.7/24,2001:db8::/32 , 172.16.0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.String(), "10.0.0.0/8,192.168.1.0/24,2001:db8::/32,172.16.0.5/32"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.200", true},
+		{"192.168.2.1", false},
+		{"::ffff:10.0.0.1", true},
+		{"2001:db8::1", true},
+		{"172.16.0.5", true},
+		{"172.16.0.6", false},
+	}
+	for _, tt := range tests {
+		if got := s.Contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.addr, tt.want, got)
+		}
+	}
+
+	if s, err := ParseSubnets(""); err != nil || len(s) != 0 {
+		t.Fatalf("empty string: expected empty set, got %v %v", s, err)
+	}
+	if _, err := ParseSubnets("10.0.0.0/8,10.0.0.0/33,nope"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"10.0.0.1":         "10.0.0.1",
+		" 10.0.0.1 ":       "10.0.0.1",
+		"10.0.0.1:1234":    "10.0.0.1",
+		"[2001:db8::1]:80": "2001:db8::1",
+		"::ffff:192.0.2.1": "192.0.2.1",
+	} {
+		got, ok := ParseAddr(in)
+		if !ok || got.String() != want {
+			t.Errorf("%q: expected %s, got %v %v", in, want, got, ok)
+		}
+	}
+	for _, in := range []string{"", "host", "10.0.0.256"} {
+		if _, ok := ParseAddr(in); ok {
+			t.Errorf("%q: expected failure", in)
+		}
+	}
+}
+
+func TestOutboundIP(t *testing.T) {
+	addr, err := OutboundIP("127.0.0.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addr.IsLoopback() {
+		t.Fatalf("expected loopback address, got %s", addr)
+	}
+}
@@ -0,0 +1,420 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+)
+
+// ErrNoHistory возвращается функциями окна, если сбор истории отключён.
+var ErrNoHistory = errors.New("history is not available")
+
+// Source — источник текущих значений; ему удовлетворяет repository.Repository.
+type Source interface {
+	List(ctx context.Context, q repository.ListQuery) (repository.ListPage, error)
+}
+
+// History — источник значений с метками времени; ему удовлетворяет *history.Store.
+type History interface {
+	Get(ctx context.Context, mType, name string) []history.Sample
+}
+
+// Evaluator вычисляет выражения по текущим значениям и истории.
+type Evaluator struct {
+	Source  Source
+	History History // nil — функции окна недоступны
+	Now     func() time.Time
+}
+
+// Eval вычисляет выражение. Числа дают Scalar, всё остальное — Vector.
+// Серии без результата (нет точек в окне, деление на ноль) в вектор не попадают.
+func (e *Evaluator) Eval(ctx context.Context, n Node) (Value, error) {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		return Scalar(n.Value), nil
+
+	case *VectorSelector:
+		return e.selectSeries(ctx, n)
+
+	case *UnaryExpr:
+		v, err := e.Eval(ctx, n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return binary('*', Scalar(-1), v)
+
+	case *BinaryExpr:
+		l, err := e.Eval(ctx, n.LHS)
+		if err != nil {
+			return nil, err
+		}
+		r, err := e.Eval(ctx, n.RHS)
+		if err != nil {
+			return nil, err
+		}
+		return binary(n.Op, l, r)
+
+	case *Call:
+		return e.call(ctx, n)
+
+	case *AggregateExpr:
+		v, err := e.Eval(ctx, n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		vec, ok := v.(Vector)
+		if !ok {
+			return nil, fmt.Errorf("%s() expects a vector, got a scalar", n.Op)
+		}
+		var k int
+		if lit, ok := n.Param.(*NumberLiteral); ok {
+			k = int(lit.Value)
+		}
+		return aggregate(n.Op, k, n.Grouping, vec), nil
+	}
+	return nil, fmt.Errorf("unsupported expression %T", n)
+}
+
+// globRegexp переводит шаблон имени в регулярное выражение.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, part := range strings.SplitAfter(glob, "") {
+		switch part {
+		case "*":
+			b.WriteString(".*")
+		case "?":
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.MustCompile(b.String())
+}
+
+// selectSeries читает из хранилища все метрики, подходящие под селектор.
+// Литеральная часть имени до первого шаблона и условия "метка=значение"
+// передаются в Repository.List, остальные условия проверяются здесь.
+func (e *Evaluator) selectSeries(ctx context.Context, sel *VectorSelector) (Vector, error) {
+	q := repository.ListQuery{Limit: repository.MaxListLimit}
+	if sel.Name != "" {
+		q.Prefix = sel.Name
+		if i := strings.IndexAny(sel.Name, "*?"); i >= 0 {
+			q.Prefix = sel.Name[:i]
+		}
+		q.Regex = globRegexp(sel.Name)
+	}
+	for _, m := range sel.Matchers {
+		if m.Type == MatchEqual && m.Value != "" {
+			if q.Labels == nil {
+				q.Labels = make(map[string]string)
+			}
+			q.Labels[m.Name] = m.Value
+		}
+	}
+
+	res := Vector{}
+	for {
+		page, err := e.Source.List(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page.Metrics {
+			if s, ok := seriesOf(m, sel.Matchers); ok {
+				res = append(res, s)
+			}
+		}
+		if page.Next == "" {
+			return res, nil
+		}
+		q.Cursor = page.Next
+	}
+}
+
+func seriesOf(m models.Metrics, matchers []*LabelMatcher) (Series, bool) {
+	for _, lm := range matchers {
+		if !lm.Matches(m.Labels[lm.Name]) {
+			return Series{}, false
+		}
+	}
+
+	s := Series{Metric: m.ID, Type: m.MType, Labels: m.Labels}
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		s.Value = *m.Value
+	case m.MType == models.Counter && m.Delta != nil:
+		s.Value = float64(*m.Delta)
+	default:
+		return Series{}, false
+	}
+	return s, true
+}
+
+func arith(op byte, l, r float64) float64 {
+	switch op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		return l / r
+	}
+	return math.NaN()
+}
+
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// binary применяет арифметическую операцию. Вектор с числом — поэлементно;
+// два вектора — попарно по совпадающему набору меток (имя метрики не
+// учитывается). Имя метрики в результате сбрасывается.
+func binary(op byte, l, r Value) (Value, error) {
+	ls, lScalar := l.(Scalar)
+	rs, rScalar := r.(Scalar)
+
+	switch {
+	case lScalar && rScalar:
+		v := arith(op, float64(ls), float64(rs))
+		if !finite(v) {
+			return Vector{}, nil
+		}
+		return Scalar(v), nil
+
+	case rScalar:
+		return mapVector(l.(Vector), func(v float64) float64 { return arith(op, v, float64(rs)) }), nil
+
+	case lScalar:
+		return mapVector(r.(Vector), func(v float64) float64 { return arith(op, float64(ls), v) }), nil
+	}
+
+	lv, rv := l.(Vector), r.(Vector)
+	right := make(map[string]Series, len(rv))
+	for _, s := range rv {
+		sig := s.signature()
+		if _, dup := right[sig]; dup {
+			return nil, fmt.Errorf("many-to-many matching is not allowed: several series on the right side have labels {%s}", sig)
+		}
+		right[sig] = s
+	}
+
+	res := Vector{}
+	seen := make(map[string]bool, len(lv))
+	for _, s := range lv {
+		sig := s.signature()
+		if seen[sig] {
+			return nil, fmt.Errorf("many-to-many matching is not allowed: several series on the left side have labels {%s}", sig)
+		}
+		seen[sig] = true
+
+		other, ok := right[sig]
+		if !ok {
+			continue
+		}
+		v := arith(op, s.Value, other.Value)
+		if !finite(v) {
+			continue
+		}
+		res = append(res, Series{Labels: s.Labels, Value: v})
+	}
+	sortVector(res)
+	return res, nil
+}
+
+func mapVector(vec Vector, f func(float64) float64) Vector {
+	res := make(Vector, 0, len(vec))
+	for _, s := range vec {
+		v := f(s.Value)
+		if !finite(v) {
+			continue
+		}
+		res = append(res, Series{Labels: s.Labels, Value: v})
+	}
+	sortVector(res)
+	return res
+}
+
+func (e *Evaluator) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+// call вычисляет функцию окна для каждой подходящей серии.
+// rate и irate применяются только к counter, delta — только к gauge.
+func (e *Evaluator) call(ctx context.Context, c *Call) (Value, error) {
+	if e.History == nil {
+		return nil, ErrNoHistory
+	}
+
+	var fn func([]history.Sample) (float64, bool)
+	mType := models.Counter
+	switch c.Func {
+	case "rate":
+		fn = Rate
+	case "irate":
+		fn = IRate
+	case "delta":
+		fn, mType = Delta, models.Gauge
+	default:
+		return nil, fmt.Errorf("unknown function %q", c.Func)
+	}
+
+	series, err := e.selectSeries(ctx, c.Arg.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	from := e.now().Add(-c.Arg.Range)
+	res := Vector{}
+	for _, s := range series {
+		if s.Type != mType {
+			continue
+		}
+		v, ok := fn(window(e.History.Get(ctx, s.Type, s.Metric), from))
+		if !ok {
+			continue
+		}
+		res = append(res, Series{Metric: s.Metric, Type: s.Type, Labels: s.Labels, Value: v})
+	}
+	return res, nil
+}
+
+// window оставляет точки не старше from.
+func window(samples []history.Sample, from time.Time) []history.Sample {
+	i := 0
+	for i < len(samples) && samples[i].T.Before(from) {
+		i++
+	}
+	return samples[i:]
+}
+
+// increase суммирует прирост counter; уменьшение значения считается сбросом.
+func increase(samples []history.Sample) float64 {
+	var inc float64
+	for i := 1; i < len(samples); i++ {
+		d := samples[i].V - samples[i-1].V
+		if d < 0 {
+			d = samples[i].V
+		}
+		inc += d
+	}
+	return inc
+}
+
+// Rate — средняя скорость роста counter в секунду между первой и последней точкой.
+func Rate(samples []history.Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	elapsed := samples[len(samples)-1].T.Sub(samples[0].T).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return increase(samples) / elapsed, true
+}
+
+// IRate — мгновенная скорость роста counter по двум последним точкам.
+func IRate(samples []history.Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	return Rate(samples[len(samples)-2:])
+}
+
+// Delta — изменение gauge между первой и последней точкой окна.
+func Delta(samples []history.Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	return samples[len(samples)-1].V - samples[0].V, true
+}
+
+// aggregate сворачивает вектор по группам меток.
+func aggregate(op string, k int, grouping []string, vec Vector) Vector {
+	type group struct {
+		labels map[string]string
+		series []Series
+	}
+	groups := make(map[string]*group)
+	var order []string
+
+	for _, s := range vec {
+		labels := make(map[string]string, len(grouping))
+		for _, name := range grouping {
+			if v, ok := s.Labels[name]; ok {
+				labels[name] = v
+			}
+		}
+		key := signature(labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: labels}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.series = append(g.series, s)
+	}
+	sort.Strings(order)
+
+	res := Vector{}
+	for _, key := range order {
+		g := groups[key]
+		if len(g.labels) == 0 {
+			g.labels = nil
+		}
+
+		switch op {
+		case "topk", "bottomk":
+			ss := append([]Series(nil), g.series...)
+			sort.SliceStable(ss, func(i, j int) bool {
+				if op == "topk" {
+					return ss[i].Value > ss[j].Value
+				}
+				return ss[i].Value < ss[j].Value
+			})
+			if len(ss) > k {
+				ss = ss[:k]
+			}
+			res = append(res, ss...)
+			continue
+		}
+
+		var v float64
+		switch op {
+		case "sum", "avg":
+			for _, s := range g.series {
+				v += s.Value
+			}
+			if op == "avg" {
+				v /= float64(len(g.series))
+			}
+		case "min", "max":
+			v = g.series[0].Value
+			for _, s := range g.series[1:] {
+				if op == "min" {
+					v = math.Min(v, s.Value)
+				} else {
+					v = math.Max(v, s.Value)
+				}
+			}
+		case "count":
+			v = float64(len(g.series))
+		}
+		res = append(res, Series{Labels: g.labels, Value: v})
+	}
+	return res
+}
@@ -0,0 +1,239 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+)
+
+type fakeHistory map[string][]history.Sample
+
+func (h fakeHistory) Get(_ context.Context, mType, name string) []history.Sample {
+	return h[mType+"/"+name]
+}
+
+func samples(at time.Time, step time.Duration, values ...float64) []history.Sample {
+	res := make([]history.Sample, len(values))
+	for i, v := range values {
+		res[i] = history.Sample{T: at.Add(time.Duration(i) * step), V: v}
+	}
+	return res
+}
+
+func TestEvaluator(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	_ = repo.UpdateGauge(ctx, "HeapInuse", 30)
+	_ = repo.UpdateGauge(ctx, "HeapSys", 120)
+	_ = repo.UpdateCounter(ctx, "PollCount", 7)
+
+	start := time.Unix(1_700_000_000, 0)
+	now := start.Add(2 * time.Minute)
+	e := &Evaluator{
+		Source: repo,
+		History: fakeHistory{
+			// 0, 10, 20, 5 (сброс), 15 с шагом 30с
+			models.Counter + "/PollCount": samples(start, 30*time.Second, 0, 10, 20, 5, 15),
+			models.Gauge + "/HeapInuse":   samples(start, 30*time.Second, 50, 40, 45, 35, 30),
+		},
+		Now: func() time.Time { return now },
+	}
+
+	tests := []struct {
+		expr string
+		want float64
+		ok   bool
+	}{
+		{"HeapInuse / HeapSys", 0.25, true},
+		{"100 * (1 - HeapInuse / HeapSys)", 75, true},
+		{"PollCount + 1", 8, true},
+		{"-HeapInuse", -30, true},
+		{"Missing + 1", 0, false},
+		{"HeapInuse / 0", 0, false},
+		// Окно 2m захватывает все точки: прирост 10+10+5+10 за 120с.
+		{"rate(PollCount[2m])", 35.0 / 120, true},
+		// Окно 1m: точки 20, 5, 15 — прирост 5+10 за 60с.
+		{"rate(PollCount[1m])", 15.0 / 60, true},
+		{"irate(PollCount[5m])", 10.0 / 30, true},
+		{"rate(PollCount[10s])", 0, false},
+		{"delta(HeapInuse[1m])", 30 - 45, true},
+		{"rate(Missing[1m])", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := e.Eval(ctx, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := ScalarValue(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Fatalf("expected %v (%v), got %v (%v)", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestEvaluator_NoHistory(t *testing.T) {
+	n, _ := Parse("rate(PollCount[1m])")
+	e := &Evaluator{Source: repository.NewMemRepository()}
+	if _, err := e.Eval(context.Background(), n); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("expected ErrNoHistory, got %v", err)
+	}
+}
+
+// format печатает результат в виде, удобном для сравнения в тестах.
+func format(v Value) string {
+	switch v := v.(type) {
+	case Scalar:
+		return fmt.Sprint(float64(v))
+	case Vector:
+		parts := make([]string, len(v))
+		for i, s := range v {
+			parts[i] = fmt.Sprintf("%s{%s} %v", s.Metric, s.signature(), s.Value)
+		}
+		return strings.Join(parts, "; ")
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func TestEvaluator_Vectors(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	gauge := func(id string, v float64, labels map[string]string) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Gauge, Value: &v, Labels: labels}
+	}
+	counter := func(id string, d int64, labels map[string]string) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Counter, Delta: &d, Labels: labels}
+	}
+	_, err := repo.UpdateBatch(ctx, []models.Metrics{
+		gauge("CPUutilization1", 10, map[string]string{"cpu": "1", "host": "a"}),
+		gauge("CPUutilization2", 30, map[string]string{"cpu": "2", "host": "a"}),
+		gauge("CPUutilization3", 50, map[string]string{"cpu": "3", "host": "b"}),
+		gauge("MemUsed", 3, map[string]string{"host": "a"}),
+		gauge("MemTotal", 4, map[string]string{"host": "a"}),
+		gauge("Free", 1, nil),
+		counter("req.a", 100, map[string]string{"host": "a"}),
+		counter("req.b", 200, map[string]string{"host": "b"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1_700_000_000, 0)
+	e := &Evaluator{
+		Source: repo,
+		History: fakeHistory{
+			models.Counter + "/req.a": samples(start, 30*time.Second, 40, 70, 100),
+			models.Counter + "/req.b": samples(start, 30*time.Second, 80, 140, 200),
+		},
+		Now: func() time.Time { return start.Add(time.Minute) },
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"CPUutilization*", `CPUutilization1{cpu="1",host="a"} 10; CPUutilization2{cpu="2",host="a"} 30; CPUutilization3{cpu="3",host="b"} 50`},
+		{"CPUutilization?", `CPUutilization1{cpu="1",host="a"} 10; CPUutilization2{cpu="2",host="a"} 30; CPUutilization3{cpu="3",host="b"} 50`},
+		{`CPU*{host="b"}`, `CPUutilization3{cpu="3",host="b"} 50`},
+		{`CPU*{host!="b"}`, `CPUutilization1{cpu="1",host="a"} 10; CPUutilization2{cpu="2",host="a"} 30`},
+		{`CPU*{cpu=~"[12]"}`, `CPUutilization1{cpu="1",host="a"} 10; CPUutilization2{cpu="2",host="a"} 30`},
+		{`CPU*{cpu!~"1|2"}`, `CPUutilization3{cpu="3",host="b"} 50`},
+		{`{host="a",cpu=""}`, `MemTotal{host="a"} 4; MemUsed{host="a"} 3; req.a{host="a"} 100`},
+		{`Free{host=""}`, `Free{} 1`},
+		{"Missing*", ``},
+
+		// арифметика над векторами
+		{"CPUutilization* / 10", `{cpu="1",host="a"} 1; {cpu="2",host="a"} 3; {cpu="3",host="b"} 5`},
+		{"100 - CPUutilization1", `{cpu="1",host="a"} 90`},
+		{"MemUsed / MemTotal", `{host="a"} 0.75`},
+		{"MemUsed / Free", ``},
+		{"Free / 0", ``},
+
+		// агрегации
+		{"sum(CPUutilization*)", `{} 90`},
+		{"avg(CPUutilization*)", `{} 30`},
+		{"min(CPUutilization*)", `{} 10`},
+		{"max(CPUutilization*)", `{} 50`},
+		{"count(CPUutilization*)", `{} 3`},
+		{"sum(Missing*)", ``},
+		{"sum by (host) (CPUutilization*)", `{host="a"} 40; {host="b"} 50`},
+		{"max(CPUutilization*) by (host)", `{host="a"} 30; {host="b"} 50`},
+		{"count by (cpu, host) (CPUutilization*)", `{cpu="1",host="a"} 1; {cpu="2",host="a"} 1; {cpu="3",host="b"} 1`},
+		{"topk(2, CPUutilization*)", `CPUutilization3{cpu="3",host="b"} 50; CPUutilization2{cpu="2",host="a"} 30`},
+		{"bottomk(1, CPUutilization*)", `CPUutilization1{cpu="1",host="a"} 10`},
+		{"topk by (host) (1, CPUutilization*)", `CPUutilization2{cpu="2",host="a"} 30; CPUutilization3{cpu="3",host="b"} 50`},
+		{"sum(CPUutilization*) / count(CPUutilization*)", `{} 30`},
+
+		// функции окна по нескольким сериям
+		{"rate(req*[1m])", `req.a{host="a"} 1; req.b{host="b"} 2`},
+		{"sum(rate(req*[1m]))", `{} 3`},
+		{`rate(req*{host="b"}[1m])`, `req.b{host="b"} 2`},
+		{"rate(CPU*[1m])", ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := e.Eval(ctx, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(res); got != tt.want {
+				t.Fatalf("expected\n  %s\ngot\n  %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluator_Errors(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	_ = repo.UpdateGauge(ctx, "a1", 1)
+	_ = repo.UpdateGauge(ctx, "a2", 2)
+	_ = repo.UpdateGauge(ctx, "b", 3)
+	e := &Evaluator{Source: repo}
+
+	for _, expr := range []string{"a* + b", "b - a*", "sum(1)"} {
+		t.Run(expr, func(t *testing.T) {
+			n, err := Parse(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := e.Eval(ctx, n); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestScalarValue(t *testing.T) {
+	if v, ok, err := ScalarValue(Scalar(2)); v != 2 || !ok || err != nil {
+		t.Fatalf("scalar: %v %v %v", v, ok, err)
+	}
+	if _, ok, err := ScalarValue(Vector{}); ok || err != nil {
+		t.Fatalf("empty vector: %v %v", ok, err)
+	}
+	if v, ok, err := ScalarValue(Vector{{Value: 3}}); v != 3 || !ok || err != nil {
+		t.Fatalf("single series: %v %v %v", v, ok, err)
+	}
+	if _, _, err := ScalarValue(Vector{{Value: 1}, {Value: 2}}); err == nil {
+		t.Fatal("expected error for several series")
+	}
+}
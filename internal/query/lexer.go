@@ -0,0 +1,205 @@
+// Package query реализует небольшой PromQL-подобный язык запросов к метрикам:
+// селекторы с шаблонами имён и метками, арифметику, агрегации
+// (sum, avg, min, max, count, topk, bottomk) и функции окна
+// (rate, irate, delta), вычисляемые по истории значений.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokString
+	tokRange // [5m]
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokComma
+	tokPlus
+	tokMinus
+	tokMul
+	tokDiv
+	tokEQ  // =
+	tokNE  // !=
+	tokRE  // =~
+	tokNRE // !~
+)
+
+var tokenNames = map[tokenKind]string{
+	tokEOF:    "end of input",
+	tokNumber: "number",
+	tokIdent:  "identifier",
+	tokString: "string",
+	tokRange:  "range",
+	tokLParen: `"("`,
+	tokRParen: `")"`,
+	tokLBrace: `"{"`,
+	tokRBrace: `"}"`,
+	tokComma:  `","`,
+	tokPlus:   `"+"`,
+	tokMinus:  `"-"`,
+	tokMul:    `"*"`,
+	tokDiv:    `"/"`,
+	tokEQ:     `"="`,
+	tokNE:     `"!="`,
+	tokRE:     `"=~"`,
+	tokNRE:    `"!~"`,
+}
+
+func (k tokenKind) String() string {
+	if s, ok := tokenNames[k]; ok {
+		return s
+	}
+	return "unknown token"
+}
+
+type token struct {
+	kind tokenKind
+	text string // для tokString и tokRange — содержимое без кавычек и скобок
+	pos  int
+}
+
+// ParseError — синтаксическая ошибка с позицией (в байтах от начала выражения).
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error at position %d: %s", e.Pos, e.Msg)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// В идентификаторах допускается точка (cpu.user), но не дефис: он всегда
+// означает вычитание. Имена с дефисом записываются в кавычках.
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '.' || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// startsOperand сообщает, может ли с символа c начинаться операнд.
+func startsOperand(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '(' || c == '"' || c == '.'
+}
+
+// globStar решает, является ли '*' в позиции i, стоящая вплотную после
+// идентификатора, частью шаблона имени, а не умножением:
+//
+//	CPU*  sum(CPU*)  CPU*{host="a"}  CPU* + 1  cpu*user   — шаблон;
+//	a * b  a*2  a* b  a*(b)                               — умножение.
+func globStar(input string, i int) bool {
+	j := i + 1
+	if j < len(input) && (isIdentStart(input[j]) || input[j] == '*' || input[j] == '?') {
+		return true
+	}
+	for j < len(input) && isSpace(input[j]) {
+		j++
+	}
+	return j == len(input) || !startsOperand(input[j])
+}
+
+var punct = map[byte]tokenKind{
+	'(': tokLParen, ')': tokRParen, '{': tokLBrace, '}': tokRBrace, ',': tokComma,
+	'+': tokPlus, '-': tokMinus, '*': tokMul, '/': tokDiv,
+}
+
+// lex разбивает выражение на токены.
+func lex(input string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case isSpace(c):
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			start := i
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+				i++
+			}
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				j := i + 1
+				if j < len(input) && (input[j] == '+' || input[j] == '-') {
+					j++
+				}
+				if j < len(input) && isDigit(input[j]) {
+					i = j
+					for i < len(input) && isDigit(input[i]) {
+						i++
+					}
+				}
+			}
+			toks = append(toks, token{kind: tokNumber, text: input[start:i], pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(input) {
+				ch := input[i]
+				if isIdentChar(ch) || ch == '?' || (ch == '*' && globStar(input, i)) {
+					i++
+					continue
+				}
+				break
+			}
+			toks = append(toks, token{kind: tokIdent, text: input[start:i], pos: start})
+		case c == '"':
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return nil, &ParseError{Pos: i, Msg: "unterminated string"}
+			}
+			toks = append(toks, token{kind: tokString, text: input[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case c == '[':
+			end := strings.IndexByte(input[i+1:], ']')
+			if end < 0 {
+				return nil, &ParseError{Pos: i, Msg: `unterminated range, expected "]"`}
+			}
+			toks = append(toks, token{kind: tokRange, text: strings.TrimSpace(input[i+1 : i+1+end]), pos: i})
+			i += end + 2
+		case c == '=' || c == '!':
+			kind := tokEQ
+			switch {
+			case c == '=' && i+1 < len(input) && input[i+1] == '~':
+				kind = tokRE
+			case c == '!' && i+1 < len(input) && input[i+1] == '=':
+				kind = tokNE
+			case c == '!' && i+1 < len(input) && input[i+1] == '~':
+				kind = tokNRE
+			case c == '!':
+				return nil, &ParseError{Pos: i, Msg: `unexpected character '!'`}
+			}
+			n := 1
+			if kind != tokEQ {
+				n = 2
+			}
+			toks = append(toks, token{kind: kind, text: input[i : i+n], pos: i})
+			i += n
+		default:
+			kind, ok := punct[c]
+			if !ok {
+				r, _ := utf8.DecodeRuneInString(input[i:])
+				return nil, &ParseError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+			toks = append(toks, token{kind: kind, text: string(c), pos: i})
+			i++
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(input)}), nil
+}
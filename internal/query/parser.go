@@ -0,0 +1,556 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node — узел синтаксического дерева выражения.
+type Node interface {
+	String() string
+}
+
+// NumberLiteral — числовая константа.
+type NumberLiteral struct {
+	Value float64
+}
+
+func (n *NumberLiteral) String() string {
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+// MatchType — тип сравнения метки.
+type MatchType string
+
+// Операторы сравнения меток.
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher — условие на значение метки. Регулярные выражения
+// привязываются к началу и концу значения.
+type LabelMatcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+func (m *LabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%s", m.Name, m.Type, strconv.Quote(m.Value))
+}
+
+// Matches проверяет значение метки; отсутствующая метка равна пустой строке.
+func (m *LabelMatcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// VectorSelector выбирает метрики по имени и меткам. Имя может содержать
+// шаблоны '*' (любая последовательность) и '?' (один символ); пустое имя
+// означает «все метрики».
+type VectorSelector struct {
+	Name     string
+	Matchers []*LabelMatcher
+}
+
+func (n *VectorSelector) String() string {
+	var b strings.Builder
+	if isPlainIdent(strings.NewReplacer("*", "", "?", "").Replace(n.Name)) {
+		b.WriteString(n.Name)
+	} else if n.Name != "" {
+		b.WriteString(strconv.Quote(n.Name))
+	}
+	if len(n.Matchers) > 0 || n.Name == "" {
+		b.WriteByte('{')
+		for i, m := range n.Matchers {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(m.String())
+		}
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+// IsGlob сообщает, содержит ли имя шаблон.
+func (n *VectorSelector) IsGlob() bool {
+	return strings.ContainsAny(n.Name, "*?")
+}
+
+// MatrixSelector — селектор с окном: значения за последние Range.
+type MatrixSelector struct {
+	Selector *VectorSelector
+	Range    time.Duration
+}
+
+func (n *MatrixSelector) String() string {
+	return fmt.Sprintf("%s[%s]", n.Selector, n.Range)
+}
+
+// Call — вызов функции окна.
+type Call struct {
+	Func string
+	Arg  *MatrixSelector
+}
+
+func (n *Call) String() string {
+	return fmt.Sprintf("%s(%s)", n.Func, n.Arg)
+}
+
+// AggregateExpr — агрегация вектора, возможно с группировкой по меткам.
+// Param задан только для topk и bottomk.
+type AggregateExpr struct {
+	Op       string
+	Param    Node
+	Expr     Node
+	Grouping []string
+}
+
+func (n *AggregateExpr) String() string {
+	var b strings.Builder
+	b.WriteString(n.Op)
+	if len(n.Grouping) > 0 {
+		fmt.Fprintf(&b, " by (%s)", strings.Join(n.Grouping, ", "))
+	}
+	b.WriteByte('(')
+	if n.Param != nil {
+		b.WriteString(n.Param.String())
+		b.WriteString(", ")
+	}
+	b.WriteString(n.Expr.String())
+	b.WriteByte(')')
+	return b.String()
+}
+
+// BinaryExpr — арифметическая операция.
+type BinaryExpr struct {
+	Op  byte // + - * /
+	LHS Node
+	RHS Node
+}
+
+func (n *BinaryExpr) String() string {
+	return fmt.Sprintf("(%s %c %s)", n.LHS, n.Op, n.RHS)
+}
+
+// UnaryExpr — унарный минус.
+type UnaryExpr struct {
+	Expr Node
+}
+
+func (n *UnaryExpr) String() string {
+	return "-" + n.Expr.String()
+}
+
+// rangeFuncs — функции, принимающие селектор с окном.
+var rangeFuncs = map[string]bool{"rate": true, "irate": true, "delta": true}
+
+// aggregateOps — операторы агрегации; topk и bottomk принимают параметр.
+var aggregateOps = map[string]bool{
+	"sum": true, "avg": true, "min": true, "max": true, "count": true,
+	"topk": true, "bottomk": true,
+}
+
+func isPlainIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// Parse разбирает выражение. Грамматика:
+//
+//	expr      = term { ("+" | "-") term }
+//	term      = unary { ("*" | "/") unary }
+//	unary     = "-" unary | primary
+//	primary   = number | selector | call | aggregate | "(" expr ")"
+//	selector  = name [ "{" [ matcher { "," matcher } ] "}" ] | "{" matcher { "," matcher } "}"
+//	name      = identifier | "строка в кавычках"
+//	matcher   = label ( "=" | "!=" | "=~" | "!~" ) "строка"
+//	call      = ( "rate" | "irate" | "delta" ) "(" selector range ")"
+//	aggregate = op [ grouping ] "(" [ number "," ] expr ")" [ grouping ]
+//	op        = "sum" | "avg" | "min" | "max" | "count" | "topk" | "bottomk"
+//	grouping  = "by" "(" label { "," label } ")"
+//
+// В имени селектора '*' и '?' — шаблоны. '*' сразу после имени считается
+// шаблоном, если за ней не следует операнд: "CPU*" — шаблон, "a * b" и "a*2" —
+// умножение. rate и irate применяются к counter, delta — к gauge.
+func Parse(input string) (Node, error) {
+	toks, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return n, nil
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokNumber, tokIdent, tokString:
+		return fmt.Sprintf("%s %q", t.kind, t.text)
+	}
+	return t.kind.String()
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &ParseError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t, "expected %s, got %s", kind, describe(t))
+	}
+	return t, nil
+}
+
+func (p *parser) expr() (Node, error) {
+	lhs, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokPlus && t.kind != tokMinus {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text[0], LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) term() (Node, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokMul && t.kind != tokDiv {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text[0], LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.peek().kind == tokMinus {
+		p.next()
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Expr: n}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return &NumberLiteral{Value: v}, nil
+
+	case tokLParen:
+		p.next()
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case tokIdent:
+		next := p.peekAt(1)
+		if aggregateOps[t.text] && (next.kind == tokLParen || (next.kind == tokIdent && next.text == "by")) {
+			return p.aggregate()
+		}
+		if next.kind == tokLParen {
+			return p.call()
+		}
+		return p.instantSelector()
+
+	case tokString, tokLBrace:
+		return p.instantSelector()
+	}
+
+	p.next()
+	return nil, p.errorf(t, "unexpected %s", describe(t))
+}
+
+// instantSelector разбирает селектор и запрещает окно вне функции:
+// "x[5m]" само по себе не имеет значения.
+func (p *parser) instantSelector() (Node, error) {
+	sel, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokRange {
+		return nil, p.errorf(t, "range selector %s[%s] is only allowed as a function argument", sel, t.text)
+	}
+	return sel, nil
+}
+
+func (p *parser) selector() (*VectorSelector, error) {
+	sel := &VectorSelector{}
+
+	t := p.peek()
+	switch t.kind {
+	case tokIdent:
+		p.next()
+		sel.Name = t.text
+	case tokString:
+		p.next()
+		if t.text == "" {
+			return nil, p.errorf(t, "empty metric name")
+		}
+		sel.Name = t.text
+	case tokLBrace:
+	default:
+		p.next()
+		return nil, p.errorf(t, "expected a metric selector, got %s", describe(t))
+	}
+
+	if p.peek().kind == tokLBrace {
+		matchers, err := p.matchers()
+		if err != nil {
+			return nil, err
+		}
+		sel.Matchers = matchers
+	}
+
+	if sel.Name == "" && len(sel.Matchers) == 0 {
+		return nil, p.errorf(t, "selector must have a name or at least one label matcher")
+	}
+	return sel, nil
+}
+
+func (p *parser) matchers() ([]*LabelMatcher, error) {
+	p.next() // {
+
+	var res []*LabelMatcher
+	for p.peek().kind != tokRBrace {
+		if len(res) > 0 {
+			if _, err := p.expect(tokComma); err != nil {
+				return nil, err
+			}
+			if p.peek().kind == tokRBrace {
+				break
+			}
+		}
+
+		name, err := p.expect(tokIdent)
+		if err != nil {
+			return nil, p.errorf(name, "expected label name, got %s", describe(name))
+		}
+		op := p.next()
+		var mt MatchType
+		switch op.kind {
+		case tokEQ:
+			mt = MatchEqual
+		case tokNE:
+			mt = MatchNotEqual
+		case tokRE:
+			mt = MatchRegexp
+		case tokNRE:
+			mt = MatchNotRegexp
+		default:
+			return nil, p.errorf(op, "expected label match operator, got %s", describe(op))
+		}
+		val, err := p.expect(tokString)
+		if err != nil {
+			return nil, err
+		}
+
+		m := &LabelMatcher{Name: name.text, Type: mt, Value: val.text}
+		if mt == MatchRegexp || mt == MatchNotRegexp {
+			re, err := regexp.Compile("^(?:" + val.text + ")$")
+			if err != nil {
+				return nil, p.errorf(val, "invalid regular expression %q", val.text)
+			}
+			m.re = re
+		}
+		res = append(res, m)
+	}
+	p.next() // }
+
+	return res, nil
+}
+
+func (p *parser) call() (Node, error) {
+	name := p.next()
+	if !rangeFuncs[name.text] {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	p.next() // (
+
+	sel, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := p.expect(tokRange)
+	if err != nil {
+		return nil, p.errorf(r, "%s() expects a range like %s[5m]", name.text, sel)
+	}
+	d, err := time.ParseDuration(r.text)
+	if err != nil || d <= 0 {
+		return nil, p.errorf(r, "invalid range %q", r.text)
+	}
+
+	if _, err := p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+	return &Call{Func: name.text, Arg: &MatrixSelector{Selector: sel, Range: d}}, nil
+}
+
+func (p *parser) aggregate() (Node, error) {
+	op := p.next()
+	agg := &AggregateExpr{Op: op.text}
+
+	if t := p.peek(); t.kind == tokIdent && t.text == "by" {
+		g, err := p.grouping()
+		if err != nil {
+			return nil, err
+		}
+		agg.Grouping = g
+	}
+
+	if _, err := p.expect(tokLParen); err != nil {
+		return nil, err
+	}
+
+	if op.text == "topk" || op.text == "bottomk" {
+		k, err := p.expect(tokNumber)
+		if err != nil {
+			return nil, p.errorf(k, "%s() expects a number of series as the first argument", op.text)
+		}
+		v, err := strconv.ParseFloat(k.text, 64)
+		if err != nil || v < 1 || v != float64(int(v)) {
+			return nil, p.errorf(k, "%s() expects a positive integer, got %q", op.text, k.text)
+		}
+		agg.Param = &NumberLiteral{Value: v}
+		if _, err := p.expect(tokComma); err != nil {
+			return nil, err
+		}
+	}
+
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	agg.Expr = e
+
+	if _, err := p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokIdent && t.text == "by" {
+		if agg.Grouping != nil {
+			return nil, p.errorf(t, "duplicate grouping")
+		}
+		g, err := p.grouping()
+		if err != nil {
+			return nil, err
+		}
+		agg.Grouping = g
+	}
+	return agg, nil
+}
+
+func (p *parser) grouping() ([]string, error) {
+	p.next() // by
+	if _, err := p.expect(tokLParen); err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for p.peek().kind != tokRParen {
+		if len(res) > 0 {
+			if _, err := p.expect(tokComma); err != nil {
+				return nil, err
+			}
+		}
+		t, err := p.expect(tokIdent)
+		if err != nil {
+			return nil, p.errorf(t, "expected label name, got %s", describe(t))
+		}
+		res = append(res, t.text)
+	}
+	p.next() // )
+
+	if len(res) == 0 {
+		return nil, p.errorf(p.toks[p.pos-1], "grouping must list at least one label")
+	}
+	return res, nil
+}
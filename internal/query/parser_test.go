@@ -0,0 +1,186 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// числа
+		{"42", "42"},
+		{"1e9", "1e+09"},
+		{".5", "0.5"},
+		{"2E-3", "0.002"},
+
+		// селекторы
+		{"HeapAlloc", "HeapAlloc"},
+		{"cpu.user", "cpu.user"},
+		{"job:requests:rate5m", "job:requests:rate5m"},
+		{`"my-metric"`, `"my-metric"`},
+		{"CPUutilization*", "CPUutilization*"},
+		{"cpu*user", "cpu*user"},
+		{"Heap???", "Heap???"},
+		{`cpu{host="a"}`, `cpu{host="a"}`},
+		{`cpu{host="a", dc!="x"}`, `cpu{host="a",dc!="x"}`},
+		{`cpu{host=~"a|b",dc!~"x.*"}`, `cpu{host=~"a|b",dc!~"x.*"}`},
+		{`cpu{host="a",}`, `cpu{host="a"}`},
+		{`cpu{}`, `cpu`},
+		{`{host="a"}`, `{host="a"}`},
+		{`CPU*{host="a"}`, `CPU*{host="a"}`},
+		{`"free-*"`, `"free-*"`},
+		{"sum", "sum"},
+		{"by", "by"},
+
+		// арифметика и приоритеты
+		{"HeapInuse / HeapSys", "(HeapInuse / HeapSys)"},
+		{"a + b * c", "(a + (b * c))"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a / b / c", "((a / b) / c)"},
+		{"-a * 2", "(-a * 2)"},
+		{"--a", "--a"},
+		{"a-1", "(a - 1)"},
+		{"a*2", "(a * 2)"},
+		{"a * b", "(a * b)"},
+		{"a* b", "(a * b)"},
+		{"a*(b)", "(a * b)"},
+		{"CPU* + 1", "(CPU* + 1)"},
+		{"CPU* * 2", "(CPU* * 2)"},
+		{"100 * (1 - FreeMemory / TotalMemory)", "(100 * (1 - (FreeMemory / TotalMemory)))"},
+
+		// функции окна
+		{"rate(PollCount[1m])", "rate(PollCount[1m0s])"},
+		{"irate( PollCount [ 30s ] )", "irate(PollCount[30s])"},
+		{`delta("free-mem"[5m])`, `delta("free-mem"[5m0s])`},
+		{`rate(req*{host="a"}[1m])`, `rate(req*{host="a"}[1m0s])`},
+
+		// агрегации
+		{"sum(CPUutilization*)", "sum(CPUutilization*)"},
+		{"avg(cpu)", "avg(cpu)"},
+		{"min(cpu) + max(cpu)", "(min(cpu) + max(cpu))"},
+		{"count(cpu)", "count(cpu)"},
+		{"max by (host) (cpu)", "max by (host)(cpu)"},
+		{"max(cpu) by (host, dc)", "max by (host, dc)(cpu)"},
+		{"topk(3, Heap*)", "topk(3, Heap*)"},
+		{"bottomk by (host) (1, cpu)", "bottomk by (host)(1, cpu)"},
+		{"sum(rate(req*[1m])) by (host)", "sum by (host)(rate(req*[1m0s]))"},
+		{"sum(a) / count(a)", "(sum(a) / count(a))"},
+		{"sum(a * 2)", "sum((a * 2))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := n.String()
+			if got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+
+			// Каноническая форма разбирается в то же дерево.
+			again, err := Parse(got)
+			if err != nil {
+				t.Fatalf("canonical form %q does not parse: %v", got, err)
+			}
+			if again.String() != got {
+				t.Fatalf("canonical form is not stable: %s -> %s", got, again)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{"", 0},
+		{"a +", 3},
+		{"a b", 2},
+		{"(a + b", 6},
+		{"a + )", 4},
+		{"a % b", 2},
+		{"a ! b", 2},
+		{"rate(a)", 6},
+		{"rate(a[])", 6},
+		{"rate(a[5x])", 6},
+		{"rate(a[-1m])", 6},
+		{"rate(1[5m])", 5},
+		{"rate(a[5m]", 10},
+		{"histogram(a[5m])", 0},
+		{"a[5m]", 1},
+		{"a[5m", 1},
+		{`"unterminated`, 0},
+		{`""`, 0},
+		{"1..2", 0},
+		{"привет", 0},
+		{"{}", 0},
+		{`cpu{host}`, 8},
+		{`cpu{host=a}`, 9},
+		{`cpu{"host"="a"}`, 4},
+		{`cpu{host="a" dc="b"}`, 13},
+		{`cpu{host=~"("}`, 10},
+		{`cpu{host="a"`, 12},
+		{"sum()", 4},
+		{"sum(a", 5},
+		{"sum by (host)", 13},
+		{"sum by () (a)", 8},
+		{"sum by (host,) (a)", 13},
+		{"sum by (host) (a) by (dc)", 18},
+		{"sum by host (a)", 7},
+		{"topk(a)", 5},
+		{"topk(0, a)", 5},
+		{"topk(1.5, a)", 5},
+		{"topk(3 a)", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected ParseError, got %v", err)
+			}
+			if pe.Pos != tt.pos {
+				t.Fatalf("expected error at %d, got %d (%v)", tt.pos, pe.Pos, err)
+			}
+		})
+	}
+}
+
+func TestLex_GlobOrMultiply(t *testing.T) {
+	tests := []struct {
+		expr  string
+		kinds []tokenKind
+	}{
+		{"a*", []tokenKind{tokIdent}},
+		{"a*b", []tokenKind{tokIdent}},
+		{"a*2", []tokenKind{tokIdent, tokMul, tokNumber}},
+		{"a * b", []tokenKind{tokIdent, tokMul, tokIdent}},
+		{"a*)", []tokenKind{tokIdent, tokRParen}},
+		{"a*{", []tokenKind{tokIdent, tokLBrace}},
+		{"a* -1", []tokenKind{tokIdent, tokMinus, tokNumber}},
+		{`a*"b"`, []tokenKind{tokIdent, tokMul, tokString}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			toks, err := lex(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			toks = toks[:len(toks)-1] // EOF
+			if len(toks) != len(tt.kinds) {
+				t.Fatalf("expected %v, got %v", tt.kinds, toks)
+			}
+			for i, k := range tt.kinds {
+				if toks[i].kind != k {
+					t.Fatalf("token %d: expected %s, got %s", i, k, toks[i].kind)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValueType — тип результата выражения.
+type ValueType string
+
+// Типы результатов.
+const (
+	ValueScalar ValueType = "scalar"
+	ValueVector ValueType = "vector"
+)
+
+// Value — результат вычисления: Scalar или Vector.
+type Value interface {
+	Type() ValueType
+}
+
+// Scalar — число без меток.
+type Scalar float64
+
+// Type возвращает ValueScalar.
+func (Scalar) Type() ValueType { return ValueScalar }
+
+// Series — элемент вектора. Metric и Type пусты, если серия получена
+// арифметикой или агрегацией.
+type Series struct {
+	Metric string            `json:"metric,omitempty"`
+	Type   string            `json:"type,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// signature — набор меток серии в каноническом виде (без имени метрики).
+func (s Series) signature() string {
+	return signature(s.Labels)
+}
+
+func signature(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Vector — набор серий.
+type Vector []Series
+
+// Type возвращает ValueVector.
+func (Vector) Type() ValueType { return ValueVector }
+
+func sortVector(v Vector) {
+	sort.SliceStable(v, func(i, j int) bool {
+		if v[i].Metric != v[j].Metric {
+			return v[i].Metric < v[j].Metric
+		}
+		return v[i].signature() < v[j].signature()
+	})
+}
+
+// ScalarValue сводит результат к одному числу: Scalar — как есть, вектор
+// из одной серии — её значение. Пустой вектор даёт false, вектор из
+// нескольких серий — ошибку.
+func ScalarValue(v Value) (float64, bool, error) {
+	switch v := v.(type) {
+	case Scalar:
+		return float64(v), true, nil
+	case Vector:
+		switch len(v) {
+		case 0:
+			return 0, false, nil
+		case 1:
+			return v[0].Value, true, nil
+		}
+		return 0, false, fmt.Errorf("expression returned %d series, expected one", len(v))
+	}
+	return 0, false, fmt.Errorf("unsupported value %T", v)
+}
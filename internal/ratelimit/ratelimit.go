@@ -0,0 +1,98 @@
+// Package ratelimit реализует ограничение частоты запросов по алгоритму
+// token bucket с отдельной корзиной на каждого клиента.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// idleFactor — через сколько «времён полного наполнения» неиспользуемая
+// корзина удаляется: полная корзина неотличима от новой.
+const idleFactor = 2
+
+// Limiter ограничивает частоту запросов каждого ключа (адреса или токена)
+// значением Rate в секунду с допустимым всплеском Burst. Безопасен для
+// конкурентного использования.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New создаёт ограничитель: rate запросов в секунду, всплеск до burst
+// запросов. burst < 1 трактуется как max(1, ceil(rate)).
+func New(rate float64, burst int) *Limiter {
+	b := float64(burst)
+	if burst < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   b,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow расходует один токен из корзины key. Если токенов нет, возвращает
+// false и время, через которое появится следующий.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Len возвращает число отслеживаемых клиентов.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep удаляет корзины, которые успели наполниться, чтобы память не росла
+// с числом когда-либо обращавшихся клиентов. Выполняется не чаще, чем
+// раз в время наполнения корзины.
+func (l *Limiter) sweep(now time.Time) {
+	fill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < fill {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleFactor*fill {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(rate, burst)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	l, clock := newTestLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d must fit into the burst", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("burst exhausted, request must be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("expected 500ms until the next token, got %s", wait)
+	}
+
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("other clients must have their own bucket")
+	}
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("token must be refilled")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("only one token must be refilled")
+	}
+}
+
+func TestLimiter_DefaultBurst(t *testing.T) {
+	l, _ := newTestLimiter(0.5, 0)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request must be allowed")
+	}
+	if ok, wait := l.Allow("a"); ok || wait != 2*time.Second {
+		t.Fatalf("expected rejection with 2s wait, got %v %s", ok, wait)
+	}
+}
+
+func TestLimiter_EvictsIdleBuckets(t *testing.T) {
+	l, clock := newTestLimiter(10, 10)
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(key)
+	}
+	if l.Len() != 3 {
+		t.Fatalf("expected 3 buckets, got %d", l.Len())
+	}
+
+	clock.t = clock.t.Add(time.Minute)
+	l.Allow("d")
+	if l.Len() != 1 {
+		t.Fatalf("idle buckets must be evicted, got %d", l.Len())
+	}
+}
@@ -0,0 +1,178 @@
+// Package recording вычисляет правила записи: производные метрики
+// (скорость роста counter, изменение gauge, арифметика над метриками),
+// которые периодически сохраняются в хранилище как gauge.
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/query"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+	"github.com/zheki1/yaprmtrc/internal/validation"
+)
+
+// DefaultInterval — период вычисления правил по умолчанию.
+const DefaultInterval = 10 * time.Second
+
+// Rule — правило записи: значение выражения Expr сохраняется как gauge Record.
+// Выражение читает и результат пишется в метрики одного арендатора.
+type Rule struct {
+	Record string     `json:"record"`
+	Tenant string     `json:"tenant,omitempty"` // пусто — tenant.Default
+	Expr   string     `json:"expr"`
+	Node   query.Node `json:"-"`
+}
+
+// tenantID возвращает арендатора правила.
+func (r Rule) tenantID() string {
+	if r.Tenant == "" {
+		return tenant.Default
+	}
+	return r.Tenant
+}
+
+// Config — содержимое файла правил записи.
+type Config struct {
+	Interval time.Duration `json:"-"`
+	Rules    []Rule        `json:"rules"`
+}
+
+// LoadConfig читает и проверяет файл правил записи в формате JSON.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("recording rules: %w", err)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig разбирает конфигурацию вида
+//
+//	{"interval": "10s", "rules": [{"record": "PollCount:rate1m", "expr": "rate(PollCount[1m])"}]}
+//
+// и возвращает все найденные ошибки сразу.
+func ParseConfig(data []byte) (*Config, error) {
+	var raw struct {
+		Interval string `json:"interval"`
+		Rules    []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("recording rules: %w", err)
+	}
+
+	cfg := &Config{Interval: DefaultInterval, Rules: raw.Rules}
+	var errs []error
+
+	if raw.Interval != "" {
+		d, err := time.ParseDuration(raw.Interval)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid interval %q", raw.Interval))
+		}
+		cfg.Interval = d
+	}
+
+	seen := make(map[string]bool, len(cfg.Rules))
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		if r.Tenant != "" {
+			if err := tenant.Validate(r.Tenant); err != nil {
+				errs = append(errs, fmt.Errorf("rule %q: %w", r.Record, err))
+			}
+		}
+		key := r.tenantID() + "/" + r.Record
+		if err := validation.Name(r.Record); err != nil {
+			errs = append(errs, fmt.Errorf("rule #%d: record: %w", i, err))
+		} else if seen[key] {
+			errs = append(errs, fmt.Errorf("rule %q: duplicate record", r.Record))
+		}
+		seen[key] = true
+
+		n, err := query.Parse(r.Expr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", r.Record, err))
+		}
+		r.Node = n
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("recording rules: %w", err)
+	}
+	return cfg, nil
+}
+
+// Storage — хранилище, из которого читаются значения и в которое
+// записываются результаты; ему удовлетворяет repository.Repository.
+type Storage interface {
+	query.Source
+	UpdateGauge(ctx context.Context, name string, value float64) error
+}
+
+// Logger — журнал движка; ему удовлетворяет *zap.SugaredLogger.
+type Logger interface {
+	Errorf(template string, args ...interface{})
+}
+
+// Engine периодически вычисляет правила записи.
+type Engine struct {
+	storage Storage
+	eval    *query.Evaluator
+	rules   []Rule
+	logger  Logger
+}
+
+// NewEngine создаёт движок. История нужна функциям rate, irate и delta:
+// метки времени обновлений берутся из неё.
+func NewEngine(storage Storage, hist query.History, rules []Rule, logger Logger) *Engine {
+	return &Engine{
+		storage: storage,
+		eval:    &query.Evaluator{Source: storage, History: hist},
+		rules:   rules,
+		logger:  logger,
+	}
+}
+
+// Run вычисляет правила каждые interval до отмены ctx.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Eval(ctx)
+		}
+	}
+}
+
+// Eval вычисляет все правила по порядку и сохраняет результаты.
+// Выражение должно давать одно число; правило без результата (нет данных,
+// деление на ноль) пропускается, предыдущее значение gauge сохраняется.
+// Правила могут ссылаться на результаты предыдущих правил своего арендатора.
+func (e *Engine) Eval(ctx context.Context) {
+	for _, r := range e.rules {
+		ctx := tenant.WithTenant(ctx, r.tenantID())
+		res, err := e.eval.Eval(ctx, r.Node)
+		if err != nil {
+			e.logger.Errorf("recording rule %q: %v", r.Record, err)
+			continue
+		}
+		v, ok, err := query.ScalarValue(res)
+		if err != nil {
+			e.logger.Errorf("recording rule %q: %v", r.Record, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := e.storage.UpdateGauge(ctx, r.Record, v); err != nil {
+			e.logger.Errorf("recording rule %q: store: %v", r.Record, err)
+		}
+	}
+}
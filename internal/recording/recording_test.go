@@ -0,0 +1,119 @@
+package recording
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zheki1/yaprmtrc/internal/history"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{
+		"interval": "5s",
+		"rules": [
+			{"record": "HeapUsage", "expr": "HeapInuse / HeapSys"},
+			{"record": "PollCount:rate1m", "expr": "rate(PollCount[1m])"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Interval != 5*time.Second || len(cfg.Rules) != 2 || cfg.Rules[1].Node == nil {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	cfg, err = ParseConfig([]byte(`{"rules": []}`))
+	if err != nil || cfg.Interval != DefaultInterval {
+		t.Fatalf("expected default interval, got %v (%v)", cfg, err)
+	}
+}
+
+func TestParseConfig_ReportsAllErrors(t *testing.T) {
+	_, err := ParseConfig([]byte(`{
+		"interval": "soon",
+		"rules": [
+			{"record": "", "expr": "1"},
+			{"record": "A", "expr": "a +"},
+			{"record": "A", "expr": "1"}
+		]
+	}`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{`invalid interval "soon"`, "rule #0: record", `rule "A": parse error`, `rule "A": duplicate record`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestEngine_StoresDerivedGauges(t *testing.T) {
+	ctx := context.Background()
+	hist := history.NewStore(10)
+	repo := history.Wrap(repository.NewMemRepository(), hist)
+
+	_ = repo.UpdateGauge(ctx, "HeapInuse", 25)
+	_ = repo.UpdateGauge(ctx, "HeapSys", 100)
+	_ = repo.UpdateCounter(ctx, "PollCount", 1)
+
+	cfg, err := ParseConfig([]byte(`{"rules": [
+		{"record": "HeapUsage", "expr": "HeapInuse / HeapSys"},
+		{"record": "HeapUsagePct", "expr": "HeapUsage * 100"},
+		{"record": "PollRate", "expr": "rate(PollCount[1h])"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine(repo, hist, cfg.Rules, zap.NewNop().Sugar())
+	e.Eval(ctx)
+
+	if v, ok, _ := repo.GetGauge(ctx, "HeapUsage"); !ok || v != 0.25 {
+		t.Fatalf("HeapUsage: %v %v", v, ok)
+	}
+	if v, ok, _ := repo.GetGauge(ctx, "HeapUsagePct"); !ok || v != 25 {
+		t.Fatalf("rules must see results of previous rules: %v %v", v, ok)
+	}
+	if _, ok, _ := repo.GetGauge(ctx, "PollRate"); ok {
+		t.Fatal("rate of a single sample must not be stored")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	_ = repo.UpdateCounter(ctx, "PollCount", 1)
+	e.Eval(ctx)
+
+	if v, ok, _ := repo.GetGauge(ctx, "PollRate"); !ok || v <= 0 {
+		t.Fatalf("PollRate: %v %v", v, ok)
+	}
+	if got := hist.Get(ctx, "gauge", "HeapUsage"); len(got) != 2 {
+		t.Fatalf("derived gauges must get history too, got %d samples", len(got))
+	}
+}
+
+func TestEngine_RulesAreTenantScoped(t *testing.T) {
+	ctx := context.Background()
+	teamA := tenant.WithTenant(ctx, "team-a")
+	hist := history.NewStore(10)
+	repo := history.Wrap(repository.NewMemRepository(), hist)
+	_ = repo.UpdateGauge(teamA, "HeapInuse", 10)
+	_ = repo.UpdateGauge(ctx, "HeapInuse", 99)
+
+	cfg, err := ParseConfig([]byte(`{"rules": [{"record": "Heap2", "tenant": "team-a", "expr": "HeapInuse * 2"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewEngine(repo, hist, cfg.Rules, zap.NewNop().Sugar()).Eval(ctx)
+
+	if v, ok, _ := repo.GetGauge(teamA, "Heap2"); !ok || v != 20 {
+		t.Fatalf("team-a Heap2: %v %v", v, ok)
+	}
+	if _, ok, _ := repo.GetGauge(ctx, "Heap2"); ok {
+		t.Fatal("team-a rule must not write into the default tenant")
+	}
+}
@@ -5,23 +5,34 @@ import (
 	"encoding/json"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
 )
 
 // FileRepository — хранилище метрик в JSON-файле.
 // Каждая операция записи перезаписывает файл целиком через атомарный rename.
+// Метрики всех арендаторов хранятся в одном файле (см. TenantMetrics).
 type FileRepository struct {
 	path string
 	mu   sync.Mutex
+	now  func() time.Time
 }
 
 // NewFileRepository создаёт хранилище, пишущее метрики в файл path.
 func NewFileRepository(path string) *FileRepository {
-	return &FileRepository{path: path}
+	return &FileRepository{path: path, now: time.Now}
 }
 
-func (f *FileRepository) save(metrics []models.Metrics) error {
+// touch отмечает обновление метрики текущим временем.
+func (f *FileRepository) touch(m *models.Metrics) {
+	now := f.now()
+	m.UpdatedAt = &now
+	m.Stale = false
+}
+
+func (f *FileRepository) save(metrics []TenantMetrics) error {
 	tmp := f.path + ".tmp"
 
 	file, err := os.Create(tmp)
@@ -44,14 +55,14 @@ func (f *FileRepository) save(metrics []models.Metrics) error {
 	return os.Rename(tmp, f.path)
 }
 
-func (f *FileRepository) restore() ([]models.Metrics, error) {
+func (f *FileRepository) restore() ([]TenantMetrics, error) {
 	file, err := os.Open(f.path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	var metrics []models.Metrics
+	var metrics []TenantMetrics
 
 	if err := json.NewDecoder(file).Decode(&metrics); err != nil {
 		return nil, err
@@ -68,30 +79,35 @@ func (f *FileRepository) UpdateGauge(
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	metrics, err := f.restore()
+	records, err := f.restore()
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	id := tenant.FromContext(ctx)
+	metrics, others := splitTenant(records, id)
 
 	updated := false
 
 	for i := range metrics {
 		if metrics[i].ID == name && metrics[i].MType == models.Gauge {
 			metrics[i].Value = &value
+			f.touch(&metrics[i])
 			updated = true
 			break
 		}
 	}
 
 	if !updated {
-		metrics = append(metrics, models.Metrics{
+		m := models.Metrics{
 			ID:    name,
 			MType: models.Gauge,
 			Value: &value,
-		})
+		}
+		f.touch(&m)
+		metrics = append(metrics, m)
 	}
 
-	return f.save(metrics)
+	return f.save(joinTenant(id, metrics, others))
 }
 
 func (f *FileRepository) UpdateCounter(
@@ -102,25 +118,30 @@ func (f *FileRepository) UpdateCounter(
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	metrics, err := f.restore()
+	records, err := f.restore()
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	id := tenant.FromContext(ctx)
+	metrics, others := splitTenant(records, id)
 
 	for i := range metrics {
 		if metrics[i].ID == name && metrics[i].MType == models.Counter {
 			*metrics[i].Delta += delta
-			return f.save(metrics)
+			f.touch(&metrics[i])
+			return f.save(joinTenant(id, metrics, others))
 		}
 	}
 
-	metrics = append(metrics, models.Metrics{
+	m := models.Metrics{
 		ID:    name,
 		MType: models.Counter,
 		Delta: &delta,
-	})
+	}
+	f.touch(&m)
+	metrics = append(metrics, m)
 
-	return f.save(metrics)
+	return f.save(joinTenant(id, metrics, others))
 }
 
 func (f *FileRepository) GetAll(
@@ -129,7 +150,12 @@ func (f *FileRepository) GetAll(
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	return f.restore()
+	records, err := f.restore()
+	if err != nil {
+		return nil, err
+	}
+	metrics, _ := splitTenant(records, tenant.FromContext(ctx))
+	return metrics, nil
 }
 
 func (f *FileRepository) GetGauge(
@@ -139,10 +165,11 @@ func (f *FileRepository) GetGauge(
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	metrics, err := f.restore()
+	records, err := f.restore()
 	if err != nil {
 		return 0, false, err
 	}
+	metrics, _ := splitTenant(records, tenant.FromContext(ctx))
 
 	for _, m := range metrics {
 		if m.ID == name && m.MType == models.Gauge {
@@ -160,10 +187,11 @@ func (f *FileRepository) GetCounter(
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	metrics, err := f.restore()
+	records, err := f.restore()
 	if err != nil {
 		return 0, false, err
 	}
+	metrics, _ := splitTenant(records, tenant.FromContext(ctx))
 
 	for _, m := range metrics {
 		if m.ID == name && m.MType == models.Counter {
@@ -177,16 +205,27 @@ func (f *FileRepository) GetCounter(
 func (f *FileRepository) UpdateBatch(
 	ctx context.Context,
 	metrics []models.Metrics,
-) error {
+) ([]models.Metrics, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	data, err := f.restore()
+	records, err := f.restore()
 	if err != nil && !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
+	id := tenant.FromContext(ctx)
+	data, others := splitTenant(records, id)
+	keep := restoring(ctx)
 
 	for _, m := range metrics {
+		if (m.MType == models.Gauge && m.Value == nil) ||
+			(m.MType == models.Counter && m.Delta == nil) {
+			continue
+		}
+		if !keep || m.UpdatedAt == nil {
+			f.touch(&m)
+		}
+
 		updated := false
 
 		for i := range data {
@@ -200,6 +239,12 @@ func (f *FileRepository) UpdateBatch(
 					*data[i].Delta += *m.Delta
 				}
 
+				if len(m.Labels) > 0 {
+					data[i].Labels = m.Labels
+				}
+				data[i].UpdatedAt = m.UpdatedAt
+				data[i].Stale = m.Stale
+
 				updated = true
 			}
 		}
@@ -209,7 +254,162 @@ func (f *FileRepository) UpdateBatch(
 		}
 	}
 
-	return f.save(data)
+	if err := f.save(joinTenant(id, data, others)); err != nil {
+		return nil, err
+	}
+
+	totals := batchSeries(metrics)
+	for i := range totals {
+		for _, d := range data {
+			if d.ID == totals[i].ID && d.MType == totals[i].MType {
+				if d.MType == models.Gauge {
+					v := *d.Value
+					totals[i].Value = &v
+				} else {
+					v := *d.Delta
+					totals[i].Delta = &v
+				}
+				break
+			}
+		}
+	}
+	return totals, nil
+}
+
+// Get возвращает метрику указанного типа. Второе значение false, если метрика не найдена.
+func (f *FileRepository) Get(
+	ctx context.Context,
+	mType, name string,
+) (models.Metrics, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.restore()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return models.Metrics{}, false, nil
+		}
+		return models.Metrics{}, false, err
+	}
+	metrics, _ := splitTenant(records, tenant.FromContext(ctx))
+
+	for _, m := range metrics {
+		if m.ID == name && m.MType == mType {
+			return m, true, nil
+		}
+	}
+
+	return models.Metrics{}, false, nil
+}
+
+// List возвращает страницу метрик, отобранных по q.
+func (f *FileRepository) List(
+	ctx context.Context,
+	q ListQuery,
+) (ListPage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.restore()
+	if err != nil && !os.IsNotExist(err) {
+		return ListPage{}, err
+	}
+	metrics, _ := splitTenant(records, tenant.FromContext(ctx))
+
+	return listSlice(metrics, q)
+}
+
+func (f *FileRepository) Delete(
+	ctx context.Context,
+	mType, name string,
+) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.restore()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	id := tenant.FromContext(ctx)
+	metrics, others := splitTenant(records, id)
+
+	for i := range metrics {
+		if metrics[i].ID == name && metrics[i].MType == mType {
+			metrics = append(metrics[:i], metrics[i+1:]...)
+			return true, f.save(joinTenant(id, metrics, others))
+		}
+	}
+
+	return false, nil
+}
+
+// Expire помечает устаревшей или удаляет метрику, не обновлявшуюся с момента before.
+// Метрики без времени обновления (записанные до его появления) не затрагиваются.
+func (f *FileRepository) Expire(
+	ctx context.Context,
+	mType, name string,
+	before time.Time,
+	remove bool,
+) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.restore()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	id := tenant.FromContext(ctx)
+	metrics, others := splitTenant(records, id)
+
+	for i := range metrics {
+		m := &metrics[i]
+		if m.ID != name || m.MType != mType {
+			continue
+		}
+		if m.UpdatedAt == nil || !m.UpdatedAt.Before(before) || (!remove && m.Stale) {
+			return false, nil
+		}
+		if remove {
+			metrics = append(metrics[:i], metrics[i+1:]...)
+		} else {
+			m.Stale = true
+		}
+		return true, f.save(joinTenant(id, metrics, others))
+	}
+
+	return false, nil
+}
+
+// Tenants возвращает отсортированный список арендаторов, у которых есть метрики.
+func (f *FileRepository) Tenants(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.restore()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	return tenantsOf(records), nil
+}
+
+// Ping проверяет, что файл хранилища читается; отсутствие файла не ошибка.
+func (f *FileRepository) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.restore(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 func (f *FileRepository) Close() error {
@@ -141,7 +141,7 @@ func TestFileRepository_UpdateBatch(t *testing.T) {
 		{ID: "C1", MType: models.Counter, Delta: &d1},
 	}
 
-	if err := repo.UpdateBatch(ctx, batch); err != nil {
+	if _, err := repo.UpdateBatch(ctx, batch); err != nil {
 		t.Fatalf("UpdateBatch: %v", err)
 	}
 
@@ -162,7 +162,7 @@ func TestFileRepository_UpdateBatch(t *testing.T) {
 		{ID: "G1", MType: models.Gauge, Value: &v2},
 		{ID: "C1", MType: models.Counter, Delta: &d2},
 	}
-	if err := repo.UpdateBatch(ctx, batch2); err != nil {
+	if _, err := repo.UpdateBatch(ctx, batch2); err != nil {
 		t.Fatalf("UpdateBatch: %v", err)
 	}
 
@@ -197,3 +197,27 @@ func TestFileRepository_RestoreNoFile(t *testing.T) {
 		t.Fatal("expected error for missing file")
 	}
 }
+
+func TestFileRepository_Delete(t *testing.T) {
+	repo := NewFileRepository(tempFilePath(t))
+	ctx := context.Background()
+
+	if ok, err := repo.Delete(ctx, models.Gauge, "Alloc"); ok || err != nil {
+		t.Fatalf("expected nothing to delete, got %v %v", ok, err)
+	}
+
+	_ = repo.UpdateGauge(ctx, "Alloc", 1)
+	_ = repo.UpdateCounter(ctx, "Poll", 1)
+
+	if ok, err := repo.Delete(ctx, models.Gauge, "Alloc"); !ok || err != nil {
+		t.Fatalf("expected gauge to be deleted, got %v %v", ok, err)
+	}
+
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].ID != "Poll" {
+		t.Fatalf("unexpected metrics after delete: %+v", all)
+	}
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/selfmetrics"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+var (
+	storageOps = selfmetrics.NewCounterVec("storage_operations_total", "operation", "result")
+	storageDur = selfmetrics.NewHistogramVec("storage_operation_duration_seconds", nil, "operation")
+)
+
+// Instrumented — обёртка, которая считает вызовы хранилища, их ошибки и
+// длительность (показатели storage_* в пространстве selfmetrics) и
+// записывает каждый вызов участком трассы storage.<операция>.
+type Instrumented struct {
+	Repository
+}
+
+// Instrument оборачивает хранилище учётом вызовов.
+func Instrument(repo Repository) *Instrumented {
+	return &Instrumented{Repository: repo}
+}
+
+// observe учитывает вызов op, начатый в start и завершившийся с err.
+func observe(op string, start time.Time, err error) {
+	storageDur.With(op).ObserveSince(start)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	storageOps.With(op, result).Inc()
+}
+
+// begin начинает вызов op: открывает участок трассы в ctx и возвращает
+// функцию, которая учитывает результат и закрывает участок.
+func begin(ctx context.Context, op string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "storage."+op)
+	return ctx, func(err error) {
+		observe(op, start, err)
+		span.End(err)
+	}
+}
+
+func (r *Instrumented) UpdateGauge(ctx context.Context, name string, value float64) error {
+	ctx, done := begin(ctx, "update_gauge")
+	err := r.Repository.UpdateGauge(ctx, name, value)
+	done(err)
+	return err
+}
+
+func (r *Instrumented) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	ctx, done := begin(ctx, "update_counter")
+	err := r.Repository.UpdateCounter(ctx, name, delta)
+	done(err)
+	return err
+}
+
+func (r *Instrumented) UpdateBatch(ctx context.Context, metrics []models.Metrics) ([]models.Metrics, error) {
+	ctx, done := begin(ctx, "update_batch")
+	totals, err := r.Repository.UpdateBatch(ctx, metrics)
+	done(err)
+	return totals, err
+}
+
+func (r *Instrumented) GetGauge(ctx context.Context, name string) (float64, bool, error) {
+	ctx, done := begin(ctx, "get_gauge")
+	v, ok, err := r.Repository.GetGauge(ctx, name)
+	done(err)
+	return v, ok, err
+}
+
+func (r *Instrumented) GetCounter(ctx context.Context, name string) (int64, bool, error) {
+	ctx, done := begin(ctx, "get_counter")
+	v, ok, err := r.Repository.GetCounter(ctx, name)
+	done(err)
+	return v, ok, err
+}
+
+func (r *Instrumented) Get(ctx context.Context, mType, name string) (models.Metrics, bool, error) {
+	ctx, done := begin(ctx, "get")
+	m, ok, err := r.Repository.Get(ctx, mType, name)
+	done(err)
+	return m, ok, err
+}
+
+func (r *Instrumented) GetAll(ctx context.Context) ([]models.Metrics, error) {
+	ctx, done := begin(ctx, "get_all")
+	res, err := r.Repository.GetAll(ctx)
+	done(err)
+	return res, err
+}
+
+func (r *Instrumented) List(ctx context.Context, q ListQuery) (ListPage, error) {
+	ctx, done := begin(ctx, "list")
+	page, err := r.Repository.List(ctx, q)
+	done(err)
+	return page, err
+}
+
+func (r *Instrumented) Delete(ctx context.Context, mType, name string) (bool, error) {
+	ctx, done := begin(ctx, "delete")
+	ok, err := r.Repository.Delete(ctx, mType, name)
+	done(err)
+	return ok, err
+}
+
+func (r *Instrumented) Expire(ctx context.Context, mType, name string, before time.Time, remove bool) (bool, error) {
+	ctx, done := begin(ctx, "expire")
+	ok, err := r.Repository.Expire(ctx, mType, name, before, remove)
+	done(err)
+	return ok, err
+}
+
+func (r *Instrumented) Ping(ctx context.Context) error {
+	ctx, done := begin(ctx, "ping")
+	err := r.Repository.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (r *Instrumented) Tenants(ctx context.Context) ([]string, error) {
+	ctx, done := begin(ctx, "tenants")
+	ids, err := r.Repository.Tenants(ctx)
+	done(err)
+	return ids, err
+}
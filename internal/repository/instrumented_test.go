@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tracing"
+)
+
+func TestInstrument_CountsCalls(t *testing.T) {
+	ctx := context.Background()
+	repo := Instrument(NewMemRepository())
+
+	okBefore := storageOps.With("update_gauge", "ok").Value()
+	errBefore := storageOps.With("list", "error").Value()
+	durBefore := storageDur.With("get").Value().Count
+
+	if err := repo.UpdateGauge(ctx, "Alloc", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := repo.Get(ctx, models.Gauge, "Alloc"); !ok {
+		t.Fatal("metric not found through the wrapper")
+	}
+	if _, err := repo.List(ctx, ListQuery{Cursor: "!!!"}); err == nil {
+		t.Fatal("expected invalid cursor error")
+	}
+
+	if n := storageOps.With("update_gauge", "ok").Value() - okBefore; n != 1 {
+		t.Errorf("update_gauge ok = %d, want 1", n)
+	}
+	if n := storageOps.With("list", "error").Value() - errBefore; n != 1 {
+		t.Errorf("list error = %d, want 1", n)
+	}
+	if n := storageDur.With("get").Value().Count - durBefore; n != 1 {
+		t.Errorf("get duration observations = %d, want 1", n)
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(s tracing.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestInstrument_RecordsSpans(t *testing.T) {
+	rec := &spanRecorder{}
+	tracing.SetExporter(rec)
+	t.Cleanup(func() { tracing.SetExporter(nil) })
+
+	ctx, parent := tracing.Start(context.Background(), "request")
+	repo := Instrument(NewMemRepository())
+	if err := repo.UpdateCounter(ctx, "PollCount", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(rec.spans))
+	}
+	s := rec.spans[0]
+	if s.Name != "storage.update_counter" || s.Parent != parent.Context().SpanID || s.Context.TraceID != parent.Context().TraceID {
+		t.Errorf("span = %+v, parent %+v", s, parent.Context())
+	}
+}
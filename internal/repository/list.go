@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+// Ограничения размера страницы для List.
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// ErrInvalidCursor возвращается, если курсор пагинации повреждён.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListQuery задаёт фильтры и пагинацию для Repository.List.
+// Пустые поля не ограничивают выборку. Результат упорядочен по имени,
+// затем по типу (побайтовое сравнение), что делает курсор стабильным.
+type ListQuery struct {
+	Type   string            // gauge или counter
+	Prefix string            // префикс имени
+	Regex  *regexp.Regexp    // регулярное выражение для имени
+	Labels map[string]string // все перечисленные метки должны совпадать
+	Cursor string            // курсор из ListPage.Next предыдущей страницы
+	Limit  int               // размер страницы; 0 — DefaultListLimit
+}
+
+// ListPage — страница результатов List. Next пуст на последней странице.
+type ListPage struct {
+	Metrics []models.Metrics
+	Next    string
+}
+
+type cursorKey struct {
+	ID   string `json:"i"`
+	Type string `json:"t"`
+}
+
+func encodeCursor(m models.Metrics) string {
+	data, _ := json.Marshal(cursorKey{ID: m.ID, Type: m.MType})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursorKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var k cursorKey
+	if err := json.Unmarshal(data, &k); err != nil || k.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &k, nil
+}
+
+func (q ListQuery) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultListLimit
+	case q.Limit > MaxListLimit:
+		return MaxListLimit
+	}
+	return q.Limit
+}
+
+// less задаёт порядок выдачи List: по имени, затем по типу.
+func less(aID, aType, bID, bType string) bool {
+	if aID != bID {
+		return aID < bID
+	}
+	return aType < bType
+}
+
+// listFilter отбирает метрики по ListQuery и позиции курсора.
+type listFilter struct {
+	q     ListQuery
+	after *cursorKey
+}
+
+func newListFilter(q ListQuery) (*listFilter, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &listFilter{q: q, after: after}, nil
+}
+
+func (f *listFilter) accept(id, mType string, labels map[string]string) bool {
+	q := f.q
+	if q.Type != "" && mType != q.Type {
+		return false
+	}
+	if q.Prefix != "" && !strings.HasPrefix(id, q.Prefix) {
+		return false
+	}
+	if f.after != nil && !less(f.after.ID, f.after.Type, id, mType) {
+		return false
+	}
+	if q.Regex != nil && !q.Regex.MatchString(id) {
+		return false
+	}
+	for k, v := range q.Labels {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// listSlice применяет ListQuery к срезу метрик.
+func listSlice(metrics []models.Metrics, q ListQuery) (ListPage, error) {
+	f, err := newListFilter(q)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	res := make([]models.Metrics, 0)
+	for _, m := range metrics {
+		if f.accept(m.ID, m.MType, m.Labels) {
+			res = append(res, m)
+		}
+	}
+
+	return sortAndPaginate(res, q.limit()), nil
+}
+
+// sortAndPaginate упорядочивает отобранные метрики, обрезает их до limit
+// элементов и формирует курсор следующей страницы.
+func sortAndPaginate(res []models.Metrics, limit int) ListPage {
+	sort.Slice(res, func(i, j int) bool {
+		return less(res[i].ID, res[i].MType, res[j].ID, res[j].MType)
+	})
+	return paginate(res, limit)
+}
+
+// paginate обрезает отсортированный результат до limit элементов
+// и формирует курсор следующей страницы.
+func paginate(res []models.Metrics, limit int) ListPage {
+	if len(res) <= limit {
+		return ListPage{Metrics: res}
+	}
+	res = res[:limit]
+	return ListPage{Metrics: res, Next: encodeCursor(res[limit-1])}
+}
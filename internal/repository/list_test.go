@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+func seedList(t *testing.T, repo Repository) {
+	t.Helper()
+
+	_, err := repo.UpdateBatch(context.Background(), []models.Metrics{
+		{ID: "cpu.user", MType: models.Gauge, Value: ptrFloat(1), Labels: map[string]string{"host": "a"}},
+		{ID: "cpu.system", MType: models.Gauge, Value: ptrFloat(2), Labels: map[string]string{"host": "b"}},
+		{ID: "cpu.ticks", MType: models.Counter, Delta: ptrInt(3)},
+		{ID: "mem.free", MType: models.Gauge, Value: ptrFloat(4), Labels: map[string]string{"host": "a"}},
+		{ID: "PollCount", MType: models.Counter, Delta: ptrInt(5)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ids(page ListPage) []string {
+	res := make([]string, len(page.Metrics))
+	for i, m := range page.Metrics {
+		res[i] = m.MType + ":" + m.ID
+	}
+	return res
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testList(t *testing.T, repo Repository) {
+	seedList(t, repo)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		q    ListQuery
+		want []string
+	}{
+		{"all sorted", ListQuery{}, []string{"counter:PollCount", "gauge:cpu.system", "counter:cpu.ticks", "gauge:cpu.user", "gauge:mem.free"}},
+		{"type", ListQuery{Type: models.Counter}, []string{"counter:PollCount", "counter:cpu.ticks"}},
+		{"prefix", ListQuery{Prefix: "cpu."}, []string{"gauge:cpu.system", "counter:cpu.ticks", "gauge:cpu.user"}},
+		{"regex", ListQuery{Regex: regexp.MustCompile(`^(mem|Poll)`)}, []string{"counter:PollCount", "gauge:mem.free"}},
+		{"labels", ListQuery{Labels: map[string]string{"host": "a"}}, []string{"gauge:cpu.user", "gauge:mem.free"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := repo.List(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(page); !equalIDs(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if page.Next != "" {
+				t.Fatalf("unexpected next cursor %q", page.Next)
+			}
+		})
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var got []string
+		q := ListQuery{Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatal("too many pages")
+			}
+			page, err := repo.List(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, ids(page)...)
+			if page.Next == "" {
+				break
+			}
+			q.Cursor = page.Next
+		}
+		want := []string{"counter:PollCount", "gauge:cpu.system", "counter:cpu.ticks", "gauge:cpu.user", "gauge:mem.free"}
+		if !equalIDs(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		if _, err := repo.List(ctx, ListQuery{Cursor: "!!!"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+func TestMemRepository_List(t *testing.T) {
+	testList(t, NewMemRepository())
+}
+
+func TestFileRepository_List(t *testing.T) {
+	testList(t, NewFileRepository(tempFilePath(t)))
+}
+
+func TestPostgresList(t *testing.T) {
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	testList(t, NewPostgresRepository(conn))
+}
@@ -2,25 +2,106 @@ package repository
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
 )
 
 // MemRepository — потокобезопасное in-memory хранилище метрик.
 // Используется как хранилище по умолчанию, когда не задана база данных.
+// Метрики каждого арендатора хранятся в отдельном пространстве.
 type MemRepository struct {
-	mu       sync.RWMutex
+	mu      sync.RWMutex
+	tenants map[string]*memSpace
+	now     func() time.Time
+}
+
+// memSpace — метрики одного арендатора.
+type memSpace struct {
 	gauges   map[string]float64
 	counters map[string]int64
+	labels   map[seriesKey]map[string]string
+	updated  map[seriesKey]time.Time
+	stale    map[seriesKey]bool
+}
+
+// seriesKey идентифицирует серию: тип и имя метрики.
+type seriesKey struct {
+	mType string
+	name  string
 }
 
 // NewMemRepository создаёт новое пустое in-memory хранилище.
 func NewMemRepository() *MemRepository {
 	return &MemRepository{
+		tenants: make(map[string]*memSpace),
+		now:     time.Now,
+	}
+}
+
+// space возвращает пространство арендатора из ctx. Для чтения
+// несуществующего арендатора возвращается пустое пространство, которое
+// не сохраняется; при записи (create) оно создаётся.
+func (m *MemRepository) space(ctx context.Context, create bool) *memSpace {
+	id := tenant.FromContext(ctx)
+	sp, ok := m.tenants[id]
+	if ok {
+		return sp
+	}
+	sp = &memSpace{
 		gauges:   make(map[string]float64),
 		counters: make(map[string]int64),
+		labels:   make(map[seriesKey]map[string]string),
+		updated:  make(map[seriesKey]time.Time),
+		stale:    make(map[seriesKey]bool),
+	}
+	if create {
+		m.tenants[id] = sp
+	}
+	return sp
+}
+
+func (m *memSpace) setLabels(mType, name string, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	cp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	m.labels[seriesKey{mType, name}] = cp
+}
+
+// touch запоминает время обновления серии и её признак устаревания.
+func (m *memSpace) touch(mType, name string, at time.Time, stale bool) {
+	k := seriesKey{mType, name}
+	m.updated[k] = at
+	if stale {
+		m.stale[k] = true
+	} else {
+		delete(m.stale, k)
+	}
+}
+
+// forget удаляет сведения об удалённой серии.
+func (m *memSpace) forget(mType, name string) {
+	k := seriesKey{mType, name}
+	delete(m.labels, k)
+	delete(m.updated, k)
+	delete(m.stale, k)
+}
+
+// metric собирает метрику со всеми сведениями о серии.
+func (m *memSpace) metric(mType, name string) models.Metrics {
+	k := seriesKey{mType, name}
+	res := models.Metrics{ID: name, MType: mType, Labels: m.labels[k], Stale: m.stale[k]}
+	if at, ok := m.updated[k]; ok {
+		res.UpdatedAt = &at
 	}
+	return res
 }
 
 // UpdateGauge устанавливает значение gauge-метрики.
@@ -32,7 +113,9 @@ func (m *MemRepository) UpdateGauge(
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.gauges[name] = value
+	sp := m.space(ctx, true)
+	sp.gauges[name] = value
+	sp.touch(models.Gauge, name, m.now(), false)
 	return nil
 }
 
@@ -45,7 +128,9 @@ func (m *MemRepository) UpdateCounter(
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.counters[name] += delta
+	sp := m.space(ctx, true)
+	sp.counters[name] += delta
+	sp.touch(models.Counter, name, m.now(), false)
 	return nil
 }
 
@@ -57,7 +142,7 @@ func (m *MemRepository) GetGauge(
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	val, ok := m.gauges[name]
+	val, ok := m.space(ctx, false).gauges[name]
 	return val, ok, nil
 }
 
@@ -69,10 +154,39 @@ func (m *MemRepository) GetCounter(
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	val, ok := m.counters[name]
+	val, ok := m.space(ctx, false).counters[name]
 	return val, ok, nil
 }
 
+// Get возвращает метрику указанного типа. Второе значение false, если метрика не найдена.
+func (m *MemRepository) Get(
+	ctx context.Context,
+	mType, name string,
+) (models.Metrics, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sp := m.space(ctx, false)
+	res := sp.metric(mType, name)
+	switch mType {
+	case models.Gauge:
+		v, ok := sp.gauges[name]
+		if !ok {
+			return models.Metrics{}, false, nil
+		}
+		res.Value = &v
+	case models.Counter:
+		v, ok := sp.counters[name]
+		if !ok {
+			return models.Metrics{}, false, nil
+		}
+		res.Delta = &v
+	default:
+		return models.Metrics{}, false, nil
+	}
+	return res, true, nil
+}
+
 // GetAll возвращает срез всех хранимых метрик.
 func (m *MemRepository) GetAll(
 	ctx context.Context,
@@ -80,47 +194,196 @@ func (m *MemRepository) GetAll(
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	res := make([]models.Metrics, 0, len(m.gauges)+len(m.counters))
+	sp := m.space(ctx, false)
+	res := make([]models.Metrics, 0, len(sp.gauges)+len(sp.counters))
 
-	for k, v := range m.gauges {
+	for k, v := range sp.gauges {
 		val := v
-		res = append(res, models.Metrics{
-			ID:    k,
-			MType: models.Gauge,
-			Value: &val,
-		})
+		mt := sp.metric(models.Gauge, k)
+		mt.Value = &val
+		res = append(res, mt)
 	}
 
-	for k, v := range m.counters {
+	for k, v := range sp.counters {
 		val := v
-		res = append(res, models.Metrics{
-			ID:    k,
-			MType: models.Counter,
-			Delta: &val,
-		})
+		mt := sp.metric(models.Counter, k)
+		mt.Delta = &val
+		res = append(res, mt)
 	}
 
 	return res, nil
 }
 
+// List возвращает страницу метрик, отобранных по q. Фильтрация выполняется
+// при обходе хранилища, в результат копируются только подходящие метрики.
+func (m *MemRepository) List(
+	ctx context.Context,
+	q ListQuery,
+) (ListPage, error) {
+	f, err := newListFilter(q)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sp := m.space(ctx, false)
+	res := make([]models.Metrics, 0)
+
+	if q.Type == "" || q.Type == models.Gauge {
+		for k, v := range sp.gauges {
+			labels := sp.labels[seriesKey{models.Gauge, k}]
+			if !f.accept(k, models.Gauge, labels) {
+				continue
+			}
+			val := v
+			mt := sp.metric(models.Gauge, k)
+			mt.Value = &val
+			res = append(res, mt)
+		}
+	}
+
+	if q.Type == "" || q.Type == models.Counter {
+		for k, v := range sp.counters {
+			labels := sp.labels[seriesKey{models.Counter, k}]
+			if !f.accept(k, models.Counter, labels) {
+				continue
+			}
+			val := v
+			mt := sp.metric(models.Counter, k)
+			mt.Delta = &val
+			res = append(res, mt)
+		}
+	}
+
+	return sortAndPaginate(res, q.limit()), nil
+}
+
 // UpdateBatch атомарно обновляет несколько метрик за один вызов.
+// Элементы без значения для своего типа пропускаются; проверку входных
+// данных выполняет вызывающая сторона (см. пакет validation). Итоговые
+// значения серий собираются под той же блокировкой, что и запись.
 func (m *MemRepository) UpdateBatch(
 	ctx context.Context,
 	metrics []models.Metrics,
-) error {
+) ([]models.Metrics, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	sp := m.space(ctx, true)
+	now, keep := m.now(), restoring(ctx)
 	for _, mt := range metrics {
-		switch mt.MType {
-		case models.Gauge:
-			m.gauges[mt.ID] = *mt.Value
+		switch {
+		case mt.MType == models.Gauge && mt.Value != nil:
+			sp.gauges[mt.ID] = *mt.Value
+
+		case mt.MType == models.Counter && mt.Delta != nil:
+			sp.counters[mt.ID] += *mt.Delta
+
+		default:
+			continue
+		}
+		sp.setLabels(mt.MType, mt.ID, mt.Labels)
+		if keep && mt.UpdatedAt != nil {
+			sp.touch(mt.MType, mt.ID, *mt.UpdatedAt, mt.Stale)
+		} else {
+			sp.touch(mt.MType, mt.ID, now, false)
+		}
+	}
+
+	totals := batchSeries(metrics)
+	for i := range totals {
+		if totals[i].MType == models.Gauge {
+			v := sp.gauges[totals[i].ID]
+			totals[i].Value = &v
+		} else {
+			v := sp.counters[totals[i].ID]
+			totals[i].Delta = &v
+		}
+	}
+	return totals, nil
+}
+
+// Delete удаляет метрику указанного типа.
+func (m *MemRepository) Delete(
+	ctx context.Context,
+	mType, name string,
+) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sp := m.space(ctx, false)
+	var ok bool
+	switch mType {
+	case models.Gauge:
+		if _, ok = sp.gauges[name]; ok {
+			delete(sp.gauges, name)
+		}
+	case models.Counter:
+		if _, ok = sp.counters[name]; ok {
+			delete(sp.counters, name)
+		}
+	}
+	if ok {
+		sp.forget(mType, name)
+	}
+
+	return ok, nil
+}
 
-		case models.Counter:
-			m.counters[mt.ID] += *mt.Delta
+// Expire помечает устаревшей или удаляет серию, не обновлявшуюся с момента before.
+func (m *MemRepository) Expire(
+	ctx context.Context,
+	mType, name string,
+	before time.Time,
+	remove bool,
+) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sp := m.space(ctx, false)
+	k := seriesKey{mType, name}
+	at, ok := sp.updated[k]
+	if !ok || !at.Before(before) {
+		return false, nil
+	}
+
+	if !remove {
+		if sp.stale[k] {
+			return false, nil
 		}
+		sp.stale[k] = true
+		return true, nil
 	}
 
+	switch mType {
+	case models.Gauge:
+		delete(sp.gauges, name)
+	case models.Counter:
+		delete(sp.counters, name)
+	}
+	sp.forget(mType, name)
+	return true, nil
+}
+
+// Tenants возвращает отсортированный список арендаторов, у которых есть метрики.
+func (m *MemRepository) Tenants(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make([]string, 0, len(m.tenants))
+	for id, sp := range m.tenants {
+		if len(sp.gauges)+len(sp.counters) > 0 {
+			res = append(res, id)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Ping всегда успешен: in-memory хранилище доступно, пока жив процесс.
+func (m *MemRepository) Ping(ctx context.Context) error {
 	return nil
 }
 
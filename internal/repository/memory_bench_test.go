@@ -86,6 +86,6 @@ func BenchmarkMemRepository_UpdateBatch(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = repo.UpdateBatch(ctx, metrics)
+		_, _ = repo.UpdateBatch(ctx, metrics)
 	}
 }
@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"sync"
 	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
 )
 
 func TestMemStorage_Gauge(t *testing.T) {
@@ -35,3 +38,96 @@ func TestMemStorage_Counter(t *testing.T) {
 		t.Fatalf("expected 8, got %v", val)
 	}
 }
+
+func TestMemStorage_UpdateBatch_MissingValues(t *testing.T) {
+	s := NewMemRepository()
+
+	_, err := s.UpdateBatch(context.Background(), []models.Metrics{
+		{ID: "x", MType: models.Gauge},
+		{ID: "y", MType: models.Counter},
+	})
+	if err != nil {
+		t.Fatalf("UpdateBatch: %v", err)
+	}
+
+	if _, ok, _ := s.GetGauge(context.Background(), "x"); ok {
+		t.Fatal("gauge without value must be skipped")
+	}
+}
+
+func TestMemStorage_UpdateBatch_ReturnsTotals(t *testing.T) {
+	s := NewMemRepository()
+	ctx := context.Background()
+
+	_ = s.UpdateCounter(ctx, "c", 5)
+
+	d1, d2, g1, g2 := int64(1), int64(2), 1.0, 3.0
+	totals, err := s.UpdateBatch(ctx, []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: &d1},
+		{ID: "g", MType: models.Gauge, Value: &g1},
+		{ID: "c", MType: models.Counter, Delta: &d2},
+		{ID: "g", MType: models.Gauge, Value: &g2},
+		{ID: "x", MType: models.Gauge},
+	})
+	if err != nil {
+		t.Fatalf("UpdateBatch: %v", err)
+	}
+
+	if len(totals) != 2 {
+		t.Fatalf("expected 2 series, got %+v", totals)
+	}
+	if totals[0].ID != "c" || totals[0].Delta == nil || *totals[0].Delta != 8 {
+		t.Fatalf("expected counter total 8, got %+v", totals[0])
+	}
+	if totals[1].ID != "g" || totals[1].Value == nil || *totals[1].Value != 3 {
+		t.Fatalf("expected gauge 3, got %+v", totals[1])
+	}
+}
+
+func TestMemStorage_UpdateBatch_ConcurrentTotalsAreExact(t *testing.T) {
+	s := NewMemRepository()
+	ctx := context.Background()
+
+	const n = 100
+	seen := make([]bool, n+1)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			one := int64(1)
+			totals, err := s.UpdateBatch(ctx, []models.Metrics{{ID: "c", MType: models.Counter, Delta: &one}})
+			if err != nil || len(totals) != 1 {
+				t.Errorf("UpdateBatch: %v %+v", err, totals)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			v := *totals[0].Delta
+			if v < 1 || v > n || seen[v] {
+				t.Errorf("total %d is out of range or reported twice", v)
+				return
+			}
+			seen[v] = true
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMemStorage_Delete(t *testing.T) {
+	s := NewMemRepository()
+	ctx := context.Background()
+
+	_ = s.UpdateGauge(ctx, "Alloc", 1)
+
+	if ok, err := s.Delete(ctx, models.Counter, "Alloc"); ok || err != nil {
+		t.Fatalf("expected no counter to delete, got %v %v", ok, err)
+	}
+	if ok, err := s.Delete(ctx, models.Gauge, "Alloc"); !ok || err != nil {
+		t.Fatalf("expected gauge to be deleted, got %v %v", ok, err)
+	}
+	if _, ok, _ := s.GetGauge(ctx, "Alloc"); ok {
+		t.Fatal("gauge still present after delete")
+	}
+}
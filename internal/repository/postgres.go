@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v5"
@@ -11,18 +14,26 @@ import (
 
 	"github.com/zheki1/yaprmtrc/internal/models"
 	"github.com/zheki1/yaprmtrc/internal/retry"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
 )
 
 // PostgresRepository — хранилище метрик на базе PostgreSQL с поддержкой повторных попыток при сетевых ошибках.
+// Таблица metrics секционирована по столбцу tenant; каждый запрос ограничен
+// арендатором из ctx. Время обновления серий (updated_at) берётся
+// из часов сервера, а не базы, чтобы совпадать с часами Expire.
 type PostgresRepository struct {
 	pool *pgxpool.Pool
+	now  func() time.Time
 }
 
 // NewPostgresRepository создаёт новое хранилище, используя переданный пул pgxpool.
 func NewPostgresRepository(pool *pgxpool.Pool) *PostgresRepository {
-	return &PostgresRepository{pool: pool}
+	return &PostgresRepository{pool: pool, now: time.Now}
 }
 
+// metricColumns — столбцы, которые читает scanMetrics.
+const metricColumns = `id, type, delta, value, labels, updated_at, stale`
+
 func (p *PostgresRepository) UpdateGauge(
 	ctx context.Context,
 	name string,
@@ -34,11 +45,13 @@ func (p *PostgresRepository) UpdateGauge(
 		}
 
 		_, err := p.pool.Exec(ctx, `
-		INSERT INTO metrics (id, type, value)
-		VALUES ($1, 'gauge', $2)
-		ON CONFLICT (id) DO UPDATE
-		SET value = EXCLUDED.value
-	`, name, value)
+		INSERT INTO metrics (tenant, id, type, value, updated_at)
+		VALUES ($1, $2, 'gauge', $3, $4)
+		ON CONFLICT (tenant, id) DO UPDATE
+		SET value = EXCLUDED.value,
+			updated_at = EXCLUDED.updated_at,
+			stale = false
+	`, tenant.FromContext(ctx), name, value, p.now())
 
 		return err
 	})
@@ -55,11 +68,13 @@ func (p *PostgresRepository) UpdateCounter(
 		}
 
 		_, err := p.pool.Exec(ctx, `
-		INSERT INTO metrics (id, type, delta)
-		VALUES ($1, 'counter', $2)
-		ON CONFLICT (id) DO UPDATE
-		SET delta = metrics.delta + EXCLUDED.delta
-	`, name, delta)
+		INSERT INTO metrics (tenant, id, type, delta, updated_at)
+		VALUES ($1, $2, 'counter', $3, $4)
+		ON CONFLICT (tenant, id) DO UPDATE
+		SET delta = metrics.delta + EXCLUDED.delta,
+			updated_at = EXCLUDED.updated_at,
+			stale = false
+	`, tenant.FromContext(ctx), name, delta, p.now())
 		return err
 	})
 }
@@ -78,8 +93,8 @@ func (p *PostgresRepository) GetGauge(
 		}
 
 		err := p.pool.QueryRow(ctx,
-			`SELECT value FROM metrics WHERE id=$1 AND type='gauge'`,
-			name,
+			`SELECT value FROM metrics WHERE tenant=$1 AND id=$2 AND type='gauge'`,
+			tenant.FromContext(ctx), name,
 		).Scan(&v)
 
 		if err == pgx.ErrNoRows {
@@ -112,8 +127,8 @@ func (p *PostgresRepository) GetCounter(
 		}
 
 		err := p.pool.QueryRow(ctx,
-			`SELECT delta FROM metrics WHERE id=$1 AND type='counter'`,
-			name,
+			`SELECT delta FROM metrics WHERE tenant=$1 AND id=$2 AND type='counter'`,
+			tenant.FromContext(ctx), name,
 		).Scan(&v)
 
 		if err == pgx.ErrNoRows {
@@ -132,6 +147,43 @@ func (p *PostgresRepository) GetCounter(
 	return v, ok, err
 }
 
+// Get возвращает метрику указанного типа. Второе значение false, если метрика не найдена.
+func (p *PostgresRepository) Get(
+	ctx context.Context,
+	mType, name string,
+) (models.Metrics, bool, error) {
+	var (
+		m  models.Metrics
+		ok bool
+	)
+	err := retry.DoRetry(ctx, isRetryablePGErr, func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rows, err := p.pool.Query(ctx,
+			`SELECT `+metricColumns+` FROM metrics WHERE tenant=$1 AND id=$2 AND type=$3`,
+			tenant.FromContext(ctx), name, mType,
+		)
+		if err != nil {
+			return err
+		}
+
+		res, err := scanMetrics(rows)
+		if err != nil {
+			return err
+		}
+
+		ok = len(res) > 0
+		if ok {
+			m = res[0]
+		}
+		return nil
+	})
+
+	return m, ok, err
+}
+
 func (p *PostgresRepository) GetAll(
 	ctx context.Context,
 ) ([]models.Metrics, error) {
@@ -143,45 +195,144 @@ func (p *PostgresRepository) GetAll(
 		}
 
 		rows, err := p.pool.Query(ctx,
-			`SELECT id, type, delta, value FROM metrics`,
+			`SELECT `+metricColumns+` FROM metrics WHERE tenant=$1`,
+			tenant.FromContext(ctx),
 		)
 		if err != nil {
 			return err
 		}
-		defer rows.Close()
 
-		var tmp []models.Metrics
-		for rows.Next() {
-			var m models.Metrics
-
-			if err := rows.Scan(
-				&m.ID,
-				&m.MType,
-				&m.Delta,
-				&m.Value,
-			); err != nil {
-				return err
-			}
+		tmp, err := scanMetrics(rows)
+		if err != nil {
+			return err
+		}
+
+		res = tmp
+		return nil
+	})
+
+	return res, err
+}
+
+// List выполняет фильтрацию, сортировку и пагинацию на стороне PostgreSQL.
+// Порядок (id, type) в сортировке "C" совпадает с побайтовым порядком MemRepository.
+// Регулярное выражение применяется оператором ~ (синтаксис POSIX).
+func (p *PostgresRepository) List(
+	ctx context.Context,
+	q ListQuery,
+) (ListPage, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return ListPage{}, err
+	}
 
-			tmp = append(tmp, m)
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where = append(where, "tenant = "+arg(tenant.FromContext(ctx)))
+	if q.Type != "" {
+		where = append(where, "type = "+arg(q.Type))
+	}
+	if q.Prefix != "" {
+		ph := arg(q.Prefix)
+		where = append(where, "left(id, char_length("+ph+")) = "+ph)
+	}
+	if q.Regex != nil {
+		where = append(where, "id ~ "+arg(q.Regex.String()))
+	}
+	if len(q.Labels) > 0 {
+		where = append(where, "labels @> "+arg(q.Labels)+"::jsonb")
+	}
+	if after != nil {
+		where = append(where, `(id COLLATE "C", type COLLATE "C") > (`+arg(after.ID)+", "+arg(after.Type)+")")
+	}
+
+	query := `SELECT ` + metricColumns + ` FROM metrics WHERE ` + strings.Join(where, " AND ")
+	limit := q.limit()
+	query += ` ORDER BY id COLLATE "C", type COLLATE "C" LIMIT ` + arg(limit+1)
+
+	var page ListPage
+	err = retry.DoRetry(ctx, isRetryablePGErr, func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		if err := rows.Err(); err != nil {
+		rows, err := p.pool.Query(ctx, query, args...)
+		if err != nil {
 			return err
 		}
 
-		res = tmp
+		res, err := scanMetrics(rows)
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			res = make([]models.Metrics, 0)
+		}
+
+		page = paginate(res, limit)
 		return nil
 	})
 
-	return res, err
+	return page, err
 }
 
+func scanMetrics(rows pgx.Rows) ([]models.Metrics, error) {
+	defer rows.Close()
+
+	var res []models.Metrics
+	for rows.Next() {
+		var (
+			m         models.Metrics
+			updatedAt time.Time
+		)
+
+		if err := rows.Scan(
+			&m.ID,
+			&m.MType,
+			&m.Delta,
+			&m.Value,
+			&m.Labels,
+			&updatedAt,
+			&m.Stale,
+		); err != nil {
+			return nil, err
+		}
+		m.UpdatedAt = &updatedAt
+		if len(m.Labels) == 0 {
+			m.Labels = nil
+		}
+
+		res = append(res, m)
+	}
+
+	return res, rows.Err()
+}
+
+// UpdateBatch обновляет пакет метрик в одной транзакции.
+// Дубликаты внутри пакета предварительно агрегируются (см. aggregateBatch),
+// после чего gauge- и counter-метрики записываются двумя upsert-запросами
+// через unnest вместо отдельного запроса на каждую метрику. Итоговые значения
+// counter возвращает сам upsert (RETURNING), а не отдельное чтение.
 func (p *PostgresRepository) UpdateBatch(
 	ctx context.Context,
 	metrics []models.Metrics,
-) error {
-	return retry.DoRetry(ctx, isRetryablePGErr, func() error {
+) ([]models.Metrics, error) {
+	batch := aggregateBatch(metrics)
+	if batch.empty() {
+		return nil, nil
+	}
+	id := tenant.FromContext(ctx)
+	now := p.now()
+	counters := make(map[string]int64, len(batch.counterIDs))
+
+	err := retry.DoRetry(ctx, isRetryablePGErr, func() error {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
@@ -191,33 +342,234 @@ func (p *PostgresRepository) UpdateBatch(
 		}
 		defer tx.Rollback(ctx)
 
-		for _, m := range metrics {
-			switch m.MType {
-
-			case models.Gauge:
-				_, err = tx.Exec(ctx, `
-				INSERT INTO metrics (id, type, value)
-				VALUES ($1, 'gauge', $2)
-				ON CONFLICT (id) DO UPDATE
-				SET value = EXCLUDED.value
-			`, m.ID, *m.Value)
-
-			case models.Counter:
-				_, err = tx.Exec(ctx, `
-				INSERT INTO metrics (id, type, delta)
-				VALUES ($1, 'counter', $2)
-				ON CONFLICT (id) DO UPDATE
-				SET delta = metrics.delta + EXCLUDED.delta
-			`, m.ID, *m.Delta)
+		if len(batch.gaugeIDs) > 0 {
+			_, err = tx.Exec(ctx, `
+			INSERT INTO metrics (tenant, id, type, value, labels, updated_at)
+			SELECT $1, id, 'gauge', value, labels::jsonb, $5
+			FROM unnest($2::text[], $3::double precision[], $4::text[]) AS t(id, value, labels)
+			ON CONFLICT (tenant, id) DO UPDATE
+			SET value = EXCLUDED.value,
+				labels = CASE WHEN EXCLUDED.labels = '{}'::jsonb THEN metrics.labels ELSE EXCLUDED.labels END,
+				updated_at = EXCLUDED.updated_at,
+				stale = false
+		`, id, batch.gaugeIDs, batch.gaugeValues, batch.gaugeLabels, now)
+			if err != nil {
+				return err
 			}
+		}
 
+		if len(batch.counterIDs) > 0 {
+			rows, err := tx.Query(ctx, `
+			INSERT INTO metrics (tenant, id, type, delta, labels, updated_at)
+			SELECT $1, id, 'counter', delta, labels::jsonb, $5
+			FROM unnest($2::text[], $3::bigint[], $4::text[]) AS t(id, delta, labels)
+			ON CONFLICT (tenant, id) DO UPDATE
+			SET delta = metrics.delta + EXCLUDED.delta,
+				labels = CASE WHEN EXCLUDED.labels = '{}'::jsonb THEN metrics.labels ELSE EXCLUDED.labels END,
+				updated_at = EXCLUDED.updated_at,
+				stale = false
+			RETURNING id, delta
+		`, id, batch.counterIDs, batch.counterDeltas, batch.counterLabels, now)
 			if err != nil {
 				return err
 			}
+			for rows.Next() {
+				var name string
+				var total int64
+				if err := rows.Scan(&name, &total); err != nil {
+					rows.Close()
+					return err
+				}
+				counters[name] = total
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
 		}
 
 		return tx.Commit(ctx)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	gauges := make(map[string]float64, len(batch.gaugeIDs))
+	for i, name := range batch.gaugeIDs {
+		gauges[name] = batch.gaugeValues[i]
+	}
+	totals := batchSeries(metrics)
+	for i := range totals {
+		if totals[i].MType == models.Gauge {
+			v := gauges[totals[i].ID]
+			totals[i].Value = &v
+		} else {
+			v := counters[totals[i].ID]
+			totals[i].Delta = &v
+		}
+	}
+	return totals, nil
+}
+
+// aggregatedBatch — пакет метрик без дубликатов, разложенный по столбцам для unnest.
+type aggregatedBatch struct {
+	gaugeIDs      []string
+	gaugeValues   []float64
+	gaugeLabels   []string
+	counterIDs    []string
+	counterDeltas []int64
+	counterLabels []string
+}
+
+func (b aggregatedBatch) empty() bool {
+	return len(b.gaugeIDs) == 0 && len(b.counterIDs) == 0
+}
+
+// aggregateBatch схлопывает повторяющиеся ID внутри пакета: для counter дельты
+// суммируются, для gauge остаётся последнее значение. Порядок метрик
+// соответствует первому вхождению ID, у меток побеждают последние непустые.
+// Элементы без значения пропускаются.
+// Это необходимо, так как один INSERT ... ON CONFLICT не может обновить
+// одну и ту же строку дважды.
+func aggregateBatch(metrics []models.Metrics) aggregatedBatch {
+	var b aggregatedBatch
+	gaugeIdx := make(map[string]int)
+	counterIdx := make(map[string]int)
+
+	for _, m := range metrics {
+		switch m.MType {
+		case models.Gauge:
+			if m.Value == nil {
+				continue
+			}
+			if i, ok := gaugeIdx[m.ID]; ok {
+				b.gaugeValues[i] = *m.Value
+				if len(m.Labels) > 0 {
+					b.gaugeLabels[i] = labelsJSON(m.Labels)
+				}
+				continue
+			}
+			gaugeIdx[m.ID] = len(b.gaugeIDs)
+			b.gaugeIDs = append(b.gaugeIDs, m.ID)
+			b.gaugeValues = append(b.gaugeValues, *m.Value)
+			b.gaugeLabels = append(b.gaugeLabels, labelsJSON(m.Labels))
+
+		case models.Counter:
+			if m.Delta == nil {
+				continue
+			}
+			if i, ok := counterIdx[m.ID]; ok {
+				b.counterDeltas[i] += *m.Delta
+				if len(m.Labels) > 0 {
+					b.counterLabels[i] = labelsJSON(m.Labels)
+				}
+				continue
+			}
+			counterIdx[m.ID] = len(b.counterIDs)
+			b.counterIDs = append(b.counterIDs, m.ID)
+			b.counterDeltas = append(b.counterDeltas, *m.Delta)
+			b.counterLabels = append(b.counterLabels, labelsJSON(m.Labels))
+		}
+	}
+
+	return b
+}
+
+func (p *PostgresRepository) Delete(
+	ctx context.Context,
+	mType, name string,
+) (bool, error) {
+	var deleted bool
+	err := retry.DoRetry(ctx, isRetryablePGErr, func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		tag, err := p.pool.Exec(ctx,
+			`DELETE FROM metrics WHERE tenant=$1 AND id=$2 AND type=$3`,
+			tenant.FromContext(ctx), name, mType,
+		)
+		if err != nil {
+			return err
+		}
+
+		deleted = tag.RowsAffected() > 0
+		return nil
+	})
+
+	return deleted, err
+}
+
+// Expire помечает устаревшей или удаляет метрику, не обновлявшуюся с момента before.
+// Условие по updated_at проверяется в том же запросе, поэтому серия,
+// обновлённая после решения сборщика, не затрагивается.
+func (p *PostgresRepository) Expire(
+	ctx context.Context,
+	mType, name string,
+	before time.Time,
+	remove bool,
+) (bool, error) {
+	query := `UPDATE metrics SET stale = true
+		WHERE tenant=$1 AND id=$2 AND type=$3 AND updated_at < $4 AND NOT stale`
+	if remove {
+		query = `DELETE FROM metrics
+		WHERE tenant=$1 AND id=$2 AND type=$3 AND updated_at < $4`
+	}
+
+	var expired bool
+	err := retry.DoRetry(ctx, isRetryablePGErr, func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		tag, err := p.pool.Exec(ctx, query, tenant.FromContext(ctx), name, mType, before)
+		if err != nil {
+			return err
+		}
+
+		expired = tag.RowsAffected() > 0
+		return nil
+	})
+
+	return expired, err
+}
+
+// Tenants возвращает отсортированный список арендаторов, у которых есть метрики.
+func (p *PostgresRepository) Tenants(ctx context.Context) ([]string, error) {
+	var res []string
+	err := retry.DoRetry(ctx, isRetryablePGErr, func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rows, err := p.pool.Query(ctx, `SELECT DISTINCT tenant FROM metrics ORDER BY tenant COLLATE "C"`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids := make([]string, 0)
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		res = ids
+		return nil
+	})
+
+	return res, err
+}
+
+// Ping проверяет соединение с базой.
+func (p *PostgresRepository) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
 }
 
 func (p *PostgresRepository) Close() error {
@@ -225,6 +577,18 @@ func (p *PostgresRepository) Close() error {
 	return nil
 }
 
+// labelsJSON кодирует метки для передачи в unnest; отсутствие меток — пустой объект.
+func labelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
 func isRetryablePGErr(err error) bool {
 	if err == nil {
 		return false
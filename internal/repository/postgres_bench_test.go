@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+// updateBatchPerRow — прежняя реализация UpdateBatch (один Exec на метрику),
+// оставлена для сравнения в бенчмарках.
+func updateBatchPerRow(ctx context.Context, pool *pgxpool.Pool, metrics []models.Metrics) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, m := range metrics {
+		switch m.MType {
+		case models.Gauge:
+			_, err = tx.Exec(ctx, `
+			INSERT INTO metrics (id, type, value)
+			VALUES ($1, 'gauge', $2)
+			ON CONFLICT (id) DO UPDATE
+			SET value = EXCLUDED.value
+		`, m.ID, *m.Value)
+
+		case models.Counter:
+			_, err = tx.Exec(ctx, `
+			INSERT INTO metrics (id, type, delta)
+			VALUES ($1, 'counter', $2)
+			ON CONFLICT (id) DO UPDATE
+			SET delta = metrics.delta + EXCLUDED.delta
+		`, m.ID, *m.Delta)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func makeBatch(n int) []models.Metrics {
+	metrics := make([]models.Metrics, 0, n)
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			metrics = append(metrics, models.Metrics{
+				ID:    fmt.Sprintf("gauge_%d", i),
+				MType: models.Gauge,
+				Value: ptrFloat(float64(i)),
+			})
+			continue
+		}
+		metrics = append(metrics, models.Metrics{
+			ID:    fmt.Sprintf("counter_%d", i),
+			MType: models.Counter,
+			Delta: ptrInt(int64(i)),
+		})
+	}
+	return metrics
+}
+
+func BenchmarkPostgresUpdateBatch(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		batch := makeBatch(n)
+
+		b.Run(fmt.Sprintf("impl=unnest/size=%d", n), func(b *testing.B) {
+			pool := openTestDB(b)
+			defer pool.Close()
+			repo := NewPostgresRepository(pool)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.UpdateBatch(ctx, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("impl=per_row/size=%d", n), func(b *testing.B) {
+			pool := openTestDB(b)
+			defer pool.Close()
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := updateBatchPerRow(ctx, pool, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
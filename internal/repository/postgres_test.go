@@ -10,7 +10,7 @@ import (
 	"github.com/zheki1/yaprmtrc/internal/models"
 )
 
-func openTestDB(t *testing.T) *pgxpool.Pool {
+func openTestDB(t testing.TB) *pgxpool.Pool {
 
 	dsn := os.Getenv("DATABASE_DSN")
 	if dsn == "" {
@@ -22,20 +22,27 @@ func openTestDB(t *testing.T) *pgxpool.Pool {
 		t.Fatalf("cannot connect db: %v", err)
 	}
 
+	// Схема соответствует migrations/003_tenant.up.sql и 005_staleness.up.sql.
 	_, err = conn.Exec(context.Background(), `
-	CREATE TABLE IF NOT EXISTS metrics (
-		id TEXT PRIMARY KEY,
+	DROP TABLE IF EXISTS metrics;
+	CREATE TABLE metrics (
+		tenant TEXT NOT NULL DEFAULT 'default',
+		id TEXT NOT NULL,
 		type TEXT NOT NULL,
 		delta BIGINT,
-		value DOUBLE PRECISION
-	)
+		value DOUBLE PRECISION,
+		labels JSONB NOT NULL DEFAULT '{}'::jsonb,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		stale BOOLEAN NOT NULL DEFAULT false,
+		PRIMARY KEY (tenant, id)
+	) PARTITION BY HASH (tenant);
+	CREATE TABLE metrics_p0 PARTITION OF metrics FOR VALUES WITH (MODULUS 2, REMAINDER 0);
+	CREATE TABLE metrics_p1 PARTITION OF metrics FOR VALUES WITH (MODULUS 2, REMAINDER 1)
 	`)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, _ = conn.Exec(context.Background(), `DELETE FROM metrics`)
-
 	return conn
 }
 
@@ -144,7 +151,7 @@ func TestPostgresBatch(t *testing.T) {
 		},
 	}
 
-	err := repo.UpdateBatch(ctx, data)
+	_, err := repo.UpdateBatch(ctx, data)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -164,6 +171,105 @@ func TestPostgresBatch(t *testing.T) {
 	}
 }
 
+func TestPostgresBatch_Duplicates(t *testing.T) {
+
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	repo := NewPostgresRepository(conn)
+
+	ctx := context.Background()
+
+	data := []models.Metrics{
+		{ID: "A", MType: models.Gauge, Value: ptrFloat(1.1)},
+		{ID: "B", MType: models.Counter, Delta: ptrInt(3)},
+		{ID: "A", MType: models.Gauge, Value: ptrFloat(2.2)},
+		{ID: "B", MType: models.Counter, Delta: ptrInt(4)},
+	}
+
+	if _, err := repo.UpdateBatch(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+
+	v, _, _ := repo.GetGauge(ctx, "A")
+	c, _, _ := repo.GetCounter(ctx, "B")
+
+	if v != 2.2 || c != 7 {
+		t.Fatalf("expected 2.2 and 7, got %v and %v", v, c)
+	}
+}
+
+func TestPostgresBatch_ReturnsTotals(t *testing.T) {
+
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	repo := NewPostgresRepository(conn)
+
+	ctx := context.Background()
+
+	_ = repo.UpdateCounter(ctx, "B", 10)
+
+	totals, err := repo.UpdateBatch(ctx, []models.Metrics{
+		{ID: "B", MType: models.Counter, Delta: ptrInt(3)},
+		{ID: "A", MType: models.Gauge, Value: ptrFloat(1.1)},
+		{ID: "B", MType: models.Counter, Delta: ptrInt(4)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(totals) != 2 || totals[0].ID != "B" || *totals[0].Delta != 17 ||
+		totals[1].ID != "A" || *totals[1].Value != 1.1 {
+		t.Fatalf("unexpected totals: %+v", totals)
+	}
+}
+
+func TestPostgresDelete(t *testing.T) {
+
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	repo := NewPostgresRepository(conn)
+
+	ctx := context.Background()
+
+	_ = repo.UpdateGauge(ctx, "A", 1.1)
+
+	ok, err := repo.Delete(ctx, models.Gauge, "A")
+	if err != nil || !ok {
+		t.Fatalf("expected delete, got %v %v", ok, err)
+	}
+
+	ok, err = repo.Delete(ctx, models.Gauge, "A")
+	if err != nil || ok {
+		t.Fatalf("expected nothing to delete, got %v %v", ok, err)
+	}
+}
+
+func TestAggregateBatch(t *testing.T) {
+	data := []models.Metrics{
+		{ID: "A", MType: models.Gauge, Value: ptrFloat(1)},
+		{ID: "C", MType: models.Counter, Delta: ptrInt(2)},
+		{ID: "B", MType: models.Gauge, Value: ptrFloat(5)},
+		{ID: "A", MType: models.Gauge, Value: ptrFloat(3)},
+		{ID: "C", MType: models.Counter, Delta: ptrInt(5)},
+		{ID: "D", MType: models.Counter},
+	}
+
+	b := aggregateBatch(data)
+
+	if len(b.gaugeIDs) != 2 || b.gaugeIDs[0] != "A" || b.gaugeIDs[1] != "B" {
+		t.Fatalf("unexpected gauge ids %v", b.gaugeIDs)
+	}
+	if b.gaugeValues[0] != 3 || b.gaugeValues[1] != 5 {
+		t.Fatalf("unexpected gauge values %v", b.gaugeValues)
+	}
+	if len(b.counterIDs) != 1 || b.counterIDs[0] != "C" || b.counterDeltas[0] != 7 {
+		t.Fatalf("unexpected counters %v %v", b.counterIDs, b.counterDeltas)
+	}
+}
+
 func ptrFloat(v float64) *float64 {
 	return &v
 }
@@ -3,22 +3,73 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/zheki1/yaprmtrc/internal/models"
 )
 
 // Repository — интерфейс хранилища метрик.
 // Поддерживает обновление и чтение gauge/counter-метрик,
-// пакетное обновление и получение всех метрик.
+// пакетное обновление, получение всех метрик и удаление.
+// Все методы работают в пространстве арендатора из ctx (см. пакет tenant).
+// Каждое обновление серии запоминает время записи и снимает признак
+// устаревания; методы чтения возвращают их в полях UpdatedAt и Stale.
 type Repository interface {
 	UpdateGauge(ctx context.Context, name string, value float64) error
 	UpdateCounter(ctx context.Context, name string, delta int64) error
-	UpdateBatch(ctx context.Context, metrics []models.Metrics) error
+
+	// UpdateBatch обновляет пакет метрик и возвращает значения затронутых
+	// серий сразу после обновления: по одной метрике на серию в порядке первого
+	// появления в пакете, Value для gauge и итоговый Delta для counter.
+	UpdateBatch(ctx context.Context, metrics []models.Metrics) ([]models.Metrics, error)
 
 	GetGauge(ctx context.Context, name string) (float64, bool, error)
 	GetCounter(ctx context.Context, name string) (int64, bool, error)
 
+	// Get возвращает метрику вместе с метками, временем обновления и
+	// признаком устаревания. Второе значение false, если метрики нет.
+	Get(ctx context.Context, mType, name string) (models.Metrics, bool, error)
+
 	GetAll(ctx context.Context) ([]models.Metrics, error)
 
+	// List возвращает отфильтрованную и упорядоченную страницу метрик.
+	List(ctx context.Context, q ListQuery) (ListPage, error)
+
+	// Delete удаляет метрику указанного типа. Второе значение false, если метрики не было.
+	Delete(ctx context.Context, mType, name string) (bool, error)
+
+	// Expire помечает устаревшей (или при remove удаляет) серию, которая не
+	// обновлялась с момента before. Второе значение false, если серии нет,
+	// она обновилась позже before или уже помечена.
+	Expire(ctx context.Context, mType, name string, before time.Time, remove bool) (bool, error)
+
+	// Tenants возвращает арендаторов, у которых есть метрики, по возрастанию.
+	Tenants(ctx context.Context) ([]string, error)
+
+	// Ping проверяет, что хранилище доступно.
+	Ping(ctx context.Context) error
+
 	Close() error
 }
+
+// batchSeries возвращает серии пакета без дубликатов в порядке первого
+// появления, пропуская элементы без значения. Значения в результате не
+// заполнены — их проставляет хранилище после обновления.
+func batchSeries(metrics []models.Metrics) []models.Metrics {
+	type key struct{ mType, id string }
+	seen := make(map[key]struct{}, len(metrics))
+	res := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if (m.MType != models.Gauge || m.Value == nil) &&
+			(m.MType != models.Counter || m.Delta == nil) {
+			continue
+		}
+		k := key{m.MType, m.ID}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		res = append(res, models.Metrics{ID: m.ID, MType: m.MType})
+	}
+	return res
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+// testExpire проверяет время обновления, пометку и удаление устаревших серий.
+func testExpire(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := context.Background()
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	if err := repo.UpdateGauge(ctx, "FreeMemory", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateCounter(ctx, "PollCount", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	m, ok, err := repo.Get(ctx, models.Gauge, "FreeMemory")
+	if err != nil || !ok {
+		t.Fatalf("Get FreeMemory: %v %v", ok, err)
+	}
+	if m.UpdatedAt == nil || m.Stale || m.Value == nil || *m.Value != 1 {
+		t.Fatalf("fresh FreeMemory = %+v", m)
+	}
+
+	if ok, err := repo.Expire(ctx, models.Gauge, "FreeMemory", past, false); err != nil || ok {
+		t.Fatalf("Expire of a fresh series = %v, %v; want false", ok, err)
+	}
+	if ok, err := repo.Expire(ctx, models.Gauge, "FreeMemory", future, false); err != nil || !ok {
+		t.Fatalf("Expire = %v, %v; want true", ok, err)
+	}
+	if ok, _ := repo.Expire(ctx, models.Gauge, "FreeMemory", future, false); ok {
+		t.Fatal("repeated Expire must report false")
+	}
+
+	if m, _, _ := repo.Get(ctx, models.Gauge, "FreeMemory"); !m.Stale {
+		t.Fatal("FreeMemory must be stale")
+	}
+	page, err := repo.List(ctx, ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range page.Metrics {
+		if m.UpdatedAt == nil {
+			t.Errorf("List %s: no updated_at", m.ID)
+		}
+		if want := m.ID == "FreeMemory"; m.Stale != want {
+			t.Errorf("List %s: stale = %v, want %v", m.ID, m.Stale, want)
+		}
+	}
+
+	if err := repo.UpdateGauge(ctx, "FreeMemory", 2); err != nil {
+		t.Fatal(err)
+	}
+	if m, _, _ := repo.Get(ctx, models.Gauge, "FreeMemory"); m.Stale {
+		t.Fatal("update must clear the stale flag")
+	}
+
+	if ok, err := repo.Expire(ctx, models.Counter, "PollCount", future, true); err != nil || !ok {
+		t.Fatalf("Expire remove = %v, %v; want true", ok, err)
+	}
+	if _, ok, _ := repo.Get(ctx, models.Counter, "PollCount"); ok {
+		t.Fatal("PollCount must be deleted")
+	}
+	if ok, _ := repo.Expire(ctx, models.Counter, "PollCount", future, true); ok {
+		t.Fatal("Expire of a missing series must report false")
+	}
+}
+
+func TestMemRepository_Expire(t *testing.T) {
+	testExpire(t, NewMemRepository())
+}
+
+func TestFileRepository_Expire(t *testing.T) {
+	testExpire(t, NewFileRepository(tempFilePath(t)))
+}
+
+func TestPostgresExpire(t *testing.T) {
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	testExpire(t, NewPostgresRepository(conn))
+}
+
+// testRestoreTimestamps проверяет, что Restore сохраняет время обновления
+// и признак устаревания, а обычная запись их игнорирует.
+func testRestoreTimestamps(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := context.Background()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := 1.5
+
+	err := Restore(ctx, repo, []TenantMetrics{{Metrics: models.Metrics{
+		ID: "FreeMemory", MType: models.Gauge, Value: &v, UpdatedAt: &at, Stale: true,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, _ := repo.Get(ctx, models.Gauge, "FreeMemory")
+	if m.UpdatedAt == nil || !m.UpdatedAt.Equal(at) || !m.Stale {
+		t.Fatalf("restored = %+v, want updated_at %v and stale", m, at)
+	}
+
+	_, err = repo.UpdateBatch(ctx, []models.Metrics{{
+		ID: "FreeMemory", MType: models.Gauge, Value: &v, UpdatedAt: &at, Stale: true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, _ = repo.Get(ctx, models.Gauge, "FreeMemory")
+	if m.UpdatedAt == nil || m.UpdatedAt.Equal(at) || m.Stale {
+		t.Fatalf("after write = %+v, want current updated_at and not stale", m)
+	}
+}
+
+func TestMemRepository_RestoreTimestamps(t *testing.T) {
+	testRestoreTimestamps(t, NewMemRepository())
+}
+
+func TestFileRepository_RestoreTimestamps(t *testing.T) {
+	testRestoreTimestamps(t, NewFileRepository(tempFilePath(t)))
+}
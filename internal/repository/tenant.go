@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// TenantMetrics — метрика вместе с арендатором. В таком виде метрики
+// записываются в файлы (FileRepository, файл восстановления сервера).
+// Пустой Tenant означает tenant.Default, поэтому файлы, записанные
+// до появления арендаторов, читаются без изменений.
+type TenantMetrics struct {
+	Tenant string `json:"tenant,omitempty"`
+	models.Metrics
+}
+
+// TenantOf возвращает арендатора записи.
+func (m TenantMetrics) TenantOf() string {
+	if m.Tenant == "" {
+		return tenant.Default
+	}
+	return m.Tenant
+}
+
+// splitTenant делит записи на метрики арендатора id и все остальные.
+func splitTenant(records []TenantMetrics, id string) (own []models.Metrics, others []TenantMetrics) {
+	for _, r := range records {
+		if r.TenantOf() == id {
+			own = append(own, r.Metrics)
+			continue
+		}
+		others = append(others, r)
+	}
+	return own, others
+}
+
+// joinTenant собирает записи обратно после изменения метрик арендатора id.
+func joinTenant(id string, own []models.Metrics, others []TenantMetrics) []TenantMetrics {
+	res := make([]TenantMetrics, 0, len(own)+len(others))
+	res = append(res, others...)
+	for _, m := range own {
+		res = append(res, newTenantMetrics(id, m))
+	}
+	return res
+}
+
+func newTenantMetrics(id string, m models.Metrics) TenantMetrics {
+	if id == tenant.Default {
+		id = ""
+	}
+	return TenantMetrics{Tenant: id, Metrics: m}
+}
+
+func tenantsOf(records []TenantMetrics) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, r := range records {
+		if id := r.TenantOf(); !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Snapshot возвращает метрики всех арендаторов хранилища.
+func Snapshot(ctx context.Context, repo Repository) ([]TenantMetrics, error) {
+	ids, err := repo.Tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []TenantMetrics
+	for _, id := range ids {
+		metrics, err := repo.GetAll(tenant.WithTenant(ctx, id))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range metrics {
+			res = append(res, newTenantMetrics(id, m))
+		}
+	}
+	return res, nil
+}
+
+// restoreKey — ключ контекста, которым Restore помечает свои записи.
+type restoreKey struct{}
+
+// restoring сообщает, что запись выполняет Restore. В этом случае
+// MemRepository и FileRepository берут время обновления и признак
+// устаревания из самих записей, а не выставляют текущее время.
+func restoring(ctx context.Context) bool {
+	v, _ := ctx.Value(restoreKey{}).(bool)
+	return v
+}
+
+// Restore записывает метрики в хранилище, по одному UpdateBatch на арендатора.
+// Сохранённые UpdatedAt и Stale переносятся в MemRepository и FileRepository;
+// PostgresRepository отмечает восстановленные серии текущим временем.
+func Restore(ctx context.Context, repo Repository, records []TenantMetrics) error {
+	ctx = context.WithValue(ctx, restoreKey{}, true)
+	byTenant := make(map[string][]models.Metrics)
+	var order []string
+	for _, r := range records {
+		id := r.TenantOf()
+		if _, ok := byTenant[id]; !ok {
+			order = append(order, id)
+		}
+		byTenant[id] = append(byTenant[id], r.Metrics)
+	}
+
+	for _, id := range order {
+		if _, err := repo.UpdateBatch(tenant.WithTenant(ctx, id), byTenant[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
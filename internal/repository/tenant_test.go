@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+func testTenants(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	a := tenant.WithTenant(ctx, "team-a")
+	b := tenant.WithTenant(ctx, "team-b")
+
+	if err := repo.UpdateCounter(a, "PollCount", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateCounter(b, "PollCount", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateGauge(ctx, "Alloc", 5); err != nil {
+		t.Fatal(err)
+	}
+	_, err := repo.UpdateBatch(a, []models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: ptrInt(2)},
+		{ID: "cpu", MType: models.Gauge, Value: ptrFloat(1), Labels: map[string]string{"host": "a"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok, err := repo.GetCounter(a, "PollCount"); err != nil || !ok || v != 3 {
+		t.Fatalf("team-a PollCount: expected 3, got %v %v %v", v, ok, err)
+	}
+	if v, ok, err := repo.GetCounter(b, "PollCount"); err != nil || !ok || v != 10 {
+		t.Fatalf("team-b PollCount: expected 10, got %v %v %v", v, ok, err)
+	}
+	if _, ok, err := repo.GetCounter(ctx, "PollCount"); err != nil || ok {
+		t.Fatalf("default tenant must not see PollCount, got %v %v", ok, err)
+	}
+	if _, ok, err := repo.GetGauge(b, "Alloc"); err != nil || ok {
+		t.Fatalf("team-b must not see Alloc, got %v %v", ok, err)
+	}
+
+	page, err := repo.List(a, ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(page), []string{"counter:PollCount", "gauge:cpu"}; !equalIDs(got, want) {
+		t.Fatalf("team-a list: expected %v, got %v", want, got)
+	}
+
+	if ok, err := repo.Delete(b, models.Gauge, "cpu"); err != nil || ok {
+		t.Fatalf("team-b must not delete team-a metric, got %v %v", ok, err)
+	}
+	if ok, err := repo.Delete(b, models.Counter, "PollCount"); err != nil || !ok {
+		t.Fatalf("expected delete, got %v %v", ok, err)
+	}
+
+	tenants, err := repo.Tenants(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{tenant.Default, "team-a"}; !equalIDs(tenants, want) {
+		t.Fatalf("tenants: expected %v, got %v", want, tenants)
+	}
+
+	snapshot, err := Snapshot(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) != 3 {
+		t.Fatalf("expected 3 metrics in snapshot, got %+v", snapshot)
+	}
+
+	restored := NewMemRepository()
+	if err := Restore(ctx, restored, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := restored.GetCounter(a, "PollCount"); !ok || v != 3 {
+		t.Fatalf("restored team-a PollCount: expected 3, got %v %v", v, ok)
+	}
+	if v, ok, _ := restored.GetGauge(ctx, "Alloc"); !ok || v != 5 {
+		t.Fatalf("restored Alloc: expected 5, got %v %v", v, ok)
+	}
+}
+
+func TestMemRepository_Tenants(t *testing.T) {
+	testTenants(t, NewMemRepository())
+}
+
+func TestFileRepository_Tenants(t *testing.T) {
+	testTenants(t, NewFileRepository(tempFilePath(t)))
+}
+
+func TestPostgresTenants(t *testing.T) {
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	testTenants(t, NewPostgresRepository(conn))
+}
@@ -1,8 +1,14 @@
 // Package retry реализует политику повторных попыток с возрастающими интервалами (1s, 3s, 5s).
+// Если сервер сам назвал время ожидания (Retry-After), используется оно.
 package retry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,9 +18,49 @@ var retryDelays = []time.Duration{
 	5 * time.Second,
 }
 
+// MaxAfter ограничивает ожидание, запрошенное сервером через Retry-After.
+const MaxAfter = time.Minute
+
+// AfterError — ошибка, после которой сервер попросил повторить запрос не
+// раньше чем через Delay (ответы 429 и 503 с заголовком Retry-After).
+type AfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *AfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.Delay)
+}
+
+func (e *AfterError) Unwrap() error {
+	return e.Err
+}
+
+// ParseAfter разбирает значение заголовка Retry-After: число секунд или
+// HTTP-дату. Прошедшая дата даёт нулевую задержку.
+func ParseAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
 // DoRetry выполняет операцию op с повторными попытками.
-// Попытка повторяется, если isRetryable возвращает true для полученной ошибки.
-// Максимум 3 повтора с задержками 1, 3 и 5 секунд. Поддерживает отмену через ctx.
+// Попытка повторяется, если isRetryable возвращает true для полученной ошибки;
+// *AfterError повторяется всегда. Максимум 3 повтора с задержками 1, 3 и 5
+// секунд; для *AfterError — с задержкой из ошибки, но не дольше MaxAfter.
+// Поддерживает отмену через ctx.
 func DoRetry(ctx context.Context, isRetryable func(error) bool, op func() error) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -27,7 +73,12 @@ func DoRetry(ctx context.Context, isRetryable func(error) bool, op func() error)
 		}
 
 		err = op()
-		if err == nil || !isRetryable(err) {
+		if err == nil {
+			return nil
+		}
+		var after *AfterError
+		hasAfter := errors.As(err, &after)
+		if !hasAfter && !isRetryable(err) {
 			return err
 		}
 
@@ -35,7 +86,11 @@ func DoRetry(ctx context.Context, isRetryable func(error) bool, op func() error)
 			break
 		}
 
-		if err := wait(ctx, retryDelays[attempt]); err != nil {
+		delay := retryDelays[attempt]
+		if hasAfter {
+			delay = min(after.Delay, MaxAfter)
+		}
+		if err := wait(ctx, delay); err != nil {
 			return err
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 )
 
 func TestDoRetry_SuccessOnFirstAttempt(t *testing.T) {
@@ -132,3 +133,49 @@ func TestDoRetry_MaxRetriesExceeded(t *testing.T) {
 		t.Errorf("expected %d attempts, got %d", len(retryDelays)+1, attempts)
 	}
 }
+
+func TestDoRetry_HonoursAfterError(t *testing.T) {
+	attempts := 0
+	start := time.Now()
+
+	err := DoRetry(context.Background(), func(error) bool { return false }, func() error {
+		attempts++
+		if attempts == 1 {
+			return &AfterError{Delay: 10 * time.Millisecond, Err: errors.New("429 Too Many Requests")}
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed >= retryDelays[0] {
+		t.Fatalf("expected server-provided delay instead of %s, waited %s", retryDelays[0], elapsed)
+	}
+}
+
+func TestParseAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{"Wed, 01 Jan 2025 12:00:05 GMT", 5 * time.Second, true},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseAfter(tt.in, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: expected %v %v, got %v %v", tt.in, tt.want, tt.ok, got, ok)
+		}
+	}
+}
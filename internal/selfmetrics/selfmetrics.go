@@ -0,0 +1,355 @@
+// Package selfmetrics собирает показатели работы самого сервера: счётчики,
+// текущие значения и гистограммы длительностей. Все показатели живут в
+// зарезервированном пространстве имён Namespace и публикуются одной
+// expvar-переменной, поэтому не пересекаются с метриками агентов.
+package selfmetrics
+
+import (
+	"expvar"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Namespace — префикс имён показателей и имя expvar-переменной, в которой
+// они публикуются (см. Registry.Publish).
+const Namespace = "yaprmtrc"
+
+// DefBuckets — границы корзин гистограмм длительностей по умолчанию, в секундах.
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector — показатель, который умеет выгрузить свои значения.
+type collector interface {
+	collect(emit func(key string, v any))
+}
+
+// Registry хранит показатели по именам. Повторная регистрация имени
+// возвращает уже созданный показатель того же вида.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]collector
+}
+
+// Default — реестр, в котором регистрируют показатели функции пакета.
+var Default = NewRegistry()
+
+// NewRegistry создаёт пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]collector)}
+}
+
+// register возвращает показатель name, создавая его через create.
+// Если имя занято показателем другого вида, это ошибка программы.
+func register[T collector](r *Registry, name string, create func(string) T) T {
+	name = Namespace + "_" + name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.metrics[name]; ok {
+		m, ok := c.(T)
+		if !ok {
+			panic("selfmetrics: " + name + " is already registered with another kind")
+		}
+		return m
+	}
+	m := create(name)
+	r.metrics[name] = m
+	return m
+}
+
+// Snapshot возвращает текущие значения всех показателей. Ключ — имя
+// показателя с метками в фигурных скобках, как в формате Prometheus.
+func (r *Registry) Snapshot() map[string]any {
+	r.mu.RLock()
+	metrics := make([]collector, 0, len(r.metrics))
+	for _, c := range r.metrics {
+		metrics = append(metrics, c)
+	}
+	r.mu.RUnlock()
+
+	res := make(map[string]any)
+	for _, c := range metrics {
+		c.collect(func(key string, v any) { res[key] = v })
+	}
+	return res
+}
+
+// Publish публикует реестр expvar-переменной Namespace (GET /debug/vars).
+// Вызывается один раз за время жизни процесса.
+func (r *Registry) Publish() {
+	expvar.Publish(Namespace, expvar.Func(func() any { return r.Snapshot() }))
+}
+
+// key собирает имя показателя с метками.
+func key(name string, labels, values []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(values[i]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter — монотонно растущий счётчик.
+type Counter struct {
+	name string
+	v    atomic.Int64
+}
+
+// NewCounter регистрирует счётчик в реестре Default.
+func NewCounter(name string) *Counter { return Default.Counter(name) }
+
+// Counter регистрирует счётчик name.
+func (r *Registry) Counter(name string) *Counter {
+	return register(r, name, func(n string) *Counter { return &Counter{name: n} })
+}
+
+// Inc увеличивает счётчик на единицу.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add увеличивает счётчик на n.
+func (c *Counter) Add(n int64) { c.v.Add(n) }
+
+// Value возвращает текущее значение.
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+func (c *Counter) collect(emit func(string, any)) { emit(c.name, c.v.Load()) }
+
+// Gauge — значение, которое может расти и уменьшаться.
+type Gauge struct {
+	name string
+	v    atomic.Int64
+}
+
+// NewGauge регистрирует показатель в реестре Default.
+func NewGauge(name string) *Gauge { return Default.Gauge(name) }
+
+// Gauge регистрирует показатель name.
+func (r *Registry) Gauge(name string) *Gauge {
+	return register(r, name, func(n string) *Gauge { return &Gauge{name: n} })
+}
+
+// Add изменяет значение на n.
+func (g *Gauge) Add(n int64) { g.v.Add(n) }
+
+// Set устанавливает значение.
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+
+// Value возвращает текущее значение.
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+func (g *Gauge) collect(emit func(string, any)) { emit(g.name, g.v.Load()) }
+
+// GaugeFunc — значение, которое вычисляется при каждом чтении реестра.
+type GaugeFunc struct {
+	name string
+	mu   sync.RWMutex
+	f    func() float64
+}
+
+// NewGaugeFunc регистрирует вычисляемый показатель в реестре Default.
+func NewGaugeFunc(name string, f func() float64) *GaugeFunc { return Default.GaugeFunc(name, f) }
+
+// GaugeFunc регистрирует вычисляемый показатель name. Повторная
+// регистрация заменяет функцию, например при переподключении к базе.
+func (r *Registry) GaugeFunc(name string, f func() float64) *GaugeFunc {
+	g := register(r, name, func(n string) *GaugeFunc { return &GaugeFunc{name: n} })
+	g.mu.Lock()
+	g.f = f
+	g.mu.Unlock()
+	return g
+}
+
+func (g *GaugeFunc) collect(emit func(string, any)) {
+	g.mu.RLock()
+	f := g.f
+	g.mu.RUnlock()
+	if f != nil {
+		emit(g.name, f())
+	}
+}
+
+// Histogram распределяет наблюдения по корзинам с верхними границами buckets.
+type Histogram struct {
+	key     string
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Uint64 // math.Float64bits суммы
+}
+
+func newHistogram(key string, buckets []float64) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{key: key, buckets: b, counts: make([]atomic.Uint64, len(b))}
+}
+
+// NewHistogram регистрирует гистограмму в реестре Default.
+func NewHistogram(name string, buckets []float64) *Histogram {
+	return Default.Histogram(name, buckets)
+}
+
+// Histogram регистрирует гистограмму name; nil buckets — DefBuckets.
+func (r *Registry) Histogram(name string, buckets []float64) *Histogram {
+	return register(r, name, func(n string) *Histogram { return newHistogram(n, buckets) })
+}
+
+// Observe добавляет наблюдение v.
+func (h *Histogram) Observe(v float64) {
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// ObserveSince добавляет длительность от start до текущего момента в секундах.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramValue — выгрузка гистограммы. Buckets накопительные, как в
+// Prometheus: значение корзины — число наблюдений не больше её границы.
+type HistogramValue struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+// Value возвращает текущее распределение.
+func (h *Histogram) Value() HistogramValue {
+	v := HistogramValue{
+		Count:   h.count.Load(),
+		Sum:     math.Float64frombits(h.sum.Load()),
+		Buckets: make(map[string]uint64, len(h.buckets)+1),
+	}
+	var acc uint64
+	for i, b := range h.buckets {
+		acc += h.counts[i].Load()
+		v.Buckets[strconv.FormatFloat(b, 'g', -1, 64)] = acc
+	}
+	v.Buckets["+Inf"] = v.Count
+	return v
+}
+
+func (h *Histogram) collect(emit func(string, any)) { emit(h.key, h.Value()) }
+
+// CounterVec — семейство счётчиков с одинаковыми метками.
+type CounterVec struct {
+	name   string
+	labels []string
+	mu     sync.RWMutex
+	m      map[string]*Counter
+}
+
+// NewCounterVec регистрирует семейство счётчиков в реестре Default.
+func NewCounterVec(name string, labels ...string) *CounterVec {
+	return Default.CounterVec(name, labels...)
+}
+
+// CounterVec регистрирует семейство счётчиков name с метками labels.
+func (r *Registry) CounterVec(name string, labels ...string) *CounterVec {
+	return register(r, name, func(n string) *CounterVec {
+		return &CounterVec{name: n, labels: labels, m: make(map[string]*Counter)}
+	})
+}
+
+// With возвращает счётчик для значений меток в порядке их объявления.
+func (v *CounterVec) With(values ...string) *Counter {
+	k := key(v.name, v.labels, values)
+
+	v.mu.RLock()
+	c, ok := v.m[k]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.m[k]; !ok {
+		c = &Counter{name: k}
+		v.m[k] = c
+	}
+	return c
+}
+
+func (v *CounterVec) collect(emit func(string, any)) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, c := range v.m {
+		c.collect(emit)
+	}
+}
+
+// HistogramVec — семейство гистограмм с одинаковыми метками и корзинами.
+type HistogramVec struct {
+	name    string
+	labels  []string
+	buckets []float64
+	mu      sync.RWMutex
+	m       map[string]*Histogram
+}
+
+// NewHistogramVec регистрирует семейство гистограмм в реестре Default.
+func NewHistogramVec(name string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.HistogramVec(name, buckets, labels...)
+}
+
+// HistogramVec регистрирует семейство гистограмм name; nil buckets — DefBuckets.
+func (r *Registry) HistogramVec(name string, buckets []float64, labels ...string) *HistogramVec {
+	return register(r, name, func(n string) *HistogramVec {
+		return &HistogramVec{name: n, labels: labels, buckets: buckets, m: make(map[string]*Histogram)}
+	})
+}
+
+// With возвращает гистограмму для значений меток в порядке их объявления.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	k := key(v.name, v.labels, values)
+
+	v.mu.RLock()
+	h, ok := v.m[k]
+	v.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok = v.m[k]; !ok {
+		h = newHistogram(k, v.buckets)
+		v.m[k] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) collect(emit func(string, any)) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, h := range v.m {
+		h.collect(emit)
+	}
+}
@@ -0,0 +1,92 @@
+package selfmetrics
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_Snapshot(t *testing.T) {
+	r := NewRegistry()
+
+	r.Counter("saves_total").Add(2)
+	r.Counter("saves_total").Inc()
+	r.Gauge("in_flight").Set(4)
+	r.GaugeFunc("pool_conns", func() float64 { return 1 })
+	r.GaugeFunc("pool_conns", func() float64 { return 7 })
+
+	reqs := r.CounterVec("http_requests_total", "method", "status")
+	reqs.With("GET", "200").Inc()
+	reqs.With("GET", "200").Inc()
+	reqs.With("POST", "500").Inc()
+
+	h := r.HistogramVec("duration_seconds", []float64{1, 0.1}, "op")
+	h.With("get").Observe(0.05)
+	h.With("get").Observe(0.5)
+	h.With("get").Observe(3)
+
+	snap := r.Snapshot()
+	want := map[string]any{
+		"yaprmtrc_saves_total": int64(3),
+		"yaprmtrc_in_flight":   int64(4),
+		"yaprmtrc_pool_conns":  float64(7),
+		`yaprmtrc_http_requests_total{method="GET",status="200"}`:  int64(2),
+		`yaprmtrc_http_requests_total{method="POST",status="500"}`: int64(1),
+	}
+	for k, v := range want {
+		if snap[k] != v {
+			t.Errorf("%s = %v, want %v", k, snap[k], v)
+		}
+	}
+
+	hv, ok := snap[`yaprmtrc_duration_seconds{op="get"}`].(HistogramValue)
+	if !ok {
+		t.Fatalf("histogram missing: %v", snap)
+	}
+	if hv.Count != 3 || hv.Sum != 3.55 {
+		t.Errorf("count %d sum %v, want 3 and 3.55", hv.Count, hv.Sum)
+	}
+	wantBuckets := map[string]uint64{"0.1": 1, "1": 2, "+Inf": 3}
+	for b, n := range wantBuckets {
+		if hv.Buckets[b] != n {
+			t.Errorf("bucket %s = %d, want %d", b, hv.Buckets[b], n)
+		}
+	}
+
+	if _, err := json.Marshal(snap); err != nil {
+		t.Fatalf("snapshot must be JSON-encodable: %v", err)
+	}
+}
+
+func TestRegistry_KindConflictPanics(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("x")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	r.Gauge("x")
+}
+
+func TestHistogram_Concurrent(t *testing.T) {
+	h := NewRegistry().Histogram("h", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.Observe(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	v := h.Value()
+	if v.Count != 8000 || v.Sum != 4000 || v.Buckets["0.5"] != 8000 {
+		t.Fatalf("unexpected value %+v", v)
+	}
+}
@@ -0,0 +1,203 @@
+// Package staleness находит серии, которые перестали обновляться: по времени
+// последней записи и TTL, заданному для метрики или префикса имени, сборщик
+// помечает серии устаревшими или удаляет их из хранилища.
+package staleness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+// DefaultInterval — период обхода хранилища по умолчанию.
+const DefaultInterval = 30 * time.Second
+
+// Rule задаёт TTL для метрики с именем Pattern или, если Pattern
+// оканчивается на "*", для всех метрик с таким префиксом.
+// Нулевой TTL отключает устаревание подходящих метрик.
+type Rule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// match сообщает, подходит ли правило к имени, и длину совпадения.
+func (r Rule) match(name string) (int, bool) {
+	if prefix, ok := strings.CutSuffix(r.Pattern, "*"); ok {
+		return len(prefix), strings.HasPrefix(name, prefix)
+	}
+	return len(r.Pattern), r.Pattern == name
+}
+
+// ParseRules разбирает список правил вида "FreeMemory=10m,cpu*=5m".
+// Пустая строка — нет правил.
+func ParseRules(s string) ([]Rule, error) {
+	var (
+		rules []Rule
+		errs  []error
+	)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, ttl, ok := strings.Cut(item, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" || pattern == "*" {
+			errs = append(errs, fmt.Errorf("rule %q: must look like name=ttl or prefix*=ttl", item))
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(ttl))
+		if err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("rule %q: invalid ttl", item))
+			continue
+		}
+		rules = append(rules, Rule{Pattern: pattern, TTL: d})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("stale rules: %w", err)
+	}
+	return rules, nil
+}
+
+// Policy — правила устаревания серий.
+type Policy struct {
+	Default time.Duration // TTL метрик без подходящего правила; 0 — не устаревают
+	Rules   []Rule
+	Delete  bool // удалять устаревшие серии вместо пометки
+}
+
+// TTL возвращает TTL метрики name: правило с точным именем, затем правило
+// с самым длинным подходящим префиксом, затем Default.
+func (p Policy) TTL(name string) time.Duration {
+	ttl, best := p.Default, -1
+	for _, r := range p.Rules {
+		n, ok := r.match(name)
+		switch {
+		case !ok:
+			continue
+		case !strings.HasSuffix(r.Pattern, "*"):
+			return r.TTL
+		case n > best:
+			ttl, best = r.TTL, n
+		}
+	}
+	return ttl
+}
+
+// Enabled сообщает, может ли по политике устареть хоть одна серия.
+func (p Policy) Enabled() bool {
+	if p.Default > 0 {
+		return true
+	}
+	for _, r := range p.Rules {
+		if r.TTL > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Storage — хранилище серий; ему удовлетворяет repository.Repository.
+type Storage interface {
+	Tenants(ctx context.Context) ([]string, error)
+	GetAll(ctx context.Context) ([]models.Metrics, error)
+	Expire(ctx context.Context, mType, name string, before time.Time, remove bool) (bool, error)
+}
+
+// Logger — журнал сборщика; ему удовлетворяет *zap.SugaredLogger.
+type Logger interface {
+	Infof(template string, args ...interface{})
+	Errorf(template string, args ...interface{})
+}
+
+// Sweeper периодически обходит хранилище и обрабатывает устаревшие серии.
+type Sweeper struct {
+	storage Storage
+	policy  Policy
+	logger  Logger
+	now     func() time.Time
+}
+
+// NewSweeper создаёт сборщик устаревших серий.
+func NewSweeper(storage Storage, policy Policy, logger Logger) *Sweeper {
+	return &Sweeper{storage: storage, policy: policy, logger: logger, now: time.Now}
+}
+
+// Run обходит хранилище каждые interval до отмены ctx.
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil {
+				s.logger.Errorf("stale series sweep failed: %v", err)
+			}
+			if n > 0 {
+				s.logger.Infof("stale series sweep: %d series %s", n, s.action())
+			}
+		}
+	}
+}
+
+func (s *Sweeper) action() string {
+	if s.policy.Delete {
+		return "deleted"
+	}
+	return "marked stale"
+}
+
+// Sweep помечает устаревшими (или удаляет) серии всех арендаторов, которые
+// не обновлялись дольше своего TTL, и возвращает их число. Ошибка по
+// одной серии не прерывает обход остальных.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	ids, err := s.storage.Tenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	var (
+		n    int
+		errs []error
+	)
+	for _, id := range ids {
+		tctx := tenant.WithTenant(ctx, id)
+		metrics, err := s.storage.GetAll(tctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %q: %w", id, err))
+			continue
+		}
+
+		for _, m := range metrics {
+			ttl := s.policy.TTL(m.ID)
+			if ttl <= 0 || m.UpdatedAt == nil || (m.Stale && !s.policy.Delete) {
+				continue
+			}
+			before := now.Add(-ttl)
+			if !m.UpdatedAt.Before(before) {
+				continue
+			}
+
+			ok, err := s.storage.Expire(tctx, m.MType, m.ID, before, s.policy.Delete)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("tenant %q: %s %s: %w", id, m.MType, m.ID, err))
+				continue
+			}
+			if ok {
+				n++
+			}
+		}
+	}
+
+	return n, errors.Join(errs...)
+}
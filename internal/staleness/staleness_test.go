@@ -0,0 +1,147 @@
+package staleness
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+	"github.com/zheki1/yaprmtrc/internal/repository"
+	"github.com/zheki1/yaprmtrc/internal/tenant"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(" FreeMemory=10m, cpu*=5m ,Keep=0s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{"FreeMemory", 10 * time.Minute}, {"cpu*", 5 * time.Minute}, {"Keep", 0}}
+	if len(rules) != len(want) {
+		t.Fatalf("rules = %v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule #%d = %v, want %v", i, rules[i], want[i])
+		}
+	}
+
+	if rules, err := ParseRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("empty: %v, %v", rules, err)
+	}
+
+	_, err = ParseRules("a=1m,b,c=-1m,*=1m,d=x")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, item := range []string{`"b"`, `"c=-1m"`, `"*=1m"`, `"d=x"`} {
+		if !strings.Contains(err.Error(), item) {
+			t.Errorf("error %q does not mention %s", err, item)
+		}
+	}
+}
+
+func TestPolicy_TTL(t *testing.T) {
+	p := Policy{
+		Default: time.Hour,
+		Rules: []Rule{
+			{"cpu*", 5 * time.Minute},
+			{"cpu_total*", 10 * time.Minute},
+			{"cpu_total_idle", 0},
+		},
+	}
+
+	tests := []struct {
+		name string
+		want time.Duration
+	}{
+		{"FreeMemory", time.Hour},
+		{"cpu1", 5 * time.Minute},
+		{"cpu_total_user", 10 * time.Minute},
+		{"cpu_total_idle", 0},
+	}
+	for _, tt := range tests {
+		if got := p.TTL(tt.name); got != tt.want {
+			t.Errorf("TTL(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !p.Enabled() {
+		t.Error("policy with default TTL must be enabled")
+	}
+	if (Policy{Rules: []Rule{{"a", 0}}}).Enabled() {
+		t.Error("policy without positive TTL must be disabled")
+	}
+}
+
+func newSweeper(repo *repository.MemRepository, p Policy, after time.Duration) *Sweeper {
+	s := NewSweeper(repo, p, nopLogger{})
+	s.now = func() time.Time { return time.Now().Add(after) }
+	return s
+}
+
+func TestSweeper_MarksStale(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemRepository()
+	_ = repo.UpdateGauge(ctx, "FreeMemory", 1)
+	_ = repo.UpdateCounter(ctx, "PollCount", 1)
+
+	s := newSweeper(repo, Policy{Rules: []Rule{{"Free*", 10 * time.Minute}}}, 11*time.Minute)
+
+	n, err := s.Sweep(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Sweep = %d, %v; want 1", n, err)
+	}
+
+	m, ok, _ := repo.Get(ctx, models.Gauge, "FreeMemory")
+	if !ok || !m.Stale || m.UpdatedAt == nil {
+		t.Fatalf("FreeMemory = %+v, %v; want stale", m, ok)
+	}
+	if m, _, _ := repo.Get(ctx, models.Counter, "PollCount"); m.Stale {
+		t.Error("PollCount has no TTL and must not become stale")
+	}
+
+	if n, _ := s.Sweep(ctx); n != 0 {
+		t.Errorf("repeated Sweep = %d, want 0", n)
+	}
+
+	_ = repo.UpdateGauge(ctx, "FreeMemory", 2)
+	if m, _, _ := repo.Get(ctx, models.Gauge, "FreeMemory"); m.Stale {
+		t.Error("update must clear the stale flag")
+	}
+}
+
+func TestSweeper_Deletes(t *testing.T) {
+	ctx := context.Background()
+	other := tenant.WithTenant(ctx, "team-a")
+	repo := repository.NewMemRepository()
+	_ = repo.UpdateGauge(ctx, "FreeMemory", 1)
+	_ = repo.UpdateGauge(other, "FreeMemory", 1)
+	_ = repo.UpdateGauge(other, "Alloc", 1)
+
+	policy := Policy{Default: time.Hour, Rules: []Rule{{"Alloc", 0}}, Delete: true}
+
+	if n, _ := newSweeper(repo, policy, 30*time.Minute).Sweep(ctx); n != 0 {
+		t.Fatalf("Sweep before TTL = %d, want 0", n)
+	}
+
+	n, err := newSweeper(repo, policy, 2*time.Hour).Sweep(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("Sweep = %d, %v; want 2", n, err)
+	}
+
+	if _, ok, _ := repo.Get(ctx, models.Gauge, "FreeMemory"); ok {
+		t.Error("default tenant FreeMemory must be deleted")
+	}
+	if _, ok, _ := repo.Get(other, models.Gauge, "FreeMemory"); ok {
+		t.Error("team-a FreeMemory must be deleted")
+	}
+	if _, ok, _ := repo.Get(other, models.Gauge, "Alloc"); !ok {
+		t.Error("Alloc has TTL 0 and must be kept")
+	}
+}
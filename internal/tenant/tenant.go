@@ -0,0 +1,45 @@
+// Package tenant описывает арендаторов (tenant) — изолированные пространства
+// имён метрик. Арендатор передаётся через context.Context: все методы
+// repository.Repository читают его оттуда, поэтому одноимённые метрики
+// разных арендаторов не пересекаются.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Default — арендатор запросов, для которых арендатор не указан.
+const Default = "default"
+
+// MaxLength — максимальная длина идентификатора арендатора.
+const MaxLength = 64
+
+// ErrInvalid возвращается для недопустимого идентификатора арендатора.
+var ErrInvalid = fmt.Errorf("tenant must be 1-%d letters, digits, '_', '.' or '-' and start with a letter or digit", MaxLength)
+
+var idRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Validate проверяет идентификатор арендатора.
+func Validate(id string) error {
+	if len(id) == 0 || len(id) > MaxLength || !idRe.MatchString(id) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+type ctxKey struct{}
+
+// WithTenant возвращает контекст, привязанный к арендатору id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext возвращает арендатора из контекста или Default.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(ctxKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
@@ -0,0 +1,33 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if got := FromContext(ctx); got != Default {
+		t.Fatalf("expected %q, got %q", Default, got)
+	}
+	if got := FromContext(WithTenant(ctx, "team-a")); got != "team-a" {
+		t.Fatalf("expected team-a, got %q", got)
+	}
+	if got := FromContext(WithTenant(ctx, "")); got != Default {
+		t.Fatalf("empty tenant: expected %q, got %q", Default, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"a", "team-a", "Team_1.prod", strings.Repeat("x", MaxLength)} {
+		if err := Validate(id); err != nil {
+			t.Errorf("%q: unexpected error %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "-a", ".a", "a b", "a/b", "тенант", strings.Repeat("x", MaxLength+1)} {
+		if err := Validate(id); err == nil {
+			t.Errorf("%q: expected error", id)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Параметры пакетной выгрузки OTLPExporter.
+const (
+	queueSize     = 4096
+	batchSize     = 256
+	flushInterval = 2 * time.Second
+	exportTimeout = 5 * time.Second
+)
+
+// Options — куда выгружать участки. Пустые File и Endpoint — выгрузка выключена.
+type Options struct {
+	Service  string // service.name ресурса
+	File     string // файл, куда дописываются пакеты OTLP/JSON построчно
+	Endpoint string // адрес приёмника OTLP/HTTP, например http://localhost:4318
+}
+
+// Enabled сообщает, задан ли хотя бы один получатель.
+func (o Options) Enabled() bool { return o.File != "" || o.Endpoint != "" }
+
+// Validate проверяет адрес приёмника.
+func (o Options) Validate() error {
+	if o.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("-trace-endpoint must be an http or https URL")
+	}
+	return nil
+}
+
+// OTLPExporter копит участки и выгружает их пакетами в формате OTLP/JSON:
+// в файл (по пакету на строку, как файловый экспортёр OpenTelemetry Collector)
+// и/или POST-запросом на <Endpoint>/v1/traces. Если очередь переполнена,
+// новые участки отбрасываются.
+type OTLPExporter struct {
+	service  string
+	file     *os.File
+	endpoint string
+	client   *http.Client
+
+	// queue никогда не закрывается: Span.End мог загрузить экспортёр до
+	// SetExporter(nil) и вызвать Export уже после Close. Остановку run
+	// сообщает stop, а closed под closeMu отсекает такие поздние участки.
+	queue   chan SpanData
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	closeMu sync.RWMutex
+	closed  bool
+
+	mu      sync.Mutex
+	dropped int
+	lastErr error
+}
+
+// NewOTLPExporter открывает получателей opts и запускает фоновую выгрузку.
+func NewOTLPExporter(opts Options) (*OTLPExporter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	e := &OTLPExporter{
+		service: opts.Service,
+		client:  &http.Client{Timeout: exportTimeout},
+		queue:   make(chan SpanData, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if opts.File != "" {
+		f, err := os.OpenFile(opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("trace file: %w", err)
+		}
+		e.file = f
+	}
+	if opts.Endpoint != "" {
+		e.endpoint = opts.Endpoint + "/v1/traces"
+	}
+	go e.run()
+	return e, nil
+}
+
+// Setup включает выгрузку участков процесса, если в opts задан получатель.
+// Возвращает функцию, которая выгружает остаток и отключает экспортёр.
+func Setup(opts Options) (func() error, error) {
+	if !opts.Enabled() {
+		return func() error { return nil }, nil
+	}
+	e, err := NewOTLPExporter(opts)
+	if err != nil {
+		return nil, err
+	}
+	SetExporter(e)
+	return func() error {
+		SetExporter(nil)
+		return e.Close()
+	}, nil
+}
+
+// Export ставит участок в очередь выгрузки. После Close участки
+// отбрасываются.
+func (e *OTLPExporter) Export(span SpanData) {
+	e.closeMu.RLock()
+	defer e.closeMu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- span:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// Close выгружает накопленные участки и закрывает файл. Участки,
+// переданные в Export после Close, отбрасываются. Возвращает последнюю
+// ошибку выгрузки.
+func (e *OTLPExporter) Close() error {
+	e.once.Do(func() {
+		e.closeMu.Lock()
+		e.closed = true
+		e.closeMu.Unlock()
+
+		close(e.stop)
+		<-e.done
+		if e.file != nil {
+			if err := e.file.Close(); err != nil {
+				e.setErr(err)
+			}
+		}
+	})
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dropped > 0 {
+		return errors.Join(e.lastErr, fmt.Errorf("trace exporter: %d spans dropped", e.dropped))
+	}
+	return e.lastErr
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.write(batch); err != nil {
+			e.setErr(err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			// После closed новых участков в очереди не появится.
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+					if len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *OTLPExporter) setErr(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastErr = err
+}
+
+func (e *OTLPExporter) write(batch []SpanData) error {
+	data, err := json.Marshal(encodeOTLP(e.service, batch))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if e.file != nil {
+		if _, err := e.file.Write(append(data, '\n')); err != nil {
+			errs = append(errs, fmt.Errorf("trace file: %w", err))
+		}
+	}
+	if e.endpoint != "" {
+		errs = append(errs, e.post(data))
+	}
+	return errors.Join(errs...)
+}
+
+func (e *OTLPExporter) post(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("trace endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("trace endpoint: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Структуры OTLP/JSON (opentelemetry-proto, ExportTraceServiceRequest).
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              Kind           `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 1 — OK, 2 — ERROR
+		Message string `json:"message,omitempty"`
+	}
+)
+
+func encodeOTLP(service string, spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attrs),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.Parent.IsValid() {
+			o.ParentSpanID = s.Parent.String()
+		}
+		if s.Error != "" {
+			o.Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+		out = append(out, o)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]string{"service.name": service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/zheki1/yaprmtrc/internal/tracing"}, Spans: out}},
+	}}}
+}
+
+func attributes(m map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kv := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kv = append(kv, otlpKeyValue{Key: k, Value: otlpValue{StringValue: m[k]}})
+	}
+	return kv
+}
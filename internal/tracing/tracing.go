@@ -0,0 +1,365 @@
+// Package tracing связывает записи журнала агента и сервера, события аудита
+// и вызовы хранилища одного запроса: идентификатор запроса (X-Request-ID) и
+// контекст трассировки W3C (заголовок traceparent) передаются от агента через
+// цепочку мидлваров сервера до хранилища и аудита.
+//
+// Участки (Span) выгружаются, только если задан экспортёр (SetExporter);
+// без него идентификаторы всё равно создаются и попадают в журнал.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Заголовки, которыми передаются идентификаторы.
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+)
+
+// maxRequestIDLen ограничивает длину входящего X-Request-ID.
+const maxRequestIDLen = 128
+
+// TraceID — идентификатор трассы W3C.
+type TraceID [16]byte
+
+// SpanID — идентификатор участка W3C.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid сообщает, что идентификатор не нулевой.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid сообщает, что идентификатор не нулевой.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext — переносимая часть участка: то, что передаётся в traceparent.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid сообщает, что оба идентификатора заданы.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent возвращает значение заголовка traceparent версии 00.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ErrInvalidTraceparent — значение traceparent не соответствует W3C Trace Context.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent разбирает заголовок traceparent. Версии новее 00
+// принимаются, если их первые четыре поля совпадают по формату с 00.
+func ParseTraceparent(v string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeLowerHex(sc.TraceID[:], parts[1]) ||
+		!decodeLowerHex(sc.SpanID[:], parts[2]) ||
+		!decodeLowerHex(flags[:], parts[3]) ||
+		!sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// decodeLowerHex декодирует s в dst; s должна быть строчной hex-строкой
+// ровно нужной длины.
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// NewRequestID возвращает случайный идентификатор запроса.
+func NewRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ValidRequestID сообщает, можно ли принять входящий X-Request-ID: он не
+// пустой, не длиннее 128 символов и состоит из видимых символов ASCII.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		_, _ = rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		_, _ = rand.Read(s[:])
+	}
+	return s
+}
+
+type (
+	requestIDKey struct{}
+	spanKey      struct{}
+	remoteKey    struct{}
+)
+
+// WithRequestID возвращает контекст с идентификатором запроса.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom возвращает идентификатор запроса из контекста.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRemoteParent возвращает контекст, в котором следующий Start продолжит
+// трассу, пришедшую извне (из заголовка traceparent).
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFrom возвращает текущий участок из контекста или nil.
+func SpanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFrom возвращает контекст текущего участка или, если участка
+// нет, внешнего родителя.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if s := SpanFrom(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Fields возвращает поля журнала с идентификаторами запроса и трассы из
+// контекста: request_id, trace_id и span_id. Пустые значения пропускаются.
+func Fields(ctx context.Context) []any {
+	var fields []any
+	if id := RequestIDFrom(ctx); id != "" {
+		fields = append(fields, "request_id", id)
+	}
+	if sc := SpanContextFrom(ctx); sc.IsValid() {
+		fields = append(fields, "trace_id", sc.TraceID.String(), "span_id", sc.SpanID.String())
+	}
+	return fields
+}
+
+// Inject записывает в h идентификатор запроса и traceparent из контекста.
+func Inject(ctx context.Context, h http.Header) {
+	if id := RequestIDFrom(ctx); id != "" {
+		h.Set(RequestIDHeader, id)
+	}
+	if sc := SpanContextFrom(ctx); sc.IsValid() {
+		h.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
+
+// Extract возвращает контекст с идентификатором запроса из h (или новым,
+// если заголовка нет или он недопустим) и внешним родителем из traceparent.
+// Недопустимый traceparent отбрасывается, и начинается новая трасса.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	id := h.Get(RequestIDHeader)
+	if !ValidRequestID(id) {
+		id = NewRequestID()
+	}
+	ctx = WithRequestID(ctx, id)
+	if sc, err := ParseTraceparent(h.Get(TraceparentHeader)); err == nil {
+		ctx = WithRemoteParent(ctx, sc)
+	}
+	return ctx
+}
+
+// Kind — роль участка в обмене (поле kind OTLP).
+type Kind int
+
+// Роли участков.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Span — участок трассы: одна операция с временем начала и конца,
+// атрибутами и результатом. Методы безопасны для nil.
+type Span struct {
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   Kind
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs map[string]string
+	ended bool
+}
+
+// SpanOption настраивает участок в Start.
+type SpanOption func(*Span)
+
+// WithKind задаёт роль участка; по умолчанию KindInternal.
+func WithKind(k Kind) SpanOption {
+	return func(s *Span) { s.kind = k }
+}
+
+// Start начинает участок name. Родитель — текущий участок ctx или внешний
+// родитель из traceparent; без них начинается новая трасса. Возвращённый
+// контекст содержит новый участок.
+func Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	parent := SpanContextFrom(ctx)
+	s := &Span{
+		name:  name,
+		kind:  KindInternal,
+		start: time.Now(),
+		sc:    SpanContext{SpanID: newSpanID(), Sampled: true},
+	}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		s.sc.TraceID = newTraceID()
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if id := RequestIDFrom(ctx); id != "" {
+		s.SetAttr("request_id", id)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Context возвращает переносимый контекст участка.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName меняет имя участка, например когда шаблон маршрута известен
+// только после обработки запроса.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttr устанавливает атрибут участка.
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]string)
+	}
+	s.attrs[key] = value
+}
+
+// End завершает участок с результатом err и передаёт его экспортёру,
+// если участок выбран для записи. Повторные вызовы ничего не делают.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Context: s.sc,
+		Parent:  s.parent,
+		Name:    s.name,
+		Kind:    s.kind,
+		Start:   s.start,
+		End:     end,
+		Attrs:   s.attrs,
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		data.Error = err.Error()
+	}
+	if e := exporter.Load(); e != nil && s.sc.Sampled {
+		(*e).Export(data)
+	}
+}
+
+// SpanData — завершённый участок, передаваемый экспортёру.
+type SpanData struct {
+	Context SpanContext
+	Parent  SpanID
+	Name    string
+	Kind    Kind
+	Start   time.Time
+	End     time.Time
+	Attrs   map[string]string
+	Error   string // пустая — участок завершился успешно
+}
+
+// Exporter принимает завершённые участки. Export не должен блокироваться
+// надолго: он вызывается на пути обработки запроса.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+var exporter atomic.Pointer[Exporter]
+
+// SetExporter задаёт экспортёр участков процесса; nil отключает выгрузку.
+func SetExporter(e Exporter) {
+	if e == nil {
+		exporter.Store(nil)
+		return
+	}
+	exporter.Store(&e)
+}
@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(valid)
+	if err != nil {
+		t.Fatalf("ParseTraceparent: %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("parsed %+v", sc)
+	}
+	if sc.Traceparent() != valid {
+		t.Fatalf("round trip = %s", sc.Traceparent())
+	}
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(v); !errors.Is(err, ErrInvalidTraceparent) {
+			t.Errorf("ParseTraceparent(%q) err = %v", v, err)
+		}
+	}
+
+	if _, err := ParseTraceparent(valid[3:] + "-future"); err == nil {
+		t.Error("malformed version accepted")
+	}
+	if _, err := ParseTraceparent("01" + valid[2:] + "-future"); err != nil {
+		t.Errorf("future version rejected: %v", err)
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	in := http.Header{}
+	in.Set(RequestIDHeader, "req-1")
+	in.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := Extract(context.Background(), in)
+	if RequestIDFrom(ctx) != "req-1" {
+		t.Fatalf("request id = %q", RequestIDFrom(ctx))
+	}
+
+	ctx, span := Start(ctx, "child")
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get(RequestIDHeader) != "req-1" {
+		t.Errorf("injected request id = %q", out.Get(RequestIDHeader))
+	}
+	sc, err := ParseTraceparent(out.Get(TraceparentHeader))
+	if err != nil {
+		t.Fatalf("injected traceparent: %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID != span.Context().SpanID {
+		t.Errorf("injected %+v, span %+v", sc, span.Context())
+	}
+
+	bad := http.Header{}
+	bad.Set(RequestIDHeader, "has space")
+	bad.Set(TraceparentHeader, "garbage")
+	ctx = Extract(context.Background(), bad)
+	if id := RequestIDFrom(ctx); id == "has space" || !ValidRequestID(id) {
+		t.Errorf("invalid request id kept: %q", id)
+	}
+	if SpanContextFrom(ctx).IsValid() {
+		t.Error("invalid traceparent accepted")
+	}
+}
+
+func TestFields(t *testing.T) {
+	if f := Fields(context.Background()); len(f) != 0 {
+		t.Fatalf("empty context fields = %v", f)
+	}
+	ctx, span := Start(WithRequestID(context.Background(), "r"), "op")
+	f := Fields(ctx)
+	want := []any{"request_id", "r", "trace_id", span.Context().TraceID.String(), "span_id", span.Context().SpanID.String()}
+	if len(f) != len(want) {
+		t.Fatalf("fields = %v", f)
+	}
+	for i := range want {
+		if f[i] != want[i] {
+			t.Errorf("fields[%d] = %v, want %v", i, f[i], want[i])
+		}
+	}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestSpan_ParentAndExport(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec)
+	t.Cleanup(func() { SetExporter(nil) })
+
+	ctx, root := Start(context.Background(), "root", WithKind(KindServer))
+	_, child := Start(ctx, "child")
+	child.SetAttr("k", "v")
+	child.End(errors.New("boom"))
+	child.End(nil)
+	root.End(nil)
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(rec.spans))
+	}
+	c, r := rec.spans[0], rec.spans[1]
+	if c.Context.TraceID != r.Context.TraceID || c.Parent != r.Context.SpanID {
+		t.Errorf("child %+v is not linked to root %+v", c.Context, r.Context)
+	}
+	if c.Error != "boom" || c.Attrs["k"] != "v" || r.Kind != KindServer || r.Parent.IsValid() {
+		t.Errorf("unexpected spans: %+v %+v", c, r)
+	}
+
+	var nilSpan *Span
+	nilSpan.SetAttr("k", "v")
+	nilSpan.End(nil)
+}
+
+func TestOTLPExporter_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	e, err := NewOTLPExporter(Options{Service: "test", File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetExporter(e)
+	t.Cleanup(func() { SetExporter(nil) })
+
+	ctx, root := Start(context.Background(), "root")
+	_, child := Start(ctx, "child")
+	child.End(errors.New("failed"))
+	root.End(nil)
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []otlpSpan
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var req otlpRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			t.Fatalf("line %s: %v", sc.Text(), err)
+		}
+		rs := req.ResourceSpans[0]
+		if rs.Resource.Attributes[0].Value.StringValue != "test" {
+			t.Errorf("resource = %+v", rs.Resource)
+		}
+		spans = append(spans, rs.ScopeSpans[0].Spans...)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].ParentSpanID != spans[1].SpanID || spans[0].Status.Code != 2 {
+		t.Errorf("child span = %+v", spans[0])
+	}
+	if spans[1].Status.Code != 1 || spans[1].ParentSpanID != "" {
+		t.Errorf("root span = %+v", spans[1])
+	}
+}
+
+func TestOTLPExporter_ExportAfterClose(t *testing.T) {
+	e, err := NewOTLPExporter(Options{Service: "test", File: filepath.Join(t.TempDir(), "traces.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Фоновые горутины продолжают завершать участки во время и после Close.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				e.Export(SpanData{Name: "late"})
+			}
+		}()
+	}
+	if err := e.Close(); err != nil {
+		t.Logf("Close: %v", err)
+	}
+	wg.Wait()
+	e.Export(SpanData{Name: "after close"})
+}
+
+func TestOptions_Validate(t *testing.T) {
+	if err := (Options{Endpoint: "localhost:4318"}).Validate(); err == nil {
+		t.Error("endpoint without scheme accepted")
+	}
+	if err := (Options{Endpoint: "http://localhost:4318"}).Validate(); err != nil {
+		t.Errorf("valid endpoint rejected: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+// Package validation проверяет входящие метрики перед записью в хранилище:
+// допустимость имени, соответствие полей значения типу метрики и конечность
+// gauge-значений. Используется всеми путями приёма метрик на сервере.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+// MaxNameLength — максимальная длина имени метрики в байтах.
+const MaxNameLength = 255
+
+// MaxLabels — максимальное число меток у одной метрики.
+// Имена меток подчиняются тем же правилам, что и имена метрик,
+// значения ограничены MaxNameLength байтами.
+const MaxLabels = 32
+
+// Ошибки валидации. Проверяются через errors.Is.
+var (
+	ErrEmptyName       = errors.New("metric name is required")
+	ErrNameTooLong     = fmt.Errorf("metric name is longer than %d bytes", MaxNameLength)
+	ErrInvalidName     = errors.New("metric name may contain only letters, digits, '_', '.', ':' and '-'")
+	ErrUnknownType     = errors.New("unknown metric type")
+	ErrMissingValue    = errors.New("value is required for gauge")
+	ErrMissingDelta    = errors.New("delta is required for counter")
+	ErrUnexpectedValue = errors.New("value is not allowed for counter")
+	ErrUnexpectedDelta = errors.New("delta is not allowed for gauge")
+	ErrNonFinite       = errors.New("gauge value must be a finite number")
+	ErrEmptyBatch      = errors.New("batch is empty")
+	ErrInvalidLabels   = fmt.Errorf("labels must have at most %d entries with valid names and values up to %d bytes", MaxLabels, MaxNameLength)
+)
+
+// ItemError описывает ошибку валидации одного элемента пакета.
+type ItemError struct {
+	Index int    // позиция элемента в пакете
+	ID    string // имя метрики из запроса
+	Err   error  // причина отклонения
+}
+
+// Error реализует интерфейс error.
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d (%q): %v", e.Index, e.ID, e.Err)
+}
+
+// Unwrap возвращает исходную ошибку валидации.
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON сериализует ошибку вместе с текстом причины.
+func (e *ItemError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Index int    `json:"index"`
+		ID    string `json:"id"`
+		Error string `json:"error"`
+	}{e.Index, e.ID, e.Err.Error()})
+}
+
+// BatchError содержит ошибки всех отклонённых элементов пакета.
+type BatchError struct {
+	Items []*ItemError `json:"errors"`
+}
+
+// Error реализует интерфейс error.
+func (e *BatchError) Error() string {
+	msgs := make([]string, len(e.Items))
+	for i, it := range e.Items {
+		msgs[i] = it.Error()
+	}
+	return fmt.Sprintf("%d invalid metrics: %s", len(e.Items), strings.Join(msgs, "; "))
+}
+
+// Name проверяет имя метрики: непустое, не длиннее MaxNameLength
+// и состоит только из символов [A-Za-z0-9_.:-].
+func Name(name string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if len(name) > MaxNameLength {
+		return ErrNameTooLong
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return ErrInvalidName
+		}
+	}
+	return nil
+}
+
+func isNameChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '_', c == '.', c == ':', c == '-':
+		return true
+	}
+	return false
+}
+
+// Type проверяет, что тип метрики — gauge или counter.
+func Type(mType string) error {
+	if mType != models.Gauge && mType != models.Counter {
+		return ErrUnknownType
+	}
+	return nil
+}
+
+// Gauge проверяет значение gauge-метрики: NaN и ±Inf не допускаются.
+func Gauge(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return ErrNonFinite
+	}
+	return nil
+}
+
+// Labels проверяет метки серии.
+func Labels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return ErrInvalidLabels
+	}
+	for k, v := range labels {
+		if Name(k) != nil || len(v) > MaxNameLength {
+			return ErrInvalidLabels
+		}
+	}
+	return nil
+}
+
+// Metric проверяет метрику целиком: имя, тип, метки и соответствие полей
+// Value/Delta типу метрики.
+func Metric(m models.Metrics) error {
+	if err := Name(m.ID); err != nil {
+		return err
+	}
+	if err := Labels(m.Labels); err != nil {
+		return err
+	}
+
+	switch m.MType {
+	case models.Gauge:
+		if m.Value == nil {
+			return ErrMissingValue
+		}
+		if m.Delta != nil {
+			return ErrUnexpectedDelta
+		}
+		return Gauge(*m.Value)
+
+	case models.Counter:
+		if m.Delta == nil {
+			return ErrMissingDelta
+		}
+		if m.Value != nil {
+			return ErrUnexpectedValue
+		}
+		return nil
+	}
+
+	return ErrUnknownType
+}
+
+// Batch проверяет каждый элемент пакета. Возвращает *BatchError со списком
+// всех отклонённых элементов или nil, если пакет корректен.
+// Пустой пакет возвращает ErrEmptyBatch.
+func Batch(metrics []models.Metrics) error {
+	if len(metrics) == 0 {
+		return ErrEmptyBatch
+	}
+
+	var items []*ItemError
+	for i, m := range metrics {
+		if err := Metric(m); err != nil {
+			items = append(items, &ItemError{Index: i, ID: m.ID, Err: err})
+		}
+	}
+
+	if len(items) > 0 {
+		return &BatchError{Items: items}
+	}
+	return nil
+}
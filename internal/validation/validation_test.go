@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/zheki1/yaprmtrc/internal/models"
+)
+
+func ptrFloat(v float64) *float64 {
+	return &v
+}
+
+func ptrInt(v int64) *int64 {
+	return &v
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{"simple", "Alloc", nil},
+		{"with symbols", "cpu.util_1:core-0", nil},
+		{"empty", "", ErrEmptyName},
+		{"too long", strings.Repeat("a", MaxNameLength+1), ErrNameTooLong},
+		{"max length", strings.Repeat("a", MaxNameLength), nil},
+		{"space", "heap alloc", ErrInvalidName},
+		{"slash", "a/b", ErrInvalidName},
+		{"unicode", "метрика", ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Name(tt.in); !errors.Is(err, tt.want) {
+				t.Fatalf("Name(%q) = %v, want %v", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetric(t *testing.T) {
+	tests := []struct {
+		name string
+		in   models.Metrics
+		want error
+	}{
+		{"gauge", models.Metrics{ID: "a", MType: models.Gauge, Value: ptrFloat(1)}, nil},
+		{"counter", models.Metrics{ID: "a", MType: models.Counter, Delta: ptrInt(1)}, nil},
+		{"gauge without value", models.Metrics{ID: "a", MType: models.Gauge}, ErrMissingValue},
+		{"counter without delta", models.Metrics{ID: "a", MType: models.Counter}, ErrMissingDelta},
+		{"gauge with delta", models.Metrics{ID: "a", MType: models.Gauge, Value: ptrFloat(1), Delta: ptrInt(1)}, ErrUnexpectedDelta},
+		{"counter with value", models.Metrics{ID: "a", MType: models.Counter, Value: ptrFloat(1), Delta: ptrInt(1)}, ErrUnexpectedValue},
+		{"nan", models.Metrics{ID: "a", MType: models.Gauge, Value: ptrFloat(math.NaN())}, ErrNonFinite},
+		{"inf", models.Metrics{ID: "a", MType: models.Gauge, Value: ptrFloat(math.Inf(-1))}, ErrNonFinite},
+		{"unknown type", models.Metrics{ID: "a", MType: "histogram"}, ErrUnknownType},
+		{"bad name", models.Metrics{ID: "a b", MType: models.Gauge, Value: ptrFloat(1)}, ErrInvalidName},
+		{"labels", models.Metrics{ID: "a", MType: models.Gauge, Value: ptrFloat(1), Labels: map[string]string{"host": "web-1"}}, nil},
+		{"bad label name", models.Metrics{ID: "a", MType: models.Gauge, Value: ptrFloat(1), Labels: map[string]string{"h st": "x"}}, ErrInvalidLabels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Metric(tt.in); !errors.Is(err, tt.want) {
+				t.Fatalf("Metric() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	if err := Batch(nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Fatalf("expected ErrEmptyBatch, got %v", err)
+	}
+
+	ok := []models.Metrics{
+		{ID: "a", MType: models.Gauge, Value: ptrFloat(1)},
+		{ID: "b", MType: models.Counter, Delta: ptrInt(1)},
+	}
+	if err := Batch(ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bad := []models.Metrics{
+		{ID: "a", MType: models.Gauge, Value: ptrFloat(1)},
+		{ID: "x", MType: models.Gauge},
+		{ID: "c", MType: models.Counter, Delta: ptrInt(1)},
+		{ID: "", MType: models.Counter, Delta: ptrInt(1)},
+	}
+
+	var be *BatchError
+	if err := Batch(bad); !errors.As(err, &be) {
+		t.Fatalf("expected *BatchError, got %v", err)
+	}
+	if len(be.Items) != 2 {
+		t.Fatalf("expected 2 item errors, got %d", len(be.Items))
+	}
+	if be.Items[0].Index != 1 || !errors.Is(be.Items[0], ErrMissingValue) {
+		t.Fatalf("unexpected first item error: %v", be.Items[0])
+	}
+	if be.Items[1].Index != 3 || !errors.Is(be.Items[1], ErrEmptyName) {
+		t.Fatalf("unexpected second item error: %v", be.Items[1])
+	}
+
+	data, err := json.Marshal(be)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"errors":[{"index":1,"id":"x","error":"value is required for gauge"},{"index":3,"id":"","error":"metric name is required"}]}`
+	if string(data) != want {
+		t.Fatalf("unexpected json:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS metrics_labels_idx;
+DROP INDEX IF EXISTS metrics_id_type_c_idx;
+ALTER TABLE metrics DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,3 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+CREATE INDEX IF NOT EXISTS metrics_id_type_c_idx ON metrics (id COLLATE "C", type COLLATE "C");
+CREATE INDEX IF NOT EXISTS metrics_labels_idx ON metrics USING GIN (labels);
@@ -0,0 +1,19 @@
+-- Возврат к общей таблице без арендаторов; сохраняются только метрики
+-- арендатора default.
+ALTER TABLE metrics RENAME TO metrics_tenant;
+
+CREATE TABLE metrics (
+    id TEXT PRIMARY KEY,
+    type TEXT NOT NULL,
+    delta BIGINT,
+    value DOUBLE PRECISION,
+    labels JSONB NOT NULL DEFAULT '{}'::jsonb
+);
+
+INSERT INTO metrics (id, type, delta, value, labels)
+SELECT id, type, delta, value, labels FROM metrics_tenant WHERE tenant = 'default';
+
+DROP TABLE metrics_tenant;
+
+CREATE INDEX IF NOT EXISTS metrics_id_type_c_idx ON metrics (id COLLATE "C", type COLLATE "C");
+CREATE INDEX IF NOT EXISTS metrics_labels_idx ON metrics USING GIN (labels);
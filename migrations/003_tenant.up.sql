@@ -0,0 +1,27 @@
+-- Метрики разделяются по арендаторам: первичный ключ (tenant, id),
+-- таблица секционирована по хешу tenant. Существующие метрики переходят
+-- арендатору default.
+ALTER TABLE metrics RENAME TO metrics_single;
+
+CREATE TABLE metrics (
+    tenant TEXT NOT NULL DEFAULT 'default',
+    id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    delta BIGINT,
+    value DOUBLE PRECISION,
+    labels JSONB NOT NULL DEFAULT '{}'::jsonb,
+    PRIMARY KEY (tenant, id)
+) PARTITION BY HASH (tenant);
+
+CREATE TABLE metrics_p0 PARTITION OF metrics FOR VALUES WITH (MODULUS 4, REMAINDER 0);
+CREATE TABLE metrics_p1 PARTITION OF metrics FOR VALUES WITH (MODULUS 4, REMAINDER 1);
+CREATE TABLE metrics_p2 PARTITION OF metrics FOR VALUES WITH (MODULUS 4, REMAINDER 2);
+CREATE TABLE metrics_p3 PARTITION OF metrics FOR VALUES WITH (MODULUS 4, REMAINDER 3);
+
+INSERT INTO metrics (tenant, id, type, delta, value, labels)
+SELECT 'default', id, type, delta, value, labels FROM metrics_single;
+
+DROP TABLE metrics_single;
+
+CREATE INDEX IF NOT EXISTS metrics_id_type_c_idx ON metrics (tenant, id COLLATE "C", type COLLATE "C");
+CREATE INDEX IF NOT EXISTS metrics_labels_idx ON metrics USING GIN (labels);
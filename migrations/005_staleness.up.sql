@@ -0,0 +1,4 @@
+-- Время последнего обновления серии и признак устаревания
+-- (см. -stale-ttl). Существующие серии считаются обновлёнными сейчас.
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS stale BOOLEAN NOT NULL DEFAULT false;
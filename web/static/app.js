@@ -0,0 +1,292 @@
+// Веб-интерфейс сервера метрик: поиск, сортировка, группировка по префиксу,
+// автообновление и графики истории. Работает без внешних зависимостей.
+(function () {
+	"use strict";
+
+	var REFRESH_KEY = "dashboard.refresh";
+	var SPARK_WIDTH = 600;
+	var SPARK_HEIGHT = 120;
+
+	function $(id) {
+		return document.getElementById(id);
+	}
+
+	function el(tag, text, cls) {
+		var e = document.createElement(tag);
+		if (text !== undefined) e.textContent = text;
+		if (cls) e.className = cls;
+		return e;
+	}
+
+	// Запросы к API выполняются от имени того же арендатора, что и страница.
+	function apiHeaders() {
+		var h = { Accept: "application/json" };
+		var ds = document.body.dataset;
+		if (ds.tenantHeader && ds.tenant) h[ds.tenantHeader] = ds.tenant;
+		return h;
+	}
+
+	function getJSON(url) {
+		return fetch(url, { headers: apiHeaders() }).then(function (r) {
+			if (!r.ok) throw new Error(url + ": " + r.status);
+			return r.json();
+		});
+	}
+
+	// fetchAll обходит все страницы GET /api/v1/metrics.
+	function fetchAll(cursor, acc) {
+		var url = "/api/v1/metrics?limit=1000" + (cursor ? "&cursor=" + encodeURIComponent(cursor) : "");
+		return getJSON(url).then(function (page) {
+			acc = acc.concat(page.metrics || []);
+			return page.next_cursor ? fetchAll(page.next_cursor, acc) : acc;
+		});
+	}
+
+	function metricValue(m) {
+		return m.type === "counter" ? m.delta : m.value;
+	}
+
+	// prefix возвращает префикс имени для группировки: часть до первого
+	// разделителя (. _ : -), а для имён в CamelCase — первое слово.
+	function prefix(name) {
+		var sep = name.search(/[._:-]/);
+		if (sep > 0) return name.slice(0, sep);
+		var word = name.match(/^[A-Z]?[a-z]+/);
+		return word ? word[0] : name;
+	}
+
+	function stamp() {
+		var u = $("updated");
+		if (u) u.textContent = "updated " + new Date().toLocaleTimeString();
+	}
+
+	// --- список метрик ---
+
+	var state = {
+		rows: [],
+		sort: "name",
+		dir: 1,
+		query: "",
+		group: false,
+		collapsed: {}
+	};
+
+	function readRows() {
+		var rows = [];
+		var trs = document.querySelectorAll("#metrics tbody tr");
+		for (var i = 0; i < trs.length; i++) {
+			var td = trs[i].cells;
+			rows.push({
+				name: td[0].textContent,
+				type: td[1].textContent,
+				value: Number(td[2].textContent),
+				updated: trs[i].dataset.updated || "",
+				stale: trs[i].classList.contains("stale")
+			});
+		}
+		return rows;
+	}
+
+	function compare(a, b) {
+		var x = a[state.sort];
+		var y = b[state.sort];
+		var c = 0;
+		if (x < y) c = -1;
+		else if (x > y) c = 1;
+		if (c === 0 && state.sort !== "name") c = a.name < b.name ? -1 : a.name > b.name ? 1 : 0;
+		return c * state.dir;
+	}
+
+	function rowElement(m) {
+		var tr = el("tr");
+		var name = el("td");
+		var a = el("a", m.name);
+		a.href = "/metric/" + encodeURIComponent(m.type) + "/" + encodeURIComponent(m.name);
+		name.appendChild(a);
+		tr.appendChild(name);
+		tr.appendChild(el("td", m.type));
+		tr.appendChild(el("td", String(m.value), "num"));
+		if (m.updated) {
+			tr.dataset.updated = m.updated;
+			tr.title = "updated " + m.updated;
+		}
+		if (m.stale) tr.className = "stale";
+		return tr;
+	}
+
+	function groupElement(key, count) {
+		var tr = el("tr", undefined, "group" + (state.collapsed[key] ? " collapsed" : ""));
+		var th = el("th", key + " (" + count + ")");
+		th.colSpan = 3;
+		tr.appendChild(th);
+		tr.addEventListener("click", function () {
+			state.collapsed[key] = !state.collapsed[key];
+			render();
+		});
+		return tr;
+	}
+
+	function render() {
+		var q = state.query.toLowerCase();
+		var rows = state.rows.filter(function (m) {
+			return !q || m.name.toLowerCase().indexOf(q) >= 0 || m.type.indexOf(q) >= 0;
+		});
+		rows.sort(compare);
+
+		var tbody = document.querySelector("#metrics tbody");
+		var frag = document.createDocumentFragment();
+
+		if (state.group) {
+			var groups = {};
+			var order = [];
+			rows.forEach(function (m) {
+				var k = prefix(m.name);
+				if (!groups[k]) {
+					groups[k] = [];
+					order.push(k);
+				}
+				groups[k].push(m);
+			});
+			order.sort();
+			order.forEach(function (k) {
+				frag.appendChild(groupElement(k, groups[k].length));
+				if (state.collapsed[k]) return;
+				groups[k].forEach(function (m) {
+					frag.appendChild(rowElement(m));
+				});
+			});
+		} else {
+			rows.forEach(function (m) {
+				frag.appendChild(rowElement(m));
+			});
+		}
+
+		tbody.replaceChildren(frag);
+		$("count").textContent = rows.length === state.rows.length ? rows.length : rows.length + " / " + state.rows.length;
+		$("empty").hidden = rows.length > 0;
+
+		var buttons = document.querySelectorAll("th button[data-sort]");
+		for (var i = 0; i < buttons.length; i++) {
+			var b = buttons[i];
+			if (b.dataset.sort === state.sort) b.dataset.dir = String(state.dir);
+			else delete b.dataset.dir;
+		}
+	}
+
+	function refreshList() {
+		return fetchAll("", []).then(function (metrics) {
+			state.rows = metrics.map(function (m) {
+				return { name: m.id, type: m.type, value: metricValue(m), updated: m.updated_at || "", stale: !!m.stale };
+			});
+			render();
+			stamp();
+		});
+	}
+
+	function initList() {
+		state.rows = readRows();
+
+		$("search").addEventListener("input", function (e) {
+			state.query = e.target.value;
+			render();
+		});
+		$("group").addEventListener("change", function (e) {
+			state.group = e.target.checked;
+			render();
+		});
+		var buttons = document.querySelectorAll("th button[data-sort]");
+		for (var i = 0; i < buttons.length; i++) {
+			buttons[i].addEventListener("click", function (e) {
+				var key = e.currentTarget.dataset.sort;
+				state.dir = state.sort === key ? -state.dir : 1;
+				state.sort = key;
+				render();
+			});
+		}
+
+		render();
+		return refreshList;
+	}
+
+	// --- страница метрики ---
+
+	// sparkline вычисляет точки ломаной так же, как sparklinePoints на сервере.
+	function sparkline(samples) {
+		if (samples.length === 0) return "";
+		var min = Infinity;
+		var max = -Infinity;
+		samples.forEach(function (s) {
+			min = Math.min(min, s.v);
+			max = Math.max(max, s.v);
+		});
+		var span = max - min;
+		var step = samples.length > 1 ? SPARK_WIDTH / (samples.length - 1) : 0;
+		return samples.map(function (s, i) {
+			var y = span === 0 ? SPARK_HEIGHT / 2 : SPARK_HEIGHT - ((s.v - min) / span) * SPARK_HEIGHT;
+			return (i * step).toFixed(1) + "," + y.toFixed(1);
+		}).join(" ");
+	}
+
+	function initMetric() {
+		var h = $("metric");
+		var path = encodeURIComponent(h.dataset.type) + "/" + encodeURIComponent(h.dataset.name);
+
+		return function () {
+			var value = getJSON("/api/v1/metrics/" + path).then(function (m) {
+				$("value").textContent = String(metricValue(m));
+				$("updated-at").textContent = m.updated_at || "";
+				$("updated-at").classList.toggle("stale", !!m.stale);
+			});
+			var hist = $("history").hidden ? null : getJSON("/api/v1/metrics/" + path + "/history").then(function (res) {
+				var samples = res.samples || [];
+				document.querySelector("#sparkline polyline").setAttribute("points", sparkline(samples));
+				var vals = samples.map(function (s) { return s.v; });
+				$("min").textContent = vals.length ? String(Math.min.apply(null, vals)) : "";
+				$("max").textContent = vals.length ? String(Math.max.apply(null, vals)) : "";
+				$("samples").textContent = String(samples.length);
+			});
+			return Promise.all([value, hist]).then(stamp);
+		};
+	}
+
+	// --- автообновление ---
+
+	function initRefresh(refresh) {
+		var sel = $("refresh");
+		var timer = null;
+
+		function schedule() {
+			if (timer) clearInterval(timer);
+			timer = null;
+			var sec = Number(sel.value);
+			if (sec > 0) {
+				timer = setInterval(function () {
+					refresh().catch(function (err) {
+						$("updated").textContent = "refresh failed: " + err.message;
+					});
+				}, sec * 1000);
+			}
+		}
+
+		try {
+			sel.value = localStorage.getItem(REFRESH_KEY) || "0";
+		} catch (e) {
+			sel.value = "0";
+		}
+		sel.addEventListener("change", function () {
+			try {
+				localStorage.setItem(REFRESH_KEY, sel.value);
+			} catch (e) {
+				// localStorage недоступен — настройка действует до перезагрузки.
+			}
+			schedule();
+		});
+		schedule();
+	}
+
+	document.addEventListener("DOMContentLoaded", function () {
+		var page = document.body.dataset.page;
+		var refresh = page === "metric" ? initMetric() : initList();
+		initRefresh(refresh);
+	});
+})();
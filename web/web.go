@@ -0,0 +1,17 @@
+// Package web содержит шаблоны и статические файлы веб-интерфейса сервера.
+// Всё встраивается в бинарник, внешние ресурсы (CDN) не используются.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed templates static
+var files embed.FS
+
+// Templates — HTML-шаблоны страниц (*.html).
+var Templates, _ = fs.Sub(files, "templates")
+
+// Static — стили и скрипты, отдаваемые по адресу /static/{file}.
+var Static, _ = fs.Sub(files, "static")